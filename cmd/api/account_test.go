@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/account"
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/comment"
+	"github.com/cheildo/deeli-api/internal/feed"
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"github.com/cheildo/deeli-api/internal/share"
+	"github.com/cheildo/deeli-api/internal/social"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPurgeAccount seeds a user with data in every table and checks what
+// Purge deletes, what it detaches and what it hands over to others.
+func TestPurgeAccount(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	create := func(value interface{}) {
+		t.Helper()
+		require.NoError(t, database.DB.Create(value).Error)
+	}
+	count := func(table, query string, args ...interface{}) int64 {
+		t.Helper()
+		var n int64
+		require.NoError(t, database.DB.Table(table).Where(query, args...).Count(&n).Error)
+		return n
+	}
+
+	gone := &user.User{Email: "Gone@Example.com", Password: "hash"}
+	other := &user.User{Email: "other@example.com", Password: "hash"}
+	member := &user.User{Email: "member@example.com", Password: "hash"}
+	follower := &user.User{Email: "follower@example.com", Password: "hash"}
+	for _, u := range []*user.User{gone, other, member, follower} {
+		create(u)
+	}
+
+	// A workspace only the user is in, and one they own together with a
+	// member who joined later.
+	sole := &workspace.Workspace{Name: "Sole"}
+	shared := &workspace.Workspace{Name: "Shared"}
+	create(sole)
+	create(shared)
+	create(&workspace.Member{WorkspaceID: sole.ID, UserID: gone.ID, Role: workspace.RoleOwner})
+	create(&workspace.Member{WorkspaceID: shared.ID, UserID: gone.ID, Role: workspace.RoleOwner})
+	create(&workspace.Member{WorkspaceID: shared.ID, UserID: member.ID, Role: workspace.RoleEditor, CreatedAt: time.Now().Add(time.Hour)})
+	create(&workspace.Invitation{WorkspaceID: shared.ID, Email: "guest@example.com", Role: workspace.RoleViewer, InvitedBy: gone.ID, TokenHash: "invite-by-gone", ExpiresAt: time.Now().Add(time.Hour)})
+	create(&workspace.Invitation{WorkspaceID: shared.ID, Email: "gone@example.com", Role: workspace.RoleViewer, InvitedBy: member.ID, TokenHash: "invite-for-gone", ExpiresAt: time.Now().Add(time.Hour)})
+
+	personal := &article.Article{URL: "https://example.com/personal", UserID: gone.ID}
+	inSole := &article.Article{URL: "https://example.com/sole", UserID: gone.ID, WorkspaceID: &sole.ID}
+	inShared := &article.Article{URL: "https://example.com/shared", UserID: gone.ID, WorkspaceID: &shared.ID}
+	others := &article.Article{URL: "https://example.com/others", UserID: other.ID}
+	for _, a := range []*article.Article{personal, inSole, inShared, others} {
+		create(a)
+	}
+
+	// Ratings, feedback and events by and about the user.
+	create(&article.Rating{ArticleID: others.ID, UserID: gone.ID, Score: 5})
+	create(&article.Rating{ArticleID: personal.ID, UserID: other.ID, Score: 4})
+	create(&article.Rating{ArticleID: inShared.ID, UserID: member.ID, Score: 4})
+	create(&recommendation.Feedback{UserID: gone.ID, ArticleID: others.ID, Action: recommendation.ActionDismiss})
+	create(&recommendation.Feedback{UserID: other.ID, ArticleID: personal.ID, Action: recommendation.ActionDismiss})
+	create(&recommendation.Event{UserID: gone.ID, ArticleID: others.ID, Type: recommendation.EventClick, Strategy: "peer"})
+
+	// Another user's cached list includes the user's article, and a follower
+	// has a list that drew on them.
+	create(&recommendation.CachedRecommendation{UserID: other.ID, Strategy: "peer", Position: 0, ArticleID: personal.ID})
+	create(&recommendation.CachedRecommendation{UserID: other.ID, Strategy: "peer", Position: 1, ArticleID: others.ID})
+	create(&recommendation.CacheState{UserID: other.ID, Strategy: "peer", GeneratedAt: time.Now()})
+	create(&recommendation.CacheState{UserID: follower.ID, Strategy: "peer", GeneratedAt: time.Now()})
+	create(&recommendation.CachedRecommendation{UserID: gone.ID, Strategy: "peer", Position: 0, ArticleID: others.ID})
+	create(&recommendation.CacheState{UserID: gone.ID, Strategy: "peer", GeneratedAt: time.Now()})
+
+	// Comments: on the user's own article, and by the user on another
+	// user's article with a reply to it.
+	create(&comment.Comment{ArticleID: personal.ID, UserID: other.ID, Body: "on a personal article"})
+	byGone := &comment.Comment{ArticleID: others.ID, UserID: gone.ID, Body: "by the user"}
+	create(byGone)
+	reply := &comment.Comment{ArticleID: others.ID, UserID: other.ID, ParentID: &byGone.ID, RootID: &byGone.ID, Body: "a reply"}
+	create(reply)
+	create(&comment.Notification{UserID: other.ID, Kind: "reply", ActorID: gone.ID, ArticleID: others.ID, CommentID: byGone.ID})
+	create(&comment.Notification{UserID: gone.ID, Kind: "reply", ActorID: other.ID, ArticleID: others.ID, CommentID: reply.ID})
+
+	// Sharing and feeds.
+	create(&share.Link{UserID: gone.ID, ArticleID: others.ID, Prefix: "s1", TokenHash: "link-by-gone"})
+	create(&share.Link{UserID: other.ID, ArticleID: personal.ID, Prefix: "s2", TokenHash: "link-to-personal"})
+	personalFeed := &feed.Feed{UserID: gone.ID, URL: "https://example.com/rss"}
+	soleFeed := &feed.Feed{UserID: member.ID, URL: "https://example.com/sole.rss", WorkspaceID: &sole.ID}
+	sharedFeed := &feed.Feed{UserID: member.ID, URL: "https://example.com/shared.rss", WorkspaceID: &shared.ID}
+	for _, f := range []*feed.Feed{personalFeed, soleFeed, sharedFeed} {
+		create(f)
+	}
+	create(&feed.Entry{FeedID: personalFeed.ID, GUID: "1", URL: "https://example.com/1"})
+	create(&feed.Entry{FeedID: sharedFeed.ID, GUID: "2", URL: "https://example.com/2"})
+	create(&feed.Token{UserID: gone.ID, Prefix: "f1", TokenHash: "feed-token-gone", Source: feed.SourceSaves})
+	create(&feed.Token{UserID: member.ID, Prefix: "f2", TokenHash: "feed-token-shared", Source: feed.SourceWorkspace, WorkspaceID: &shared.ID})
+
+	// Follows and sign-in data.
+	create(&social.Follow{FollowerID: follower.ID, FolloweeID: gone.ID})
+	create(&social.Follow{FollowerID: gone.ID, FolloweeID: other.ID})
+	session := &auth.Session{UserID: gone.ID, LastSeenAt: time.Now()}
+	create(session)
+	create(&auth.RefreshToken{SessionID: session.ID, TokenHash: "refresh-gone", ExpiresAt: time.Now().Add(time.Hour)})
+	create(&auth.PersonalAccessToken{UserID: gone.ID, Name: "script", Prefix: "dli_gone", TokenHash: "pat-gone", Scopes: auth.ScopeArticlesRead})
+	create(&user.RecoveryCode{UserID: gone.ID, CodeHash: "code"})
+	create(&user.Identity{UserID: gone.ID, Provider: "google", Subject: "gone"})
+	create(&user.LoginFailure{UserID: &gone.ID, Email: gone.Email, Reason: "password"})
+	create(&auth.LoginAttempt{Key: "account:gone@example.com", Failures: 1})
+
+	require.NoError(t, account.NewRepository().Purge(gone.ID))
+
+	// Deleted: the user and everything only they had.
+	assert.Zero(t, count("users", "id = ?", gone.ID))
+	for table, query := range map[string]string{
+		"ratings":                "user_id = ?",
+		"feedbacks":              "user_id = ?",
+		"cached_recommendations": "user_id = ?",
+		"cache_states":           "user_id = ?",
+		"share_links":            "user_id = ?",
+		"feeds":                  "user_id = ?",
+		"feed_tokens":            "user_id = ?",
+		"notifications":          "user_id = ? OR actor_id = ?",
+		"sessions":               "user_id = ?",
+		"personal_access_tokens": "user_id = ?",
+		"recovery_codes":         "user_id = ?",
+		"identities":             "user_id = ?",
+		"login_failures":         "user_id = ?",
+		"workspace_members":      "user_id = ?",
+		"follows":                "follower_id = ? OR followee_id = ?",
+	} {
+		args := []interface{}{gone.ID}
+		if table == "notifications" || table == "follows" {
+			args = append(args, gone.ID)
+		}
+		assert.Zero(t, count(table, query, args...), table)
+	}
+	assert.Zero(t, count("refresh_tokens", "session_id = ?", session.ID))
+	assert.Zero(t, count("login_attempts", "key = ?", "account:gone@example.com"))
+	assert.Zero(t, count("workspace_invitations", "workspace_id = ?", shared.ID), "invitations by or for the user")
+
+	// Deleted: the personal library and the sole workspace, with everything
+	// other users attached to them.
+	assert.Zero(t, count("articles", "id IN ?", []uint{personal.ID, inSole.ID}))
+	assert.Zero(t, count("ratings", "article_id = ?", personal.ID))
+	assert.Zero(t, count("feedbacks", "article_id = ?", personal.ID))
+	assert.Zero(t, count("comments", "article_id = ?", personal.ID))
+	assert.Zero(t, count("share_links", "article_id = ?", personal.ID))
+	assert.Zero(t, count("cached_recommendations", "article_id = ?", personal.ID))
+	assert.Zero(t, count("workspaces", "id = ?", sole.ID))
+	assert.Zero(t, count("feeds", "id = ?", soleFeed.ID))
+	assert.Zero(t, count("feed_entries", "feed_id = ?", personalFeed.ID))
+
+	// Detached: events, the article saved to the shared workspace and the
+	// comment others replied to.
+	assert.EqualValues(t, 1, count("events", "user_id = 0 AND article_id = ?", others.ID))
+	assert.EqualValues(t, 1, count("articles", "id = ? AND user_id = 0", inShared.ID))
+	assert.EqualValues(t, 1, count("ratings", "article_id = ?", inShared.ID))
+	var blanked comment.Comment
+	require.NoError(t, database.DB.Unscoped().First(&blanked, byGone.ID).Error)
+	assert.Zero(t, blanked.UserID)
+	assert.Empty(t, blanked.Body)
+	assert.NotNil(t, blanked.RemovedAt)
+	assert.EqualValues(t, 1, count("comments", "id = ? AND body = ?", reply.ID, "a reply"))
+
+	// Transferred: the shared workspace now belongs to the member, and
+	// keeps its feeds and feed tokens.
+	assert.EqualValues(t, 1, count("workspace_members", "workspace_id = ? AND user_id = ? AND role = ?", shared.ID, member.ID, workspace.RoleOwner))
+	assert.EqualValues(t, 1, count("feeds", "id = ?", sharedFeed.ID))
+	assert.EqualValues(t, 1, count("feed_entries", "feed_id = ?", sharedFeed.ID))
+	assert.EqualValues(t, 1, count("feed_tokens", "workspace_id = ?", shared.ID))
+
+	// Untouched, but stale: others' lists that drew on the user.
+	assert.EqualValues(t, 1, count("cached_recommendations", "user_id = ? AND article_id = ?", other.ID, others.ID))
+	assert.EqualValues(t, 1, count("cache_states", "user_id = ? AND stale", other.ID))
+	assert.EqualValues(t, 1, count("cache_states", "user_id = ? AND stale", follower.ID))
+	assert.EqualValues(t, 1, count("ratings", "user_id = ?", member.ID))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/admin"
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAdmin creates a user with the admin role and returns their access
+// token.
+func testAdmin(t *testing.T) (uint, string) {
+	t.Helper()
+	u, token := testUser(t, "admin@example.com")
+	require.NoError(t, database.DB.Model(u).Update("role", auth.RoleAdmin).Error)
+	return u.ID, token
+}
+
+func TestAdminRequiresAdminRole(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	_, userToken := testUser(t, "user@example.com")
+	for _, path := range []string{"/admin/users", "/admin/worker"} {
+		assert.Equal(t, http.StatusForbidden, call(t, userToken, "GET", path, nil).Code, path)
+	}
+
+	// An admin's personal access token doesn't reach the admin API either.
+	adminID, _ := testAdmin(t)
+	plain, _, err := auth.NewPersonalTokenService(auth.NewPersonalTokenRepository()).Create(adminID, "script", []string{auth.ScopeArticlesRead}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, call(t, plain, "GET", "/admin/users", nil).Code)
+}
+
+func TestAdminListUsers(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	_, adminToken := testAdmin(t)
+	testUser(t, "alice@example.com")
+	testUser(t, "bob@example.com")
+
+	w := call(t, adminToken, "GET", "/admin/users?q=ALICE", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Users []admin.UserResponse `json:"users"`
+		Total int64                `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.EqualValues(t, 1, response.Total)
+	require.Len(t, response.Users, 1)
+	assert.Equal(t, "alice@example.com", response.Users[0].Email)
+
+	w = call(t, adminToken, "GET", "/admin/users?limit=2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.EqualValues(t, 3, response.Total)
+	assert.Len(t, response.Users, 2)
+}
+
+func TestAdminDisableAndEnableUser(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	adminID, adminToken := testAdmin(t)
+	target, targetToken := testUser(t, "target@example.com")
+	plain, _, err := auth.NewPersonalTokenService(auth.NewPersonalTokenRepository()).Create(target.ID, "script", []string{auth.ScopeArticlesRead}, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, call(t, plain, "GET", "/articles", nil).Code)
+
+	w := call(t, adminToken, "POST", fmt.Sprintf("/admin/users/%d/disable", target.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response admin.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotNil(t, response.DisabledAt)
+
+	// The user's sessions are ended and their personal access tokens refused.
+	assert.Equal(t, http.StatusUnauthorized, call(t, targetToken, "GET", "/me", nil).Code)
+	assert.Equal(t, http.StatusForbidden, call(t, plain, "GET", "/articles", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, adminToken, "POST", fmt.Sprintf("/admin/users/%d/disable", adminID), nil).Code)
+
+	w = call(t, adminToken, "POST", fmt.Sprintf("/admin/users/%d/enable", target.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, call(t, plain, "GET", "/articles", nil).Code)
+
+	assert.Equal(t, http.StatusNotFound, call(t, adminToken, "POST", "/admin/users/999999/disable", nil).Code)
+}
+
+func TestAdminSetRole(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	adminID, adminToken := testAdmin(t)
+	target, targetToken := testUser(t, "target@example.com")
+	role := fmt.Sprintf("/admin/users/%d/role", target.ID)
+
+	assert.Equal(t, http.StatusBadRequest, call(t, adminToken, "PUT", role, fields{"role": "superuser"}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, adminToken, "PUT", fmt.Sprintf("/admin/users/%d/role", adminID), fields{"role": auth.RoleUser}).Code)
+
+	w := call(t, adminToken, "PUT", role, fields{"role": auth.RoleAdmin})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, call(t, targetToken, "GET", "/admin/users", nil).Code)
+
+	// Demotion takes effect on the next request.
+	require.Equal(t, http.StatusOK, call(t, adminToken, "PUT", role, fields{"role": auth.RoleUser}).Code)
+	assert.Equal(t, http.StatusForbidden, call(t, targetToken, "GET", "/admin/users", nil).Code)
+}
+
+func TestAdminRescrapeAndWorkerStatus(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	_, adminToken := testAdmin(t)
+	owner, _ := testUser(t, "owner@example.com")
+	failed := &article.Article{URL: "http://127.0.0.1:1/unreachable", UserID: owner.ID, Status: article.StatusFailed, RetryCount: 3}
+	require.NoError(t, database.DB.Create(failed).Error)
+
+	w := call(t, adminToken, "GET", "/admin/worker", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status struct {
+		Jobs     []json.RawMessage `json:"jobs"`
+		Articles map[string]int64  `json:"articles"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.EqualValues(t, 1, status.Articles["failed"])
+	assert.Zero(t, status.Articles["retrying"], "articles out of retries aren't queued")
+
+	w = call(t, adminToken, "POST", fmt.Sprintf("/admin/articles/%d/rescrape", failed.ID), nil)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var rescraped article.Article
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rescraped))
+	assert.Equal(t, article.StatusPending, rescraped.Status)
+	assert.Zero(t, rescraped.RetryCount)
+
+	assert.Equal(t, http.StatusNotFound, call(t, adminToken, "POST", "/admin/articles/999999/rescrape", nil).Code)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/stretchr/testify/require"
+)
+
+// testUser creates a user and returns them with an access token.
+func testUser(t *testing.T, email string) (*user.User, string) {
+	t.Helper()
+	u := &user.User{Email: email, Password: "hash"}
+	require.NoError(t, database.DB.Create(u).Error)
+	pair, err := testTokens.IssueTokens(u.ID, "test", "127.0.0.1")
+	require.NoError(t, err)
+	return u, pair.AccessToken
+}
+
+// call sends a request with token as the bearer token and returns the
+// recorded response.
+func call(t *testing.T, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&payload).Encode(body))
+	}
+	req, err := http.NewRequest(method, path, &payload)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	return w
+}
+
+// fields is shorthand for a JSON request body.
+type fields map[string]interface{}
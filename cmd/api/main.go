@@ -2,65 +2,250 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/cheildo/deeli-api/internal/recommendation"
 
+	"github.com/cheildo/deeli-api/internal/account"
+	"github.com/cheildo/deeli-api/internal/admin"
 	"github.com/cheildo/deeli-api/internal/article"
 	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/comment"
+	"github.com/cheildo/deeli-api/internal/experiment"
+	"github.com/cheildo/deeli-api/internal/feed"
+	"github.com/cheildo/deeli-api/internal/oidc"
+	"github.com/cheildo/deeli-api/internal/share"
+	"github.com/cheildo/deeli-api/internal/social"
 	"github.com/cheildo/deeli-api/internal/user"
 	"github.com/cheildo/deeli-api/internal/worker"
+	"github.com/cheildo/deeli-api/internal/workspace"
 	"github.com/cheildo/deeli-api/pkg/config"
 	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/cheildo/deeli-api/pkg/mailer"
 )
 
 func main() {
 	config.LoadConfig()
 	database.Connect()
-	database.Migrate(&user.User{}, &article.Article{}, &article.Rating{})
+	database.Migrate(&user.User{}, &user.Identity{}, &user.RecoveryCode{}, &user.LoginFailure{}, &auth.LoginAttempt{}, &auth.Session{}, &auth.RefreshToken{}, &auth.PersonalAccessToken{}, &article.Article{}, &article.Rating{}, &recommendation.Feedback{}, &recommendation.Event{}, &recommendation.CachedRecommendation{}, &recommendation.CacheState{}, &social.Follow{}, &share.Link{}, &workspace.Workspace{}, &workspace.Member{}, &workspace.Invitation{}, &comment.Comment{}, &comment.Notification{}, &feed.Feed{}, &feed.Entry{}, &feed.Token{}, &experiment.Experiment{}, &experiment.Variant{})
+	if err := article.DropLegacyIndexes(); err != nil {
+		log.Fatal("Failed to migrate article indexes:", err)
+	}
 
 	// --- Repositories ---
 	userRepo := user.NewRepository()
-	articleRepo := article.NewRepository()
+	user.SeedAdminsFromConfig(userRepo)
+	sessionRepo := auth.NewSessionRepository()
+	personalTokenRepo := auth.NewPersonalTokenRepository()
+	recommendationRepo := recommendation.NewRepository()
+	recommendationCacheRepo := recommendation.NewCacheRepository()
+	experimentRepo := experiment.NewRepository()
+	accountRepo := account.NewRepository()
+	articleRepo := article.NewRepository(recommendation.NewInvalidator(recommendationCacheRepo))
+	socialRepo := social.NewRepository(recommendation.NewInvalidator(recommendationCacheRepo))
+	workspaceRepo := workspace.NewRepository(feed.WorkspaceObserver{})
 
 	// --- Services ---
-	recommendationService := recommendation.NewService(articleRepo)
+	jwtKeys, err := auth.KeySetFromConfig()
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	tokens := auth.NewTokenServiceFromConfig(sessionRepo, jwtKeys)
+	personalTokens := auth.NewPersonalTokenService(personalTokenRepo)
+	actionTokens, err := auth.ActionTokensFromConfig()
+	if err != nil {
+		log.Fatal("Failed to set up action tokens:", err)
+	}
+	loginThrottle := auth.LoginThrottleFromConfig()
+	userMFA := user.NewMFA(userRepo, actionTokens, config.GetString("TOTP_ISSUER", "Deeli"))
+	userEmails := user.NewEmailsFromConfig(mailer.FromConfig(), actionTokens)
+	workspaceInvitations := workspace.NewInvitations(workspaceRepo, mailer.FromConfig(), config.GetString("APP_BASE_URL", "http://localhost:3000"))
+	oidcProviders, err := oidc.ProvidersFromConfig()
+	if err != nil {
+		log.Fatal("Failed to configure OIDC providers:", err)
+	}
+	oidcStates, err := oidc.StateCodecFromConfig()
+	if err != nil {
+		log.Fatal("Failed to set up OIDC state:", err)
+	}
+	modelHolder := &recommendation.ModelHolder{}
+	modelStore := recommendation.NewModelStore(config.GetString("MF_MODEL_DIR", "models"), config.GetInt("MF_MODELS_KEPT", 3))
+	trainer := recommendation.NewTrainer(articleRepo, modelStore, modelHolder, recommendation.NewInvalidator(recommendationCacheRepo), recommendation.MFParamsFromConfig())
+	trainer.LoadLatest()
+	reranker := recommendation.RerankerFromConfig()
+	peerService := recommendation.NewService(articleRepo, recommendationRepo, reranker, socialRepo)
+	recommendationService := recommendation.NewMFService(articleRepo, recommendationRepo, modelHolder, peerService, reranker)
+	recommendationCache := recommendation.NewCacheFromConfig(recommendationCacheRepo, recommendationRepo, articleRepo, recommendationService, peerService)
+	feedService := feed.NewServiceFromConfig(feed.NewRepository(), articleRepo, workspaceRepo)
+	experimentRouter := experiment.NewRouter(experimentRepo, recommendationCache.DefaultStrategy(), config.GetDuration("EXPERIMENT_RELOAD_INTERVAL", 30*time.Second))
 
 	// --- Start Background Worker ---
 	bgWorker := worker.NewWorker(articleRepo)
+	bgWorker.AddJob(worker.Job{
+		Name:     "train-recommendation-model",
+		Interval: config.GetDuration("MF_TRAIN_INTERVAL", time.Hour),
+		Run:      trainer.Train,
+	})
+	bgWorker.AddJob(worker.Job{
+		Name:     "refresh-recommendation-cache",
+		Interval: config.GetDuration("REC_CACHE_REFRESH_INTERVAL", time.Minute),
+		Run:      recommendationCache.RefreshStale,
+	})
+	bgWorker.AddJob(worker.Job{
+		Name:     "flush-session-activity",
+		Interval: config.GetDuration("SESSION_ACTIVITY_FLUSH_INTERVAL", 30*time.Second),
+		Run:      tokens.FlushActivity,
+	})
+	bgWorker.AddJob(worker.Job{
+		Name:     "purge-deleted-accounts",
+		Interval: config.GetDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+		Run:      account.NewPurger(accountRepo, trainer).PurgeDue,
+	})
+	bgWorker.AddJob(worker.Job{
+		Name:     "poll-feeds",
+		Interval: config.GetDuration("FEED_CHECK_INTERVAL", time.Minute),
+		Run:      feedService.PollDue,
+	})
 	go bgWorker.Start()
 
 	// --- Handlers ---
-	userHandler := user.NewHandler(userRepo)
-	articleHandler := article.NewHandler(articleRepo)
+	userHandler := user.NewHandler(userRepo, tokens, userEmails, userMFA, loginThrottle)
+	authHandler := auth.NewHandler(tokens, personalTokens)
+	accountHandler := account.NewHandler(accountRepo)
+	oidcHandler := oidc.NewHandler(oidcProviders, oidcStates, userRepo, userHandler)
+	articleHandler := article.NewHandler(articleRepo, workspaceRepo)
+	workspaceHandler := workspace.NewHandler(workspaceRepo, userRepo, workspaceInvitations)
+	commentHandler := comment.NewHandler(comment.NewService(comment.NewRepository(), articleRepo, workspaceRepo, userRepo))
+	feedHandler := feed.NewHandler(feedService, feed.NewOutputService(feed.NewOutputRepository(), articleRepo, workspaceRepo, userRepo), config.GetString("FEED_BASE_URL", "http://localhost:8080"))
+	socialHandler := social.NewHandler(socialRepo, userRepo)
+	shareHandler := share.NewHandler(share.NewService(share.NewRepository(), articleRepo, config.GetInt("SHARE_PASSWORD_CHECKS", 4)), share.PasswordThrottleFromConfig(), config.GetString("SHARE_BASE_URL", "http://localhost:8080"))
 
-	recommendationHandler := recommendation.NewHandler(recommendationService)
+	recommendationHandler := recommendation.NewHandler(recommendationCache, experimentRouter, recommendation.NewSimilarService(articleRepo), recommendationRepo, articleRepo, userRepo, recommendation.NewWorkspaceService(articleRepo, recommendationRepo, workspaceRepo, reranker))
+	adminHandler := admin.NewHandler(userRepo, articleRepo, tokens, bgWorker)
+	experimentHandler := experiment.NewHandler(experimentRepo, experimentRouter, recommendationCache.Strategies())
 
 	r := gin.Default()
 
 	// Public routes
 	r.POST("/signup", userHandler.Signup)
 	r.POST("/login", userHandler.Login)
+	r.POST("/login/mfa", userHandler.LoginMFA)
+	r.POST("/token/refresh", authHandler.Refresh)
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+	r.POST("/password/forgot", userHandler.ForgotPassword)
+	r.POST("/password/reset", userHandler.ResetPassword)
+	r.POST("/email/verify", userHandler.VerifyEmail)
+	r.POST("/email/verify/resend", userHandler.ResendVerification)
+	r.POST("/account/restore", userHandler.RestoreAccount)
+	r.GET("/auth/oidc/:provider/login", oidcHandler.Login)
+	r.GET("/auth/oidc/:provider/callback", oidcHandler.Callback)
+	r.GET("/s/:token", shareHandler.View)
+	r.GET("/feeds/out/:file", feedHandler.Output)
 
 	// Authenticated routes
 	authRoutes := r.Group("/")
-	authRoutes.Use(auth.Middleware())
+	authRoutes.Use(auth.Middleware(tokens, personalTokens, userRepo))
 	{
-		authRoutes.GET("/me", userHandler.GetMe)
+		authRoutes.GET("/me", auth.RequireScope(auth.ScopeProfileRead), userHandler.GetMe)
+		authRoutes.GET("/me/preferences", auth.RequireScope(auth.ScopeProfileRead), userHandler.GetPreferences)
+
+		// Account routes, not available to personal access tokens
+		sessionRoutes := authRoutes.Group("/", auth.RequireSession())
+		sessionRoutes.POST("/logout", authHandler.Logout)
+		sessionRoutes.GET("/sessions", authHandler.ListSessions)
+		sessionRoutes.DELETE("/sessions", authHandler.RevokeOtherSessions)
+		sessionRoutes.DELETE("/sessions/:id", authHandler.RevokeSession)
+		sessionRoutes.POST("/tokens", authHandler.CreatePersonalToken)
+		sessionRoutes.GET("/tokens", authHandler.ListPersonalTokens)
+		sessionRoutes.DELETE("/tokens/:id", authHandler.RevokePersonalToken)
+		sessionRoutes.POST("/feed-tokens", feedHandler.CreateToken)
+		sessionRoutes.GET("/feed-tokens", feedHandler.ListTokens)
+		sessionRoutes.DELETE("/feed-tokens/:id", feedHandler.RevokeToken)
+		sessionRoutes.PATCH("/me", userHandler.UpdateMe)
+		sessionRoutes.POST("/me/password", userHandler.ChangePassword)
+		sessionRoutes.DELETE("/me", userHandler.DeleteAccount)
+		sessionRoutes.GET("/me/data-export", accountHandler.ExportData)
+		sessionRoutes.POST("/me/mfa/totp", userHandler.EnrollTOTP)
+		sessionRoutes.POST("/me/mfa/totp/confirm", userHandler.ConfirmTOTP)
+		sessionRoutes.DELETE("/me/mfa/totp", userHandler.DisableTOTP)
+		sessionRoutes.POST("/me/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+		sessionRoutes.POST("/users/:id/follow", socialHandler.Follow)
+		sessionRoutes.DELETE("/users/:id/follow", socialHandler.Unfollow)
+
+		// Workspace routes, not available to personal access tokens
+		sessionRoutes.POST("/workspaces", workspaceHandler.CreateWorkspace)
+		sessionRoutes.GET("/workspaces", workspaceHandler.ListWorkspaces)
+		sessionRoutes.GET("/workspaces/:id", workspaceHandler.GetWorkspace)
+		sessionRoutes.PATCH("/workspaces/:id", workspaceHandler.RenameWorkspace)
+		sessionRoutes.DELETE("/workspaces/:id", workspaceHandler.DeleteWorkspace)
+		sessionRoutes.POST("/workspaces/:id/invitations", workspaceHandler.Invite)
+		sessionRoutes.GET("/workspaces/:id/invitations", workspaceHandler.ListInvitations)
+		sessionRoutes.DELETE("/workspaces/:id/invitations/:invitationID", workspaceHandler.RevokeInvitation)
+		sessionRoutes.PUT("/workspaces/:id/members/:userID/role", workspaceHandler.SetMemberRole)
+		sessionRoutes.DELETE("/workspaces/:id/members/:userID", workspaceHandler.RemoveMember)
+		sessionRoutes.POST("/invitations/accept", workspaceHandler.AcceptInvitation)
 
 		// Article routes
-		authRoutes.POST("/articles", articleHandler.CreateArticle)
-		authRoutes.GET("/articles", articleHandler.GetArticles)
-		authRoutes.DELETE("/articles/:id", articleHandler.DeleteArticle)
+		authRoutes.POST("/articles", auth.RequireScope(auth.ScopeArticlesWrite), articleHandler.CreateArticle)
+		authRoutes.GET("/articles", auth.RequireScope(auth.ScopeArticlesRead), articleHandler.GetArticles)
+		authRoutes.PATCH("/articles/:id", auth.RequireScope(auth.ScopeArticlesWrite), articleHandler.UpdateArticle)
+		authRoutes.POST("/articles/:id/shares", auth.RequireScope(auth.ScopeArticlesWrite), shareHandler.CreateLink)
+		authRoutes.GET("/shares", auth.RequireScope(auth.ScopeArticlesRead), shareHandler.ListLinks)
+		authRoutes.DELETE("/shares/:id", auth.RequireScope(auth.ScopeArticlesWrite), shareHandler.RevokeLink)
+		authRoutes.DELETE("/articles/:id", auth.RequireScope(auth.ScopeArticlesWrite), articleHandler.DeleteArticle)
+		authRoutes.GET("/articles/:id/similar", auth.RequireScope(auth.ScopeArticlesRead), recommendationHandler.GetSimilarArticles)
 
 		// Rating routes
-		authRoutes.POST("/articles/:id/rate", articleHandler.RateArticle)
-		authRoutes.GET("/articles/:id/rate", articleHandler.GetRating)
-		authRoutes.DELETE("/articles/:id/rate", articleHandler.DeleteRating)
+		authRoutes.POST("/articles/:id/rate", auth.RequireScope(auth.ScopeRatingsWrite), articleHandler.RateArticle)
+		authRoutes.GET("/articles/:id/rate", auth.RequireScope(auth.ScopeArticlesRead), articleHandler.GetRating)
+		authRoutes.DELETE("/articles/:id/rate", auth.RequireScope(auth.ScopeRatingsWrite), articleHandler.DeleteRating)
+		authRoutes.GET("/articles/:id/ratings", auth.RequireScope(auth.ScopeArticlesRead), articleHandler.GetArticleRatings)
 
-		// Recommendation route
-		authRoutes.GET("/recommendations", recommendationHandler.GetRecommendations)
+		// Comment routes
+		authRoutes.GET("/articles/:id/comments", auth.RequireScope(auth.ScopeArticlesRead), commentHandler.ListComments)
+		authRoutes.POST("/articles/:id/comments", auth.RequireScope(auth.ScopeArticlesWrite), commentHandler.CreateComment)
+		authRoutes.PATCH("/comments/:id", auth.RequireScope(auth.ScopeArticlesWrite), commentHandler.UpdateComment)
+		authRoutes.DELETE("/comments/:id", auth.RequireScope(auth.ScopeArticlesWrite), commentHandler.DeleteComment)
+		authRoutes.GET("/notifications", auth.RequireScope(auth.ScopeArticlesRead), commentHandler.ListNotifications)
+		authRoutes.POST("/notifications/:id/read", auth.RequireScope(auth.ScopeArticlesWrite), commentHandler.MarkNotificationRead)
+
+		// Feed subscription routes
+		authRoutes.POST("/feeds", auth.RequireScope(auth.ScopeArticlesWrite), feedHandler.Subscribe)
+		authRoutes.GET("/feeds", auth.RequireScope(auth.ScopeArticlesRead), feedHandler.ListFeeds)
+		authRoutes.DELETE("/feeds/:id", auth.RequireScope(auth.ScopeArticlesWrite), feedHandler.Unsubscribe)
+
+		// Social routes
+		authRoutes.GET("/feed", auth.RequireScope(auth.ScopeArticlesRead), socialHandler.GetFeed)
+		authRoutes.GET("/users/:id", auth.RequireScope(auth.ScopeArticlesRead), socialHandler.GetProfile)
+		authRoutes.GET("/me/following", auth.RequireScope(auth.ScopeArticlesRead), socialHandler.ListFollowing)
+
+		// Recommendation routes
+		authRoutes.GET("/recommendations", auth.RequireScope(auth.ScopeRecommendationsRead), recommendationHandler.GetRecommendations)
+		authRoutes.POST("/recommendations/:id/feedback", auth.RequireScope(auth.ScopeRecommendationsWrite), recommendationHandler.CreateFeedback)
+		authRoutes.POST("/recommendations/:id/click", auth.RequireScope(auth.ScopeRecommendationsWrite), recommendationHandler.RecordClick)
+	}
+
+	// Admin routes
+	adminRoutes := r.Group("/admin")
+	adminRoutes.Use(auth.Middleware(tokens, personalTokens, userRepo), auth.RequireSession(), auth.RequireRole(auth.RoleAdmin))
+	{
+		adminRoutes.GET("/users", adminHandler.ListUsers)
+		adminRoutes.GET("/users/:id", adminHandler.GetUser)
+		adminRoutes.POST("/users/:id/disable", adminHandler.DisableUser)
+		adminRoutes.POST("/users/:id/enable", adminHandler.EnableUser)
+		adminRoutes.PUT("/users/:id/role", adminHandler.SetRole)
+		adminRoutes.GET("/users/:id/articles", adminHandler.GetUserArticles)
+		adminRoutes.GET("/users/:id/ratings", adminHandler.GetUserRatings)
+		adminRoutes.POST("/articles/:id/rescrape", adminHandler.RescrapeArticle)
+		adminRoutes.GET("/worker", adminHandler.GetWorkerStatus)
+		adminRoutes.GET("/recommendations/stats", recommendationHandler.GetStats)
+		adminRoutes.POST("/experiments", experimentHandler.CreateExperiment)
+		adminRoutes.GET("/experiments", experimentHandler.ListExperiments)
+		adminRoutes.POST("/experiments/:id/start", experimentHandler.StartExperiment)
+		adminRoutes.POST("/experiments/:id/stop", experimentHandler.StopExperiment)
+		adminRoutes.GET("/experiments/:id/results", experimentHandler.GetResults)
 	}
 
 	// Start the server
@@ -5,16 +5,28 @@ import (
 	"os"
 	"testing"
 
+	"github.com/cheildo/deeli-api/internal/account"
+	"github.com/cheildo/deeli-api/internal/admin"
 	"github.com/cheildo/deeli-api/internal/article"
 	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/comment"
+	"github.com/cheildo/deeli-api/internal/experiment"
+	"github.com/cheildo/deeli-api/internal/feed"
+	"github.com/cheildo/deeli-api/internal/oidc"
 	"github.com/cheildo/deeli-api/internal/recommendation"
+	"github.com/cheildo/deeli-api/internal/share"
+	"github.com/cheildo/deeli-api/internal/social"
 	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/worker"
+	"github.com/cheildo/deeli-api/internal/workspace"
 	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/cheildo/deeli-api/pkg/mailer"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 var testRouter *gin.Engine
+var testTokens *auth.TokenService
 
 func TestMain(m *testing.M) {
 
@@ -26,7 +38,7 @@ func TestMain(m *testing.M) {
 
 	database.Connect()
 	clearTables() // Ensure tables are clean before migrations
-	database.Migrate(&user.User{}, &article.Article{}, &article.Rating{})
+	database.Migrate(&user.User{}, &user.Identity{}, &user.RecoveryCode{}, &user.LoginFailure{}, &auth.LoginAttempt{}, &auth.Session{}, &auth.RefreshToken{}, &auth.PersonalAccessToken{}, &article.Article{}, &article.Rating{}, &recommendation.Feedback{}, &recommendation.Event{}, &recommendation.CachedRecommendation{}, &recommendation.CacheState{}, &social.Follow{}, &share.Link{}, &workspace.Workspace{}, &workspace.Member{}, &workspace.Invitation{}, &comment.Comment{}, &comment.Notification{}, &feed.Feed{}, &feed.Entry{}, &feed.Token{}, &experiment.Experiment{}, &experiment.Variant{})
 	testRouter = setupRouter()
 
 	exitCode := m.Run()
@@ -39,40 +51,165 @@ func TestMain(m *testing.M) {
 func setupRouter() *gin.Engine {
 	// Repositories
 	userRepo := user.NewRepository()
-	articleRepo := article.NewRepository()
+	sessionRepo := auth.NewSessionRepository()
+	personalTokenRepo := auth.NewPersonalTokenRepository()
+	recommendationRepo := recommendation.NewRepository()
+	recommendationCacheRepo := recommendation.NewCacheRepository()
+	accountRepo := account.NewRepository()
+	articleRepo := article.NewRepository(recommendation.NewInvalidator(recommendationCacheRepo))
+	socialRepo := social.NewRepository(recommendation.NewInvalidator(recommendationCacheRepo))
 
 	// Services
-	recommendationService := recommendation.NewService(articleRepo)
+	reranker := recommendation.RerankerFromConfig()
+	peerService := recommendation.NewService(articleRepo, recommendationRepo, reranker, socialRepo)
+	recommendationService := recommendation.NewMFService(articleRepo, recommendationRepo, &recommendation.ModelHolder{}, peerService, reranker)
+	recommendationCache := recommendation.NewCacheFromConfig(recommendationCacheRepo, recommendationRepo, articleRepo, recommendationService, peerService)
+	experimentRouter := experiment.NewRouter(experiment.NewRepository(), recommendationCache.DefaultStrategy(), 0)
 
 	// Handlers
-	userHandler := user.NewHandler(userRepo)
-	articleHandler := article.NewHandler(articleRepo)
-	recommendationHandler := recommendation.NewHandler(recommendationService)
+	jwtKeys, err := auth.KeySetFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	tokens := auth.NewTokenServiceFromConfig(sessionRepo, jwtKeys)
+	testTokens = tokens
+	personalTokens := auth.NewPersonalTokenService(personalTokenRepo)
+	actionTokens, err := auth.ActionTokensFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to set up action tokens: %v", err)
+	}
+	loginThrottle := auth.LoginThrottleFromConfig()
+	userMFA := user.NewMFA(userRepo, actionTokens, "Deeli")
+	userEmails := user.NewEmailsFromConfig(mailer.NewMemoryMailer(), actionTokens)
+	oidcStates, err := oidc.StateCodecFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to set up OIDC state: %v", err)
+	}
+	userHandler := user.NewHandler(userRepo, tokens, userEmails, userMFA, loginThrottle)
+	authHandler := auth.NewHandler(tokens, personalTokens)
+	accountHandler := account.NewHandler(accountRepo)
+	oidcHandler := oidc.NewHandler(map[string]*oidc.Provider{}, oidcStates, userRepo, userHandler)
+	workspaceRepo := workspace.NewRepository(feed.WorkspaceObserver{})
+	articleHandler := article.NewHandler(articleRepo, workspaceRepo)
+	commentHandler := comment.NewHandler(comment.NewService(comment.NewRepository(), articleRepo, workspaceRepo, userRepo))
+	workspaceHandler := workspace.NewHandler(workspaceRepo, userRepo, workspace.NewInvitations(workspaceRepo, mailer.NewMemoryMailer(), "http://localhost:3000"))
+	socialHandler := social.NewHandler(socialRepo, userRepo)
+	shareHandler := share.NewHandler(share.NewService(share.NewRepository(), articleRepo, 4), share.PasswordThrottleFromConfig(), "http://localhost:8080")
+	adminHandler := admin.NewHandler(userRepo, articleRepo, tokens, worker.NewWorker(articleRepo))
+	recommendationHandler := recommendation.NewHandler(recommendationCache, experimentRouter, recommendation.NewSimilarService(articleRepo), recommendationRepo, articleRepo, userRepo, recommendation.NewWorkspaceService(articleRepo, recommendationRepo, workspaceRepo, nil))
 
 	r := gin.Default()
 
 	// Public routes
 	r.POST("/signup", userHandler.Signup)
 	r.POST("/login", userHandler.Login)
+	r.POST("/login/mfa", userHandler.LoginMFA)
+	r.POST("/token/refresh", authHandler.Refresh)
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+	r.POST("/password/forgot", userHandler.ForgotPassword)
+	r.POST("/password/reset", userHandler.ResetPassword)
+	r.POST("/email/verify", userHandler.VerifyEmail)
+	r.POST("/email/verify/resend", userHandler.ResendVerification)
+	r.POST("/account/restore", userHandler.RestoreAccount)
+	r.GET("/auth/oidc/:provider/login", oidcHandler.Login)
+	r.GET("/auth/oidc/:provider/callback", oidcHandler.Callback)
+	r.GET("/s/:token", shareHandler.View)
 
 	// Authenticated routes
 	authRoutes := r.Group("/")
-	authRoutes.Use(auth.Middleware())
+	authRoutes.Use(auth.Middleware(tokens, personalTokens, userRepo))
 	{
-		authRoutes.GET("/me", userHandler.GetMe)
-		authRoutes.POST("/articles", articleHandler.CreateArticle)
-		authRoutes.GET("/articles", articleHandler.GetArticles)
-		authRoutes.GET("/recommendations", recommendationHandler.GetRecommendations)
+		authRoutes.GET("/me", auth.RequireScope(auth.ScopeProfileRead), userHandler.GetMe)
+		authRoutes.GET("/me/preferences", auth.RequireScope(auth.ScopeProfileRead), userHandler.GetPreferences)
+
+		// Account routes, not available to personal access tokens
+		sessionRoutes := authRoutes.Group("/", auth.RequireSession())
+		sessionRoutes.POST("/logout", authHandler.Logout)
+		sessionRoutes.GET("/sessions", authHandler.ListSessions)
+		sessionRoutes.DELETE("/sessions", authHandler.RevokeOtherSessions)
+		sessionRoutes.DELETE("/sessions/:id", authHandler.RevokeSession)
+		sessionRoutes.POST("/tokens", authHandler.CreatePersonalToken)
+		sessionRoutes.GET("/tokens", authHandler.ListPersonalTokens)
+		sessionRoutes.DELETE("/tokens/:id", authHandler.RevokePersonalToken)
+		sessionRoutes.PATCH("/me", userHandler.UpdateMe)
+		sessionRoutes.POST("/me/password", userHandler.ChangePassword)
+		sessionRoutes.DELETE("/me", userHandler.DeleteAccount)
+		sessionRoutes.GET("/me/data-export", accountHandler.ExportData)
+		sessionRoutes.POST("/me/mfa/totp", userHandler.EnrollTOTP)
+		sessionRoutes.POST("/me/mfa/totp/confirm", userHandler.ConfirmTOTP)
+		sessionRoutes.DELETE("/me/mfa/totp", userHandler.DisableTOTP)
+		sessionRoutes.POST("/me/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+		sessionRoutes.POST("/users/:id/follow", socialHandler.Follow)
+		sessionRoutes.DELETE("/users/:id/follow", socialHandler.Unfollow)
+		sessionRoutes.POST("/workspaces", workspaceHandler.CreateWorkspace)
+		sessionRoutes.GET("/workspaces", workspaceHandler.ListWorkspaces)
+		sessionRoutes.GET("/workspaces/:id", workspaceHandler.GetWorkspace)
+		sessionRoutes.POST("/workspaces/:id/invitations", workspaceHandler.Invite)
+		sessionRoutes.PUT("/workspaces/:id/members/:userID/role", workspaceHandler.SetMemberRole)
+		sessionRoutes.DELETE("/workspaces/:id/members/:userID", workspaceHandler.RemoveMember)
+		sessionRoutes.POST("/invitations/accept", workspaceHandler.AcceptInvitation)
+		authRoutes.POST("/articles", auth.RequireScope(auth.ScopeArticlesWrite), articleHandler.CreateArticle)
+		authRoutes.GET("/articles", auth.RequireScope(auth.ScopeArticlesRead), articleHandler.GetArticles)
+		authRoutes.DELETE("/articles/:id", auth.RequireScope(auth.ScopeArticlesWrite), articleHandler.DeleteArticle)
+		authRoutes.POST("/articles/:id/rate", auth.RequireScope(auth.ScopeRatingsWrite), articleHandler.RateArticle)
+		authRoutes.GET("/articles/:id/ratings", auth.RequireScope(auth.ScopeArticlesRead), articleHandler.GetArticleRatings)
+		authRoutes.GET("/articles/:id/comments", auth.RequireScope(auth.ScopeArticlesRead), commentHandler.ListComments)
+		authRoutes.POST("/articles/:id/comments", auth.RequireScope(auth.ScopeArticlesWrite), commentHandler.CreateComment)
+		authRoutes.GET("/notifications", auth.RequireScope(auth.ScopeArticlesRead), commentHandler.ListNotifications)
+		authRoutes.PATCH("/articles/:id", auth.RequireScope(auth.ScopeArticlesWrite), articleHandler.UpdateArticle)
+		authRoutes.POST("/articles/:id/shares", auth.RequireScope(auth.ScopeArticlesWrite), shareHandler.CreateLink)
+		authRoutes.GET("/shares", auth.RequireScope(auth.ScopeArticlesRead), shareHandler.ListLinks)
+		authRoutes.DELETE("/shares/:id", auth.RequireScope(auth.ScopeArticlesWrite), shareHandler.RevokeLink)
+		authRoutes.GET("/feed", auth.RequireScope(auth.ScopeArticlesRead), socialHandler.GetFeed)
+		authRoutes.GET("/users/:id", auth.RequireScope(auth.ScopeArticlesRead), socialHandler.GetProfile)
+		authRoutes.GET("/recommendations", auth.RequireScope(auth.ScopeRecommendationsRead), recommendationHandler.GetRecommendations)
+		authRoutes.POST("/recommendations/:id/feedback", auth.RequireScope(auth.ScopeRecommendationsWrite), recommendationHandler.CreateFeedback)
+		authRoutes.POST("/recommendations/:id/click", auth.RequireScope(auth.ScopeRecommendationsWrite), recommendationHandler.RecordClick)
 
 	}
 
+	adminRoutes := r.Group("/admin")
+	adminRoutes.Use(auth.Middleware(tokens, personalTokens, userRepo), auth.RequireSession(), auth.RequireRole(auth.RoleAdmin))
+	{
+		adminRoutes.GET("/users", adminHandler.ListUsers)
+		adminRoutes.GET("/users/:id", adminHandler.GetUser)
+		adminRoutes.POST("/users/:id/disable", adminHandler.DisableUser)
+		adminRoutes.POST("/users/:id/enable", adminHandler.EnableUser)
+		adminRoutes.PUT("/users/:id/role", adminHandler.SetRole)
+		adminRoutes.POST("/articles/:id/rescrape", adminHandler.RescrapeArticle)
+		adminRoutes.GET("/worker", adminHandler.GetWorkerStatus)
+	}
+
 	return r
 }
 
 // clearTables removes all data from the tables to ensure a clean state for each test run.
 func clearTables() {
 	// The order matters due to foreign key constraints. Delete ratings/articles before users.
+	database.DB.Exec("DELETE FROM variants")
+	database.DB.Exec("DELETE FROM experiments")
+	database.DB.Exec("DELETE FROM cached_recommendations")
+	database.DB.Exec("DELETE FROM cache_states")
+	database.DB.Exec("DELETE FROM events")
+	database.DB.Exec("DELETE FROM feedbacks")
+	database.DB.Exec("DELETE FROM feed_tokens")
+	database.DB.Exec("DELETE FROM feed_entries")
+	database.DB.Exec("DELETE FROM feeds")
+	database.DB.Exec("DELETE FROM notifications")
+	database.DB.Exec("DELETE FROM comments")
 	database.DB.Exec("DELETE FROM ratings")
 	database.DB.Exec("DELETE FROM articles")
+	database.DB.Exec("DELETE FROM workspace_invitations")
+	database.DB.Exec("DELETE FROM workspace_members")
+	database.DB.Exec("DELETE FROM workspaces")
+	database.DB.Exec("DELETE FROM login_attempts")
+	database.DB.Exec("DELETE FROM login_failures")
+	database.DB.Exec("DELETE FROM recovery_codes")
+	database.DB.Exec("DELETE FROM personal_access_tokens")
+	database.DB.Exec("DELETE FROM refresh_tokens")
+	database.DB.Exec("DELETE FROM sessions")
+	database.DB.Exec("DELETE FROM share_links")
+	database.DB.Exec("DELETE FROM follows")
+	database.DB.Exec("DELETE FROM identities")
 	database.DB.Exec("DELETE FROM users")
 }
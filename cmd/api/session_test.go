@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayedRefreshTokenRevokesSessionAfterExpiry(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	u := &user.User{Email: "alice@example.com", Password: "hash"}
+	require.NoError(t, database.DB.Create(u).Error)
+	sessions := auth.NewSessionRepository()
+	now := time.Now()
+	session := &auth.Session{UserID: u.ID, LastSeenAt: now}
+	require.NoError(t, sessions.CreateSession(session, &auth.RefreshToken{TokenHash: "first", ExpiresAt: now.Add(time.Hour)}))
+
+	_, err := sessions.RotateRefreshToken("first", &auth.RefreshToken{TokenHash: "second", ExpiresAt: now.Add(2 * time.Hour)}, now)
+	require.NoError(t, err)
+
+	// The rotated token is replayed once it has expired.
+	later := now.Add(90 * time.Minute)
+	_, err = sessions.RotateRefreshToken("first", &auth.RefreshToken{TokenHash: "third", ExpiresAt: later.Add(time.Hour)}, later)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused)
+	revoked, err := sessions.GetSession(session.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+
+	_, err = sessions.RotateRefreshToken("second", &auth.RefreshToken{TokenHash: "fourth", ExpiresAt: later.Add(time.Hour)}, later)
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+}
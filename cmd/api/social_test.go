@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/social"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setPublicProfile shows or hides the user's profile.
+func setPublicProfile(t *testing.T, userID uint, public bool) {
+	t.Helper()
+	require.NoError(t, database.DB.Exec(
+		"UPDATE users SET preferences = jsonb_set(preferences, '{public_profile}', to_jsonb(?::boolean)) WHERE id = ?", public, userID,
+	).Error)
+}
+
+func TestFollowAndProfile(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	alice, _ := testUser(t, "alice@example.com")
+	bob, _ := testUser(t, "bob@example.com")
+	carol, carolToken := testUser(t, "carol@example.com")
+	setPublicProfile(t, alice.ID, true)
+
+	// Private profiles can't be seen or followed by others, and nobody can
+	// follow themselves.
+	assert.Equal(t, http.StatusNotFound, call(t, carolToken, "GET", fmt.Sprintf("/users/%d", bob.ID), nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, carolToken, "POST", fmt.Sprintf("/users/%d/follow", bob.ID), nil).Code)
+	assert.Equal(t, http.StatusOK, call(t, carolToken, "GET", fmt.Sprintf("/users/%d", carol.ID), nil).Code)
+	setPublicProfile(t, carol.ID, true)
+	assert.Equal(t, http.StatusBadRequest, call(t, carolToken, "POST", fmt.Sprintf("/users/%d/follow", carol.ID), nil).Code)
+
+	// Following twice is not an error.
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, call(t, carolToken, "POST", fmt.Sprintf("/users/%d/follow", alice.ID), nil).Code)
+	}
+	w := call(t, carolToken, "GET", fmt.Sprintf("/users/%d", alice.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var profile struct {
+		Followers int64 `json:"followers"`
+		Following int64 `json:"following"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+	assert.EqualValues(t, 1, profile.Followers)
+	assert.EqualValues(t, 0, profile.Following)
+
+	// Unfollowing works after the profile goes private.
+	setPublicProfile(t, alice.ID, false)
+	assert.Equal(t, http.StatusNoContent, call(t, carolToken, "DELETE", fmt.Sprintf("/users/%d/follow", alice.ID), nil).Code)
+	var follows int64
+	require.NoError(t, database.DB.Model(&social.Follow{}).Where("follower_id = ?", carol.ID).Count(&follows).Error)
+	assert.Zero(t, follows)
+}
+
+func TestFeedShowsOnlyPublicActivity(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	alice, _ := testUser(t, "alice@example.com")
+	dave, _ := testUser(t, "dave@example.com")
+	_, carolToken := testUser(t, "carol@example.com")
+	setPublicProfile(t, alice.ID, true)
+	_, inWorkspace := testWorkspace(t, alice.ID, nil)
+
+	save := func(owner uint, url string, public bool) *article.Article {
+		a := &article.Article{URL: url, UserID: owner, Public: public, Status: article.StatusCompleted}
+		require.NoError(t, database.DB.Create(a).Error)
+		return a
+	}
+	publicSave := save(alice.ID, "https://example.com/public", true)
+	save(alice.ID, "https://example.com/private", false)
+	liked := save(dave.ID, "https://example.com/liked", true)
+	lukewarm := save(dave.ID, "https://example.com/lukewarm", true)
+	hidden := save(dave.ID, "https://example.com/hidden", false)
+	for _, r := range []article.Rating{
+		{UserID: alice.ID, ArticleID: liked.ID, Score: 5},
+		{UserID: alice.ID, ArticleID: lukewarm.ID, Score: 3},
+		{UserID: alice.ID, ArticleID: hidden.ID, Score: 5},
+		{UserID: alice.ID, ArticleID: inWorkspace.ID, Score: 5},
+	} {
+		rating := r
+		require.NoError(t, database.DB.Create(&rating).Error)
+	}
+
+	w := call(t, carolToken, "GET", "/feed", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page social.FeedPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Empty(t, page.Items, "only followed users are in the feed")
+
+	require.Equal(t, http.StatusOK, call(t, carolToken, "POST", fmt.Sprintf("/users/%d/follow", alice.ID), nil).Code)
+	w = call(t, carolToken, "GET", "/feed", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	type entry struct {
+		Type      string
+		ArticleID uint
+	}
+	var got []entry
+	for _, item := range page.Items {
+		got = append(got, entry{item.Type, item.Article.ID})
+		assert.Equal(t, alice.ID, item.User.ID)
+	}
+	assert.ElementsMatch(t, []entry{{social.ItemSave, publicSave.ID}, {social.ItemRating, liked.ID}}, got)
+
+	// Pages follow on from the cursor.
+	w = call(t, carolToken, "GET", "/feed?limit=1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Items, 1)
+	require.NotEmpty(t, page.NextCursor)
+	first := page.Items[0].Article.ID
+	w = call(t, carolToken, "GET", "/feed?limit=1&cursor="+page.NextCursor, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	page = social.FeedPage{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Items, 1)
+	assert.NotEqual(t, first, page.Items[0].Article.ID)
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, http.StatusBadRequest, call(t, carolToken, "GET", "/feed?cursor=nonsense", nil).Code)
+
+	// A followed user who makes their profile private drops out.
+	setPublicProfile(t, alice.ID, false)
+	w = call(t, carolToken, "GET", "/feed", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	page = social.FeedPage{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Empty(t, page.Items)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalTokenNeedsProfileScopeForProfile(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	u, _ := testUser(t, "alice@example.com")
+	service := auth.NewPersonalTokenService(auth.NewPersonalTokenRepository())
+	articlesOnly, _, err := service.Create(u.ID, "script", []string{auth.ScopeArticlesRead}, nil)
+	require.NoError(t, err)
+	profile, _, err := service.Create(u.ID, "profile", []string{auth.ScopeProfileRead}, nil)
+	require.NoError(t, err)
+
+	for _, path := range []string{"/me", "/me/preferences"} {
+		assert.Equal(t, http.StatusForbidden, call(t, articlesOnly, "GET", path, nil).Code, path)
+		assert.Equal(t, http.StatusOK, call(t, profile, "GET", path, nil).Code, path)
+	}
+}
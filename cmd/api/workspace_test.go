@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/feed"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWorkspace creates a workspace owned by owner with the given members
+// and an article saved to it.
+func testWorkspace(t *testing.T, owner uint, members map[uint]string) (*workspace.Workspace, *article.Article) {
+	t.Helper()
+	ws := &workspace.Workspace{Name: "Team"}
+	require.NoError(t, workspace.NewRepository().CreateWorkspace(ws, owner))
+	for id, role := range members {
+		require.NoError(t, database.DB.Create(&workspace.Member{WorkspaceID: ws.ID, UserID: id, Role: role}).Error)
+	}
+	a := &article.Article{URL: fmt.Sprintf("https://example.com/team/%d", ws.ID), UserID: owner, WorkspaceID: &ws.ID, Status: article.StatusCompleted}
+	require.NoError(t, database.DB.Create(a).Error)
+	return ws, a
+}
+
+func TestWorkspaceArticleAccessByRole(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	owner, _ := testUser(t, "owner@example.com")
+	editor, editorToken := testUser(t, "editor@example.com")
+	viewer, viewerToken := testUser(t, "viewer@example.com")
+	_, outsiderToken := testUser(t, "outsider@example.com")
+	ws, a := testWorkspace(t, owner.ID, map[uint]string{editor.ID: workspace.RoleEditor, viewer.ID: workspace.RoleViewer})
+
+	list := fmt.Sprintf("/articles?workspace_id=%d", ws.ID)
+	ratings := fmt.Sprintf("/articles/%d/ratings", a.ID)
+	rate := fmt.Sprintf("/articles/%d/rate", a.ID)
+	shares := fmt.Sprintf("/articles/%d/shares", a.ID)
+	remove := fmt.Sprintf("/articles/%d", a.ID)
+
+	// Non-members can't tell the workspace or its articles exist.
+	assert.Equal(t, http.StatusNotFound, call(t, outsiderToken, "GET", list, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, outsiderToken, "GET", ratings, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, outsiderToken, "POST", rate, fields{"score": 5}).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, outsiderToken, "POST", shares, fields{}).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, outsiderToken, "DELETE", remove, nil).Code)
+	w := call(t, outsiderToken, "GET", "/articles", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed []article.Article
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Empty(t, listed, "workspace articles are not in anyone's own library")
+
+	// Viewers read and rate, but can't share or delete.
+	w = call(t, viewerToken, "GET", list, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, a.ID, listed[0].ID)
+	assert.Equal(t, http.StatusOK, call(t, viewerToken, "GET", ratings, nil).Code)
+	assert.Equal(t, http.StatusOK, call(t, viewerToken, "POST", rate, fields{"score": 4}).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, viewerToken, "POST", shares, fields{}).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, viewerToken, "DELETE", remove, nil).Code)
+
+	// Editors can do all of it.
+	assert.Equal(t, http.StatusOK, call(t, editorToken, "POST", rate, fields{"score": 5}).Code)
+	assert.Equal(t, http.StatusCreated, call(t, editorToken, "POST", shares, fields{}).Code)
+	assert.Equal(t, http.StatusNoContent, call(t, editorToken, "DELETE", remove, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(t, viewerToken, "GET", ratings, nil).Code)
+}
+
+func TestAcceptInvitationChecksEmail(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	owner, _ := testUser(t, "owner@example.com")
+	_, invitedToken := testUser(t, "Invited@Example.com")
+	_, otherToken := testUser(t, "other@example.com")
+	ws, _ := testWorkspace(t, owner.ID, nil)
+	token := "invitation-token"
+	require.NoError(t, database.DB.Create(&workspace.Invitation{
+		WorkspaceID: ws.ID,
+		Email:       "invited@example.com",
+		Role:        workspace.RoleEditor,
+		InvitedBy:   owner.ID,
+		TokenHash:   auth.HashToken(token),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}).Error)
+
+	w := call(t, otherToken, "POST", "/invitations/accept", fields{"token": token})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusNotFound, call(t, otherToken, "GET", fmt.Sprintf("/workspaces/%d", ws.ID), nil).Code)
+
+	// The address is compared without regard to case.
+	w = call(t, invitedToken, "POST", "/invitations/accept", fields{"token": token})
+	require.Equal(t, http.StatusOK, w.Code)
+	var membership workspace.Membership
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &membership))
+	assert.Equal(t, ws.ID, membership.ID)
+	assert.Equal(t, workspace.RoleEditor, membership.Role)
+
+	// The invitation can't be used twice.
+	assert.Equal(t, http.StatusNotFound, call(t, invitedToken, "POST", "/invitations/accept", fields{"token": token}).Code)
+}
+
+func TestWorkspaceKeepsAnOwner(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	owner, ownerToken := testUser(t, "owner@example.com")
+	editor, editorToken := testUser(t, "editor@example.com")
+	ws, _ := testWorkspace(t, owner.ID, map[uint]string{editor.ID: workspace.RoleEditor})
+	ownerRole := fmt.Sprintf("/workspaces/%d/members/%d/role", ws.ID, owner.ID)
+	ownerMember := fmt.Sprintf("/workspaces/%d/members/%d", ws.ID, owner.ID)
+
+	// The last owner can neither step down nor leave.
+	assert.Equal(t, http.StatusBadRequest, call(t, ownerToken, "PUT", ownerRole, fields{"role": workspace.RoleEditor}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, ownerToken, "DELETE", ownerMember, nil).Code)
+
+	// Only owners manage members.
+	assert.Equal(t, http.StatusForbidden, call(t, editorToken, "PUT", ownerRole, fields{"role": workspace.RoleViewer}).Code)
+	assert.Equal(t, http.StatusForbidden, call(t, editorToken, "DELETE", ownerMember, nil).Code)
+
+	// With a second owner, the first can leave.
+	editorRole := fmt.Sprintf("/workspaces/%d/members/%d/role", ws.ID, editor.ID)
+	assert.Equal(t, http.StatusOK, call(t, ownerToken, "PUT", editorRole, fields{"role": workspace.RoleOwner}).Code)
+	assert.Equal(t, http.StatusNoContent, call(t, ownerToken, "DELETE", ownerMember, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, editorToken, "PUT", editorRole, fields{"role": workspace.RoleViewer}).Code)
+}
+
+func TestDeleteWorkspaceRemovesItsFeeds(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	owner, ownerToken := testUser(t, "owner@example.com")
+	ws, _ := testWorkspace(t, owner.ID, nil)
+	subscription := &feed.Feed{UserID: owner.ID, URL: "https://example.com/feed.xml", WorkspaceID: &ws.ID}
+	require.NoError(t, database.DB.Create(subscription).Error)
+	require.NoError(t, database.DB.Create(&feed.Entry{FeedID: subscription.ID, GUID: "1", URL: "https://example.com/1"}).Error)
+	require.NoError(t, database.DB.Create(&feed.Token{UserID: owner.ID, Prefix: "dlf_", TokenHash: "hash", Source: feed.SourceWorkspace, WorkspaceID: &ws.ID}).Error)
+
+	assert.Equal(t, http.StatusNoContent, call(t, ownerToken, "DELETE", fmt.Sprintf("/workspaces/%d", ws.ID), nil).Code)
+	for _, table := range []string{"feeds", "feed_entries", "feed_tokens"} {
+		var n int64
+		database.DB.Table(table).Count(&n)
+		assert.Zero(t, n, table)
+	}
+}
+
+func TestFavoritesFeedSkipsWorkspacesLeft(t *testing.T) {
+	clearTables()
+	defer clearTables()
+
+	owner, _ := testUser(t, "owner@example.com")
+	former, _ := testUser(t, "former@example.com")
+	ws, _ := testWorkspace(t, owner.ID, map[uint]string{former.ID: workspace.RoleViewer})
+	own := &article.Article{URL: "https://example.com/own", UserID: former.ID, Status: article.StatusCompleted}
+	require.NoError(t, database.DB.Create(own).Error)
+	require.NoError(t, database.DB.Create(&article.Rating{UserID: former.ID, ArticleID: own.ID, Score: 5}).Error)
+	// More workspace favorites, rated since, than a feed lists.
+	for i := 0; i < 60; i++ {
+		a := &article.Article{URL: fmt.Sprintf("https://example.com/team/%d", i), UserID: owner.ID, WorkspaceID: &ws.ID, Status: article.StatusCompleted}
+		require.NoError(t, database.DB.Create(a).Error)
+		require.NoError(t, database.DB.Create(&article.Rating{UserID: former.ID, ArticleID: a.ID, Score: 5}).Error)
+	}
+
+	require.NoError(t, workspace.NewRepository().RemoveMember(ws.ID, former.ID))
+
+	favorites, err := feed.NewOutputRepository().Favorites(former.ID, 4, 50)
+	require.NoError(t, err)
+	require.Len(t, favorites, 1)
+	assert.Equal(t, own.ID, favorites[0].ID)
+}
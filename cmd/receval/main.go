@@ -0,0 +1,140 @@
+// Command receval evaluates recommendation algorithms offline.
+//
+// It loads ratings from a MovieLens-style file or from the database, holds
+// out part of each user's ratings, runs the chosen algorithm on the rest and
+// reports ranking metrics against the held-out items:
+//
+//	go run ./cmd/receval -source csv -file ratings.csv -split temporal -k 10
+//	go run ./cmd/receval -source db -split random -seed 7 -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"github.com/cheildo/deeli-api/internal/recommendation/eval"
+	"github.com/cheildo/deeli-api/pkg/config"
+	"github.com/cheildo/deeli-api/pkg/database"
+)
+
+// algorithms lists the recommendation services that can be evaluated.
+var algorithms = map[string]func(reranker *recommendation.Reranker) eval.Factory{
+	"peer": func(reranker *recommendation.Reranker) eval.Factory {
+		return func(articleRepo article.Repository, repo recommendation.Repository) recommendation.Service {
+			return recommendation.NewService(articleRepo, repo, reranker, nil)
+		}
+	},
+	"mf": func(reranker *recommendation.Reranker) eval.Factory {
+		return func(articleRepo article.Repository, repo recommendation.Repository) recommendation.Service {
+			ratings, err := articleRepo.GetAllRatings()
+			if err != nil {
+				log.Fatalf("Failed to read training ratings: %v", err)
+			}
+			models := &recommendation.ModelHolder{}
+			models.Store(recommendation.TrainMF(ratings, recommendation.MFParamsFromConfig()))
+			fallback := recommendation.NewService(articleRepo, repo, reranker, nil)
+			return recommendation.NewMFService(articleRepo, repo, models, fallback, reranker)
+		}
+	},
+}
+
+func main() {
+	source := flag.String("source", "csv", "where to load ratings from: csv or db")
+	file := flag.String("file", "", "ratings file for -source csv (user,item,rating[,timestamp])")
+	algo := flag.String("algo", "peer", "algorithm to evaluate: "+strings.Join(algorithmNames(), ", "))
+	splitMethod := flag.String("split", string(eval.SplitTemporal), "holdout split: temporal or random")
+	testFraction := flag.Float64("test-fraction", 0.2, "fraction of each user's ratings to hold out")
+	k := flag.Int("k", 10, "cut-off for precision, recall, NDCG and MAP")
+	threshold := flag.Float64("relevance", 4, "minimum held-out rating that counts as relevant")
+	seed := flag.Int64("seed", 1, "random seed for the split")
+	rerank := flag.Bool("rerank", false, "apply the configured re-ranking stages (RERANK_* settings)")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	newFactory, ok := algorithms[*algo]
+	if !ok {
+		log.Fatalf("Unknown algorithm %q (available: %s)", *algo, strings.Join(algorithmNames(), ", "))
+	}
+	var reranker *recommendation.Reranker
+	if *rerank {
+		reranker = recommendation.RerankerFromConfig()
+	}
+	factory := newFactory(reranker)
+
+	ratings, err := loadRatings(*source, *file)
+	if err != nil {
+		log.Fatalf("Failed to load ratings: %v", err)
+	}
+
+	split, err := eval.SplitRatings(ratings, eval.SplitMethod(*splitMethod), *testFraction, *seed)
+	if err != nil {
+		log.Fatalf("Failed to split ratings: %v", err)
+	}
+
+	report, err := eval.Evaluate(split, factory, eval.Config{K: *k, RelevanceThreshold: *threshold})
+	if err != nil {
+		log.Fatalf("Evaluation failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		return
+	}
+
+	fmt.Printf("algorithm      %s (rerank %t)\n", *algo, *rerank)
+	fmt.Printf("split          %s (test fraction %.2f, seed %d)\n", *splitMethod, *testFraction, *seed)
+	fmt.Printf("ratings        %d train / %d test\n", report.TrainRatings, report.TestRatings)
+	fmt.Printf("users          %d evaluated, %d served\n", report.Users, report.UsersServed)
+	fmt.Printf("items          %d\n", report.Items)
+	fmt.Printf("precision@%-4d %.4f\n", report.K, report.PrecisionAtK)
+	fmt.Printf("recall@%-7d %.4f\n", report.K, report.RecallAtK)
+	fmt.Printf("ndcg@%-9d %.4f\n", report.K, report.NDCGAtK)
+	fmt.Printf("map@%-10d %.4f\n", report.K, report.MAPAtK)
+	fmt.Printf("coverage       %.4f\n", report.Coverage)
+	fmt.Printf("novelty        %.4f bits\n", report.Novelty)
+}
+
+func loadRatings(source, file string) ([]eval.Rating, error) {
+	switch source {
+	case "csv":
+		if file == "" {
+			return nil, fmt.Errorf("-file is required with -source csv")
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return eval.LoadCSV(f)
+	case "db":
+		config.LoadConfig()
+		database.Connect()
+		stored, err := article.NewRepository().GetAllRatings()
+		if err != nil {
+			return nil, err
+		}
+		return eval.FromArticleRatings(stored), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", source)
+	}
+}
+
+func algorithmNames() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,190 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/user"
+)
+
+// exportReadme is the first file in an export, describing the others.
+const exportReadme = `This archive holds everything Deeli stores about your account, as JSON.
+
+account.json                  Your account, profile and preferences.
+identities.json               Accounts at identity providers linked to yours.
+sessions.json                 Your login sessions and where they came from.
+personal_access_tokens.json   Your personal access tokens, without the tokens themselves.
+login_failures.json           Failed attempts to log in to your account.
+articles.json                 The articles you saved, including deleted ones.
+ratings.json                  Your article ratings.
+recommendation_feedback.json  Recommendations you dismissed or muted.
+recommendation_events.json    Recommendations you were shown and clicked.
+following.json                The users you follow.
+share_links.json              Links you created to share articles.
+workspaces.json               The workspaces you belong to and your role in each.
+comments.json                 Your comments on articles, including deleted ones.
+feeds.json                    The feeds you subscribe to.
+feed_tokens.json              Tokens for reading your articles as feeds, without the tokens themselves.
+
+Secrets are left out: your password hash, 2FA secret and recovery codes,
+token hashes and share link passwords.
+`
+
+// exportedAccount is the account without its secrets.
+type exportedAccount struct {
+	ID              uint             `json:"id"`
+	Email           string           `json:"email"`
+	Role            string           `json:"role"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	EmailVerifiedAt *time.Time       `json:"email_verified_at"`
+	MFAEnabledAt    *time.Time       `json:"mfa_enabled_at"`
+	HasPassword     bool             `json:"has_password"`
+	DisabledAt      *time.Time       `json:"disabled_at"`
+	DeleteAfter     *time.Time       `json:"delete_after"`
+	DisplayName     string           `json:"display_name"`
+	AvatarURL       string           `json:"avatar_url"`
+	Bio             string           `json:"bio"`
+	Timezone        string           `json:"timezone"`
+	Locale          string           `json:"locale"`
+	Preferences     user.Preferences `json:"preferences"`
+}
+
+type exportedToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type exportedShareLink struct {
+	ID             uint       `json:"id"`
+	ArticleID      uint       `json:"article_id"`
+	Prefix         string     `json:"prefix"`
+	HasPassword    bool       `json:"has_password"`
+	IncludeContent bool       `json:"include_content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	Views          int64      `json:"views"`
+	LastViewedAt   *time.Time `json:"last_viewed_at"`
+}
+
+type exportedFeedToken struct {
+	ID          uint       `json:"id"`
+	Prefix      string     `json:"prefix"`
+	Source      string     `json:"source"`
+	WorkspaceID *uint      `json:"workspace_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// WriteArchive writes the data as a ZIP archive of JSON files.
+func WriteArchive(w io.Writer, data *Data) error {
+	tokens := make([]exportedToken, len(data.PersonalAccessTokens))
+	for i, t := range data.PersonalAccessTokens {
+		tokens[i] = exportedToken{
+			ID:         t.ID,
+			Name:       t.Name,
+			Prefix:     t.Prefix,
+			Scopes:     t.ScopeList(),
+			CreatedAt:  t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+			LastUsedAt: t.LastUsedAt,
+			RevokedAt:  t.RevokedAt,
+		}
+	}
+	shareLinks := make([]exportedShareLink, len(data.ShareLinks))
+	for i, l := range data.ShareLinks {
+		shareLinks[i] = exportedShareLink{
+			ID:             l.ID,
+			ArticleID:      l.ArticleID,
+			Prefix:         l.Prefix,
+			HasPassword:    l.PasswordHash != "",
+			IncludeContent: l.IncludeContent,
+			CreatedAt:      l.CreatedAt,
+			ExpiresAt:      l.ExpiresAt,
+			RevokedAt:      l.RevokedAt,
+			Views:          l.Views,
+			LastViewedAt:   l.LastViewedAt,
+		}
+	}
+	feedTokens := make([]exportedFeedToken, len(data.FeedTokens))
+	for i, t := range data.FeedTokens {
+		feedTokens[i] = exportedFeedToken{
+			ID:          t.ID,
+			Prefix:      t.Prefix,
+			Source:      t.Source,
+			WorkspaceID: t.WorkspaceID,
+			CreatedAt:   t.CreatedAt,
+			LastUsedAt:  t.LastUsedAt,
+			RevokedAt:   t.RevokedAt,
+		}
+	}
+	u := data.User
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"account.json", exportedAccount{
+			ID:              u.ID,
+			Email:           u.Email,
+			Role:            u.Role,
+			CreatedAt:       u.CreatedAt,
+			UpdatedAt:       u.UpdatedAt,
+			EmailVerifiedAt: u.EmailVerifiedAt,
+			MFAEnabledAt:    u.TOTPEnabledAt,
+			HasPassword:     u.Password != "",
+			DisabledAt:      u.DisabledAt,
+			DeleteAfter:     u.DeleteAfter,
+			DisplayName:     u.DisplayName,
+			AvatarURL:       u.AvatarURL,
+			Bio:             u.Bio,
+			Timezone:        u.Timezone,
+			Locale:          u.Locale,
+			Preferences:     u.Preferences,
+		}},
+		{"identities.json", data.Identities},
+		{"sessions.json", data.Sessions},
+		{"personal_access_tokens.json", tokens},
+		{"login_failures.json", data.LoginFailures},
+		{"articles.json", data.Articles},
+		{"ratings.json", data.Ratings},
+		{"recommendation_feedback.json", data.RecommendationFeedback},
+		{"recommendation_events.json", data.RecommendationEvents},
+		{"following.json", data.Following},
+		{"share_links.json", shareLinks},
+		{"workspaces.json", data.Workspaces},
+		{"comments.json", data.Comments},
+		{"feeds.json", data.Feeds},
+		{"feed_tokens.json", feedTokens},
+	}
+
+	archive := zip.NewWriter(w)
+	readme, err := archive.Create("README.txt")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(readme, exportReadme); err != nil {
+		return err
+	}
+	for _, f := range files {
+		fw, err := archive.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
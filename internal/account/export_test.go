@@ -0,0 +1,71 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteArchive(t *testing.T) {
+	enabled := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := &Data{
+		User: user.User{
+			Email:         "export@example.com",
+			Password:      "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+			TOTPSecret:    "JBSWY3DPEHPK3PXP",
+			TOTPEnabledAt: &enabled,
+			Role:          auth.RoleUser,
+		},
+		PersonalAccessTokens: []auth.PersonalAccessToken{
+			{Name: "script", Prefix: "dli_abcd", TokenHash: "secret-hash", Scopes: "articles:read ratings:write"},
+		},
+		Articles: []article.Article{{URL: "https://example.com/a", Title: "A"}},
+		Ratings:  []article.Rating{{ArticleID: 1, Score: 5}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteArchive(&buf, data))
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[f.Name] = content
+	}
+	assert.Contains(t, files, "README.txt")
+
+	var account map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["account.json"], &account))
+	assert.Equal(t, "export@example.com", account["email"])
+	assert.Equal(t, true, account["has_password"])
+	assert.Equal(t, "2024-05-01T12:00:00Z", account["mfa_enabled_at"])
+
+	var tokens []map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["personal_access_tokens.json"], &tokens))
+	require.Len(t, tokens, 1)
+	assert.Equal(t, []interface{}{"articles:read", "ratings:write"}, tokens[0]["scopes"])
+
+	var articles []article.Article
+	require.NoError(t, json.Unmarshal(files["articles.json"], &articles))
+	assert.Equal(t, "https://example.com/a", articles[0].URL)
+
+	// Secrets never leave.
+	for name, content := range files {
+		for _, secret := range []string{data.User.Password, data.User.TOTPSecret, "secret-hash"} {
+			assert.NotContains(t, string(content), secret, name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package account
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	repo Repository
+}
+
+func NewHandler(repo Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// ExportData handles GET /me/data-export, returning a ZIP archive of
+// everything stored about the user.
+func (h *Handler) ExportData(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	data, err := h.repo.Collect(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to collect data"})
+		return
+	}
+	// Built in memory so that a failure can still be reported as an error.
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+		return
+	}
+
+	filename := fmt.Sprintf("deeli-export-%d-%s.zip", userID, time.Now().UTC().Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
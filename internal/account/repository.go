@@ -0,0 +1,179 @@
+package account
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/comment"
+	"github.com/cheildo/deeli-api/internal/feed"
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"github.com/cheildo/deeli-api/internal/share"
+	"github.com/cheildo/deeli-api/internal/social"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Repository reads and erases everything stored about a user, across the
+// tables of the other packages.
+type Repository interface {
+	// DueForPurge returns the users whose deletion grace period is over.
+	DueForPurge(now time.Time) ([]uint, error)
+	// Purge erases the user and their data in one transaction.
+	Purge(userID uint) error
+	// Collect loads everything stored about the user for an export.
+	Collect(userID uint) (*Data, error)
+}
+
+// Data is everything stored about a user.
+type Data struct {
+	User                   user.User
+	Identities             []user.Identity
+	LoginFailures          []user.LoginFailure
+	Sessions               []auth.Session
+	PersonalAccessTokens   []auth.PersonalAccessToken
+	Articles               []article.Article
+	Ratings                []article.Rating
+	RecommendationFeedback []recommendation.Feedback
+	RecommendationEvents   []recommendation.Event
+	Following              []social.Follow
+	ShareLinks             []share.Link
+	Workspaces             []workspace.Membership
+	Comments               []comment.Comment
+	Feeds                  []feed.Feed
+	FeedTokens             []feed.Token
+}
+
+type repository struct{}
+
+func NewRepository() Repository {
+	return &repository{}
+}
+
+func (r *repository) DueForPurge(now time.Time) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Unscoped().Model(&user.User{}).
+		Where("delete_after IS NOT NULL AND delete_after <= ?", now).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// Purge hard-deletes, bypassing soft deletes, every row about the user.
+// Recommendation events are kept for aggregate statistics but detached from
+// the user. Other users' cached recommendations that include the user's
+// articles are marked stale first.
+//
+// Workspaces the user was the only member of go with their articles. Shared
+// workspaces keep the articles the user saved there, detached from them, and
+// if the user was their only owner the longest-standing member takes over.
+// The user's comments elsewhere are blanked rather than deleted so that the
+// replies to them still make sense.
+func (r *repository) Purge(userID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var account user.User
+		if err := tx.Unscoped().First(&account, userID).Error; err != nil {
+			return err
+		}
+		var soleWorkspaces []uint
+		err := tx.Table("workspace_members").
+			Where("workspace_id IN (?)", tx.Table("workspace_members").Select("workspace_id").Where("user_id = ?", userID)).
+			Group("workspace_id").
+			Having("count(*) = 1").
+			Pluck("workspace_id", &soleWorkspaces).Error
+		if err != nil {
+			return err
+		}
+		articles := tx.Unscoped().Model(&article.Article{}).Select("id").
+			Where("(user_id = ? AND workspace_id IS NULL) OR workspace_id IN ?", userID, soleWorkspaces)
+
+		statements := []struct {
+			sql  string
+			args []interface{}
+		}{
+			{`UPDATE cache_states SET stale = true WHERE user_id IN (
+				SELECT user_id FROM cached_recommendations WHERE article_id IN (?))`, []interface{}{articles}},
+			{"UPDATE cache_states SET stale = true WHERE user_id IN (SELECT follower_id FROM follows WHERE followee_id = ?)", []interface{}{userID}},
+			{"DELETE FROM cached_recommendations WHERE user_id = ? OR article_id IN (?)", []interface{}{userID, articles}},
+			{"DELETE FROM cache_states WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM feedbacks WHERE user_id = ? OR article_id IN (?)", []interface{}{userID, articles}},
+			{"UPDATE events SET user_id = 0 WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM ratings WHERE user_id = ? OR article_id IN (?)", []interface{}{userID, articles}},
+			{"DELETE FROM share_links WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM feed_entries WHERE feed_id IN (SELECT id FROM feeds WHERE user_id = ? OR workspace_id IN ?)", []interface{}{userID, soleWorkspaces}},
+			{"DELETE FROM feeds WHERE user_id = ? OR workspace_id IN ?", []interface{}{userID, soleWorkspaces}},
+			{"DELETE FROM feed_tokens WHERE user_id = ? OR workspace_id IN ?", []interface{}{userID, soleWorkspaces}},
+			{"DELETE FROM notifications WHERE user_id = ? OR actor_id = ? OR article_id IN (?)", []interface{}{userID, userID, articles}},
+			{"DELETE FROM comments WHERE article_id IN (?)", []interface{}{articles}},
+			{"UPDATE comments SET user_id = 0, body = '', removed_at = now() WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM share_links WHERE article_id IN (?)", []interface{}{articles}},
+			{"DELETE FROM articles WHERE id IN (?)", []interface{}{articles}},
+			{"UPDATE articles SET user_id = 0 WHERE user_id = ?", []interface{}{userID}},
+			{`UPDATE workspace_members SET role = ? WHERE id IN (
+				SELECT DISTINCT ON (workspace_id) id FROM workspace_members
+				WHERE user_id <> ?
+				AND workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = ? AND role = ?)
+				AND workspace_id NOT IN (SELECT workspace_id FROM workspace_members WHERE user_id <> ? AND role = ?)
+				ORDER BY workspace_id, created_at, id)`, []interface{}{workspace.RoleOwner, userID, userID, workspace.RoleOwner, userID, workspace.RoleOwner}},
+			{"DELETE FROM workspace_invitations WHERE workspace_id IN ? OR invited_by = ? OR lower(email) = ?", []interface{}{soleWorkspaces, userID, strings.ToLower(account.Email)}},
+			{"DELETE FROM workspace_members WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM workspaces WHERE id IN ?", []interface{}{soleWorkspaces}},
+			{"DELETE FROM refresh_tokens WHERE session_id IN (SELECT id FROM sessions WHERE user_id = ?)", []interface{}{userID}},
+			{"DELETE FROM sessions WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM personal_access_tokens WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM recovery_codes WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM identities WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM follows WHERE follower_id = ? OR followee_id = ?", []interface{}{userID, userID}},
+			{"DELETE FROM login_failures WHERE user_id = ? OR email = ?", []interface{}{userID, account.Email}},
+			{"DELETE FROM login_attempts WHERE key = ?", []interface{}{"account:" + strings.ToLower(account.Email)}},
+			{"DELETE FROM users WHERE id = ?", []interface{}{userID}},
+		}
+		for _, s := range statements {
+			if err := tx.Exec(s.sql, s.args...).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Collect includes soft-deleted rows, since we still hold them.
+func (r *repository) Collect(userID uint) (*Data, error) {
+	var data Data
+	if err := database.DB.Unscoped().First(&data.User, userID).Error; err != nil {
+		return nil, err
+	}
+	for _, dest := range []interface{}{
+		&data.Identities,
+		&data.LoginFailures,
+		&data.Sessions,
+		&data.PersonalAccessTokens,
+		&data.Articles,
+		&data.Ratings,
+		&data.RecommendationFeedback,
+		&data.RecommendationEvents,
+		&data.ShareLinks,
+		&data.Comments,
+		&data.Feeds,
+		&data.FeedTokens,
+	} {
+		if err := database.DB.Unscoped().Where("user_id = ?", userID).Order("id").Find(dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := database.DB.Where("follower_id = ?", userID).Order("id").Find(&data.Following).Error; err != nil {
+		return nil, err
+	}
+	err := database.DB.Model(&workspace.Workspace{}).
+		Select("workspaces.id, workspaces.name, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.id").
+		Scan(&data.Workspaces).Error
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
@@ -0,0 +1,43 @@
+package account
+
+import (
+	"log"
+	"time"
+)
+
+// Forgetter drops a purged user from data kept outside the database.
+type Forgetter interface {
+	ForgetUser(userID uint) error
+}
+
+// Purger erases accounts whose deletion grace period is over.
+type Purger struct {
+	repo      Repository
+	forgetter Forgetter
+}
+
+// NewPurger creates a purger that also has forgetter drop each purged user,
+// such as from the saved recommendation models.
+func NewPurger(repo Repository, forgetter Forgetter) *Purger {
+	return &Purger{repo: repo, forgetter: forgetter}
+}
+
+// PurgeDue erases every account due for deletion. It runs as a worker job;
+// an account that fails is retried on the next run.
+func (p *Purger) PurgeDue() {
+	ids, err := p.repo.DueForPurge(time.Now())
+	if err != nil {
+		log.Printf("Failed to find accounts to purge: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := p.repo.Purge(id); err != nil {
+			log.Printf("Failed to purge account %d: %v", id, err)
+			continue
+		}
+		if err := p.forgetter.ForgetUser(id); err != nil {
+			log.Printf("Failed to forget purged account %d: %v", id, err)
+		}
+		log.Printf("Purged account %d", id)
+	}
+}
@@ -0,0 +1,271 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/worker"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the /admin endpoints for managing users and their data.
+type Handler struct {
+	users    user.Repository
+	articles article.Repository
+	tokens   *auth.TokenService
+	worker   *worker.Worker
+}
+
+func NewHandler(users user.Repository, articles article.Repository, tokens *auth.TokenService, w *worker.Worker) *Handler {
+	return &Handler{users: users, articles: articles, tokens: tokens, worker: w}
+}
+
+// UserResponse is a user as admins see it.
+type UserResponse struct {
+	ID            uint       `json:"id"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	EmailVerified bool       `json:"email_verified"`
+	MFAEnabled    bool       `json:"mfa_enabled"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func newUserResponse(u *user.User) UserResponse {
+	return UserResponse{
+		ID:            u.ID,
+		Email:         u.Email,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerified(),
+		MFAEnabled:    u.MFAEnabled(),
+		DisabledAt:    u.DisabledAt,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+// ListUsers handles GET /admin/users. The optional q parameter searches
+// emails.
+func (h *Handler) ListUsers(c *gin.Context) {
+	page, limit := pagination(c)
+	users, total, err := h.users.ListUsers(c.Query("q"), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	response := make([]UserResponse, len(users))
+	for i := range users {
+		response[i] = newUserResponse(&users[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"users": response, "total": total, "page": page, "limit": limit})
+}
+
+// GetUser handles GET /admin/users/:id
+func (h *Handler) GetUser(c *gin.Context) {
+	target, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(target))
+}
+
+// DisableUser handles POST /admin/users/:id/disable. The user's sessions
+// are ended; their personal access tokens stop working while the account
+// is disabled.
+func (h *Handler) DisableUser(c *gin.Context) {
+	target, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	if target.ID == c.MustGet("userID").(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't disable your own account"})
+		return
+	}
+
+	if !target.Disabled() {
+		now := time.Now()
+		if err := h.users.SetDisabled(target.ID, &now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+			return
+		}
+		target.DisabledAt = &now
+	}
+	if _, err := h.tokens.RevokeAllSessions(target.ID); err != nil {
+		log.Printf("Failed to revoke sessions of disabled user %d: %v", target.ID, err)
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(target))
+}
+
+// EnableUser handles POST /admin/users/:id/enable
+func (h *Handler) EnableUser(c *gin.Context) {
+	target, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	if err := h.users.SetDisabled(target.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+		return
+	}
+	target.DisabledAt = nil
+
+	c.JSON(http.StatusOK, newUserResponse(target))
+}
+
+// SetRoleRequest defines the JSON for changing a user's role.
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SetRole handles PUT /admin/users/:id/role
+func (h *Handler) SetRole(c *gin.Context) {
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.Role})
+		return
+	}
+	target, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	// Otherwise the last admin could lock everyone out of the admin API.
+	if target.ID == c.MustGet("userID").(uint) && req.Role != auth.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't remove your own admin role"})
+		return
+	}
+
+	if err := h.users.SetRole(target.ID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	target.Role = req.Role
+
+	c.JSON(http.StatusOK, newUserResponse(target))
+}
+
+// GetUserArticles handles GET /admin/users/:id/articles, paginated like
+// GET /articles.
+func (h *Handler) GetUserArticles(c *gin.Context) {
+	target, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	page, limit := pagination(c)
+	articles, err := h.articles.GetArticlesByUserID(target.ID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve articles"})
+		return
+	}
+	c.JSON(http.StatusOK, articles)
+}
+
+// GetUserRatings handles GET /admin/users/:id/ratings
+func (h *Handler) GetUserRatings(c *gin.Context) {
+	target, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	ratings, err := h.articles.GetRatingsByUserID(target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ratings"})
+		return
+	}
+	c.JSON(http.StatusOK, ratings)
+}
+
+// RescrapeArticle handles POST /admin/articles/:id/rescrape. The article's
+// retries are reset and it is scraped again in the background.
+func (h *Handler) RescrapeArticle(c *gin.Context) {
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+	art, err := h.articles.GetArticleByID(uint(articleID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	art.Status = article.StatusPending
+	art.RetryCount = 0
+	if err := h.articles.UpdateArticle(art); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update article"})
+		return
+	}
+	scraped := *art
+	go article.Scrape(h.articles, &scraped)
+
+	c.JSON(http.StatusAccepted, art)
+}
+
+// GetWorkerStatus handles GET /admin/worker, reporting the background
+// jobs and the state of the scrape queue.
+func (h *Handler) GetWorkerStatus(c *gin.Context) {
+	counts, err := h.articles.CountArticlesByStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count articles"})
+		return
+	}
+	retrying, err := h.worker.RetryQueue()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count articles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": h.worker.Status(),
+		"articles": gin.H{
+			"pending":   counts[article.StatusPending],
+			"completed": counts[article.StatusCompleted],
+			"failed":    counts[article.StatusFailed],
+			"retrying":  retrying,
+		},
+	})
+}
+
+// targetUser loads the user named by the :id parameter, answering 400 or
+// 404 if there is none.
+func (h *Handler) targetUser(c *gin.Context) (*user.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	target, err := h.users.GetUserByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return target, true
+}
+
+func pagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
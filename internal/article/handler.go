@@ -1,27 +1,39 @@
 package article
 
 import (
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"github.com/cheildo/deeli-api/pkg/scraper"
+	"github.com/cheildo/deeli-api/internal/workspace"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// Memberships looks up users' roles in workspaces.
+type Memberships interface {
+	// MemberRole returns the user's role in the workspace, or
+	// gorm.ErrRecordNotFound if they aren't a member.
+	MemberRole(workspaceID, userID uint) (string, error)
+}
+
 // Handler holds the repository dependency.
 type Handler struct {
-	repo Repository
+	repo        Repository
+	memberships Memberships
 }
 
-func NewHandler(repo Repository) *Handler {
-	return &Handler{repo: repo}
+func NewHandler(repo Repository, memberships Memberships) *Handler {
+	return &Handler{repo: repo, memberships: memberships}
 }
 
 // CreateArticleRequest defines the expected JSON for creating an article.
+// With WorkspaceID the article is saved to the workspace instead of the
+// user's own library.
 type CreateArticleRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL         string `json:"url" binding:"required,url"`
+	Public      bool   `json:"public"`
+	WorkspaceID *uint  `json:"workspace_id"`
 }
 
 // CreateArticle handles POST /articles
@@ -33,42 +45,37 @@ func (h *Handler) CreateArticle(c *gin.Context) {
 	}
 
 	userID := c.MustGet("userID").(uint)
+	if req.WorkspaceID != nil {
+		if req.Public {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Workspace articles can't be public"})
+			return
+		}
+		if !h.requireRole(c, *req.WorkspaceID, userID, workspace.RoleEditor) {
+			return
+		}
+	}
 
 	article := &Article{
-		URL:    req.URL,
-		UserID: userID,
-		Status: StatusPending,
+		URL:         req.URL,
+		UserID:      userID,
+		WorkspaceID: req.WorkspaceID,
+		Status:      StatusPending,
+		Public:      req.Public,
 	}
 
 	if err := h.repo.CreateArticle(article); err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Article from this URL already exists for this user"})
+		c.JSON(http.StatusConflict, gin.H{"error": "Article from this URL already exists in this library"})
 		return
 	}
 
 	// Start scraping in a background goroutine so the API returns immediately.
-	go func() {
-		log.Printf("Starting initial scrape for article ID %d", article.ID)
-		scrapedData, err := scraper.ScrapeMetadata(article.URL)
-		if err != nil {
-			log.Printf("Scrape failed for article ID %d: %v", article.ID, err)
-			article.Status = StatusFailed
-		} else {
-			article.Title = scrapedData.Title
-			article.Description = scrapedData.Description
-			article.ImageURL = scrapedData.ImageURL
-			article.Status = StatusCompleted
-		}
-
-		if err := h.repo.UpdateArticle(article); err != nil {
-			log.Printf("Failed to update article ID %d after scrape: %v", article.ID, err)
-		}
-		log.Printf("Finished initial scrape for article ID %d with status %s", article.ID, article.Status)
-	}()
+	go Scrape(h.repo, article)
 
 	c.JSON(http.StatusAccepted, article)
 }
 
-// GetArticles handles GET /articles
+// GetArticles handles GET /articles. It lists the user's own library, or a
+// workspace's with ?workspace_id=, optionally searched with ?q=.
 func (h *Handler) GetArticles(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 
@@ -84,7 +91,21 @@ func (h *Handler) GetArticles(c *gin.Context) {
 		limit = 10
 	}
 
-	articles, err := h.repo.GetArticlesByUserID(userID, page, limit)
+	filter := ListFilter{Query: strings.TrimSpace(c.Query("q"))}
+	if raw := c.Query("workspace_id"); raw != "" {
+		workspaceID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+			return
+		}
+		if !h.requireRole(c, uint(workspaceID), userID, workspace.RoleViewer) {
+			return
+		}
+		id := uint(workspaceID)
+		filter.WorkspaceID = &id
+	}
+
+	articles, err := h.repo.ListArticles(userID, filter, page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve articles"})
 		return
@@ -114,6 +135,44 @@ func (h *Handler) DeleteArticle(c *gin.Context) {
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// UpdateArticleRequest defines the JSON for changing an article. Only its
+// visibility can be changed; the rest comes from the page.
+type UpdateArticleRequest struct {
+	Public *bool `json:"public" binding:"required"`
+}
+
+// UpdateArticle handles PATCH /articles/:id
+func (h *Handler) UpdateArticle(c *gin.Context) {
+	var req UpdateArticleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	if err := h.repo.SetArticlePublic(uint(articleID), userID, *req.Public); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found in your library"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update article"})
+		return
+	}
+
+	article, err := h.repo.GetAccessibleArticle(uint(articleID), userID, AccessRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, article)
+}
+
 // RateArticleRequest defines the JSON for rating an article.
 type RateArticleRequest struct {
 	Score int `json:"score" binding:"required,min=1,max=5"`
@@ -134,9 +193,9 @@ func (h *Handler) RateArticle(c *gin.Context) {
 		return
 	}
 
-	if _, err := h.repo.GetArticleByIDAndUserID(uint(articleID), userID); err != nil {
+	if _, err := h.repo.GetAccessibleArticle(uint(articleID), userID, AccessRead); err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found or you don't own it"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -199,3 +258,66 @@ func (h *Handler) DeleteRating(c *gin.Context) {
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// RatingResponse is one member's rating of a shared article.
+type RatingResponse struct {
+	UserID uint `json:"user_id"`
+	Score  int  `json:"score"`
+}
+
+// GetArticleRatings handles GET /articles/:id/ratings, listing everyone's
+// ratings of an article the user can see. In a workspace these are the
+// members' ratings.
+func (h *Handler) GetArticleRatings(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	if _, err := h.repo.GetAccessibleArticle(uint(articleID), userID, AccessRead); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	ratings, err := h.repo.GetArticleRatings(uint(articleID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ratings"})
+		return
+	}
+	response := make([]RatingResponse, len(ratings))
+	total := 0
+	for i, rating := range ratings {
+		response[i] = RatingResponse{UserID: rating.UserID, Score: rating.Score}
+		total += rating.Score
+	}
+	average := 0.0
+	if len(ratings) > 0 {
+		average = float64(total) / float64(len(ratings))
+	}
+	c.JSON(http.StatusOK, gin.H{"ratings": response, "average": average})
+}
+
+// requireRole answers 404 unless the user is a member of the workspace and
+// 403 unless their role is at least want.
+func (h *Handler) requireRole(c *gin.Context, workspaceID, userID uint, want string) bool {
+	role, err := h.memberships.MemberRole(workspaceID, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !workspace.HasRole(role, want) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This requires the " + want + " role in the workspace"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package article
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// roles is a Memberships backed by a map of user roles per workspace.
+type roles map[uint]map[uint]string
+
+func (r roles) MemberRole(workspaceID, userID uint) (string, error) {
+	if role, ok := r[workspaceID][userID]; ok {
+		return role, nil
+	}
+	return "", gorm.ErrRecordNotFound
+}
+
+func TestWorkspaceArticleAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const owner, editor, viewer, outsider = 1, 2, 3, 4
+	workspaceID := uint(7)
+	members := roles{workspaceID: {owner: workspace.RoleOwner, editor: workspace.RoleEditor, viewer: workspace.RoleViewer}}
+	repo := NewMemoryRepositoryWithMemberships(members)
+	require.NoError(t, repo.CreateArticle(&Article{Model: gorm.Model{ID: 1}, UserID: owner, WorkspaceID: &workspaceID, URL: "https://example.com/team"}))
+	require.NoError(t, repo.CreateArticle(&Article{Model: gorm.Model{ID: 2}, UserID: outsider, URL: "https://example.com/own"}))
+
+	h := NewHandler(repo, members)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 32)
+		c.Set("userID", uint(id))
+	})
+	r.GET("/articles", h.GetArticles)
+	r.POST("/articles/:id/rate", h.RateArticle)
+	r.GET("/articles/:id/ratings", h.GetArticleRatings)
+	r.DELETE("/articles/:id", h.DeleteArticle)
+	call := func(userID uint, method, path, body string) int {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", fmt.Sprint(userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, tc := range []struct {
+		name     string
+		userID   uint
+		list     int
+		read     int
+		rate     int
+		deletion int
+	}{
+		{"outsider", outsider, http.StatusNotFound, http.StatusNotFound, http.StatusNotFound, http.StatusNotFound},
+		{"viewer", viewer, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNotFound},
+		{"editor", editor, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.list, call(tc.userID, "GET", "/articles?workspace_id=7", ""))
+			assert.Equal(t, tc.read, call(tc.userID, "GET", "/articles/1/ratings", ""))
+			assert.Equal(t, tc.rate, call(tc.userID, "POST", "/articles/1/rate", `{"score": 4}`))
+			assert.Equal(t, tc.deletion, call(tc.userID, "DELETE", "/articles/1", ""))
+		})
+	}
+
+	// Workspace roles grant nothing in other users' own libraries.
+	assert.Equal(t, http.StatusNotFound, call(owner, "GET", "/articles/2/ratings", ""))
+	assert.Equal(t, http.StatusNotFound, call(owner, "DELETE", "/articles/2", ""))
+}
+
+func TestSavedArticlesLeaveOutFormerWorkspaces(t *testing.T) {
+	const member, other = 1, 2
+	workspaceID := uint(7)
+	members := roles{workspaceID: {member: workspace.RoleEditor}}
+	repo := NewMemoryRepositoryWithMemberships(members)
+	require.NoError(t, repo.CreateArticle(&Article{Model: gorm.Model{ID: 1}, UserID: member, URL: "https://example.com/own"}))
+	require.NoError(t, repo.CreateArticle(&Article{Model: gorm.Model{ID: 2}, UserID: member, WorkspaceID: &workspaceID, URL: "https://example.com/saved-to-team"}))
+	require.NoError(t, repo.CreateArticle(&Article{Model: gorm.Model{ID: 3}, UserID: other, WorkspaceID: &workspaceID, URL: "https://example.com/team"}))
+	require.NoError(t, repo.CreateArticle(&Article{Model: gorm.Model{ID: 4}, UserID: other, URL: "https://example.com/public", Public: true}))
+	for _, id := range []uint{3, 4} {
+		require.NoError(t, repo.CreateOrUpdateRating(&Rating{UserID: member, ArticleID: id, Score: 4}))
+	}
+
+	saved, err := repo.GetArticleIDsSavedByUser(member)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1, 2, 3, 4}, saved)
+	articles, err := repo.GetArticlesByUserID(member, 1, 10)
+	require.NoError(t, err)
+	assert.Len(t, articles, 2)
+
+	delete(members[workspaceID], member)
+	saved, err = repo.GetArticleIDsSavedByUser(member)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1, 4}, saved)
+	articles, err = repo.GetArticlesByUserID(member, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+	assert.Equal(t, uint(1), articles[0].ID)
+}
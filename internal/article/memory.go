@@ -0,0 +1,557 @@
+package article
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ratingKey struct {
+	userID    uint
+	articleID uint
+}
+
+// memoryRepository is an in-memory Repository for tools and tests that run
+// without a database. Results are returned in ID order so that callers see
+// the same output for the same input. Without memberships it knows nothing
+// of workspace members, so workspace articles are only reachable through the
+// workspace listings, which trust the caller to have checked membership.
+type memoryRepository struct {
+	mu            sync.RWMutex
+	memberships   Memberships
+	nextArticleID uint
+	nextRatingID  uint
+	articles      map[uint]*Article
+	ratings       []*Rating // in ID order
+	ratingIndex   map[ratingKey]*Rating
+}
+
+// NewMemoryRepository creates an empty in-memory Repository. Articles created
+// with a non-zero ID keep it, mirroring an explicit-ID insert.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		articles:    make(map[uint]*Article),
+		ratingIndex: make(map[ratingKey]*Rating),
+	}
+}
+
+// NewMemoryRepositoryWithMemberships creates an empty in-memory Repository
+// that grants access to workspace articles by the roles in memberships, as
+// the database does.
+func NewMemoryRepositoryWithMemberships(memberships Memberships) Repository {
+	r := NewMemoryRepository().(*memoryRepository)
+	r.memberships = memberships
+	return r
+}
+
+func (r *memoryRepository) CreateArticle(article *Article) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range r.articles {
+		if a.URL == article.URL && sameLibrary(a, article) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if article.ID == 0 {
+		r.nextArticleID++
+		for r.articles[r.nextArticleID] != nil {
+			r.nextArticleID++
+		}
+		article.ID = r.nextArticleID
+	} else if r.articles[article.ID] != nil {
+		return gorm.ErrDuplicatedKey
+	}
+	now := time.Now()
+	if article.CreatedAt.IsZero() {
+		article.CreatedAt = now
+	}
+	article.UpdatedAt = now
+	if article.Status == "" {
+		article.Status = StatusPending
+	}
+	stored := *article
+	r.articles[article.ID] = &stored
+	return nil
+}
+
+func (r *memoryRepository) GetArticlesByUserID(userID uint, page, limit int) ([]Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var articles []Article
+	for _, a := range r.articles {
+		if a.UserID != userID {
+			continue
+		}
+		ok, err := r.allows(a, userID, AccessRead)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			articles = append(articles, *a)
+		}
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		if !articles[i].CreatedAt.Equal(articles[j].CreatedAt) {
+			return articles[i].CreatedAt.After(articles[j].CreatedAt)
+		}
+		return articles[i].ID > articles[j].ID
+	})
+	offset := (page - 1) * limit
+	if offset >= len(articles) {
+		return []Article{}, nil
+	}
+	end := offset + limit
+	if end > len(articles) {
+		end = len(articles)
+	}
+	return articles[offset:end], nil
+}
+
+// sameLibrary reports whether two articles were saved to the same library.
+func sameLibrary(a, b *Article) bool {
+	if a.WorkspaceID == nil || b.WorkspaceID == nil {
+		return a.WorkspaceID == nil && b.WorkspaceID == nil && a.UserID == b.UserID
+	}
+	return *a.WorkspaceID == *b.WorkspaceID
+}
+
+// ownedBy reports whether the article is in the user's own library.
+func ownedBy(a *Article, userID uint) bool {
+	return a.WorkspaceID == nil && a.UserID == userID
+}
+
+// allows reports whether the user has the access to the article: it is in
+// their own library, or in a workspace where their role grants it.
+func (r *memoryRepository) allows(a *Article, userID uint, access Access) (bool, error) {
+	if ownedBy(a, userID) {
+		return true, nil
+	}
+	if a.WorkspaceID == nil || r.memberships == nil {
+		return false, nil
+	}
+	role, err := r.memberships.MemberRole(*a.WorkspaceID, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, granted := range access.roles() {
+		if role == granted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) ListArticles(userID uint, filter ListFilter, page, limit int) ([]Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	var articles []Article
+	for _, a := range r.articles {
+		if filter.WorkspaceID != nil {
+			if a.WorkspaceID == nil || *a.WorkspaceID != *filter.WorkspaceID {
+				continue
+			}
+			if r.memberships != nil {
+				if ok, err := r.allows(a, userID, AccessRead); err != nil {
+					return nil, err
+				} else if !ok {
+					continue
+				}
+			}
+		} else if !ownedBy(a, userID) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(a.Title), query) &&
+			!strings.Contains(strings.ToLower(a.Description), query) &&
+			!strings.Contains(strings.ToLower(a.URL), query) {
+			continue
+		}
+		articles = append(articles, *a)
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		if !articles[i].CreatedAt.Equal(articles[j].CreatedAt) {
+			return articles[i].CreatedAt.After(articles[j].CreatedAt)
+		}
+		return articles[i].ID > articles[j].ID
+	})
+	offset := (page - 1) * limit
+	if offset >= len(articles) {
+		return []Article{}, nil
+	}
+	end := offset + limit
+	if end > len(articles) {
+		end = len(articles)
+	}
+	return articles[offset:end], nil
+}
+
+func (r *memoryRepository) GetAccessibleArticle(articleID, userID uint, access Access) (*Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.articles[articleID]
+	if !ok {
+		return &Article{}, gorm.ErrRecordNotFound
+	}
+	if ok, err := r.allows(a, userID, access); err != nil {
+		return &Article{}, err
+	} else if !ok {
+		return &Article{}, gorm.ErrRecordNotFound
+	}
+	found := *a
+	return &found, nil
+}
+
+func (r *memoryRepository) GetArticleByID(articleID uint) (*Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.articles[articleID]
+	if !ok {
+		return &Article{}, gorm.ErrRecordNotFound
+	}
+	found := *a
+	return &found, nil
+}
+
+func (r *memoryRepository) UpdateArticle(article *Article) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	article.UpdatedAt = time.Now()
+	stored := *article
+	if existing, ok := r.articles[article.ID]; ok {
+		stored.Public = existing.Public
+	}
+	r.articles[article.ID] = &stored
+	return nil
+}
+
+func (r *memoryRepository) SetArticlePublic(articleID, userID uint, public bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.articles[articleID]
+	if !ok || !ownedBy(a, userID) {
+		return gorm.ErrRecordNotFound
+	}
+	a.Public = public
+	a.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryRepository) DeleteArticle(articleID, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.articles[articleID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if ok, err := r.allows(a, userID, AccessWrite); err != nil {
+		return err
+	} else if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.articles, articleID)
+	return nil
+}
+
+func (r *memoryRepository) GetFailedArticlesToRetry(maxRetries int) ([]Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var articles []Article
+	for _, a := range r.sortedArticles() {
+		if a.Status == StatusFailed && a.RetryCount < maxRetries {
+			articles = append(articles, *a)
+		}
+	}
+	return articles, nil
+}
+
+func (r *memoryRepository) CreateOrUpdateRating(rating *Rating) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := ratingKey{userID: rating.UserID, articleID: rating.ArticleID}
+	if existing, ok := r.ratingIndex[key]; ok {
+		existing.Score = rating.Score
+		existing.UpdatedAt = time.Now()
+		rating.ID = existing.ID
+		return nil
+	}
+	r.nextRatingID++
+	rating.ID = r.nextRatingID
+	if rating.CreatedAt.IsZero() {
+		rating.CreatedAt = time.Now()
+	}
+	rating.UpdatedAt = rating.CreatedAt
+	stored := *rating
+	r.ratings = append(r.ratings, &stored)
+	r.ratingIndex[key] = &stored
+	return nil
+}
+
+func (r *memoryRepository) GetRating(articleID, userID uint) (*Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rating, ok := r.ratingIndex[ratingKey{userID: userID, articleID: articleID}]
+	if !ok {
+		return &Rating{}, gorm.ErrRecordNotFound
+	}
+	found := *rating
+	return &found, nil
+}
+
+func (r *memoryRepository) DeleteRating(articleID, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := ratingKey{userID: userID, articleID: articleID}
+	rating, ok := r.ratingIndex[key]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.ratingIndex, key)
+	for i, stored := range r.ratings {
+		if stored == rating {
+			r.ratings = append(r.ratings[:i], r.ratings[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) GetArticleRatings(articleID uint) ([]Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ratings := []Rating{}
+	for _, rating := range r.ratings {
+		if rating.ArticleID == articleID {
+			ratings = append(ratings, *rating)
+		}
+	}
+	return ratings, nil
+}
+
+// GetWorkspaceRatings returns every rating of the workspace's articles, as
+// if all raters were still members.
+func (r *memoryRepository) GetWorkspaceRatings(workspaceID uint) ([]Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ratings := []Rating{}
+	for _, rating := range r.ratings {
+		if a, ok := r.articles[rating.ArticleID]; ok && a.WorkspaceID != nil && *a.WorkspaceID == workspaceID {
+			ratings = append(ratings, *rating)
+		}
+	}
+	return ratings, nil
+}
+
+func (r *memoryRepository) GetHighlyRatedArticleIDsForUser(userID uint, minScore int) ([]uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	articleIDs := []uint{}
+	for _, rating := range r.ratings {
+		if rating.UserID == userID && rating.Score >= minScore {
+			articleIDs = append(articleIDs, rating.ArticleID)
+		}
+	}
+	return articleIDs, nil
+}
+
+func (r *memoryRepository) FindPeerUsers(userID uint, articleIDs []uint, minScore int) ([]uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(articleIDs))
+	for _, id := range articleIDs {
+		wanted[id] = true
+	}
+	seen := make(map[uint]bool)
+	peerIDs := []uint{}
+	for _, rating := range r.ratings {
+		if rating.UserID != userID && wanted[rating.ArticleID] && rating.Score >= minScore && !seen[rating.UserID] {
+			seen[rating.UserID] = true
+			peerIDs = append(peerIDs, rating.UserID)
+		}
+	}
+	sort.Slice(peerIDs, func(i, j int) bool { return peerIDs[i] < peerIDs[j] })
+	return peerIDs, nil
+}
+
+func (r *memoryRepository) GetHighlyRatedArticlesByUsers(userIDs []uint, minScore int) ([]Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+	ratings := []Rating{}
+	for _, rating := range r.ratings {
+		if wanted[rating.UserID] && rating.Score >= minScore && r.personal(rating.ArticleID) {
+			ratings = append(ratings, *rating)
+		}
+	}
+	return ratings, nil
+}
+
+func (r *memoryRepository) GetHighlyRatedVisibleArticles(viewerID uint, userIDs []uint, minScore int) ([]Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+	ratings := []Rating{}
+	for _, rating := range r.ratings {
+		a, ok := r.articles[rating.ArticleID]
+		if !ok || !wanted[rating.UserID] || rating.Score < minScore {
+			continue
+		}
+		if visible, err := r.allows(a, viewerID, AccessRead); err != nil {
+			return nil, err
+		} else if visible {
+			ratings = append(ratings, *rating)
+		}
+	}
+	return ratings, nil
+}
+
+func (r *memoryRepository) GetArticleIDsSavedByUser(userID uint) ([]uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	saved := make(map[uint]bool)
+	for _, a := range r.articles {
+		if a.UserID == userID {
+			saved[a.ID] = true
+		}
+	}
+	for _, rating := range r.ratings {
+		if rating.UserID == userID {
+			saved[rating.ArticleID] = true
+		}
+	}
+	articleIDs := make([]uint, 0, len(saved))
+	for id := range saved {
+		a, ok := r.articles[id]
+		if !ok {
+			continue
+		}
+		if a.WorkspaceID != nil {
+			member, err := r.allows(a, userID, AccessRead)
+			if err != nil {
+				return nil, err
+			}
+			if !member {
+				continue
+			}
+		}
+		articleIDs = append(articleIDs, id)
+	}
+	sort.Slice(articleIDs, func(i, j int) bool { return articleIDs[i] < articleIDs[j] })
+	return articleIDs, nil
+}
+
+func (r *memoryRepository) GetArticlesByIDs(articleIDs []uint) ([]Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	articles := []Article{}
+	for _, id := range articleIDs {
+		if a, ok := r.articles[id]; ok {
+			articles = append(articles, *a)
+		}
+	}
+	return articles, nil
+}
+
+func (r *memoryRepository) GetAllRatings() ([]Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ratings := make([]Rating, 0, len(r.ratings))
+	for _, rating := range r.ratings {
+		if r.personal(rating.ArticleID) {
+			ratings = append(ratings, *rating)
+		}
+	}
+	return ratings, nil
+}
+
+// personal reports whether the article exists and is outside any workspace.
+// Callers must hold the lock.
+func (r *memoryRepository) personal(articleID uint) bool {
+	a, ok := r.articles[articleID]
+	return ok && a.WorkspaceID == nil
+}
+
+// sortedArticles returns the stored articles in ID order. Callers must hold the lock.
+func (r *memoryRepository) sortedArticles() []*Article {
+	articles := make([]*Article, 0, len(r.articles))
+	for _, a := range r.articles {
+		articles = append(articles, a)
+	}
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+	return articles
+}
+
+func (r *memoryRepository) FilterVisibleArticleIDs(userID uint, articleIDs []uint) ([]uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	visible := []uint{}
+	for _, id := range articleIDs {
+		a, ok := r.articles[id]
+		if !ok {
+			continue
+		}
+		if ok, err := r.allows(a, userID, AccessRead); err != nil {
+			return nil, err
+		} else if ok {
+			visible = append(visible, id)
+		}
+	}
+	return visible, nil
+}
+
+func (r *memoryRepository) GetRatingsByUserID(userID uint) ([]Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ratings []Rating
+	for _, rating := range r.ratings {
+		if rating.UserID == userID {
+			ratings = append(ratings, *rating)
+		}
+	}
+	return ratings, nil
+}
+
+func (r *memoryRepository) CountArticlesByStatus() (map[ArticleStatus]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[ArticleStatus]int64)
+	for _, a := range r.articles {
+		counts[a.Status]++
+	}
+	return counts, nil
+}
@@ -1,6 +1,9 @@
 package article
 
 import (
+	"net/url"
+	"strings"
+
 	"gorm.io/gorm"
 )
 
@@ -13,16 +16,35 @@ const (
 	StatusFailed    ArticleStatus = "failed"
 )
 
-// Article represents a saved link by a user.
+// Article represents a link saved by a user, either to their own library or
+// to a workspace they belong to. A URL is saved once per library.
 type Article struct {
 	gorm.Model
-	URL         string `gorm:"uniqueIndex:idx_user_url;not null"`
+	URL         string `gorm:"uniqueIndex:idx_user_url_personal,where:workspace_id IS NULL;uniqueIndex:idx_workspace_url,where:workspace_id IS NOT NULL;not null"`
 	Title       string
 	Description string
 	ImageURL    string
-	Status      ArticleStatus `gorm:"default:'pending';index"`
-	RetryCount  int           `gorm:"default:0"`
-	UserID      uint          `gorm:"uniqueIndex:idx_user_url;not null"`
+	// Content is the text extracted from the page. It is left out of the
+	// article's JSON to keep lists small, and served through share links.
+	Content    string        `gorm:"type:text" json:"-"`
+	Status     ArticleStatus `gorm:"default:'pending';index"`
+	RetryCount int           `gorm:"default:0"`
+	// UserID is the user who saved the article. In a workspace it is kept
+	// for attribution; access comes from the workspace's members.
+	UserID      uint  `gorm:"uniqueIndex:idx_user_url_personal,where:workspace_id IS NULL;not null"`
+	WorkspaceID *uint `gorm:"uniqueIndex:idx_workspace_url,where:workspace_id IS NOT NULL"`
+	// Public articles show up in the feeds of the user's followers.
+	Public bool `gorm:"not null;default:false"`
+}
+
+// Domain returns the article's host name without a leading "www.",
+// or an empty string if the URL cannot be parsed.
+func (a *Article) Domain() string {
+	u, err := url.Parse(a.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
 }
 
 // Rating represents a user's rating for a specific article.
@@ -1,50 +1,169 @@
 package article
 
 import (
+	"strings"
+
+	"github.com/cheildo/deeli-api/internal/workspace"
 	"github.com/cheildo/deeli-api/pkg/database"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// Access is what a user wants to do with an article. Users have full access
+// to their own library; in a workspace, viewers can read and rate articles
+// and editors can also change and delete them.
+type Access int
+
+const (
+	AccessRead Access = iota
+	AccessWrite
+)
+
+// roles returns the workspace roles that grant the access.
+func (a Access) roles() []string {
+	if a == AccessWrite {
+		return workspace.RolesAtLeast(workspace.RoleEditor)
+	}
+	return workspace.RolesAtLeast(workspace.RoleViewer)
+}
+
+// ListFilter narrows a listing of articles.
+type ListFilter struct {
+	// WorkspaceID lists the workspace's articles instead of the user's own.
+	WorkspaceID *uint
+	// Query matches the title, description or URL, ignoring case.
+	Query string
+}
+
 // Repository defines the interface for article and rating database operations.
 type Repository interface {
 	CreateArticle(article *Article) error
+	// GetArticlesByUserID returns the articles the user saved, in their own
+	// library or in workspaces they can still read.
 	GetArticlesByUserID(userID uint, page, limit int) ([]Article, error)
-	GetArticleByIDAndUserID(articleID, userID uint) (*Article, error)
+	// ListArticles returns the user's library, or with filter.WorkspaceID a
+	// workspace's library if the user is a member.
+	ListArticles(userID uint, filter ListFilter, page, limit int) ([]Article, error)
+	// GetAccessibleArticle returns the article if the user has the access
+	// to it, and gorm.ErrRecordNotFound otherwise.
+	GetAccessibleArticle(articleID, userID uint, access Access) (*Article, error)
 	GetArticleByID(articleID uint) (*Article, error)
+	// UpdateArticle saves the article, except its visibility.
 	UpdateArticle(article *Article) error
+	// SetArticlePublic changes the visibility of an article in the user's
+	// own library. Workspace articles can't be made public.
+	SetArticlePublic(articleID, userID uint, public bool) error
+	// DeleteArticle deletes an article the user has write access to.
 	DeleteArticle(articleID, userID uint) error
 	GetFailedArticlesToRetry(maxRetries int) ([]Article, error)
 	CreateOrUpdateRating(rating *Rating) error
 	GetRating(articleID, userID uint) (*Rating, error)
 	DeleteRating(articleID, userID uint) error
+	// GetArticleRatings returns every rating of the article.
+	GetArticleRatings(articleID uint) ([]Rating, error)
+	// GetWorkspaceRatings returns the ratings that the workspace's members
+	// gave its articles.
+	GetWorkspaceRatings(workspaceID uint) ([]Rating, error)
 	GetHighlyRatedArticleIDsForUser(userID uint, minScore int) ([]uint, error)
 	FindPeerUsers(userID uint, articleIDs []uint, minScore int) ([]uint, error)
+	// GetHighlyRatedArticlesByUsers returns the users' ratings of at least
+	// minScore of personal articles. Workspace articles are left out, since
+	// they are only visible to the workspace's members.
 	GetHighlyRatedArticlesByUsers(userIDs []uint, minScore int) ([]Rating, error)
+	// GetHighlyRatedVisibleArticles returns the users' ratings of at least
+	// minScore of articles the viewer can see, workspace articles included.
+	GetHighlyRatedVisibleArticles(viewerID uint, userIDs []uint, minScore int) ([]Rating, error)
+	// GetArticleIDsSavedByUser returns the articles the user owns or has
+	// rated, which recommendations leave out since the user has seen them.
+	// Articles of workspaces the user has left aren't included.
 	GetArticleIDsSavedByUser(userID uint) ([]uint, error)
 	GetArticlesByIDs(articleIDs []uint) ([]Article, error)
+	// GetAllRatings returns every rating of a personal article, for training
+	// models that recommend across users. Workspace articles are left out, as
+	// in GetHighlyRatedArticlesByUsers.
+	GetAllRatings() ([]Rating, error)
+	FilterVisibleArticleIDs(userID uint, articleIDs []uint) ([]uint, error)
+	GetRatingsByUserID(userID uint) ([]Rating, error)
+	CountArticlesByStatus() (map[ArticleStatus]int64, error)
+}
+
+// ActivityObserver is notified after a user saves or deletes an article, or
+// rates or unrates one, so that data derived from ratings can be refreshed.
+type ActivityObserver interface {
+	ArticleActivity(userID, articleID uint)
 }
 
-type repository struct{}
+type repository struct {
+	observers []ActivityObserver
+}
 
-func NewRepository() Repository {
-	return &repository{}
+// NewRepository creates a Repository that notifies the given observers of
+// saves, deletions and rating changes.
+func NewRepository(observers ...ActivityObserver) Repository {
+	return &repository{observers: observers}
+}
+
+func (r *repository) notify(userID, articleID uint) {
+	for _, o := range r.observers {
+		o.ArticleActivity(userID, articleID)
+	}
 }
 
 func (r *repository) CreateArticle(article *Article) error {
-	return database.DB.Create(article).Error
+	if err := database.DB.Create(article).Error; err != nil {
+		return err
+	}
+	r.notify(article.UserID, article.ID)
+	return nil
+}
+
+// AccessibleTo limits a query to the articles the user has the access to:
+// their own library and the workspaces where their role grants it. Other
+// packages use it when joining articles into their own queries.
+func AccessibleTo(userID uint, access Access) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("((articles.workspace_id IS NULL AND articles.user_id = ?) OR articles.workspace_id IN (?))", userID, memberWorkspaces(userID, access))
+	}
+}
+
+// memberWorkspaces selects the workspaces where the user's role grants the
+// access.
+func memberWorkspaces(userID uint, access Access) *gorm.DB {
+	return database.DB.Table("workspace_members").
+		Select("workspace_id").
+		Where("user_id = ? AND role IN ?", userID, access.roles())
 }
 
 func (r *repository) GetArticlesByUserID(userID uint, page, limit int) ([]Article, error) {
 	var articles []Article
 	offset := (page - 1) * limit
-	err := database.DB.Where("user_id = ?", userID).Order("created_at desc").Offset(offset).Limit(limit).Find(&articles).Error
+	err := database.DB.Scopes(AccessibleTo(userID, AccessRead)).
+		Where("articles.user_id = ?", userID).
+		Order("created_at desc").Offset(offset).Limit(limit).Find(&articles).Error
+	return articles, err
+}
+
+func (r *repository) ListArticles(userID uint, filter ListFilter, page, limit int) ([]Article, error) {
+	db := database.DB.Scopes(AccessibleTo(userID, AccessRead))
+	if filter.WorkspaceID != nil {
+		db = db.Where("articles.workspace_id = ?", *filter.WorkspaceID)
+	} else {
+		db = db.Where("articles.workspace_id IS NULL")
+	}
+	if filter.Query != "" {
+		// Escape LIKE wildcards so the query matches literally.
+		escaped := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Query) + "%"
+		db = db.Where("(articles.title ILIKE ? OR articles.description ILIKE ? OR articles.url ILIKE ?)", escaped, escaped, escaped)
+	}
+
+	var articles []Article
+	err := db.Order("created_at desc, id desc").Offset((page - 1) * limit).Limit(limit).Find(&articles).Error
 	return articles, err
 }
 
-func (r *repository) GetArticleByIDAndUserID(articleID, userID uint) (*Article, error) {
+func (r *repository) GetAccessibleArticle(articleID, userID uint, access Access) (*Article, error) {
 	var article Article
-	err := database.DB.Where("id = ? AND user_id = ?", articleID, userID).First(&article).Error
+	err := database.DB.Scopes(AccessibleTo(userID, access)).Where("articles.id = ?", articleID).First(&article).Error
 	return &article, err
 }
 
@@ -54,18 +173,34 @@ func (r *repository) GetArticleByID(articleID uint) (*Article, error) {
 	return &article, err
 }
 
+// UpdateArticle leaves the public flag alone so that a scrape finishing
+// after the user changed it doesn't undo the change.
 func (r *repository) UpdateArticle(article *Article) error {
-	return database.DB.Save(article).Error
+	return database.DB.Omit("public").Save(article).Error
+}
+
+func (r *repository) SetArticlePublic(articleID, userID uint, public bool) error {
+	result := database.DB.Model(&Article{}).
+		Where("id = ? AND user_id = ? AND workspace_id IS NULL", articleID, userID).
+		Update("public", public)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 func (r *repository) DeleteArticle(articleID, userID uint) error {
-	result := database.DB.Where("id = ? AND user_id = ?", articleID, userID).Delete(&Article{})
+	result := database.DB.Scopes(AccessibleTo(userID, AccessWrite)).Where("articles.id = ?", articleID).Delete(&Article{})
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound // No article found with that ID for that user
+		return gorm.ErrRecordNotFound // No article found with that ID that the user may delete
 	}
+	r.notify(userID, articleID)
 	return nil
 }
 
@@ -78,10 +213,15 @@ func (r *repository) GetFailedArticlesToRetry(maxRetries int) ([]Article, error)
 // This will INSERT a new rating, or if a rating with the same
 // user_id and article_id already exists, it will UPDATE the score.
 func (r *repository) CreateOrUpdateRating(rating *Rating) error {
-	return database.DB.Clauses(clause.OnConflict{
+	err := database.DB.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "user_id"}, {Name: "article_id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"score"}),
+		DoUpdates: clause.AssignmentColumns([]string{"score", "updated_at"}),
 	}).Create(rating).Error
+	if err != nil {
+		return err
+	}
+	r.notify(rating.UserID, rating.ArticleID)
+	return nil
 }
 
 func (r *repository) GetRating(articleID, userID uint) (*Rating, error) {
@@ -98,9 +238,27 @@ func (r *repository) DeleteRating(articleID, userID uint) error {
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
+	r.notify(userID, articleID)
 	return nil
 }
 
+func (r *repository) GetArticleRatings(articleID uint) ([]Rating, error) {
+	var ratings []Rating
+	err := database.DB.Where("article_id = ?", articleID).Order("id").Find(&ratings).Error
+	return ratings, err
+}
+
+func (r *repository) GetWorkspaceRatings(workspaceID uint) ([]Rating, error) {
+	var ratings []Rating
+	err := database.DB.
+		Joins("JOIN articles ON articles.id = ratings.article_id AND articles.deleted_at IS NULL").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = articles.workspace_id AND workspace_members.user_id = ratings.user_id").
+		Where("articles.workspace_id = ?", workspaceID).
+		Order("ratings.id").
+		Find(&ratings).Error
+	return ratings, err
+}
+
 func (r *repository) GetHighlyRatedArticleIDsForUser(userID uint, minScore int) ([]uint, error) {
 	var articleIDs []uint
 	err := database.DB.Model(&Rating{}).
@@ -127,15 +285,31 @@ func (r *repository) GetHighlyRatedArticlesByUsers(userIDs []uint, minScore int)
 		return ratings, nil
 	}
 	err := database.DB.Model(&Rating{}).
-		Where("user_id IN ? AND score >= ?", userIDs, minScore).
+		Joins("JOIN articles ON articles.id = ratings.article_id AND articles.deleted_at IS NULL AND articles.workspace_id IS NULL").
+		Where("ratings.user_id IN ? AND ratings.score >= ?", userIDs, minScore).
+		Find(&ratings).Error
+	return ratings, err
+}
+
+func (r *repository) GetHighlyRatedVisibleArticles(viewerID uint, userIDs []uint, minScore int) ([]Rating, error) {
+	var ratings []Rating
+	if len(userIDs) == 0 {
+		return ratings, nil
+	}
+	err := database.DB.Model(&Rating{}).
+		Joins("JOIN articles ON articles.id = ratings.article_id AND articles.deleted_at IS NULL").
+		Scopes(AccessibleTo(viewerID, AccessRead)).
+		Where("ratings.user_id IN ? AND ratings.score >= ?", userIDs, minScore).
 		Find(&ratings).Error
 	return ratings, err
 }
 
 func (r *repository) GetArticleIDsSavedByUser(userID uint) ([]uint, error) {
 	var articleIDs []uint
+	rated := database.DB.Model(&Rating{}).Select("article_id").Where("user_id = ?", userID)
 	err := database.DB.Model(&Article{}).
-		Where("user_id = ?", userID).
+		Where("articles.user_id = ? OR articles.id IN (?)", userID, rated).
+		Where("articles.workspace_id IS NULL OR articles.workspace_id IN (?)", memberWorkspaces(userID, AccessRead)).
 		Pluck("id", &articleIDs).Error
 	return articleIDs, err
 }
@@ -148,3 +322,58 @@ func (r *repository) GetArticlesByIDs(articleIDs []uint) ([]Article, error) {
 	err := database.DB.Where("id IN ?", articleIDs).Find(&articles).Error
 	return articles, err
 }
+
+func (r *repository) GetAllRatings() ([]Rating, error) {
+	var ratings []Rating
+	err := database.DB.
+		Joins("JOIN articles ON articles.id = ratings.article_id AND articles.deleted_at IS NULL AND articles.workspace_id IS NULL").
+		Order("ratings.id").
+		Find(&ratings).Error
+	return ratings, err
+}
+
+// FilterVisibleArticleIDs returns the subset of articleIDs the user is allowed
+// to see: the articles in their own library and in their workspaces.
+func (r *repository) FilterVisibleArticleIDs(userID uint, articleIDs []uint) ([]uint, error) {
+	var visible []uint
+	if len(articleIDs) == 0 {
+		return visible, nil
+	}
+	err := database.DB.Model(&Article{}).
+		Scopes(AccessibleTo(userID, AccessRead)).
+		Where("articles.id IN ?", articleIDs).
+		Pluck("articles.id", &visible).Error
+	return visible, err
+}
+
+func (r *repository) GetRatingsByUserID(userID uint) ([]Rating, error) {
+	var ratings []Rating
+	err := database.DB.Where("user_id = ?", userID).Order("id").Find(&ratings).Error
+	return ratings, err
+}
+
+func (r *repository) CountArticlesByStatus() (map[ArticleStatus]int64, error) {
+	var rows []struct {
+		Status ArticleStatus
+		Count  int64
+	}
+	err := database.DB.Model(&Article{}).Select("status, count(*) AS count").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[ArticleStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// DropLegacyIndexes removes the index that made a URL unique per user across
+// all libraries, which would stop a user saving a URL both to their own
+// library and to a workspace. Run it after migrating.
+func DropLegacyIndexes() error {
+	if !database.DB.Migrator().HasIndex(&Article{}, "idx_user_url") {
+		return nil
+	}
+	return database.DB.Migrator().DropIndex(&Article{}, "idx_user_url")
+}
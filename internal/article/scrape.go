@@ -0,0 +1,29 @@
+package article
+
+import (
+	"log"
+
+	"github.com/cheildo/deeli-api/pkg/scraper"
+)
+
+// Scrape fetches the article's metadata and stores the result, marking the
+// article failed if the page can't be scraped so the worker retries it.
+func Scrape(repo Repository, article *Article) {
+	log.Printf("Starting scrape for article ID %d", article.ID)
+	scrapedData, err := scraper.ScrapeMetadata(article.URL)
+	if err != nil {
+		log.Printf("Scrape failed for article ID %d: %v", article.ID, err)
+		article.Status = StatusFailed
+	} else {
+		article.Title = scrapedData.Title
+		article.Description = scrapedData.Description
+		article.ImageURL = scrapedData.ImageURL
+		article.Content = scrapedData.Content
+		article.Status = StatusCompleted
+	}
+
+	if err := repo.UpdateArticle(article); err != nil {
+		log.Printf("Failed to update article ID %d after scrape: %v", article.ID, err)
+	}
+	log.Printf("Finished scrape for article ID %d with status %s", article.ID, article.Status)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionTokens(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tokens := NewActionTokens([]byte("secret"))
+	tokens.now = func() time.Time { return now }
+
+	state := "hash-1"
+	lookup := func(userID uint) (string, error) { return state, nil }
+
+	token, err := tokens.Issue(PurposeResetPassword, 42, state, time.Hour)
+	require.NoError(t, err)
+
+	userID, err := tokens.Verify(token, PurposeResetPassword, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, uint(42), userID)
+
+	// Wrong purpose, tampering and a different secret are rejected.
+	_, err = tokens.Verify(token, PurposeVerifyEmail, lookup)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+	_, err = tokens.Verify(token+"x", PurposeResetPassword, lookup)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+	_, err = NewActionTokens([]byte("other")).Verify(token, PurposeResetPassword, lookup)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+
+	// Once the state changes the token is spent.
+	state = "hash-2"
+	_, err = tokens.Verify(token, PurposeResetPassword, lookup)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+
+	// And it expires.
+	state = "hash-1"
+	now = now.Add(time.Hour)
+	_, err = tokens.Verify(token, PurposeResetPassword, lookup)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// activityTracker collects session last-seen times in memory so that
+// authenticated requests don't each write to the database. Flush writes
+// them in one batch.
+type activityTracker struct {
+	sessions SessionRepository
+
+	mu      sync.Mutex
+	pending map[uint]time.Time
+}
+
+func newActivityTracker(sessions SessionRepository) *activityTracker {
+	return &activityTracker{sessions: sessions, pending: make(map[uint]time.Time)}
+}
+
+func (t *activityTracker) touch(sessionID uint, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.After(t.pending[sessionID]) {
+		t.pending[sessionID] = at
+	}
+}
+
+// lastSeen returns a session's unflushed last-seen time, if any.
+func (t *activityTracker) lastSeen(sessionID uint) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.pending[sessionID]
+	return at, ok
+}
+
+func (t *activityTracker) flush() {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = make(map[uint]time.Time)
+	t.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := t.sessions.UpdateLastSeen(batch); err != nil {
+		log.Printf("Failed to record activity for %d sessions: %v", len(batch), err)
+		// Put the batch back unless newer times arrived meanwhile.
+		for id, at := range batch {
+			t.touch(id, at)
+		}
+	}
+}
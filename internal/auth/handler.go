@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	tokens         *TokenService
+	personalTokens *PersonalTokenService
+}
+
+func NewHandler(tokens *TokenService, personalTokens *PersonalTokenService) *Handler {
+	return &Handler{tokens: tokens, personalTokens: personalTokens}
+}
+
+// TokenResponse renders a token pair for the client.
+func TokenResponse(pair *TokenPair) gin.H {
+	return gin.H{
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_at":    pair.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// RefreshRequest defines the JSON for renewing an access token.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh handles POST /token/refresh
+func (h *Handler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := h.tokens.Refresh(req.RefreshToken)
+	if err != nil {
+		if err == ErrInvalidRefreshToken || err == ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse(pair))
+}
+
+// Logout handles POST /logout, revoking the current session.
+func (h *Handler) Logout(c *gin.Context) {
+	sessionID := c.MustGet("sessionID").(uint)
+	if err := h.tokens.Revoke(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// SessionResponse describes one of the user's sessions.
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions handles GET /sessions
+func (h *Handler) ListSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	currentID := c.MustGet("sessionID").(uint)
+
+	sessions, err := h.tokens.ListSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, s := range sessions {
+		response[i] = SessionResponse{
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			Current:    s.ID == currentID,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession handles DELETE /sessions/:id
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.tokens.RevokeUserSession(userID, uint(sessionID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// RevokeOtherSessions handles DELETE /sessions, logging the user out
+// everywhere except the current session.
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	currentID := c.MustGet("sessionID").(uint)
+
+	revoked, err := h.tokens.RevokeOtherSessions(userID, currentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// JWKS handles GET /.well-known/jwks.json, publishing the public keys
+// access tokens are signed with.
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.tokens.JWKS()})
+}
+
+// PersonalTokenResponse describes a personal access token. Token is only set
+// when the token is created.
+type PersonalTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newPersonalTokenResponse(t *PersonalAccessToken) PersonalTokenResponse {
+	return PersonalTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.ScopeList(),
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
+
+// CreatePersonalTokenRequest defines the JSON for creating a personal
+// access token. Without ExpiresAt the token doesn't expire.
+type CreatePersonalTokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatePersonalToken handles POST /tokens
+func (h *Handler) CreatePersonalToken(c *gin.Context) {
+	var req CreatePersonalTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	plain, token, err := h.personalTokens.Create(userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if err == ErrUnknownScope {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "valid_scopes": Scopes})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	response := newPersonalTokenResponse(token)
+	response.Token = plain
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListPersonalTokens handles GET /tokens
+func (h *Handler) ListPersonalTokens(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	tokens, err := h.personalTokens.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tokens"})
+		return
+	}
+
+	response := make([]PersonalTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = newPersonalTokenResponse(&tokens[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokePersonalToken handles DELETE /tokens/:id
+func (h *Handler) RevokePersonalToken(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.personalTokens.Revoke(userID, uint(tokenID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
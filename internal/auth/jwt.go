@@ -1,54 +1,72 @@
 package auth
 
 import (
-	"errors"
 	"time"
 
-	"github.com/cheildo/deeli-api/pkg/config"
-	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(config.Get("JWT_SECRET_KEY"))
+// clockSkew is how far token times may be off between servers.
+const clockSkew = 30 * time.Second
 
 type Claims struct {
-	UserID uint `json:"user_id"`
-	jwt.StandardClaims
+	UserID    uint `json:"user_id"`
+	SessionID uint `json:"sid"`
+	jwt.RegisteredClaims
 }
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+// JWTIssuer signs and validates access tokens with a key set, for a given
+// issuer and audience.
+type JWTIssuer struct {
+	keys     *KeySet
+	issuer   string
+	audience string
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func NewJWTIssuer(keys *KeySet, issuer, audience string) *JWTIssuer {
+	return &JWTIssuer{keys: keys, issuer: issuer, audience: audience}
 }
 
-func GenerateJWT(userID uint) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// Keys returns the key set tokens are signed with.
+func (j *JWTIssuer) Keys() *KeySet {
+	return j.keys
+}
+
+func (j *JWTIssuer) GenerateJWT(userID, sessionID uint, expiresAt time.Time) (string, error) {
+	jti, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{j.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return j.keys.sign(claims)
 }
 
-func ValidateJWT(tokenStr string) (*Claims, error) {
+// ValidateJWT checks the token's signature, algorithm, issuer, audience and
+// expiry, issued-at and not-before times.
+func (j *JWTIssuer) ValidateJWT(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
+	_, err := jwt.ParseWithClaims(tokenStr, claims, j.keys.verificationKey,
+		jwt.WithValidMethods(j.keys.methods()),
+		jwt.WithIssuer(j.issuer),
+		jwt.WithAudience(j.audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
 	if err != nil {
 		return nil, err
 	}
-	if !token.Valid {
-		return nil, errors.New("invalid token")
-	}
 	return claims, nil
 }
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cheildo/deeli-api/pkg/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a JWT signing key identified by its kid. Keys loaded from a public
+// key file can only verify.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// CanSign reports whether the key has its private half.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// KeySet holds every key tokens may be verified with, and the one new
+// tokens are signed with.
+//
+// Rotation works with overlap windows: add the new key to the set (it is
+// published in the JWKS so other services can fetch it), switch
+// JWT_SIGNING_KEY_ID to it once they have, then keep the old key, or just
+// its public half, until the last token it signed has expired.
+type KeySet struct {
+	keys   map[string]*Key
+	active *Key
+}
+
+// NewKeySet creates a key set that signs with the key activeID.
+func NewKeySet(keys []*Key, activeID string) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if _, dup := set.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		set.keys[k.ID] = k
+	}
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", activeID)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("signing key %q has no private key", activeID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// NewHMACKeySet creates a key set with a single shared-secret HS256 key.
+func NewHMACKeySet(secret []byte) (*KeySet, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty HMAC secret")
+	}
+	return NewKeySet([]*Key{{ID: "hs256", Method: jwt.SigningMethodHS256, private: secret, public: secret}}, "hs256")
+}
+
+// LoadKeySet reads every *.pem file in dir. A file's name without the .pem
+// (and .pub) extension is the key's kid. Private keys may be PKCS#8 RSA or
+// Ed25519 keys, or PKCS#1 RSA keys; public keys are PKIX.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []*Key
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	if activeID == "" && len(keys) > 0 {
+		// Default to the last signing key by name, so date-named keys
+		// rotate by adding a file.
+		for _, k := range keys {
+			if k.CanSign() {
+				activeID = k.ID
+			}
+		}
+	}
+	return NewKeySet(keys, activeID)
+}
+
+// KeySetFromConfig loads the keys in JWT_KEYS_DIR, signing with
+// JWT_SIGNING_KEY_ID. Without a keys directory it falls back to HS256 with
+// JWT_SECRET_KEY.
+func KeySetFromConfig() (*KeySet, error) {
+	dir := config.Get("JWT_KEYS_DIR")
+	if dir == "" {
+		log.Println("JWT_KEYS_DIR not set, signing tokens with HS256 and JWT_SECRET_KEY")
+		return NewHMACKeySet([]byte(config.Get("JWT_SECRET_KEY")))
+	}
+	return LoadKeySet(dir, config.Get("JWT_SIGNING_KEY_ID"))
+}
+
+func loadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	id := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".pem"), ".pub")
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(id, parsed)
+}
+
+func newKey(id string, parsed interface{}) (*Key, error) {
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// sign signs the claims with the active key, naming it in the kid header.
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.private)
+}
+
+// verificationKey is a jwt.Keyfunc that picks the key named by the token's
+// kid and checks the token uses that key's algorithm.
+func (s *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// methods returns the algorithms used by the set's keys.
+func (s *KeySet) methods() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, k := range s.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the set, sorted by kid. Shared-secret keys
+// are never published.
+func (s *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, k := range s.keys {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
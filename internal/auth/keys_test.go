@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+// writeKeys writes an RSA key "2024-01" and an Ed25519 key "2024-06" to a
+// temporary directory.
+func writeKeys(t *testing.T) (string, ed25519.PublicKey) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2024-01.pem", "PRIVATE KEY", der)
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKCS8PrivateKey(edPrivate)
+	require.NoError(t, err)
+	writePEM(t, dir, "2024-06.pem", "PRIVATE KEY", der)
+
+	return dir, edPublic
+}
+
+func TestLoadKeySetSignsWithNewestKey(t *testing.T) {
+	dir, _ := writeKeys(t)
+	keys, err := LoadKeySet(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", keys.active.ID)
+	assert.Equal(t, "EdDSA", keys.active.Method.Alg())
+}
+
+func TestJWTRoundTripAndRotation(t *testing.T) {
+	dir, _ := writeKeys(t)
+	oldKeys, err := LoadKeySet(dir, "2024-01")
+	require.NoError(t, err)
+	newKeys, err := LoadKeySet(dir, "2024-06")
+	require.NoError(t, err)
+
+	oldIssuer := NewJWTIssuer(oldKeys, "deeli", "deeli-api")
+	newIssuer := NewJWTIssuer(newKeys, "deeli", "deeli-api")
+
+	token, err := oldIssuer.GenerateJWT(7, 3, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	// Tokens signed before the rotation still verify afterwards.
+	claims, err := newIssuer.ValidateJWT(token)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+	assert.Equal(t, uint(3), claims.SessionID)
+	assert.NotEmpty(t, claims.ID)
+
+	// Once the old key is removed they don't.
+	require.NoError(t, os.Remove(filepath.Join(dir, "2024-01.pem")))
+	retired, err := LoadKeySet(dir, "2024-06")
+	require.NoError(t, err)
+	_, err = NewJWTIssuer(retired, "deeli", "deeli-api").ValidateJWT(token)
+	assert.Error(t, err)
+}
+
+func TestValidateJWTChecksClaims(t *testing.T) {
+	dir, _ := writeKeys(t)
+	keys, err := LoadKeySet(dir, "")
+	require.NoError(t, err)
+	issuer := NewJWTIssuer(keys, "deeli", "deeli-api")
+
+	token, err := NewJWTIssuer(keys, "deeli", "other-service").GenerateJWT(1, 1, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	_, err = issuer.ValidateJWT(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+
+	token, err = NewJWTIssuer(keys, "someone-else", "deeli-api").GenerateJWT(1, 1, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	_, err = issuer.ValidateJWT(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	token, err = issuer.GenerateJWT(1, 1, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = issuer.ValidateJWT(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	future := time.Now().Add(time.Hour)
+	token, err = keys.sign(&Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    "deeli",
+		Audience:  jwt.ClaimStrings{"deeli-api"},
+		NotBefore: jwt.NewNumericDate(future),
+		ExpiresAt: jwt.NewNumericDate(future.Add(time.Hour)),
+	}})
+	require.NoError(t, err)
+	_, err = issuer.ValidateJWT(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenNotValidYet)
+}
+
+func TestValidateJWTRejectsAlgorithmSwitch(t *testing.T) {
+	dir, edPublic := writeKeys(t)
+	keys, err := LoadKeySet(dir, "")
+	require.NoError(t, err)
+
+	// An HS256 token keyed with the public key must not verify.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    "deeli",
+		Audience:  jwt.ClaimStrings{"deeli-api"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	token.Header["kid"] = "2024-06"
+	signed, err := token.SignedString([]byte(edPublic))
+	require.NoError(t, err)
+
+	_, err = NewJWTIssuer(keys, "deeli", "deeli-api").ValidateJWT(signed)
+	assert.Error(t, err)
+}
+
+func TestJWKS(t *testing.T) {
+	dir, _ := writeKeys(t)
+	keys, err := LoadKeySet(dir, "")
+	require.NoError(t, err)
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks, 2)
+	assert.Equal(t, "2024-01", jwks[0].Kid)
+	assert.Equal(t, "RSA", jwks[0].Kty)
+	assert.Equal(t, "AQAB", jwks[0].E)
+	assert.Equal(t, "OKP", jwks[1].Kty)
+	assert.Equal(t, "Ed25519", jwks[1].Crv)
+	assert.Len(t, jwks[1].X, 43)
+
+	hmac, err := NewHMACKeySet([]byte("secret"))
+	require.NoError(t, err)
+	assert.Empty(t, hmac.JWKS())
+}
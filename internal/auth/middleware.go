@@ -5,9 +5,15 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func Middleware() gin.HandlerFunc {
+// Middleware authenticates requests by their bearer token: either a
+// session's access token, or a personal access token. Personal access
+// tokens only reach routes guarded by a RequireScope they were granted.
+// Disabled users and accounts scheduled for deletion are turned away
+// whatever their token.
+func Middleware(tokens *TokenService, personalTokens *PersonalTokenService, accounts AccountLookup) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -21,15 +27,80 @@ func Middleware() gin.HandlerFunc {
 			return
 		}
 
+		var userID uint
 		tokenStr := parts[1]
-		claims, err := ValidateJWT(tokenStr)
+		if strings.HasPrefix(tokenStr, PersonalTokenPrefix) {
+			token, err := personalTokens.Authenticate(tokenStr)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+			userID = token.UserID
+			c.Set("scopes", token.ScopeList())
+		} else {
+			claims, err := tokens.Authenticate(tokenStr)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+			userID = claims.UserID
+			c.Set("sessionID", claims.SessionID)
+		}
+
+		account, err := accounts.LookupAccount(userID)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			if err == gorm.ErrRecordNotFound {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if account.Disabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+			return
+		}
+		if account.PendingDeletion {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account scheduled for deletion"})
 			return
 		}
 
 		// Set user ID in context for downstream handlers
-		c.Set("userID", claims.UserID)
+		c.Set("userID", userID)
+		c.Set("role", account.Role)
+		c.Next()
+	}
+}
+
+// RequireScope lets through personal access tokens granted the scope.
+// Session logins have every scope. It must run after Middleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("sessionID"); ok {
+			c.Next()
+			return
+		}
+		scopes, _ := c.Get("scopes")
+		granted, _ := scopes.([]string)
+		for _, s := range granted {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token lacks the " + scope + " scope"})
+	}
+}
+
+// RequireSession only lets through session logins, keeping account
+// management out of reach of personal access tokens. It must run after
+// Middleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("sessionID"); !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a login session"})
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveWith runs a request through the guards after setting up the
+// context the way Middleware would.
+func serveWith(setup func(c *gin.Context), guards ...gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handlers := append([]gin.HandlerFunc{setup}, guards...)
+	handlers = append(handlers, func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/", handlers...)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireScope(t *testing.T) {
+	session := func(c *gin.Context) { c.Set("userID", uint(1)); c.Set("sessionID", uint(1)) }
+	readOnly := func(c *gin.Context) { c.Set("userID", uint(1)); c.Set("scopes", []string{ScopeArticlesRead}) }
+
+	assert.Equal(t, http.StatusOK, serveWith(session, RequireScope(ScopeArticlesWrite)))
+	assert.Equal(t, http.StatusOK, serveWith(readOnly, RequireScope(ScopeArticlesRead)))
+	assert.Equal(t, http.StatusForbidden, serveWith(readOnly, RequireScope(ScopeArticlesWrite)))
+}
+
+func TestRequireSession(t *testing.T) {
+	session := func(c *gin.Context) { c.Set("userID", uint(1)); c.Set("sessionID", uint(1)) }
+	token := func(c *gin.Context) { c.Set("userID", uint(1)); c.Set("scopes", Scopes) }
+
+	assert.Equal(t, http.StatusOK, serveWith(session, RequireSession()))
+	assert.Equal(t, http.StatusForbidden, serveWith(token, RequireSession()))
+}
+
+func TestRequireRole(t *testing.T) {
+	user := func(c *gin.Context) { c.Set("userID", uint(1)); c.Set("role", RoleUser) }
+	admin := func(c *gin.Context) { c.Set("userID", uint(1)); c.Set("role", RoleAdmin) }
+
+	assert.Equal(t, http.StatusForbidden, serveWith(user, RequireRole(RoleAdmin)))
+	assert.Equal(t, http.StatusOK, serveWith(admin, RequireRole(RoleAdmin)))
+	assert.Equal(t, http.StatusOK, serveWith(admin, RequireRole(RoleUser)))
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/cheildo/deeli-api/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are stored in PHC string format. New hashes use argon2id:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// bcrypt hashes ($2a$, $2b$) from before argon2id are still accepted and
+// replaced on the next login.
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var passwordParams struct {
+	once   sync.Once
+	params Argon2Params
+}
+
+// defaultArgon2Params are used when the configured parameters are unset or
+// invalid.
+var defaultArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 3, Parallelism: 2}
+
+// valid reports whether argon2 accepts the parameters: at least one pass
+// and one lane, and at least 8 KiB of memory per lane.
+func (p Argon2Params) valid() bool {
+	return p.Time >= 1 && p.Parallelism >= 1 && p.Memory >= 8*uint32(p.Parallelism)
+}
+
+// currentParams returns the parameters for new hashes, read once from
+// PASSWORD_ARGON2_MEMORY (KiB), PASSWORD_ARGON2_TIME and
+// PASSWORD_ARGON2_PARALLELISM.
+func currentParams() Argon2Params {
+	passwordParams.once.Do(func() {
+		passwordParams.params = argon2ParamsFromConfig()
+	})
+	return passwordParams.params
+}
+
+// argon2ParamsFromConfig reads the argon2id parameters, falling back to the
+// defaults if any of them is out of range.
+func argon2ParamsFromConfig() Argon2Params {
+	memory := config.GetInt("PASSWORD_ARGON2_MEMORY", int(defaultArgon2Params.Memory))
+	time := config.GetInt("PASSWORD_ARGON2_TIME", int(defaultArgon2Params.Time))
+	parallelism := config.GetInt("PASSWORD_ARGON2_PARALLELISM", int(defaultArgon2Params.Parallelism))
+	if memory < 1 || int64(memory) > math.MaxUint32 || time < 1 || int64(time) > math.MaxUint32 || parallelism < 1 || parallelism > math.MaxUint8 {
+		log.Printf("Invalid argon2id parameters m=%d,t=%d,p=%d, using defaults", memory, time, parallelism)
+		return defaultArgon2Params
+	}
+	params := Argon2Params{Memory: uint32(memory), Time: uint32(time), Parallelism: uint8(parallelism)}
+	if !params.valid() {
+		log.Printf("Invalid argon2id parameters m=%d,t=%d,p=%d: memory must be at least 8 KiB per lane, using defaults", memory, time, parallelism)
+		return defaultArgon2Params
+	}
+	return params
+}
+
+// HashPassword hashes a password with argon2id and the current parameters.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := currentParams()
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Parallelism, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPasswordHash reports whether password matches an argon2id or bcrypt
+// hash.
+func CheckPasswordHash(password, hash string) bool {
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	params, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return false
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+// NeedsRehash reports whether a hash should be replaced: it is bcrypt, or
+// argon2id with other than the current parameters.
+func NeedsRehash(hash string) bool {
+	if isBcrypt(hash) {
+		return true
+	}
+	params, _, _, err := parseArgon2(hash)
+	return err != nil || params != currentParams()
+}
+
+var dummyHash struct {
+	once sync.Once
+	hash string
+}
+
+// CheckDummyPassword takes as long as CheckPasswordHash but always fails.
+// Login calls it for unknown emails so response times don't reveal which
+// emails have accounts.
+func CheckDummyPassword(password string) {
+	dummyHash.once.Do(func() {
+		dummyHash.hash, _ = HashPassword("dummy password for unknown accounts")
+	})
+	CheckPasswordHash(password, dummyHash.hash)
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// parseArgon2 splits an argon2id PHC string into its parameters, salt and
+// key.
+func parseArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil || !params.valid() {
+		return params, nil, nil, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errInvalidHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useParams sets cheap argon2id parameters for a test.
+func useParams(t *testing.T, p Argon2Params) {
+	currentParams()
+	old := passwordParams.params
+	passwordParams.params = p
+	t.Cleanup(func() { passwordParams.params = old })
+}
+
+func TestArgon2PasswordHash(t *testing.T) {
+	useParams(t, Argon2Params{Memory: 1024, Time: 1, Parallelism: 1})
+
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.True(t, CheckPasswordHash("correct horse", hash))
+	assert.False(t, CheckPasswordHash("wrong horse", hash))
+	assert.False(t, NeedsRehash(hash))
+
+	// Raising the cost marks existing hashes for an upgrade, but they still
+	// verify.
+	useParams(t, Argon2Params{Memory: 2048, Time: 1, Parallelism: 1})
+	assert.True(t, NeedsRehash(hash))
+	assert.True(t, CheckPasswordHash("correct horse", hash))
+}
+
+func TestBcryptPasswordHash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	assert.True(t, CheckPasswordHash("old password", string(legacy)))
+	assert.False(t, CheckPasswordHash("new password", string(legacy)))
+	assert.True(t, NeedsRehash(string(legacy)))
+}
+
+func TestMalformedPasswordHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$aGFzaA",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=8,t=1,p=4$c2FsdA$aGFzaA",
+	} {
+		assert.False(t, CheckPasswordHash("x", hash), hash)
+		assert.True(t, NeedsRehash(hash), hash)
+	}
+}
+
+func TestArgon2ParamsFromConfig(t *testing.T) {
+	t.Setenv("PASSWORD_ARGON2_MEMORY", "1024")
+	t.Setenv("PASSWORD_ARGON2_TIME", "2")
+	t.Setenv("PASSWORD_ARGON2_PARALLELISM", "4")
+	assert.Equal(t, Argon2Params{Memory: 1024, Time: 2, Parallelism: 4}, argon2ParamsFromConfig())
+
+	for _, bad := range []map[string]string{
+		{"PASSWORD_ARGON2_TIME": "0"},
+		{"PASSWORD_ARGON2_TIME": "-1"},
+		{"PASSWORD_ARGON2_PARALLELISM": "0"},
+		{"PASSWORD_ARGON2_PARALLELISM": "256"},
+		{"PASSWORD_ARGON2_MEMORY": "16"},
+		{"PASSWORD_ARGON2_MEMORY": "-1024"},
+	} {
+		t.Run(fmt.Sprint(bad), func(t *testing.T) {
+			for key, value := range bad {
+				t.Setenv(key, value)
+			}
+			assert.Equal(t, defaultArgon2Params, argon2ParamsFromConfig())
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles a user can have, from least to most privileged.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleUser:  1,
+	RoleAdmin: 2,
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// Account is what Middleware needs to know about an authenticated user.
+type Account struct {
+	Role            string
+	Disabled        bool
+	PendingDeletion bool
+}
+
+// AccountLookup loads a user's account. Middleware looks it up on every
+// request, so disabling a user or changing their role takes effect
+// immediately.
+type AccountLookup interface {
+	LookupAccount(userID uint) (*Account, error)
+}
+
+// RequireRole lets through users with the role or a more privileged one.
+// It must run after Middleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current, _ := c.Get("role")
+		name, _ := current.(string)
+		if roleRank[name] < roleRank[role] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint requires the " + role + " role"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Session is a login. Its refresh tokens form a family: each refresh
+// replaces the current token with a new one, and presenting a replaced token
+// again revokes the whole session.
+type Session struct {
+	gorm.Model
+	UserID     uint `gorm:"index;not null"`
+	UserAgent  string
+	IP         string
+	LastSeenAt time.Time
+	RevokedAt  *time.Time
+}
+
+// RefreshToken stores the SHA-256 hash of an opaque refresh token.
+type RefreshToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	SessionID uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+// SessionRepository defines the interface for session and refresh token
+// storage.
+type SessionRepository interface {
+	CreateSession(session *Session, token *RefreshToken) error
+	// RotateRefreshToken marks the token with the given hash as used and
+	// stores next in its place. A token that was already used revokes its
+	// session and yields ErrRefreshTokenReused, even if it has expired since.
+	RotateRefreshToken(tokenHash string, next *RefreshToken, now time.Time) (*Session, error)
+	GetSession(id uint) (*Session, error)
+	// ListActiveSessions returns the user's sessions that are neither revoked
+	// nor past their refresh token's expiry, most recently seen first.
+	ListActiveSessions(userID uint, now time.Time) ([]Session, error)
+	RevokeSession(id uint) error
+	// RevokeUserSession revokes one of the user's sessions, returning
+	// gorm.ErrRecordNotFound if the user has no such active session.
+	RevokeUserSession(userID, sessionID uint) error
+	// RevokeOtherSessions revokes all of the user's sessions except keepID.
+	RevokeOtherSessions(userID, keepID uint) (int64, error)
+	// UpdateLastSeen writes a batch of last-seen times keyed by session ID.
+	UpdateLastSeen(seen map[uint]time.Time) error
+}
+
+type sessionRepository struct{}
+
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{}
+}
+
+func (r *sessionRepository) CreateSession(session *Session, token *RefreshToken) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		token.SessionID = session.ID
+		return tx.Create(token).Error
+	})
+}
+
+func (r *sessionRepository) RotateRefreshToken(tokenHash string, next *RefreshToken, now time.Time) (*Session, error) {
+	var session Session
+	var reused bool
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var current RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).First(&current).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&session, current.SessionID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if session.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		// Reuse is checked before expiry, so a stolen token replayed after
+		// it expired still ends the session.
+		if current.UsedAt != nil {
+			reused = true
+			return tx.Model(&session).Update("revoked_at", now).Error
+		}
+		if !now.Before(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		next.SessionID = session.ID
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetSession(id uint) (*Session, error) {
+	var session Session
+	err := database.DB.First(&session, id).Error
+	return &session, err
+}
+
+func (r *sessionRepository) ListActiveSessions(userID uint, now time.Time) ([]Session, error) {
+	var sessions []Session
+	err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.session_id = sessions.id AND refresh_tokens.used_at IS NULL AND refresh_tokens.expires_at > ?)", now).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) RevokeSession(id uint) error {
+	return database.DB.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeUserSession(userID, sessionID uint) error {
+	result := database.DB.Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *sessionRepository) RevokeOtherSessions(userID, keepID uint) (int64, error) {
+	result := database.DB.Model(&Session{}).
+		Where("user_id = ? AND id != ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func (r *sessionRepository) UpdateLastSeen(seen map[uint]time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for id, at := range seen {
+			if err := tx.Model(&Session{}).Where("id = ? AND last_seen_at < ?", id, at).
+				Update("last_seen_at", at).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/config"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Attempts is the failed-attempt record for one throttle key.
+type Attempts struct {
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+}
+
+// AttemptStore keeps failed-attempt counts. Implementations must make
+// RecordFailure atomic per key.
+type AttemptStore interface {
+	Get(key string) (Attempts, error)
+	// RecordFailure counts a failure at now, starting the count over if the
+	// previous failure was before windowStart, and stores the time block
+	// returns for the new count.
+	RecordFailure(key string, now, windowStart time.Time, block func(failures int) time.Time) (Attempts, error)
+	Reset(key string) error
+}
+
+// ThrottlePolicy sets how failures slow down further attempts. The first
+// FreeAttempts failures cost nothing; each one after that doubles the wait,
+// from BaseDelay up to MaxDelay, and LockoutAfter failures lock the key for
+// LockoutDuration. Counts start over after Window without failures.
+type ThrottlePolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// blockedUntil returns when the next attempt is allowed after failures.
+func (p ThrottlePolicy) blockedUntil(failures int, now time.Time) time.Time {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return now.Add(p.LockoutDuration)
+	}
+	if failures <= p.FreeAttempts {
+		return time.Time{}
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return now.Add(delay)
+}
+
+// LoginThrottle tracks failed logins per account and per client IP.
+type LoginThrottle struct {
+	store   AttemptStore
+	account ThrottlePolicy
+	ip      ThrottlePolicy
+	now     func() time.Time
+}
+
+func NewLoginThrottle(store AttemptStore, account, ip ThrottlePolicy) *LoginThrottle {
+	return &LoginThrottle{store: store, account: account, ip: ip, now: time.Now}
+}
+
+// AttemptStoreFromConfig returns the store named by LOGIN_THROTTLE_STORE:
+// "postgres", the default, or "memory".
+func AttemptStoreFromConfig() AttemptStore {
+	if config.GetString("LOGIN_THROTTLE_STORE", "postgres") == "memory" {
+		return NewMemoryAttemptStore()
+	}
+	return NewPostgresAttemptStore()
+}
+
+// LoginThrottleFromConfig uses the store from AttemptStoreFromConfig with
+// the account policy from LOGIN_ACCOUNT_* and the IP policy from LOGIN_IP_*
+// settings.
+func LoginThrottleFromConfig() *LoginThrottle {
+	store := AttemptStoreFromConfig()
+	account := ThrottlePolicy{
+		FreeAttempts:    config.GetInt("LOGIN_ACCOUNT_FREE_ATTEMPTS", 3),
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    config.GetInt("LOGIN_ACCOUNT_LOCKOUT_AFTER", 10),
+		LockoutDuration: config.GetDuration("LOGIN_ACCOUNT_LOCKOUT_DURATION", 15*time.Minute),
+		Window:          time.Hour,
+	}
+	ip := ThrottlePolicy{
+		FreeAttempts:    config.GetInt("LOGIN_IP_FREE_ATTEMPTS", 20),
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    config.GetInt("LOGIN_IP_LOCKOUT_AFTER", 100),
+		LockoutDuration: config.GetDuration("LOGIN_IP_LOCKOUT_DURATION", time.Hour),
+		Window:          time.Hour,
+	}
+	return NewLoginThrottle(store, account, ip)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the client must wait before trying to log in to
+// the account (if email is set) from ip. Zero means it may try now.
+func (t *LoginThrottle) Check(email, ip string) (time.Duration, error) {
+	now := t.now()
+	var wait time.Duration
+	keys := []string{ipKey(ip)}
+	if email != "" {
+		keys = append(keys, accountKey(email))
+	}
+	for _, key := range keys {
+		attempts, err := t.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := attempts.BlockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Failure records a failed attempt on the account (if email is set) and ip.
+func (t *LoginThrottle) Failure(email, ip string) error {
+	now := t.now()
+	if _, err := t.record(ipKey(ip), t.ip, now); err != nil {
+		return err
+	}
+	if email == "" {
+		return nil
+	}
+	_, err := t.record(accountKey(email), t.account, now)
+	return err
+}
+
+// Success clears the account's failures. The IP's are kept, since one
+// address may be guessing at many accounts.
+func (t *LoginThrottle) Success(email string) error {
+	return t.store.Reset(accountKey(email))
+}
+
+func (t *LoginThrottle) record(key string, policy ThrottlePolicy, now time.Time) (Attempts, error) {
+	return t.store.RecordFailure(key, now, now.Add(-policy.Window), func(failures int) time.Time {
+		return policy.blockedUntil(failures, now)
+	})
+}
+
+// Throttle tracks failures of one kind under a single policy. Its keys are
+// namespaced by kind, so it can share a store with the login throttle
+// without the two counting each other's failures.
+type Throttle struct {
+	store  AttemptStore
+	kind   string
+	policy ThrottlePolicy
+	now    func() time.Time
+}
+
+func NewThrottle(store AttemptStore, kind string, policy ThrottlePolicy) *Throttle {
+	return &Throttle{store: store, kind: kind, policy: policy, now: time.Now}
+}
+
+func (t *Throttle) storeKey(key string) string {
+	return t.kind + ":" + key
+}
+
+// Check returns how long the client must wait before another attempt on
+// key. Zero means it may try now.
+func (t *Throttle) Check(key string) (time.Duration, error) {
+	attempts, err := t.store.Get(t.storeKey(key))
+	if err != nil {
+		return 0, err
+	}
+	if wait := attempts.BlockedUntil.Sub(t.now()); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Failure records a failed attempt on key.
+func (t *Throttle) Failure(key string) error {
+	now := t.now()
+	_, err := t.store.RecordFailure(t.storeKey(key), now, now.Add(-t.policy.Window), func(failures int) time.Time {
+		return t.policy.blockedUntil(failures, now)
+	})
+	return err
+}
+
+// MemoryAttemptStore keeps attempts in process memory. It suits a single
+// instance and tests.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]Attempts)}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *MemoryAttemptStore) RecordFailure(key string, now, windowStart time.Time, block func(failures int) time.Time) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.attempts[key]
+	if a.LastFailureAt.Before(windowStart) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	a.BlockedUntil = block(a.Failures)
+	s.attempts[key] = a
+	return a, nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// LoginAttempt is the Postgres row behind PostgresAttemptStore.
+type LoginAttempt struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int    `gorm:"not null"`
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+}
+
+// PostgresAttemptStore shares attempts between instances through the
+// login_attempts table.
+type PostgresAttemptStore struct{}
+
+func NewPostgresAttemptStore() *PostgresAttemptStore {
+	return &PostgresAttemptStore{}
+}
+
+func (s *PostgresAttemptStore) Get(key string) (Attempts, error) {
+	var row LoginAttempt
+	err := database.DB.Where("key = ?", key).First(&row).Error
+	if err == gorm.ErrRecordNotFound {
+		return Attempts{}, nil
+	}
+	return Attempts{Failures: row.Failures, LastFailureAt: row.LastFailureAt, BlockedUntil: row.BlockedUntil}, err
+}
+
+func (s *PostgresAttemptStore) RecordFailure(key string, now, windowStart time.Time, block func(failures int) time.Time) (Attempts, error) {
+	var attempts Attempts
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists so it can be locked.
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+		var row LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+		if row.LastFailureAt.Before(windowStart) {
+			row.Failures = 0
+		}
+		row.Failures++
+		row.LastFailureAt = now
+		row.BlockedUntil = block(row.Failures)
+		attempts = Attempts{Failures: row.Failures, LastFailureAt: row.LastFailureAt, BlockedUntil: row.BlockedUntil}
+		return tx.Save(&row).Error
+	})
+	return attempts, err
+}
+
+func (s *PostgresAttemptStore) Reset(key string) error {
+	return database.DB.Where("key = ?", key).Delete(&LoginAttempt{}).Error
+}
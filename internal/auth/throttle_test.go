@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottlePolicyBackoff(t *testing.T) {
+	policy := ThrottlePolicy{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        4 * time.Second,
+		LockoutAfter:    6,
+		LockoutDuration: time.Hour,
+	}
+	now := time.Unix(0, 0)
+	wait := func(failures int) time.Duration {
+		until := policy.blockedUntil(failures, now)
+		if until.IsZero() {
+			return 0
+		}
+		return until.Sub(now)
+	}
+
+	assert.Equal(t, time.Duration(0), wait(2))
+	assert.Equal(t, time.Second, wait(3))
+	assert.Equal(t, 2*time.Second, wait(4))
+	assert.Equal(t, 4*time.Second, wait(5))
+	assert.Equal(t, time.Hour, wait(6))
+}
+
+func TestLoginThrottle(t *testing.T) {
+	now := time.Unix(1000, 0)
+	account := ThrottlePolicy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutAfter: 3, LockoutDuration: time.Hour, Window: time.Hour}
+	ip := ThrottlePolicy{FreeAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour}
+	throttle := NewLoginThrottle(NewMemoryAttemptStore(), account, ip)
+	throttle.now = func() time.Time { return now }
+
+	check := func(email string) time.Duration {
+		wait, err := throttle.Check(email, "10.0.0.1")
+		require.NoError(t, err)
+		return wait
+	}
+
+	require.NoError(t, throttle.Failure("A@example.com", "10.0.0.1"))
+	assert.Zero(t, check("a@example.com"))
+
+	require.NoError(t, throttle.Failure("a@example.com", "10.0.0.1"))
+	assert.Equal(t, time.Second, check("a@example.com"))
+	// Other accounts from the same address are not held up yet.
+	assert.Zero(t, check("b@example.com"))
+
+	require.NoError(t, throttle.Failure("a@example.com", "10.0.0.1"))
+	assert.Equal(t, time.Hour, check("a@example.com"))
+
+	// The lockout runs out, and a success clears the count.
+	now = now.Add(time.Hour)
+	assert.Zero(t, check("a@example.com"))
+	require.NoError(t, throttle.Success("a@example.com"))
+	require.NoError(t, throttle.Failure("a@example.com", "10.0.0.1"))
+	assert.Zero(t, check("a@example.com"))
+}
+
+func TestThrottleKeepsItsOwnKeys(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryAttemptStore()
+	policy := ThrottlePolicy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour}
+	throttle := NewThrottle(store, "share", policy)
+	throttle.now = func() time.Time { return now }
+	login := NewLoginThrottle(store, policy, policy)
+	login.now = throttle.now
+
+	require.NoError(t, throttle.Failure("10.0.0.1"))
+	require.NoError(t, throttle.Failure("10.0.0.1"))
+	wait, err := throttle.Check("10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	wait, err = login.Check("", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait, "share failures don't count against logins")
+
+	now = now.Add(time.Second)
+	wait, err = throttle.Check("10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
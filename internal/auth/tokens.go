@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/config"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionRevoked      = errors.New("session revoked")
+)
+
+// TokenPair is what a client receives on login or refresh.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// TokenService issues short-lived access tokens tied to a session, and
+// rotating refresh tokens to renew them.
+type TokenService struct {
+	sessions   SessionRepository
+	issuer     *JWTIssuer
+	activity   *activityTracker
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenService(sessions SessionRepository, issuer *JWTIssuer, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		sessions:   sessions,
+		issuer:     issuer,
+		activity:   newActivityTracker(sessions),
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// NewTokenServiceFromConfig signs tokens with the given keys for JWT_ISSUER
+// and JWT_AUDIENCE, and reads the token lifetimes from ACCESS_TOKEN_TTL and
+// REFRESH_TOKEN_TTL.
+func NewTokenServiceFromConfig(sessions SessionRepository, keys *KeySet) *TokenService {
+	return NewTokenService(
+		sessions,
+		NewJWTIssuer(keys, config.GetString("JWT_ISSUER", "deeli-api"), config.GetString("JWT_AUDIENCE", "deeli-api")),
+		config.GetDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		config.GetDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+	)
+}
+
+// IssueTokens starts a new session for the user on the given client.
+func (s *TokenService) IssueTokens(userID uint, userAgent, ip string) (*TokenPair, error) {
+	now := time.Now()
+	refreshToken, record, err := s.newRefreshToken(now)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{UserID: userID, UserAgent: userAgent, IP: ip, LastSeenAt: now}
+	if err := s.sessions.CreateSession(session, record); err != nil {
+		return nil, err
+	}
+	return s.pair(session, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The old refresh
+// token stops working; presenting it again revokes the session.
+func (s *TokenService) Refresh(refreshToken string) (*TokenPair, error) {
+	now := time.Now()
+	next, record, err := s.newRefreshToken(now)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.sessions.RotateRefreshToken(HashToken(refreshToken), record, now)
+	if err != nil {
+		if err == ErrRefreshTokenReused {
+			log.Printf("Refresh token reuse detected, session revoked")
+		}
+		return nil, err
+	}
+	s.activity.touch(session.ID, now)
+	return s.pair(session, next)
+}
+
+// Revoke ends a session. Its access tokens are rejected from then on.
+func (s *TokenService) Revoke(sessionID uint) error {
+	return s.sessions.RevokeSession(sessionID)
+}
+
+// RevokeUserSession ends one of the user's sessions.
+func (s *TokenService) RevokeUserSession(userID, sessionID uint) error {
+	return s.sessions.RevokeUserSession(userID, sessionID)
+}
+
+// RevokeOtherSessions ends every session of the user except the current one.
+func (s *TokenService) RevokeOtherSessions(userID, currentID uint) (int64, error) {
+	return s.sessions.RevokeOtherSessions(userID, currentID)
+}
+
+// RevokeAllSessions ends every session of the user, e.g. after a password
+// reset.
+func (s *TokenService) RevokeAllSessions(userID uint) (int64, error) {
+	return s.sessions.RevokeOtherSessions(userID, 0)
+}
+
+// ListSessions returns the user's active sessions, including last-seen
+// times that have not been flushed yet.
+func (s *TokenService) ListSessions(userID uint) ([]Session, error) {
+	sessions, err := s.sessions.ListActiveSessions(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if at, ok := s.activity.lastSeen(sessions[i].ID); ok && at.After(sessions[i].LastSeenAt) {
+			sessions[i].LastSeenAt = at
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// SessionStartedAt returns when the user logged in to start the session.
+// Refreshing tokens doesn't change it.
+func (s *TokenService) SessionStartedAt(sessionID uint) (time.Time, error) {
+	session, err := s.sessions.GetSession(sessionID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return session.CreatedAt, nil
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (s *TokenService) JWKS() []JWK {
+	return s.issuer.Keys().JWKS()
+}
+
+// FlushActivity writes the last-seen times collected since the previous
+// flush. It runs as a worker job.
+func (s *TokenService) FlushActivity() {
+	s.activity.flush()
+}
+
+// Authenticate validates an access token and checks that its session has
+// not been revoked.
+func (s *TokenService) Authenticate(accessToken string) (*Claims, error) {
+	claims, err := s.issuer.ValidateJWT(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.sessions.GetSession(claims.SessionID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSessionRevoked
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil || session.UserID != claims.UserID {
+		return nil, ErrSessionRevoked
+	}
+	s.activity.touch(session.ID, time.Now())
+	return claims, nil
+}
+
+func (s *TokenService) pair(session *Session, refreshToken string) (*TokenPair, error) {
+	expiresAt := time.Now().Add(s.accessTTL)
+	accessToken, err := s.issuer.GenerateJWT(session.UserID, session.ID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: expiresAt}, nil
+}
+
+func (s *TokenService) newRefreshToken(now time.Time) (string, *RefreshToken, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &RefreshToken{TokenHash: HashToken(token), ExpiresAt: now.Add(s.refreshTTL)}, nil
+}
+
+// RandomToken returns 32 random bytes, base64url encoded.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes an opaque token for storage. Tokens are random, so a
+// plain SHA-256 is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
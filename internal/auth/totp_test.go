@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHOTPVectors checks the SHA-1 test vectors from RFC 6238 appendix B.
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		assert.Equal(t, v.code, hotp(key, uint64(v.unix/totpPeriod), 8), "t=%d", v.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(secret, now)
+	require.NoError(t, err)
+	assert.Equal(t, "050471", code)
+
+	step, ok := ValidateTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now), step)
+
+	// One period of drift is tolerated, two are not.
+	_, ok = ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(secret, code, now.Add(2*totpPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	// A code can't be used twice.
+	_, ok = ValidateTOTP(secret, code, now, step)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "000000", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Deeli", "a@b.com", "ABC")
+	assert.Equal(t, "otpauth://totp/Deeli:a@b.com?algorithm=SHA1&digits=6&issuer=Deeli&period=30&secret=ABC", uri)
+}
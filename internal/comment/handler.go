@@ -0,0 +1,188 @@
+package comment
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves comments on articles and the notifications they cause.
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateCommentRequest defines the JSON for commenting on an article. With
+// ParentID the comment replies to another one on the same article.
+type CreateCommentRequest struct {
+	Body     string `json:"body" binding:"required,max=5000"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// UpdateCommentRequest defines the JSON for editing a comment.
+type UpdateCommentRequest struct {
+	Body string `json:"body" binding:"required,max=5000"`
+}
+
+// pagination reads ?page= and ?limit=, capping limit at 100.
+func pagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// ListComments handles GET /articles/:id/comments
+func (h *Handler) ListComments(c *gin.Context) {
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+	page, limit := pagination(c)
+
+	threads, err := h.service.List(c.MustGet("userID").(uint), uint(articleID), page, limit)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+	c.JSON(http.StatusOK, threads)
+}
+
+// CreateComment handles POST /articles/:id/comments
+func (h *Handler) CreateComment(c *gin.Context) {
+	var req CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment body is empty"})
+		return
+	}
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	comment, err := h.service.Create(c.MustGet("userID").(uint), uint(articleID), req.ParentID, body)
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+		return
+	case ErrInvalidParent:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "parent_id must be a comment on the same article"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save comment"})
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateComment handles PATCH /comments/:id. Only the author can edit.
+func (h *Handler) UpdateComment(c *gin.Context) {
+	var req UpdateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment body is empty"})
+		return
+	}
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	comment, err := h.service.Edit(c.MustGet("userID").(uint), uint(commentID), body)
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	case ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own comments"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment handles DELETE /comments/:id
+func (h *Handler) DeleteComment(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	switch err := h.service.Delete(c.MustGet("userID").(uint), uint(commentID)); err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	case ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't delete this comment"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListNotifications handles GET /notifications. Pass ?unread=true for
+// unread ones only.
+func (h *Handler) ListNotifications(c *gin.Context) {
+	page, limit := pagination(c)
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, err := h.service.Notifications(c.MustGet("userID").(uint), unreadOnly, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// MarkNotificationRead handles POST /notifications/:id/read
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	notificationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+	if err := h.service.MarkRead(c.MustGet("userID").(uint), uint(notificationID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
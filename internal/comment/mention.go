@@ -0,0 +1,35 @@
+package comment
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxMentions caps how many users one comment can notify.
+const maxMentions = 20
+
+// mentionPattern matches "@" followed by an email address, at the start of
+// the text or after a space or opening bracket.
+var mentionPattern = regexp.MustCompile(`(?:^|[\s(\[])@([^\s@()\[\]<>,;]+@[^\s@()\[\]<>,;]+\.[^\s@()\[\]<>,;]+)`)
+
+// ParseMentions returns the email addresses mentioned as "@user@example.com"
+// in body, in order of first mention, without duplicates and at most
+// maxMentions of them. Punctuation ending a sentence is not part of the
+// address.
+func ParseMentions(body string) []string {
+	var emails []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.TrimRight(match[1], ".:!?'\"")
+		key := strings.ToLower(email)
+		if seen[key] || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+			continue
+		}
+		seen[key] = true
+		emails = append(emails, email)
+		if len(emails) == maxMentions {
+			break
+		}
+	}
+	return emails
+}
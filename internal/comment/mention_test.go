@@ -0,0 +1,37 @@
+package comment
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"no mentions here", nil},
+		{"@ann@example.com have a look", []string{"ann@example.com"}},
+		{"thanks @ann@example.com.", []string{"ann@example.com"}},
+		{"cc @ann@example.com, @bob@example.org!", []string{"ann@example.com", "bob@example.org"}},
+		{"(@ann@example.com) and @Ann@Example.com again", []string{"ann@example.com"}},
+		{"mail ann@example.com directly", nil},
+		{"not an address: @ann and @ann@localhost", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseMentions(tt.body))
+		})
+	}
+}
+
+func TestParseMentionsCapsCount(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < maxMentions+5; i++ {
+		fmt.Fprintf(&body, "@user%d@example.com ", i)
+	}
+	assert.Len(t, ParseMentions(body.String()), maxMentions)
+}
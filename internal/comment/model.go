@@ -0,0 +1,77 @@
+package comment
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KindMention is the notification a user gets when a comment mentions them.
+const KindMention = "mention"
+
+// Comment is a message on an article. A reply points at the comment it
+// answers and at the first comment of its thread, so that a whole thread
+// loads in one query.
+type Comment struct {
+	gorm.Model
+	ArticleID uint `gorm:"index;not null"`
+	UserID    uint `gorm:"index;not null"`
+	ParentID  *uint
+	RootID    *uint  `gorm:"index"`
+	Body      string `gorm:"type:text;not null"`
+	EditedAt  *time.Time
+	// RemovedAt is set when a comment with replies is deleted. Its body is
+	// cleared but it stays in place so the replies still read as a thread.
+	RemovedAt *time.Time
+}
+
+// Notification tells a user about a comment that concerns them.
+type Notification struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	Kind      string `gorm:"not null"`
+	ActorID   uint   `gorm:"not null"`
+	ArticleID uint   `gorm:"not null"`
+	CommentID uint   `gorm:"index;not null"`
+	ReadAt    *time.Time
+}
+
+// Author is the public profile of whoever wrote a comment. Comments by
+// deleted accounts have a zero ID.
+type Author struct {
+	ID          uint   `json:"id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// Entry is a comment as readers see it.
+type Entry struct {
+	ID        uint       `json:"id"`
+	ParentID  *uint      `json:"parent_id"`
+	Body      string     `json:"body"`
+	Author    Author     `json:"author" gorm:"embedded;embeddedPrefix:author_"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	Removed   bool       `json:"removed"`
+}
+
+// Thread is a top-level comment with all the replies under it, oldest
+// first. Replies carry their ParentID so clients can nest them.
+type Thread struct {
+	Entry
+	Replies []Entry `json:"replies"`
+}
+
+// NotificationView is a notification with who caused it and the start of
+// the comment.
+type NotificationView struct {
+	ID        uint       `json:"id"`
+	Kind      string     `json:"kind"`
+	ArticleID uint       `json:"article_id"`
+	CommentID uint       `json:"comment_id"`
+	Actor     Author     `json:"actor" gorm:"embedded;embeddedPrefix:actor_"`
+	Excerpt   string     `json:"excerpt"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
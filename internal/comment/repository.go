@@ -0,0 +1,189 @@
+package comment
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Repository defines the interface for comment and notification storage.
+type Repository interface {
+	// CreateComment saves the comment and notifies the mentioned users of
+	// it in one transaction.
+	CreateComment(c *Comment, mentioned []uint) error
+	GetComment(id uint) (*Comment, error)
+	// UpdateComment saves an edited body and notifies the newly mentioned
+	// users.
+	UpdateComment(c *Comment, mentioned []uint) error
+	// DeleteComment deletes the comment, or if it has replies clears its
+	// body and marks it removed.
+	DeleteComment(id uint, at time.Time) error
+	// ListThreads returns a page of the article's top-level comments, oldest
+	// first, each with all its replies.
+	ListThreads(articleID uint, page, limit int) ([]Thread, error)
+
+	// ListNotifications returns a page of the user's notifications, newest
+	// first.
+	ListNotifications(userID uint, unreadOnly bool, page, limit int) ([]NotificationView, error)
+	MarkNotificationRead(userID, id uint, at time.Time) error
+}
+
+type repository struct{}
+
+func NewRepository() Repository {
+	return &repository{}
+}
+
+func notifications(c *Comment, mentioned []uint) []Notification {
+	notes := make([]Notification, len(mentioned))
+	for i, userID := range mentioned {
+		notes[i] = Notification{UserID: userID, Kind: KindMention, ActorID: c.UserID, ArticleID: c.ArticleID, CommentID: c.ID}
+	}
+	return notes
+}
+
+func (r *repository) CreateComment(c *Comment, mentioned []uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(c).Error; err != nil {
+			return err
+		}
+		if len(mentioned) == 0 {
+			return nil
+		}
+		return tx.Create(notifications(c, mentioned)).Error
+	})
+}
+
+func (r *repository) GetComment(id uint) (*Comment, error) {
+	var c Comment
+	err := database.DB.First(&c, id).Error
+	return &c, err
+}
+
+func (r *repository) UpdateComment(c *Comment, mentioned []uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(c).Updates(map[string]interface{}{"body": c.Body, "edited_at": c.EditedAt}).Error
+		if err != nil {
+			return err
+		}
+		if len(mentioned) == 0 {
+			return nil
+		}
+		return tx.Create(notifications(c, mentioned)).Error
+	})
+}
+
+func (r *repository) DeleteComment(id uint, at time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var replies int64
+		if err := tx.Model(&Comment{}).Where("parent_id = ?", id).Count(&replies).Error; err != nil {
+			return err
+		}
+		var result *gorm.DB
+		if replies > 0 {
+			result = tx.Model(&Comment{}).Where("id = ?", id).Updates(map[string]interface{}{"body": "", "removed_at": at})
+		} else {
+			result = tx.Delete(&Comment{}, id)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("comment_id = ?", id).Delete(&Notification{}).Error
+	})
+}
+
+// entryColumns selects a comment as an Entry, with its author.
+const entryColumns = `comments.id, comments.parent_id, comments.body, comments.created_at, comments.edited_at,
+	comments.removed_at IS NOT NULL AS removed,
+	COALESCE(users.id, 0) AS author_id, COALESCE(users.display_name, '') AS author_display_name,
+	COALESCE(users.avatar_url, '') AS author_avatar_url`
+
+// entries queries comments with their authors, selecting entryColumns and
+// any extra columns.
+func entries(extra string) *gorm.DB {
+	columns := entryColumns
+	if extra != "" {
+		columns += ", " + extra
+	}
+	return database.DB.Model(&Comment{}).
+		Select(columns).
+		Joins("LEFT JOIN users ON users.id = comments.user_id AND users.deleted_at IS NULL")
+}
+
+func (r *repository) ListThreads(articleID uint, page, limit int) ([]Thread, error) {
+	var roots []Entry
+	err := entries("").
+		Where("comments.article_id = ? AND comments.root_id IS NULL", articleID).
+		Order("comments.created_at, comments.id").
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&roots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make([]Thread, len(roots))
+	if len(roots) == 0 {
+		return threads, nil
+	}
+	rootIDs := make([]uint, len(roots))
+	index := make(map[uint]int, len(roots))
+	for i, root := range roots {
+		threads[i] = Thread{Entry: root, Replies: []Entry{}}
+		rootIDs[i] = root.ID
+		index[root.ID] = i
+	}
+
+	var replies []struct {
+		Entry
+		RootID uint
+	}
+	err = entries("comments.root_id").
+		Where("comments.root_id IN ?", rootIDs).
+		Order("comments.created_at, comments.id").
+		Scan(&replies).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		i := index[reply.RootID]
+		threads[i].Replies = append(threads[i].Replies, reply.Entry)
+	}
+	return threads, nil
+}
+
+func (r *repository) ListNotifications(userID uint, unreadOnly bool, page, limit int) ([]NotificationView, error) {
+	db := database.DB.Model(&Notification{}).
+		Select(`notifications.id, notifications.kind, notifications.article_id, notifications.comment_id,
+			notifications.created_at, notifications.read_at, left(comments.body, 200) AS excerpt,
+			COALESCE(users.id, 0) AS actor_id, COALESCE(users.display_name, '') AS actor_display_name,
+			COALESCE(users.avatar_url, '') AS actor_avatar_url`).
+		Joins("JOIN comments ON comments.id = notifications.comment_id AND comments.deleted_at IS NULL").
+		Joins("LEFT JOIN users ON users.id = notifications.actor_id AND users.deleted_at IS NULL").
+		Where("notifications.user_id = ?", userID)
+	if unreadOnly {
+		db = db.Where("notifications.read_at IS NULL")
+	}
+
+	var views []NotificationView
+	err := db.Order("notifications.created_at desc, notifications.id desc").
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&views).Error
+	return views, err
+}
+
+func (r *repository) MarkNotificationRead(userID, id uint, at time.Time) error {
+	result := database.DB.Model(&Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", at))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package comment
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrForbidden is returned when a user who can see a comment tries to
+	// change it without being allowed to.
+	ErrForbidden = errors.New("not allowed to change this comment")
+	// ErrInvalidParent is returned for a reply to a comment on another
+	// article, or to a removed one.
+	ErrInvalidParent = errors.New("invalid parent comment")
+)
+
+// Service checks who may read and write comments and works out whom they
+// mention. Anyone who can read an article can comment on it: in a workspace
+// that is every member.
+type Service struct {
+	repo        Repository
+	articles    article.Repository
+	memberships article.Memberships
+	users       user.Repository
+	now         func() time.Time
+}
+
+func NewService(repo Repository, articles article.Repository, memberships article.Memberships, users user.Repository) *Service {
+	return &Service{repo: repo, articles: articles, memberships: memberships, users: users, now: time.Now}
+}
+
+// Create adds a comment to the article, or with parentID a reply to another
+// comment on it. It returns gorm.ErrRecordNotFound if the user can't see the
+// article.
+func (s *Service) Create(userID, articleID uint, parentID *uint, body string) (*Comment, error) {
+	if _, err := s.articles.GetAccessibleArticle(articleID, userID, article.AccessRead); err != nil {
+		return nil, err
+	}
+	c := &Comment{ArticleID: articleID, UserID: userID, Body: body}
+	if parentID != nil {
+		parent, err := s.repo.GetComment(*parentID)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, ErrInvalidParent
+			}
+			return nil, err
+		}
+		if parent.ArticleID != articleID || parent.RemovedAt != nil {
+			return nil, ErrInvalidParent
+		}
+		c.ParentID = &parent.ID
+		c.RootID = parent.RootID
+		if c.RootID == nil {
+			c.RootID = &parent.ID
+		}
+	}
+
+	mentioned, err := s.mentioned(articleID, userID, body, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateComment(c, mentioned); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Edit changes the body of one of the user's comments. Only users mentioned
+// for the first time are notified.
+func (s *Service) Edit(userID, commentID uint, body string) (*Comment, error) {
+	c, err := s.visibleComment(userID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserID != userID {
+		return nil, ErrForbidden
+	}
+
+	mentioned, err := s.mentioned(c.ArticleID, userID, body, c.Body)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	c.Body = body
+	c.EditedAt = &now
+	if err := s.repo.UpdateComment(c, mentioned); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Delete deletes a comment. Authors can delete their own comments; the
+// owner of the article's library, or in a workspace its owners, can delete
+// anyone's.
+func (s *Service) Delete(userID, commentID uint) error {
+	c, err := s.visibleComment(userID, commentID)
+	if err != nil {
+		return err
+	}
+	if c.UserID != userID {
+		moderator, err := s.moderates(userID, c.ArticleID)
+		if err != nil {
+			return err
+		}
+		if !moderator {
+			return ErrForbidden
+		}
+	}
+	return s.repo.DeleteComment(c.ID, s.now())
+}
+
+// List returns a page of the article's threads. It returns
+// gorm.ErrRecordNotFound if the user can't see the article.
+func (s *Service) List(userID, articleID uint, page, limit int) ([]Thread, error) {
+	if _, err := s.articles.GetAccessibleArticle(articleID, userID, article.AccessRead); err != nil {
+		return nil, err
+	}
+	return s.repo.ListThreads(articleID, page, limit)
+}
+
+func (s *Service) Notifications(userID uint, unreadOnly bool, page, limit int) ([]NotificationView, error) {
+	return s.repo.ListNotifications(userID, unreadOnly, page, limit)
+}
+
+func (s *Service) MarkRead(userID, notificationID uint) error {
+	return s.repo.MarkNotificationRead(userID, notificationID, s.now())
+}
+
+// visibleComment loads a comment that hasn't been removed, on an article
+// the user can see. Anything else is gorm.ErrRecordNotFound.
+func (s *Service) visibleComment(userID, commentID uint) (*Comment, error) {
+	c, err := s.repo.GetComment(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if c.RemovedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if _, err := s.articles.GetAccessibleArticle(c.ArticleID, userID, article.AccessRead); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// moderates reports whether the user may delete others' comments on the
+// article.
+func (s *Service) moderates(userID, articleID uint) (bool, error) {
+	art, err := s.articles.GetArticleByID(articleID)
+	if err != nil {
+		return false, err
+	}
+	if art.WorkspaceID == nil {
+		return art.UserID == userID, nil
+	}
+	role, err := s.memberships.MemberRole(*art.WorkspaceID, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return role == workspace.RoleOwner, nil
+}
+
+// mentioned returns the users mentioned in body but not in previous who can
+// see the article, other than the author. Addresses that don't belong to
+// such a user are ignored, so mentions don't reveal who has an account.
+func (s *Service) mentioned(articleID, authorID uint, body, previous string) ([]uint, error) {
+	already := make(map[string]bool)
+	for _, email := range ParseMentions(previous) {
+		already[strings.ToLower(email)] = true
+	}
+
+	var userIDs []uint
+	for _, email := range ParseMentions(body) {
+		if already[strings.ToLower(email)] {
+			continue
+		}
+		u, err := s.users.GetUserByEmail(email)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				continue
+			}
+			return nil, err
+		}
+		if u.ID == authorID {
+			continue
+		}
+		if _, err := s.articles.GetAccessibleArticle(articleID, u.ID, article.AccessRead); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				continue
+			}
+			return nil, err
+		}
+		userIDs = append(userIDs, u.ID)
+	}
+	return userIDs, nil
+}
@@ -0,0 +1,193 @@
+package comment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryRepository is a Repository for comments and their mentions, kept
+// in maps. Threads and notification listings need the database.
+type memoryRepository struct {
+	Repository
+	comments map[uint]*Comment
+	notified map[uint][]uint // comment ID to mentioned users
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{comments: make(map[uint]*Comment), notified: make(map[uint][]uint)}
+}
+
+func (r *memoryRepository) CreateComment(c *Comment, mentioned []uint) error {
+	c.ID = uint(len(r.comments) + 1)
+	stored := *c
+	r.comments[c.ID] = &stored
+	r.notified[c.ID] = append(r.notified[c.ID], mentioned...)
+	return nil
+}
+
+func (r *memoryRepository) GetComment(id uint) (*Comment, error) {
+	c, ok := r.comments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *c
+	return &found, nil
+}
+
+func (r *memoryRepository) UpdateComment(c *Comment, mentioned []uint) error {
+	stored := *c
+	r.comments[c.ID] = &stored
+	r.notified[c.ID] = append(r.notified[c.ID], mentioned...)
+	return nil
+}
+
+func (r *memoryRepository) DeleteComment(id uint, at time.Time) error {
+	for _, c := range r.comments {
+		if c.ParentID != nil && *c.ParentID == id {
+			r.comments[id].Body = ""
+			r.comments[id].RemovedAt = &at
+			return nil
+		}
+	}
+	delete(r.comments, id)
+	return nil
+}
+
+// users is a user.Repository that finds users by email.
+type users struct {
+	user.Repository
+	byEmail map[string]uint
+}
+
+func (u users) GetUserByEmail(email string) (*user.User, error) {
+	id, ok := u.byEmail[email]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user.User{Model: gorm.Model{ID: id}, Email: email}, nil
+}
+
+// roles is an article.Memberships backed by a map of roles per workspace.
+type roles map[uint]map[uint]string
+
+func (r roles) MemberRole(workspaceID, userID uint) (string, error) {
+	if role, ok := r[workspaceID][userID]; ok {
+		return role, nil
+	}
+	return "", gorm.ErrRecordNotFound
+}
+
+const (
+	owner uint = iota + 1
+	editor
+	viewer
+	outsider
+)
+
+// newTestService sets up a workspace article, saved by the editor, and a
+// personal article of the outsider.
+func newTestService(t *testing.T) (*Service, *memoryRepository, roles) {
+	t.Helper()
+	workspaceID := uint(7)
+	members := roles{workspaceID: {owner: workspace.RoleOwner, editor: workspace.RoleEditor, viewer: workspace.RoleViewer}}
+	articles := article.NewMemoryRepositoryWithMemberships(members)
+	require.NoError(t, articles.CreateArticle(&article.Article{Model: gorm.Model{ID: 1}, UserID: editor, WorkspaceID: &workspaceID, URL: "https://example.com/team"}))
+	require.NoError(t, articles.CreateArticle(&article.Article{Model: gorm.Model{ID: 2}, UserID: outsider, URL: "https://example.com/own"}))
+	repo := newMemoryRepository()
+	directory := users{byEmail: map[string]uint{
+		"owner@example.com":    owner,
+		"editor@example.com":   editor,
+		"viewer@example.com":   viewer,
+		"outsider@example.com": outsider,
+	}}
+	return NewService(repo, articles, members, directory), repo, members
+}
+
+func TestCommentsNeedAccessToTheArticle(t *testing.T) {
+	service, _, _ := newTestService(t)
+
+	_, err := service.Create(outsider, 1, nil, "let me in")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = service.List(outsider, 1, 1, 10)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = service.Create(viewer, 2, nil, "not mine")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	c, err := service.Create(viewer, 1, nil, "viewers can comment")
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.Delete(outsider, c.ID), gorm.ErrRecordNotFound)
+	_, err = service.Edit(outsider, c.ID, "hijacked")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestMentionsOnlyNotifyUsersWhoCanSeeTheArticle(t *testing.T) {
+	service, repo, _ := newTestService(t)
+
+	// The outsider, the author and unknown addresses are skipped.
+	c, err := service.Create(viewer, 1, nil, "@editor@example.com @outsider@example.com @viewer@example.com @nobody@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{editor}, repo.notified[c.ID])
+
+	// Editing notifies only users mentioned for the first time.
+	edited := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return edited }
+	c, err = service.Edit(viewer, c.ID, "@Editor@example.com and @owner@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{editor, owner}, repo.notified[c.ID])
+	require.NotNil(t, c.EditedAt)
+	assert.Equal(t, edited, *c.EditedAt)
+
+	_, err = service.Edit(editor, c.ID, "not my comment")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestMentionsFollowMembership(t *testing.T) {
+	service, repo, members := newTestService(t)
+	delete(members[7], editor)
+
+	c, err := service.Create(owner, 1, nil, "@editor@example.com left, @viewer@example.com didn't")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{viewer}, repo.notified[c.ID])
+}
+
+func TestDeleteComment(t *testing.T) {
+	service, repo, _ := newTestService(t)
+	c, err := service.Create(viewer, 1, nil, "first")
+	require.NoError(t, err)
+
+	// Saving the article doesn't make the editor a moderator; owning the
+	// workspace does.
+	assert.ErrorIs(t, service.Delete(editor, c.ID), ErrForbidden)
+	require.NoError(t, service.Delete(owner, c.ID))
+	assert.NotContains(t, repo.comments, c.ID)
+
+	// Authors delete their own comments, which stay as placeholders while
+	// they have replies.
+	parent, err := service.Create(viewer, 1, nil, "parent")
+	require.NoError(t, err)
+	reply, err := service.Create(editor, 1, &parent.ID, "reply")
+	require.NoError(t, err)
+	assert.Equal(t, parent.ID, *reply.RootID)
+	removed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return removed }
+	require.NoError(t, service.Delete(viewer, parent.ID))
+	placeholder := repo.comments[parent.ID]
+	require.NotNil(t, placeholder)
+	assert.Empty(t, placeholder.Body)
+	assert.Equal(t, removed, *placeholder.RemovedAt)
+
+	// A removed comment can't be changed or replied to.
+	_, err = service.Edit(viewer, parent.ID, "back")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = service.Create(editor, 1, &parent.ID, "another reply")
+	assert.ErrorIs(t, err, ErrInvalidParent)
+	_, err = service.Create(outsider, 2, &reply.ID, "wrong article")
+	assert.ErrorIs(t, err, ErrInvalidParent)
+}
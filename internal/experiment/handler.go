@@ -0,0 +1,153 @@
+package experiment
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	repo       Repository
+	router     *Router
+	strategies map[string]bool
+}
+
+// NewHandler creates the experiment admin handler. Variants may only use the
+// given recommendation strategies.
+func NewHandler(repo Repository, router *Router, strategies []string) *Handler {
+	known := make(map[string]bool, len(strategies))
+	for _, s := range strategies {
+		known[s] = true
+	}
+	return &Handler{repo: repo, router: router, strategies: known}
+}
+
+// VariantRequest defines one variant of a new experiment.
+type VariantRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Strategy string `json:"strategy" binding:"required"`
+	Weight   int    `json:"weight" binding:"required,min=1"`
+}
+
+// CreateExperimentRequest defines the JSON for creating an experiment.
+type CreateExperimentRequest struct {
+	Name        string           `json:"name" binding:"required"`
+	Description string           `json:"description"`
+	Variants    []VariantRequest `json:"variants" binding:"required,min=2,dive"`
+}
+
+// CreateExperiment handles POST /admin/experiments
+func (h *Handler) CreateExperiment(c *gin.Context) {
+	var req CreateExperimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	experiment := &Experiment{Name: req.Name, Description: req.Description}
+	seen := make(map[string]bool, len(req.Variants))
+	for _, v := range req.Variants {
+		if seen[v.Name] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Variant names must be unique"})
+			return
+		}
+		seen[v.Name] = true
+		if !h.strategies[v.Strategy] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown strategy: " + v.Strategy})
+			return
+		}
+		experiment.Variants = append(experiment.Variants, Variant{Name: v.Name, Strategy: v.Strategy, Weight: v.Weight})
+	}
+
+	if err := h.repo.CreateExperiment(experiment); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Experiment already exists"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, experiment)
+}
+
+// ListExperiments handles GET /admin/experiments
+func (h *Handler) ListExperiments(c *gin.Context) {
+	experiments, err := h.repo.ListExperiments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve experiments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, experiments)
+}
+
+// StartExperiment handles POST /admin/experiments/:id/start. Any other
+// running experiment is stopped.
+func (h *Handler) StartExperiment(c *gin.Context) {
+	h.setRunning(c, h.repo.StartExperiment)
+}
+
+// StopExperiment handles POST /admin/experiments/:id/stop
+func (h *Handler) StopExperiment(c *gin.Context) {
+	h.setRunning(c, h.repo.StopExperiment)
+}
+
+func (h *Handler) setRunning(c *gin.Context, update func(id uint) error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid experiment ID"})
+		return
+	}
+
+	if err := update(uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Experiment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update experiment"})
+		return
+	}
+	h.router.Reload()
+
+	experiment, err := h.repo.GetExperiment(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve experiment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, experiment)
+}
+
+// GetResults handles GET /admin/experiments/:id/results
+func (h *Handler) GetResults(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid experiment ID"})
+		return
+	}
+
+	experiment, err := h.repo.GetExperiment(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Experiment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	counts, err := h.repo.GetEventCounts(experiment.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute experiment results"})
+		return
+	}
+	outcomes, err := h.repo.GetRatingOutcomes(experiment.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute experiment results"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"experiment": experiment,
+		"variants":   Results(experiment, counts, outcomes),
+	})
+}
@@ -0,0 +1,71 @@
+package experiment
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Experiment splits recommendation traffic between variants. At most one
+// experiment runs at a time.
+type Experiment struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	Running     bool `gorm:"index;not null;default:false"`
+	StartedAt   *time.Time
+	StoppedAt   *time.Time
+	Variants    []Variant
+}
+
+// Variant is one arm of an experiment: the strategy its users get and its
+// share of traffic relative to the other variants' weights.
+type Variant struct {
+	gorm.Model
+	ExperimentID uint   `gorm:"uniqueIndex:idx_experiment_variant;not null"`
+	Name         string `gorm:"uniqueIndex:idx_experiment_variant;not null"`
+	Strategy     string `gorm:"not null"`
+	Weight       int    `gorm:"not null"`
+}
+
+// Interval is a 95% confidence interval.
+type Interval struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// VariantResult summarises how a variant performed. Rating outcomes count
+// distinct recommended articles that the user rated after first seeing them.
+type VariantResult struct {
+	Variant            string   `json:"variant"`
+	Strategy           string   `json:"strategy"`
+	Users              int64    `json:"users"`
+	Impressions        int64    `json:"impressions"`
+	Clicks             int64    `json:"clicks"`
+	CTR                float64  `json:"ctr"`
+	CTRInterval        Interval `json:"ctr_interval"`
+	Recommended        int64    `json:"recommended"`
+	Rated              int64    `json:"rated"`
+	RatingRate         float64  `json:"rating_rate"`
+	RatingRateInterval Interval `json:"rating_rate_interval"`
+	MeanRating         float64  `json:"mean_rating"`
+	MeanRatingInterval Interval `json:"mean_rating_interval"`
+}
+
+// EventCounts holds a variant's impression and click totals.
+type EventCounts struct {
+	Variant     string
+	Users       int64
+	Impressions int64
+	Clicks      int64
+}
+
+// RatingOutcomes holds how often a variant's recommendations were later
+// rated, and the scores they got.
+type RatingOutcomes struct {
+	Variant     string
+	Recommended int64
+	Rated       int64
+	MeanScore   float64
+	StddevScore float64
+}
@@ -0,0 +1,124 @@
+package experiment
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Repository defines the interface for experiment storage and the
+// aggregates used to evaluate them.
+type Repository interface {
+	CreateExperiment(experiment *Experiment) error
+	ListExperiments() ([]Experiment, error)
+	GetExperiment(id uint) (*Experiment, error)
+	GetRunningExperiment() (*Experiment, error)
+	StartExperiment(id uint) error
+	StopExperiment(id uint) error
+	GetEventCounts(name string) ([]EventCounts, error)
+	GetRatingOutcomes(name string) ([]RatingOutcomes, error)
+}
+
+type repository struct{}
+
+func NewRepository() Repository {
+	return &repository{}
+}
+
+func (r *repository) CreateExperiment(experiment *Experiment) error {
+	return database.DB.Create(experiment).Error
+}
+
+func (r *repository) ListExperiments() ([]Experiment, error) {
+	var experiments []Experiment
+	err := database.DB.Preload("Variants").Order("created_at desc").Find(&experiments).Error
+	return experiments, err
+}
+
+func (r *repository) GetExperiment(id uint) (*Experiment, error) {
+	var experiment Experiment
+	err := database.DB.Preload("Variants").First(&experiment, id).Error
+	return &experiment, err
+}
+
+func (r *repository) GetRunningExperiment() (*Experiment, error) {
+	var experiment Experiment
+	err := database.DB.Preload("Variants").Where("running = ?", true).First(&experiment).Error
+	return &experiment, err
+}
+
+// StartExperiment stops whichever experiment is running and starts this one.
+func (r *repository) StartExperiment(id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&Experiment{}).Where("running = ? AND id != ?", true, id).
+			Updates(map[string]interface{}{"running": false, "stopped_at": now}).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&Experiment{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"running": true, "started_at": now, "stopped_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *repository) StopExperiment(id uint) error {
+	result := database.DB.Model(&Experiment{}).Where("id = ? AND running = ?", id, true).
+		Updates(map[string]interface{}{"running": false, "stopped_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *repository) GetEventCounts(name string) ([]EventCounts, error) {
+	var counts []EventCounts
+	err := database.DB.Model(&recommendation.Event{}).
+		Select("variant, "+
+			"COUNT(DISTINCT user_id) AS users, "+
+			"COUNT(*) FILTER (WHERE type = ?) AS impressions, "+
+			"COUNT(*) FILTER (WHERE type = ?) AS clicks", recommendation.EventImpression, recommendation.EventClick).
+		Where("experiment = ?", name).
+		Group("variant").
+		Order("variant").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// GetRatingOutcomes pairs each recommended article with the first time the
+// variant showed it to the user, and looks for a rating made after that.
+func (r *repository) GetRatingOutcomes(name string) ([]RatingOutcomes, error) {
+	var outcomes []RatingOutcomes
+	err := database.DB.Raw(`
+		WITH shown AS (
+			SELECT variant, user_id, article_id, MIN(created_at) AS first_seen
+			FROM events
+			WHERE experiment = @experiment AND type = @impression
+			GROUP BY variant, user_id, article_id
+		)
+		SELECT shown.variant AS variant,
+			COUNT(*) AS recommended,
+			COUNT(ratings.id) AS rated,
+			COALESCE(AVG(ratings.score), 0) AS mean_score,
+			COALESCE(STDDEV_SAMP(ratings.score), 0) AS stddev_score
+		FROM shown
+		LEFT JOIN ratings ON ratings.user_id = shown.user_id
+			AND ratings.article_id = shown.article_id
+			AND ratings.deleted_at IS NULL
+			AND ratings.created_at >= shown.first_seen
+		GROUP BY shown.variant
+		ORDER BY shown.variant`,
+		map[string]interface{}{"experiment": name, "impression": recommendation.EventImpression},
+	).Scan(&outcomes).Error
+	return outcomes, err
+}
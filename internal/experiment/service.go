@@ -0,0 +1,170 @@
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"gorm.io/gorm"
+)
+
+// z95 is the standard normal quantile for a two-sided 95% interval.
+const z95 = 1.959963984540054
+
+// Assign deterministically places a user in one of the experiment's
+// variants. The user ID is hashed with the experiment name, so the same user
+// always gets the same variant within an experiment but assignments are
+// independent across experiments. Traffic is split in proportion to weight.
+func Assign(experiment *Experiment, userID uint) *Variant {
+	total := 0
+	for _, v := range experiment.Variants {
+		if v.Weight > 0 {
+			total += v.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(experiment.Name + ":" + strconv.FormatUint(uint64(userID), 10)))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for i := range experiment.Variants {
+		v := &experiment.Variants[i]
+		if v.Weight <= 0 {
+			continue
+		}
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return nil
+}
+
+// Router assigns users to the running experiment's variants. It implements
+// recommendation.Router. The running experiment is re-read at most once per
+// ttl, or immediately after Reload.
+type Router struct {
+	repo            Repository
+	defaultStrategy string
+	ttl             time.Duration
+
+	mu       sync.Mutex
+	running  *Experiment
+	loadedAt time.Time
+}
+
+// NewRouter creates a router that falls back to defaultStrategy when no
+// experiment is running.
+func NewRouter(repo Repository, defaultStrategy string, ttl time.Duration) *Router {
+	return &Router{repo: repo, defaultStrategy: defaultStrategy, ttl: ttl}
+}
+
+// Route returns the strategy, experiment and variant for a user.
+func (r *Router) Route(userID uint) (recommendation.Attribution, error) {
+	experiment, err := r.runningExperiment()
+	if err != nil {
+		return recommendation.Attribution{}, err
+	}
+	if experiment == nil {
+		return recommendation.Attribution{Strategy: r.defaultStrategy}, nil
+	}
+	variant := Assign(experiment, userID)
+	if variant == nil {
+		return recommendation.Attribution{Strategy: r.defaultStrategy}, nil
+	}
+	return recommendation.Attribution{
+		Strategy:   variant.Strategy,
+		Experiment: experiment.Name,
+		Variant:    variant.Name,
+	}, nil
+}
+
+// Reload makes the next Route re-read the running experiment.
+func (r *Router) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loadedAt = time.Time{}
+}
+
+func (r *Router) runningExperiment() (*Experiment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < r.ttl {
+		return r.running, nil
+	}
+	experiment, err := r.repo.GetRunningExperiment()
+	if err == gorm.ErrRecordNotFound {
+		experiment, err = nil, nil
+	}
+	if err != nil {
+		log.Printf("Error loading running experiment: %v", err)
+		return nil, err
+	}
+	r.running = experiment
+	r.loadedAt = time.Now()
+	return r.running, nil
+}
+
+// Results computes each variant's CTR and rating-after-recommendation with
+// 95% confidence intervals: Wilson score intervals for the proportions and a
+// normal approximation for the mean rating.
+func Results(experiment *Experiment, counts []EventCounts, outcomes []RatingOutcomes) []VariantResult {
+	countsByVariant := make(map[string]EventCounts, len(counts))
+	for _, c := range counts {
+		countsByVariant[c.Variant] = c
+	}
+	outcomesByVariant := make(map[string]RatingOutcomes, len(outcomes))
+	for _, o := range outcomes {
+		outcomesByVariant[o.Variant] = o
+	}
+
+	results := make([]VariantResult, 0, len(experiment.Variants))
+	for _, v := range experiment.Variants {
+		c := countsByVariant[v.Name]
+		o := outcomesByVariant[v.Name]
+		result := VariantResult{
+			Variant:     v.Name,
+			Strategy:    v.Strategy,
+			Users:       c.Users,
+			Impressions: c.Impressions,
+			Clicks:      c.Clicks,
+			Recommended: o.Recommended,
+			Rated:       o.Rated,
+			MeanRating:  o.MeanScore,
+		}
+		result.CTR, result.CTRInterval = wilson(c.Clicks, c.Impressions)
+		result.RatingRate, result.RatingRateInterval = wilson(o.Rated, o.Recommended)
+		result.MeanRatingInterval = meanInterval(o.MeanScore, o.StddevScore, o.Rated)
+		results = append(results, result)
+	}
+	return results
+}
+
+// wilson returns the observed proportion and its Wilson score interval.
+func wilson(successes, trials int64) (float64, Interval) {
+	if trials <= 0 {
+		return 0, Interval{}
+	}
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := z95 * z95
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := z95 / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return p, Interval{Low: math.Max(0, center-margin), High: math.Min(1, center+margin)}
+}
+
+// meanInterval returns the normal-approximation interval around a sample mean.
+func meanInterval(mean, stddev float64, n int64) Interval {
+	if n <= 0 {
+		return Interval{}
+	}
+	margin := z95 * stddev / math.Sqrt(float64(n))
+	return Interval{Low: mean - margin, High: mean + margin}
+}
@@ -0,0 +1,65 @@
+package experiment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testExperiment() *Experiment {
+	return &Experiment{
+		Name: "mf-vs-peer",
+		Variants: []Variant{
+			{Name: "control", Strategy: "peer", Weight: 1},
+			{Name: "treatment", Strategy: "mf", Weight: 3},
+		},
+	}
+}
+
+func TestAssignIsDeterministic(t *testing.T) {
+	experiment := testExperiment()
+	for userID := uint(1); userID <= 100; userID++ {
+		assert.Equal(t, Assign(experiment, userID).Name, Assign(experiment, userID).Name)
+	}
+}
+
+func TestAssignFollowsWeights(t *testing.T) {
+	experiment := testExperiment()
+	counts := map[string]int{}
+	for userID := uint(1); userID <= 10000; userID++ {
+		counts[Assign(experiment, userID).Name]++
+	}
+	assert.InDelta(t, 2500, counts["control"], 200)
+	assert.InDelta(t, 7500, counts["treatment"], 200)
+}
+
+func TestAssignWithoutWeights(t *testing.T) {
+	assert.Nil(t, Assign(&Experiment{Name: "empty"}, 1))
+}
+
+func TestWilson(t *testing.T) {
+	p, interval := wilson(10, 100)
+	assert.InDelta(t, 0.1, p, 1e-9)
+	assert.InDelta(t, 0.0552, interval.Low, 1e-4)
+	assert.InDelta(t, 0.1744, interval.High, 1e-4)
+
+	p, interval = wilson(0, 0)
+	assert.Zero(t, p)
+	assert.Equal(t, Interval{}, interval)
+}
+
+func TestResults(t *testing.T) {
+	experiment := testExperiment()
+	results := Results(experiment,
+		[]EventCounts{{Variant: "treatment", Users: 2, Impressions: 100, Clicks: 10}},
+		[]RatingOutcomes{{Variant: "treatment", Recommended: 50, Rated: 25, MeanScore: 4, StddevScore: 1}},
+	)
+
+	assert.Len(t, results, 2)
+	assert.Equal(t, "control", results[0].Variant)
+	assert.Zero(t, results[0].Impressions)
+	assert.Equal(t, "mf", results[1].Strategy)
+	assert.InDelta(t, 0.1, results[1].CTR, 1e-9)
+	assert.InDelta(t, 0.5, results[1].RatingRate, 1e-9)
+	assert.InDelta(t, 4-1.96*0.2, results[1].MeanRatingInterval.Low, 1e-3)
+}
@@ -0,0 +1,291 @@
+package feed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/feeds"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the user's feed subscriptions, and their articles as
+// feeds.
+type Handler struct {
+	service *Service
+	outputs *OutputService
+	baseURL string
+}
+
+// NewHandler creates a Handler. Output feeds are served at
+// baseURL + "/feeds/out/" + token + "." + format.
+func NewHandler(service *Service, outputs *OutputService, baseURL string) *Handler {
+	return &Handler{service: service, outputs: outputs, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// FeedResponse is a subscription as its owner sees it.
+type FeedResponse struct {
+	ID            uint       `json:"id"`
+	URL           string     `json:"url"`
+	Title         string     `json:"title"`
+	SiteURL       string     `json:"site_url"`
+	WorkspaceID   *uint      `json:"workspace_id"`
+	Public        bool       `json:"public"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+	NextFetchAt   time.Time  `json:"next_fetch_at"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+func newFeedResponse(f *Feed) FeedResponse {
+	return FeedResponse{
+		ID:            f.ID,
+		URL:           f.URL,
+		Title:         f.Title,
+		SiteURL:       f.SiteURL,
+		WorkspaceID:   f.WorkspaceID,
+		Public:        f.Public,
+		CreatedAt:     f.CreatedAt,
+		LastFetchedAt: f.LastFetchedAt,
+		NextFetchAt:   f.NextFetchAt,
+		LastError:     f.LastError,
+	}
+}
+
+// SubscribeRequest defines the JSON for subscribing to a feed. URL may be
+// the feed itself or a page that links to it. With WorkspaceID new items
+// are saved to the workspace, and with Public they are made public.
+type SubscribeRequest struct {
+	URL         string `json:"url" binding:"required,url"`
+	WorkspaceID *uint  `json:"workspace_id"`
+	Public      bool   `json:"public"`
+}
+
+// Subscribe handles POST /feeds
+func (h *Handler) Subscribe(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.WorkspaceID != nil && req.Public {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Workspace articles can't be public"})
+		return
+	}
+
+	feed, err := h.service.Subscribe(c.MustGet("userID").(uint), req.URL, Rules{WorkspaceID: req.WorkspaceID, Public: req.Public})
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	case ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You need the editor role to save to this workspace"})
+		return
+	case ErrNoFeedFound:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No RSS, Atom or JSON feed found at this URL"})
+		return
+	case ErrFetchFailed:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not fetch this URL"})
+		return
+	case ErrAlreadySubscribed:
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already subscribed to this feed"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe to feed"})
+		return
+	}
+	c.JSON(http.StatusCreated, newFeedResponse(feed))
+}
+
+// ListFeeds handles GET /feeds
+func (h *Handler) ListFeeds(c *gin.Context) {
+	feeds, err := h.service.List(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve feeds"})
+		return
+	}
+
+	response := make([]FeedResponse, len(feeds))
+	for i := range feeds {
+		response[i] = newFeedResponse(&feeds[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Unsubscribe handles DELETE /feeds/:id. Articles already saved from the
+// feed are kept.
+func (h *Handler) Unsubscribe(c *gin.Context) {
+	feedID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+		return
+	}
+	if err := h.service.Unsubscribe(c.MustGet("userID").(uint), uint(feedID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe from feed"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// TokenResponse is a feed token as its owner sees it. Token and URLs are
+// only set when the token is created.
+type TokenResponse struct {
+	ID          uint              `json:"id"`
+	Prefix      string            `json:"prefix"`
+	Source      string            `json:"source"`
+	WorkspaceID *uint             `json:"workspace_id"`
+	Token       string            `json:"token,omitempty"`
+	URLs        map[string]string `json:"urls,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	LastUsedAt  *time.Time        `json:"last_used_at"`
+}
+
+func newTokenResponse(t *Token) TokenResponse {
+	return TokenResponse{
+		ID:          t.ID,
+		Prefix:      t.Prefix,
+		Source:      t.Source,
+		WorkspaceID: t.WorkspaceID,
+		CreatedAt:   t.CreatedAt,
+		LastUsedAt:  t.LastUsedAt,
+	}
+}
+
+// CreateTokenRequest defines the JSON for creating a feed token. A
+// workspace feed needs WorkspaceID.
+type CreateTokenRequest struct {
+	Source      string `json:"source" binding:"required,oneof=saves favorites workspace"`
+	WorkspaceID *uint  `json:"workspace_id"`
+}
+
+// CreateToken handles POST /feed-tokens
+func (h *Handler) CreateToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Source == SourceWorkspace && req.WorkspaceID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "workspace_id is required for a workspace feed"})
+		return
+	}
+
+	plain, token, err := h.outputs.CreateToken(c.MustGet("userID").(uint), req.Source, req.WorkspaceID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feed token"})
+		return
+	}
+
+	response := newTokenResponse(token)
+	response.Token = plain
+	response.URLs = make(map[string]string, len(feeds.ContentTypes))
+	for format := range feeds.ContentTypes {
+		response.URLs[format] = h.baseURL + "/feeds/out/" + plain + "." + format
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListTokens handles GET /feed-tokens
+func (h *Handler) ListTokens(c *gin.Context) {
+	tokens, err := h.outputs.ListTokens(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve feed tokens"})
+		return
+	}
+
+	response := make([]TokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = newTokenResponse(&tokens[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeToken handles DELETE /feed-tokens/:id
+func (h *Handler) RevokeToken(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed token ID"})
+		return
+	}
+	if err := h.outputs.RevokeToken(c.MustGet("userID").(uint), uint(tokenID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feed token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke feed token"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Output handles GET /feeds/out/:file, where the file is the token with an
+// .atom, .rss or .json extension. It is open to anyone with the token, and
+// answers conditional requests with 304 Not Modified. The ETag takes
+// precedence; Last-Modified is the feed's update time, which moves when an
+// article is removed as well as when one changes.
+func (h *Handler) Output(c *gin.Context) {
+	file := c.Param("file")
+	dot := strings.LastIndexByte(file, '.')
+	if dot < 0 || feeds.ContentTypes[file[dot+1:]] == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+	plain, format := file[:dot], file[dot+1:]
+
+	out, err := h.outputs.Build(plain, h.baseURL+"/feeds/out/"+file)
+	if err != nil {
+		if err == ErrTokenNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build feed"})
+		return
+	}
+	body, err := feeds.Write(format, out)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build feed"})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	lastModified := out.Updated.UTC().Truncate(time.Second)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("Referrer-Policy", "no-referrer")
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, feeds.ContentTypes[format], body)
+}
+
+// notModified reports whether If-None-Match matches the feed's ETag or,
+// without one, whether the feed is unchanged since If-Modified-Since.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.After(since)
+}
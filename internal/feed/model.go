@@ -0,0 +1,88 @@
+// Package feed subscribes users to RSS, Atom and JSON feeds and saves the
+// new items of each feed to their library, and publishes users' articles as
+// feeds of their own.
+package feed
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenPrefix starts every output feed token.
+const TokenPrefix = "dlf_"
+
+// Sources of an output feed.
+const (
+	// SourceSaves is the user's own library.
+	SourceSaves = "saves"
+	// SourceFavorites is the articles the user rated highly, wherever
+	// they were saved.
+	SourceFavorites = "favorites"
+	// SourceWorkspace is a workspace's library.
+	SourceWorkspace = "workspace"
+)
+
+// Feed is a user's subscription to a feed. Its rules say where new items
+// are saved: WorkspaceID saves them to a workspace instead of the user's own
+// library, and Public makes them public. A subscription is deleted outright
+// so that the user can subscribe again later.
+type Feed struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint `gorm:"uniqueIndex:idx_user_feed;not null"`
+	// URL is the feed itself, found from the page the user gave if needed.
+	URL         string `gorm:"uniqueIndex:idx_user_feed;not null"`
+	Title       string
+	SiteURL     string
+	WorkspaceID *uint `gorm:"index"`
+	Public      bool  `gorm:"not null;default:false"`
+	// ETag and LastModified come from the last response, to make the next
+	// fetch conditional.
+	ETag          string
+	LastModified  string
+	LastFetchedAt *time.Time
+	NextFetchAt   time.Time `gorm:"index;not null"`
+	// LastError and ErrorCount describe the failures since the last
+	// successful fetch; polling backs off while they last.
+	LastError  string
+	ErrorCount int `gorm:"not null;default:0"`
+}
+
+// Entry records an item of a feed that has been seen, so that it is saved
+// at most once. ArticleID is nil for items that weren't saved: those in the
+// feed when the user subscribed, or already in the library.
+type Entry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	FeedID    uint   `gorm:"uniqueIndex:idx_feed_guid;index:idx_feed_url;not null"`
+	GUID      string `gorm:"uniqueIndex:idx_feed_guid;not null"`
+	URL       string `gorm:"index:idx_feed_url;not null"`
+	ArticleID *uint
+}
+
+// TableName keeps the table from being called just "entries".
+func (Entry) TableName() string {
+	return "feed_entries"
+}
+
+// Token lets a feed reader fetch some of the user's articles as a feed,
+// without logging in. It is separate from the login tokens, so that it can
+// be given to a reader and revoked on its own. Only a hash of the token is
+// stored; Prefix keeps enough of it for the owner to recognise it.
+type Token struct {
+	gorm.Model
+	UserID      uint   `gorm:"index;not null"`
+	Prefix      string `gorm:"not null"`
+	TokenHash   string `gorm:"uniqueIndex;not null"`
+	Source      string `gorm:"not null"`
+	WorkspaceID *uint  `gorm:"index"`
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+}
+
+// TableName keeps feed tokens apart from the login tokens.
+func (Token) TableName() string {
+	return "feed_tokens"
+}
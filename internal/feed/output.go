@@ -0,0 +1,178 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/cheildo/deeli-api/pkg/feeds"
+)
+
+const (
+	// outputSize is how many articles an output feed lists.
+	outputSize = 50
+	// minFavoriteRating is the lowest rating that makes an article a
+	// favorite.
+	minFavoriteRating = 4
+)
+
+// ErrTokenNotFound covers unknown and revoked tokens alike.
+var ErrTokenNotFound = errors.New("feed token not found")
+
+// Workspaces looks up the workspaces output feeds are made of.
+type Workspaces interface {
+	GetWorkspace(id uint) (*workspace.Workspace, error)
+	MemberRole(workspaceID, userID uint) (string, error)
+}
+
+// OutputService publishes users' articles as feeds that readers fetch with
+// a token.
+type OutputService struct {
+	repo       OutputRepository
+	articles   article.Repository
+	workspaces Workspaces
+	users      user.Repository
+	now        func() time.Time
+}
+
+func NewOutputService(repo OutputRepository, articles article.Repository, workspaces Workspaces, users user.Repository) *OutputService {
+	return &OutputService{repo: repo, articles: articles, workspaces: workspaces, users: users, now: time.Now}
+}
+
+// CreateToken creates a token for one source. A workspace feed needs the
+// user to be a member, and returns gorm.ErrRecordNotFound otherwise. The
+// plain token is only ever returned here.
+func (s *OutputService) CreateToken(userID uint, source string, workspaceID *uint) (string, *Token, error) {
+	if source == SourceWorkspace {
+		if _, err := s.workspaces.MemberRole(*workspaceID, userID); err != nil {
+			return "", nil, err
+		}
+	} else {
+		workspaceID = nil
+	}
+	secret, err := auth.RandomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	plain := TokenPrefix + secret
+	token := &Token{
+		UserID:      userID,
+		Prefix:      plain[:len(TokenPrefix)+6],
+		TokenHash:   auth.HashToken(plain),
+		Source:      source,
+		WorkspaceID: workspaceID,
+	}
+	if err := s.repo.CreateToken(token); err != nil {
+		return "", nil, err
+	}
+	return plain, token, nil
+}
+
+func (s *OutputService) ListTokens(userID uint) ([]Token, error) {
+	return s.repo.ListTokens(userID)
+}
+
+func (s *OutputService) RevokeToken(userID, tokenID uint) error {
+	return s.repo.RevokeToken(userID, tokenID)
+}
+
+// Build returns the feed a token gives access to, ready to be written at
+// selfURL. Access is checked again on every fetch, so a workspace feed
+// stops working when its owner leaves the workspace.
+func (s *OutputService) Build(plain, selfURL string) (*feeds.Output, error) {
+	token, err := s.repo.GetTokenByHash(auth.HashToken(plain))
+	if err != nil {
+		return nil, ErrTokenNotFound
+	}
+	owner, err := s.users.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &feeds.Output{
+		ID:      fmt.Sprintf("urn:deeli:feed:%d", token.ID),
+		Author:  owner.DisplayName,
+		SelfURL: selfURL,
+		Updated: token.CreatedAt,
+	}
+	if out.Author == "" {
+		out.Author = "Deeli"
+	}
+
+	switch token.Source {
+	case SourceFavorites:
+		out.Title = "Favorites"
+		favorites, err := s.repo.Favorites(token.UserID, minFavoriteRating, outputSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range favorites {
+			item := outputItem(&favorites[i].Article)
+			// An article enters the feed when it is rated.
+			item.Published = favorites[i].RatedAt
+			if item.Published.After(item.Updated) {
+				item.Updated = item.Published
+			}
+			out.Items = append(out.Items, item)
+		}
+	default:
+		filter := article.ListFilter{}
+		out.Title = "Saved articles"
+		if token.Source == SourceWorkspace {
+			ws, err := s.workspaces.GetWorkspace(*token.WorkspaceID)
+			if err != nil {
+				return nil, ErrTokenNotFound
+			}
+			if _, err := s.workspaces.MemberRole(ws.ID, token.UserID); err != nil {
+				return nil, ErrTokenNotFound
+			}
+			out.Title = ws.Name
+			filter.WorkspaceID = token.WorkspaceID
+		}
+		saved, err := s.articles.ListArticles(token.UserID, filter, 1, outputSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range saved {
+			out.Items = append(out.Items, outputItem(&saved[i]))
+		}
+	}
+
+	// The feed is updated when an item is, and also when one is removed,
+	// so that it can be validated by its update time.
+	removed, err := s.repo.LastRemoval(token)
+	if err != nil {
+		return nil, err
+	}
+	if removed.After(out.Updated) {
+		out.Updated = removed
+	}
+	for _, item := range out.Items {
+		if item.Updated.After(out.Updated) {
+			out.Updated = item.Updated
+		}
+	}
+	if err := s.repo.RecordTokenUse(token.ID, s.now()); err != nil {
+		log.Printf("Failed to record use of feed token %d: %v", token.ID, err)
+	}
+	return out, nil
+}
+
+// outputItem makes an entry of an article, published when it was saved and
+// updated when it last changed, such as when its scrape finished.
+func outputItem(a *article.Article) feeds.OutputItem {
+	return feeds.OutputItem{
+		ID:        fmt.Sprintf("urn:deeli:article:%d", a.ID),
+		URL:       a.URL,
+		Title:     a.Title,
+		Summary:   a.Description,
+		Content:   a.Content,
+		Published: a.CreatedAt,
+		Updated:   a.UpdatedAt,
+	}
+}
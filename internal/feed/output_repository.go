@@ -0,0 +1,115 @@
+package feed
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Favorite is an article the user rated highly, with when they rated it.
+type Favorite struct {
+	article.Article `gorm:"embedded"`
+	RatedAt         time.Time
+}
+
+// OutputRepository defines the interface for output feed storage.
+type OutputRepository interface {
+	CreateToken(token *Token) error
+	// GetTokenByHash returns the token if it hasn't been revoked and its
+	// owner's account is in use, and gorm.ErrRecordNotFound otherwise.
+	GetTokenByHash(hash string) (*Token, error)
+	// ListTokens returns the user's tokens that haven't been revoked,
+	// newest first.
+	ListTokens(userID uint) ([]Token, error)
+	RevokeToken(userID, tokenID uint) error
+	RecordTokenUse(tokenID uint, at time.Time) error
+	// Favorites returns up to limit articles the user rated minScore or
+	// more and can still read, most recently rated first.
+	Favorites(userID uint, minScore, limit int) ([]Favorite, error)
+	// LastRemoval returns when an article last left the token's feed by
+	// being deleted or, for favorites, unrated or rated again, or the zero
+	// time if none has.
+	LastRemoval(token *Token) (time.Time, error)
+}
+
+type outputRepository struct{}
+
+func NewOutputRepository() OutputRepository {
+	return &outputRepository{}
+}
+
+func (r *outputRepository) CreateToken(token *Token) error {
+	return database.DB.Create(token).Error
+}
+
+func (r *outputRepository) GetTokenByHash(hash string) (*Token, error) {
+	var token Token
+	err := database.DB.
+		Joins("JOIN users ON users.id = feed_tokens.user_id AND users.deleted_at IS NULL").
+		Where("feed_tokens.token_hash = ? AND feed_tokens.revoked_at IS NULL", hash).
+		Where("users.disabled_at IS NULL AND users.delete_after IS NULL").
+		First(&token).Error
+	return &token, err
+}
+
+func (r *outputRepository) ListTokens(userID uint) ([]Token, error) {
+	var tokens []Token
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *outputRepository) RevokeToken(userID, tokenID uint) error {
+	result := database.DB.Model(&Token{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *outputRepository) RecordTokenUse(tokenID uint, at time.Time) error {
+	return database.DB.Model(&Token{}).Where("id = ?", tokenID).Update("last_used_at", at).Error
+}
+
+func (r *outputRepository) Favorites(userID uint, minScore, limit int) ([]Favorite, error) {
+	var favorites []Favorite
+	err := database.DB.Model(&article.Article{}).
+		Select("articles.*, ratings.updated_at AS rated_at").
+		Joins("JOIN ratings ON ratings.article_id = articles.id AND ratings.deleted_at IS NULL").
+		Where("ratings.user_id = ? AND ratings.score >= ?", userID, minScore).
+		Scopes(article.AccessibleTo(userID, article.AccessRead)).
+		Order("ratings.updated_at desc, articles.id desc").
+		Limit(limit).
+		Scan(&favorites).Error
+	return favorites, err
+}
+
+func (r *outputRepository) LastRemoval(token *Token) (time.Time, error) {
+	var query string
+	var args []interface{}
+	switch token.Source {
+	case SourceFavorites:
+		query = `SELECT GREATEST(
+			(SELECT MAX(GREATEST(updated_at, deleted_at)) FROM ratings WHERE user_id = ?),
+			(SELECT MAX(articles.deleted_at) FROM articles JOIN ratings ON ratings.article_id = articles.id WHERE ratings.user_id = ?))`
+		args = []interface{}{token.UserID, token.UserID}
+	case SourceWorkspace:
+		query = "SELECT MAX(deleted_at) FROM articles WHERE workspace_id = ?"
+		args = []interface{}{token.WorkspaceID}
+	default:
+		query = "SELECT MAX(deleted_at) FROM articles WHERE user_id = ? AND workspace_id IS NULL"
+		args = []interface{}{token.UserID}
+	}
+	var at sql.NullTime
+	if err := database.DB.Raw(query, args...).Row().Scan(&at); err != nil {
+		return time.Time{}, err
+	}
+	return at.Time, nil
+}
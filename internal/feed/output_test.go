@@ -0,0 +1,187 @@
+package feed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryOutputRepository is an OutputRepository backed by a slice. It has
+// no ratings, so favorites are always empty, and articles are removed when
+// removed says.
+type memoryOutputRepository struct {
+	tokens  []*Token
+	removed time.Time
+}
+
+func (r *memoryOutputRepository) CreateToken(token *Token) error {
+	token.ID = uint(len(r.tokens) + 1)
+	token.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := *token
+	r.tokens = append(r.tokens, &stored)
+	return nil
+}
+
+func (r *memoryOutputRepository) GetTokenByHash(hash string) (*Token, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == hash && t.RevokedAt == nil {
+			found := *t
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryOutputRepository) ListTokens(userID uint) ([]Token, error) { return nil, nil }
+
+func (r *memoryOutputRepository) RevokeToken(userID, tokenID uint) error {
+	for _, t := range r.tokens {
+		if t.ID == tokenID && t.UserID == userID && t.RevokedAt == nil {
+			now := time.Now()
+			t.RevokedAt = &now
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *memoryOutputRepository) RecordTokenUse(tokenID uint, at time.Time) error {
+	r.tokens[tokenID-1].LastUsedAt = &at
+	return nil
+}
+
+func (r *memoryOutputRepository) Favorites(userID uint, minScore, limit int) ([]Favorite, error) {
+	return nil, nil
+}
+
+func (r *memoryOutputRepository) LastRemoval(token *Token) (time.Time, error) {
+	return r.removed, nil
+}
+
+// users answers GetUserByID for a single user.
+type users struct {
+	user.Repository
+	user *user.User
+}
+
+func (u users) GetUserByID(id uint) (*user.User, error) {
+	if id != u.user.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return u.user, nil
+}
+
+type workspaces map[uint]string
+
+func (w workspaces) GetWorkspace(id uint) (*workspace.Workspace, error) {
+	ws := &workspace.Workspace{Name: "Team"}
+	ws.ID = id
+	return ws, nil
+}
+
+func (w workspaces) MemberRole(workspaceID, userID uint) (string, error) {
+	if role, ok := w[workspaceID]; ok {
+		return role, nil
+	}
+	return "", gorm.ErrRecordNotFound
+}
+
+func TestOutputFeed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	articles := article.NewMemoryRepository()
+	saved := &article.Article{URL: "https://example.com/a", UserID: 1, Status: article.StatusCompleted}
+	require.NoError(t, articles.CreateArticle(saved))
+	saved.Title = "Scraped <title>"
+	saved.Content = "First paragraph.\nSecond & last."
+	require.NoError(t, articles.UpdateArticle(saved))
+
+	repo := &memoryOutputRepository{}
+	member := workspaces{7: workspace.RoleViewer}
+	outputs := NewOutputService(repo, articles, member, users{user: &user.User{Model: gorm.Model{ID: 1}, DisplayName: "Ada"}})
+	handler := NewHandler(nil, outputs, "https://api.example.com/")
+	router := gin.New()
+	router.GET("/feeds/out/:file", handler.Output)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	plain, token, err := outputs.CreateToken(1, SourceSaves, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plain, TokenPrefix))
+
+	w := get("/feeds/out/"+plain+".atom", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "<title>Scraped &lt;title&gt;</title>")
+	assert.Contains(t, body, "&lt;p&gt;Second &amp;amp; last.&lt;/p&gt;")
+	assert.Contains(t, body, `href="https://api.example.com/feeds/out/`+plain+`.atom"`)
+	assert.Contains(t, body, "<name>Ada</name>")
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	lastModified := w.Header().Get("Last-Modified")
+	assert.Equal(t, saved.UpdatedAt.UTC().Format(http.TimeFormat), lastModified)
+	assert.NotNil(t, repo.tokens[0].LastUsedAt)
+
+	assert.Equal(t, http.StatusNotModified, get("/feeds/out/"+plain+".atom", map[string]string{"If-None-Match": etag}).Code)
+	assert.Equal(t, http.StatusNotModified, get("/feeds/out/"+plain+".atom", map[string]string{"If-None-Match": `"other", W/` + etag}).Code)
+	assert.Equal(t, http.StatusOK, get("/feeds/out/"+plain+".atom", map[string]string{"If-None-Match": `"other"`}).Code)
+	assert.Equal(t, http.StatusNotModified, get("/feeds/out/"+plain+".atom", map[string]string{"If-Modified-Since": lastModified}).Code)
+	// The ETag wins over the date.
+	assert.Equal(t, http.StatusOK, get("/feeds/out/"+plain+".atom", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}).Code)
+
+	// A removal moves Last-Modified even though no remaining item changed.
+	repo.removed = saved.UpdatedAt.Add(time.Hour)
+	w = get("/feeds/out/"+plain+".atom", map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, repo.removed.UTC().Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	repo.removed = time.Time{}
+
+	// Deleting an article changes the feed even though no remaining item
+	// was updated.
+	other := &article.Article{URL: "https://example.com/b", UserID: 1, Status: article.StatusCompleted}
+	require.NoError(t, articles.CreateArticle(other))
+	etag = get("/feeds/out/"+plain+".atom", nil).Header().Get("ETag")
+	require.NoError(t, articles.DeleteArticle(other.ID, 1))
+	assert.Equal(t, http.StatusOK, get("/feeds/out/"+plain+".atom", map[string]string{"If-None-Match": etag}).Code)
+	etag = get("/feeds/out/"+plain+".atom", nil).Header().Get("ETag")
+
+	w = get("/feeds/out/"+plain+".json", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content_text": "First paragraph.\nSecond & last."`)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, get("/feeds/out/"+plain+".rss", nil).Code)
+	assert.Equal(t, http.StatusNotFound, get("/feeds/out/"+plain+".html", nil).Code)
+
+	require.NoError(t, outputs.RevokeToken(1, token.ID))
+	assert.Equal(t, http.StatusNotFound, get("/feeds/out/"+plain+".atom", nil).Code)
+
+	// A workspace feed stops working when the user leaves the workspace.
+	workspaceID, otherWorkspaceID := uint(7), uint(8)
+	_, _, err = outputs.CreateToken(1, SourceWorkspace, &otherWorkspaceID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	plain, _, err = outputs.CreateToken(1, SourceWorkspace, &workspaceID)
+	require.NoError(t, err)
+	w = get("/feeds/out/"+plain+".rss", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<title>Team</title>")
+	delete(member, 7)
+	assert.Equal(t, http.StatusNotFound, get("/feeds/out/"+plain+".rss", nil).Code)
+}
@@ -0,0 +1,141 @@
+package feed
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Repository defines the interface for feed subscription storage.
+type Repository interface {
+	CreateFeed(feed *Feed) error
+	// GetFeedByURL returns the user's subscription to the feed, or
+	// gorm.ErrRecordNotFound.
+	GetFeedByURL(userID uint, url string) (*Feed, error)
+	ListFeeds(userID uint) ([]Feed, error)
+	// DeleteFeed deletes the subscription and its entries. The articles
+	// saved from it stay.
+	DeleteFeed(userID, feedID uint) error
+	// DueFeeds returns up to limit feeds whose next fetch is due, most
+	// overdue first, skipping those of disabled and deleted accounts.
+	DueFeeds(now time.Time, limit int) ([]Feed, error)
+	// SaveFetchState stores what a fetch learned about the feed. It doesn't
+	// bring back a feed deleted in the meantime.
+	SaveFetchState(feed *Feed) error
+	// SeenItems returns which of the GUIDs and URLs the feed already has
+	// entries for.
+	SeenItems(feedID uint, guids, urls []string) (map[string]bool, error)
+	// RecordEntries stores entries, ignoring those already recorded.
+	RecordEntries(entries []Entry) error
+	// InLibrary reports whether the URL was ever saved to the library,
+	// including articles the user has since deleted.
+	InLibrary(userID uint, workspaceID *uint, url string) (bool, error)
+}
+
+type repository struct{}
+
+func NewRepository() Repository {
+	return &repository{}
+}
+
+func (r *repository) CreateFeed(feed *Feed) error {
+	return database.DB.Create(feed).Error
+}
+
+func (r *repository) GetFeedByURL(userID uint, url string) (*Feed, error) {
+	var feed Feed
+	err := database.DB.Where("user_id = ? AND url = ?", userID, url).First(&feed).Error
+	return &feed, err
+}
+
+func (r *repository) ListFeeds(userID uint) ([]Feed, error) {
+	var feeds []Feed
+	err := database.DB.Where("user_id = ?", userID).Order("created_at desc, id desc").Find(&feeds).Error
+	return feeds, err
+}
+
+func (r *repository) DeleteFeed(userID, feedID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", feedID, userID).Delete(&Feed{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("feed_id = ?", feedID).Delete(&Entry{}).Error
+	})
+}
+
+func (r *repository) DueFeeds(now time.Time, limit int) ([]Feed, error) {
+	var feeds []Feed
+	err := database.DB.
+		Joins("JOIN users ON users.id = feeds.user_id AND users.deleted_at IS NULL").
+		Where("feeds.next_fetch_at <= ? AND users.disabled_at IS NULL AND users.delete_after IS NULL", now).
+		Order("feeds.next_fetch_at, feeds.id").
+		Limit(limit).
+		Find(&feeds).Error
+	return feeds, err
+}
+
+func (r *repository) SaveFetchState(feed *Feed) error {
+	return database.DB.Model(feed).
+		Select("title", "site_url", "etag", "last_modified", "last_fetched_at", "next_fetch_at", "last_error", "error_count").
+		Updates(feed).Error
+}
+
+func (r *repository) SeenItems(feedID uint, guids, urls []string) (map[string]bool, error) {
+	var entries []Entry
+	err := database.DB.Select("guid", "url").
+		Where("feed_id = ? AND (guid IN ? OR url IN ?)", feedID, guids, urls).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, 2*len(entries))
+	for _, e := range entries {
+		seen[e.GUID] = true
+		seen[e.URL] = true
+	}
+	return seen, nil
+}
+
+func (r *repository) RecordEntries(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries).Error
+}
+
+func (r *repository) InLibrary(userID uint, workspaceID *uint, url string) (bool, error) {
+	db := database.DB.Unscoped().Model(&article.Article{}).Where("url = ?", url)
+	if workspaceID != nil {
+		db = db.Where("workspace_id = ?", *workspaceID)
+	} else {
+		db = db.Where("user_id = ? AND workspace_id IS NULL", userID)
+	}
+	var count int64
+	err := db.Count(&count).Error
+	return count > 0, err
+}
+
+// WorkspaceObserver implements workspace.DeletionObserver, deleting the
+// feeds that save to a deleted workspace and the output feed tokens that
+// read from it.
+type WorkspaceObserver struct{}
+
+func (WorkspaceObserver) WorkspaceDeleted(tx *gorm.DB, workspaceID uint) error {
+	for _, statement := range []string{
+		"DELETE FROM feed_entries WHERE feed_id IN (SELECT id FROM feeds WHERE workspace_id = ?)",
+		"DELETE FROM feeds WHERE workspace_id = ?",
+		"DELETE FROM feed_tokens WHERE workspace_id = ?",
+	} {
+		if err := tx.Exec(statement, workspaceID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
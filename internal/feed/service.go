@@ -0,0 +1,289 @@
+package feed
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/cheildo/deeli-api/pkg/config"
+	"github.com/cheildo/deeli-api/pkg/feeds"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBackoff caps how long polling waits after repeated failures.
+	maxBackoff = 24 * time.Hour
+	// pollBatch is how many due feeds one run of the poller fetches.
+	pollBatch = 50
+)
+
+var (
+	ErrNoFeedFound       = errors.New("no feed found at URL")
+	ErrFetchFailed       = errors.New("could not fetch URL")
+	ErrAlreadySubscribed = errors.New("already subscribed to feed")
+	// ErrForbidden is returned for a workspace rule when the user can't
+	// save to the workspace.
+	ErrForbidden = errors.New("not allowed to save to workspace")
+)
+
+// Rules say where the items of a feed are saved.
+type Rules struct {
+	// WorkspaceID saves items to a workspace where the user is an editor.
+	WorkspaceID *uint
+	// Public makes the saved articles public. It can't be combined with a
+	// workspace.
+	Public bool
+}
+
+// Service subscribes users to feeds and polls them.
+type Service struct {
+	repo        Repository
+	articles    article.Repository
+	memberships article.Memberships
+	fetcher     *feeds.Fetcher
+	// interval is the time between fetches of a healthy feed, and maxItems
+	// the most items saved from one fetch.
+	interval time.Duration
+	maxItems int
+	now      func() time.Time
+	scrape   func(article.Repository, *article.Article)
+}
+
+func NewService(repo Repository, articles article.Repository, memberships article.Memberships, fetcher *feeds.Fetcher, interval time.Duration, maxItems int) *Service {
+	return &Service{
+		repo:        repo,
+		articles:    articles,
+		memberships: memberships,
+		fetcher:     fetcher,
+		interval:    interval,
+		maxItems:    maxItems,
+		now:         time.Now,
+		scrape:      article.Scrape,
+	}
+}
+
+// NewServiceFromConfig creates a Service set up by FEED_POLL_INTERVAL,
+// FEED_MAX_ITEMS_PER_POLL and FEED_FETCH_TIMEOUT.
+func NewServiceFromConfig(repo Repository, articles article.Repository, memberships article.Memberships) *Service {
+	fetcher := feeds.NewFetcher(config.GetDuration("FEED_FETCH_TIMEOUT", 15*time.Second), config.GetString("FEED_USER_AGENT", "Deeli feed reader"))
+	return NewService(repo, articles, memberships, fetcher,
+		config.GetDuration("FEED_POLL_INTERVAL", 30*time.Minute),
+		config.GetInt("FEED_MAX_ITEMS_PER_POLL", 20))
+}
+
+// Subscribe subscribes the user to the feed at rawURL, or to the first feed
+// advertised by the page there. Items already in the feed are only marked
+// seen; those published from now on are saved.
+func (s *Service) Subscribe(userID uint, rawURL string, rules Rules) (*Feed, error) {
+	if rules.WorkspaceID != nil {
+		if err := s.canSave(*rules.WorkspaceID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	feedURL, res, parsed, err := s.fetcher.Locate(rawURL)
+	if errors.Is(err, feeds.ErrUnknownFormat) {
+		return nil, ErrNoFeedFound
+	}
+	if err != nil {
+		log.Printf("Failed to fetch feed %s: %v", rawURL, err)
+		return nil, ErrFetchFailed
+	}
+	if _, err := s.repo.GetFeedByURL(userID, feedURL); err == nil {
+		return nil, ErrAlreadySubscribed
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	now := s.now()
+	feed := &Feed{
+		UserID:        userID,
+		URL:           feedURL,
+		Title:         parsed.Title,
+		SiteURL:       parsed.SiteURL,
+		WorkspaceID:   rules.WorkspaceID,
+		Public:        rules.Public,
+		ETag:          res.ETag,
+		LastModified:  res.LastModified,
+		LastFetchedAt: &now,
+		NextFetchAt:   now.Add(s.interval),
+	}
+	if err := s.repo.CreateFeed(feed); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(parsed.Items))
+	for _, item := range parsed.Items {
+		entries = append(entries, Entry{FeedID: feed.ID, GUID: item.GUID, URL: item.URL})
+	}
+	if err := s.repo.RecordEntries(entries); err != nil {
+		log.Printf("Failed to record entries of feed %d: %v", feed.ID, err)
+	}
+	return feed, nil
+}
+
+func (s *Service) List(userID uint) ([]Feed, error) {
+	return s.repo.ListFeeds(userID)
+}
+
+func (s *Service) Unsubscribe(userID, feedID uint) error {
+	return s.repo.DeleteFeed(userID, feedID)
+}
+
+// canSave checks that the user may save articles to the workspace, and
+// returns gorm.ErrRecordNotFound if they aren't a member.
+func (s *Service) canSave(workspaceID, userID uint) error {
+	role, err := s.memberships.MemberRole(workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if !workspace.HasRole(role, workspace.RoleEditor) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// PollDue fetches the feeds that are due and saves their new items. It is
+// run periodically by the worker.
+func (s *Service) PollDue() {
+	due, err := s.repo.DueFeeds(s.now(), pollBatch)
+	if err != nil {
+		log.Printf("Failed to load due feeds: %v", err)
+		return
+	}
+	for i := range due {
+		s.poll(&due[i])
+	}
+}
+
+// poll fetches one feed. A fetch that fails, or finds the user can no
+// longer save where the feed's rules say, is retried later with backoff.
+func (s *Service) poll(feed *Feed) {
+	now := s.now()
+	res, err := s.fetcher.Fetch(feed.URL, feed.ETag, feed.LastModified)
+	var parsed *feeds.Feed
+	if err == nil && !res.NotModified {
+		parsed, err = feeds.Parse(res.Body, res.URL)
+	}
+	if err == nil && feed.WorkspaceID != nil {
+		err = s.canSave(*feed.WorkspaceID, feed.UserID)
+	}
+	if err != nil {
+		log.Printf("Failed to poll feed %d: %v", feed.ID, err)
+		feed.ErrorCount++
+		feed.LastError = err.Error()
+		feed.NextFetchAt = now.Add(backoff(s.interval, feed.ErrorCount))
+		if err := s.repo.SaveFetchState(feed); err != nil {
+			log.Printf("Failed to update feed %d: %v", feed.ID, err)
+		}
+		return
+	}
+
+	if parsed != nil {
+		if parsed.Title != "" {
+			feed.Title = parsed.Title
+		}
+		if parsed.SiteURL != "" {
+			feed.SiteURL = parsed.SiteURL
+		}
+		if err := s.saveNew(feed, parsed.Items); err != nil {
+			log.Printf("Failed to save items of feed %d: %v", feed.ID, err)
+		}
+	}
+	feed.ETag, feed.LastModified = res.ETag, res.LastModified
+	feed.LastFetchedAt = &now
+	feed.NextFetchAt = now.Add(s.interval)
+	feed.ErrorCount = 0
+	feed.LastError = ""
+	if err := s.repo.SaveFetchState(feed); err != nil {
+		log.Printf("Failed to update feed %d: %v", feed.ID, err)
+	}
+}
+
+// saveNew saves the items not seen before as articles and starts scraping
+// them, without waiting for the scrapes so that one slow page doesn't hold
+// up the other feeds.
+// Feeds list their newest items first; the newest maxItems are saved oldest
+// first so that the library lists them in the feed's order, and anything
+// older is only marked seen. Items already in the library aren't saved
+// again.
+func (s *Service) saveNew(feed *Feed, items []feeds.Item) error {
+	guids := make([]string, len(items))
+	urls := make([]string, len(items))
+	for i, item := range items {
+		guids[i], urls[i] = item.GUID, item.URL
+	}
+	seen, err := s.repo.SeenItems(feed.ID, guids, urls)
+	if err != nil {
+		return err
+	}
+	var fresh []feeds.Item
+	for _, item := range items {
+		if seen[item.GUID] || seen[item.URL] {
+			continue
+		}
+		seen[item.GUID], seen[item.URL] = true, true
+		fresh = append(fresh, item)
+	}
+
+	var entries []Entry
+	var saved []*article.Article
+	for i := len(fresh) - 1; i >= 0; i-- {
+		item := fresh[i]
+		entry := Entry{FeedID: feed.ID, GUID: item.GUID, URL: item.URL}
+		if i < s.maxItems {
+			art, err := s.save(feed, item)
+			if err != nil {
+				// Left unrecorded so the next poll tries again.
+				log.Printf("Failed to save %s from feed %d: %v", item.URL, feed.ID, err)
+				continue
+			}
+			if art != nil {
+				entry.ArticleID = &art.ID
+				saved = append(saved, art)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := s.repo.RecordEntries(entries); err != nil {
+		return err
+	}
+	for _, art := range saved {
+		go s.scrape(s.articles, art)
+	}
+	return nil
+}
+
+// save creates the article for an item, or returns nil if the library
+// already has it.
+func (s *Service) save(feed *Feed, item feeds.Item) (*article.Article, error) {
+	exists, err := s.repo.InLibrary(feed.UserID, feed.WorkspaceID, item.URL)
+	if err != nil || exists {
+		return nil, err
+	}
+	art := &article.Article{
+		URL:         item.URL,
+		Title:       item.Title,
+		UserID:      feed.UserID,
+		WorkspaceID: feed.WorkspaceID,
+		Status:      article.StatusPending,
+		Public:      feed.Public && feed.WorkspaceID == nil,
+	}
+	if err := s.articles.CreateArticle(art); err != nil {
+		return nil, err
+	}
+	return art, nil
+}
+
+// backoff doubles the wait after each consecutive failure, up to a day.
+func backoff(interval time.Duration, failures int) time.Duration {
+	wait := interval
+	for i := 1; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,245 @@
+package feed
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/workspace"
+	"github.com/cheildo/deeli-api/pkg/feeds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeRepository keeps feeds and entries in memory and looks up library
+// contents in an article repository.
+type fakeRepository struct {
+	feeds    []*Feed
+	entries  []Entry
+	articles article.Repository
+}
+
+func (r *fakeRepository) CreateFeed(feed *Feed) error {
+	feed.ID = uint(len(r.feeds) + 1)
+	r.feeds = append(r.feeds, feed)
+	return nil
+}
+
+func (r *fakeRepository) GetFeedByURL(userID uint, url string) (*Feed, error) {
+	for _, f := range r.feeds {
+		if f.UserID == userID && f.URL == url {
+			return f, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepository) ListFeeds(userID uint) ([]Feed, error) { return nil, nil }
+
+func (r *fakeRepository) DeleteFeed(userID, feedID uint) error { return nil }
+
+func (r *fakeRepository) DueFeeds(now time.Time, limit int) ([]Feed, error) {
+	var due []Feed
+	for _, f := range r.feeds {
+		if !f.NextFetchAt.After(now) {
+			due = append(due, *f)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeRepository) SaveFetchState(feed *Feed) error {
+	stored := *feed
+	r.feeds[feed.ID-1] = &stored
+	return nil
+}
+
+func (r *fakeRepository) SeenItems(feedID uint, guids, urls []string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	for _, e := range r.entries {
+		if e.FeedID == feedID {
+			seen[e.GUID], seen[e.URL] = true, true
+		}
+	}
+	return seen, nil
+}
+
+func (r *fakeRepository) RecordEntries(entries []Entry) error {
+	r.entries = append(r.entries, entries...)
+	return nil
+}
+
+func (r *fakeRepository) InLibrary(userID uint, workspaceID *uint, url string) (bool, error) {
+	articles, err := r.articles.GetArticlesByUserID(userID, 1, 1000)
+	for _, a := range articles {
+		if a.URL == url {
+			return true, err
+		}
+	}
+	return false, err
+}
+
+type roles map[uint]string
+
+func (r roles) MemberRole(workspaceID, userID uint) (string, error) {
+	if role, ok := r[workspaceID]; ok {
+		return role, nil
+	}
+	return "", gorm.ErrRecordNotFound
+}
+
+// rss renders a feed listing the given item paths, newest first.
+func rss(base string, paths ...string) string {
+	var b strings.Builder
+	b.WriteString(`<rss version="2.0"><channel><title>Test feed</title>`)
+	for _, p := range paths {
+		fmt.Fprintf(&b, `<item><title>%s</title><link>%s%s</link></item>`, p, base, p)
+	}
+	b.WriteString(`</channel></rss>`)
+	return b.String()
+}
+
+type feedServer struct {
+	*httptest.Server
+	paths    []string
+	requests int
+}
+
+func newFeedServer(t *testing.T, paths ...string) *feedServer {
+	fs := &feedServer{paths: paths}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.requests++
+		etag := fmt.Sprintf(`"%d"`, len(fs.paths))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(rss(fs.URL, fs.paths...)))
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func newTestService(memberships article.Memberships) (*Service, *fakeRepository, article.Repository, *time.Time) {
+	articles := article.NewMemoryRepository()
+	repo := &fakeRepository{articles: articles}
+	s := NewService(repo, articles, memberships, feeds.NewFetcher(5*time.Second, "test"), time.Hour, 2)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	s.scrape = func(article.Repository, *article.Article) {}
+	return s, repo, articles, &now
+}
+
+func TestPollSavesOnlyNewItems(t *testing.T) {
+	server := newFeedServer(t, "/old")
+	s, repo, articles, now := newTestService(roles{})
+
+	feed, err := s.Subscribe(1, server.URL, Rules{Public: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Test feed", feed.Title)
+
+	// Nothing due yet.
+	s.PollDue()
+	assert.Equal(t, 1, server.requests)
+
+	// Three new items, one of them already saved by hand; at most two are
+	// saved per poll.
+	require.NoError(t, articles.CreateArticle(&article.Article{URL: server.URL + "/mine", UserID: 1}))
+	server.paths = []string{"/c", "/b", "/mine", "/a", "/old"}
+	*now = now.Add(time.Hour)
+	s.PollDue()
+
+	saved, err := articles.GetArticlesByUserID(1, 1, 10)
+	require.NoError(t, err)
+	var urls []string
+	for _, a := range saved {
+		if a.URL != server.URL+"/mine" {
+			urls = append(urls, strings.TrimPrefix(a.URL, server.URL))
+			assert.True(t, a.Public)
+		}
+	}
+	assert.ElementsMatch(t, []string{"/c", "/b"}, urls)
+	assert.Len(t, repo.entries, 5)
+
+	// Unchanged feed: a conditional fetch that saves nothing.
+	*now = now.Add(time.Hour)
+	s.PollDue()
+	assert.Equal(t, 3, server.requests)
+	again, err := articles.GetArticlesByUserID(1, 1, 10)
+	require.NoError(t, err)
+	assert.Len(t, again, len(saved))
+	assert.Equal(t, now.Add(time.Hour), repo.feeds[0].NextFetchAt)
+}
+
+func TestPollDoesNotWaitForScrapes(t *testing.T) {
+	server := newFeedServer(t)
+	s, _, _, now := newTestService(roles{})
+	release := make(chan struct{})
+	scraped := make(chan string, 2)
+	s.scrape = func(_ article.Repository, a *article.Article) {
+		<-release
+		scraped <- strings.TrimPrefix(a.URL, server.URL)
+	}
+
+	_, err := s.Subscribe(1, server.URL, Rules{})
+	require.NoError(t, err)
+	server.paths = []string{"/b", "/a"}
+	*now = now.Add(time.Hour)
+	s.PollDue()
+
+	close(release)
+	assert.ElementsMatch(t, []string{"/a", "/b"}, []string{<-scraped, <-scraped})
+}
+
+func TestPollBacksOffWhenWorkspaceAccessIsLost(t *testing.T) {
+	server := newFeedServer(t, "/a")
+	memberships := roles{7: workspace.RoleEditor}
+	s, repo, _, now := newTestService(memberships)
+
+	workspaceID := uint(7)
+	_, err := s.Subscribe(1, server.URL, Rules{WorkspaceID: &workspaceID})
+	require.NoError(t, err)
+
+	memberships[7] = workspace.RoleViewer
+	*now = now.Add(time.Hour)
+	s.PollDue()
+	s.PollDue()
+
+	feed := repo.feeds[0]
+	assert.Equal(t, 1, feed.ErrorCount)
+	assert.NotEmpty(t, feed.LastError)
+	assert.Equal(t, now.Add(time.Hour), feed.NextFetchAt)
+
+	_, err = s.Subscribe(2, server.URL, Rules{WorkspaceID: &workspaceID})
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestSubscribeRejectsDuplicatesAndPages(t *testing.T) {
+	server := newFeedServer(t, "/a")
+	s, _, _, _ := newTestService(roles{})
+
+	_, err := s.Subscribe(1, server.URL, Rules{})
+	require.NoError(t, err)
+	_, err = s.Subscribe(1, server.URL, Rules{})
+	assert.ErrorIs(t, err, ErrAlreadySubscribed)
+
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>No feeds</title></head></html>"))
+	}))
+	defer page.Close()
+	_, err = s.Subscribe(1, page.URL, Rules{})
+	assert.ErrorIs(t, err, ErrNoFeedFound)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Minute, backoff(30*time.Minute, 1))
+	assert.Equal(t, 2*time.Hour, backoff(30*time.Minute, 3))
+	assert.Equal(t, 24*time.Hour, backoff(30*time.Minute, 20))
+}
@@ -0,0 +1,48 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cheildo/deeli-api/pkg/config"
+)
+
+// ProvidersFromConfig reads the providers named in OIDC_PROVIDERS (comma
+// separated). Each name reads OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and optionally OIDC_<NAME>_SCOPES. Callbacks
+// go to OIDC_REDIRECT_BASE_URL, the API's public address.
+func ProvidersFromConfig() (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	base := strings.TrimSuffix(config.GetString("OIDC_REDIRECT_BASE_URL", "http://localhost:8080"), "/")
+	for _, name := range strings.Split(config.Get("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := Config{
+			Name:         name,
+			Issuer:       config.Get(prefix + "ISSUER"),
+			ClientID:     config.Get(prefix + "CLIENT_ID"),
+			ClientSecret: config.Get(prefix + "CLIENT_SECRET"),
+			RedirectURL:  base + "/auth/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(config.Get(prefix + "SCOPES")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers[name] = NewProvider(cfg, nil)
+	}
+	return providers, nil
+}
+
+// StateCodecFromConfig signs with OIDC_STATE_SECRET, falling back to
+// ACTION_TOKEN_SECRET and JWT_SECRET_KEY.
+func StateCodecFromConfig() (*StateCodec, error) {
+	secret := config.GetString("OIDC_STATE_SECRET", config.GetString("ACTION_TOKEN_SECRET", config.Get("JWT_SECRET_KEY")))
+	if secret == "" {
+		return nil, errors.New("OIDC_STATE_SECRET is not set")
+	}
+	return NewStateCodec([]byte(secret)), nil
+}
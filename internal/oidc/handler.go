@@ -0,0 +1,189 @@
+package oidc
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	stateCookie = "oidc_state"
+	stateTTL    = 10 * time.Minute
+)
+
+var (
+	errNoEmail         = errors.New("the provider did not share an email address")
+	errUnverifiedEmail = errors.New("an account with this email already exists; log in with your password")
+)
+
+type Handler struct {
+	providers map[string]*Provider
+	states    *StateCodec
+	users     user.Repository
+	logins    *user.Handler
+}
+
+// NewHandler creates the handler for logins through external providers.
+// Once a provider has vouched for the user, logins finishes the login as
+// for a password.
+func NewHandler(providers map[string]*Provider, states *StateCodec, users user.Repository, logins *user.Handler) *Handler {
+	return &Handler{providers: providers, states: states, users: users, logins: logins}
+}
+
+// Login handles GET /auth/oidc/:provider/login, redirecting to the
+// provider.
+func (h *Handler) Login(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	state, err := NewLoginState(provider.Name, stateTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	redirect, err := provider.AuthCodeURL(c.Request.Context(), state.State, state.Nonce, state.Challenge())
+	if err != nil {
+		log.Printf("Failed to start login with %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+	cookie, err := h.states.Encode(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	h.setStateCookie(c, provider, cookie, int(stateTTL.Seconds()))
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Callback handles GET /auth/oidc/:provider/callback. It exchanges the
+// code, checks the ID token and logs in the linked user, creating the
+// account on first login.
+func (h *Handler) Callback(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	cookie, _ := c.Cookie(stateCookie)
+	// The state is single use.
+	h.setStateCookie(c, provider, "", -1)
+
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed: " + reason})
+		return
+	}
+	state, err := h.states.Decode(cookie, provider.Name, c.Query("state"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	idToken, err := provider.Exchange(ctx, c.Query("code"), state.Verifier)
+	if err != nil {
+		log.Printf("Failed to exchange code with %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider rejected the login"})
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, idToken, state.Nonce)
+	if err != nil {
+		log.Printf("Rejected ID token from %s: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidIDToken.Error()})
+		return
+	}
+
+	account, err := h.resolveUser(provider.Name, claims)
+	switch {
+	case errors.Is(err, errNoEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errUnverifiedEmail):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.logins.CompleteLogin(c, account)
+}
+
+// resolveUser finds the user linked to the identity. An unknown identity
+// is linked to the account with the same email if the provider has
+// verified that email, and otherwise gets a new account without a
+// password.
+func (h *Handler) resolveUser(provider string, claims *Claims) (*user.User, error) {
+	identity, err := h.users.GetIdentity(provider, claims.Subject)
+	if err == nil {
+		return h.users.GetUserByID(identity.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return nil, errNoEmail
+	}
+	identity = &user.Identity{Provider: provider, Subject: claims.Subject, Email: email}
+
+	existing, err := h.users.GetUserByEmail(email)
+	if err == nil {
+		// Linking on an unverified email would let anyone who can create
+		// an account at the provider take over ours.
+		if !claims.EmailVerified {
+			return nil, errUnverifiedEmail
+		}
+		identity.UserID = existing.ID
+		if err := h.users.CreateIdentity(identity); err != nil {
+			return nil, err
+		}
+		if !existing.EmailVerified() {
+			now := time.Now()
+			if err := h.users.MarkEmailVerified(existing.ID, now); err != nil {
+				return nil, err
+			}
+			existing.EmailVerifiedAt = &now
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	account := &user.User{Email: email}
+	if claims.EmailVerified {
+		now := time.Now()
+		account.EmailVerifiedAt = &now
+	}
+	if err := h.users.CreateUserWithIdentity(account, identity); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (h *Handler) provider(c *gin.Context) (*Provider, bool) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+	}
+	return provider, ok
+}
+
+// setStateCookie sets the state cookie, scoped to the provider's callback.
+// It is sent on the top-level redirect back from the provider, so it
+// can't be SameSite=Strict.
+func (h *Handler) setStateCookie(c *gin.Context, provider *Provider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(provider.RedirectURL, "https://")
+	c.SetCookie(stateCookie, value, maxAge, "/auth/oidc/"+provider.Name, "", secure, true)
+}
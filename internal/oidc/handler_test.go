@@ -0,0 +1,175 @@
+package oidc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/cheildo/deeli-api/pkg/mailer"
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := godotenv.Load("../../.env.test"); err != nil {
+		panic("Error loading .env.test file for oidc test: " + err.Error())
+	}
+	database.Connect()
+	database.DB.AutoMigrate(&user.User{}, &user.Identity{}, &user.RecoveryCode{}, &auth.LoginAttempt{}, &auth.Session{}, &auth.RefreshToken{})
+
+	exitCode := m.Run()
+	teardown()
+	os.Exit(exitCode)
+}
+
+func teardown() {
+	database.DB.Exec("DELETE FROM identities")
+	database.DB.Exec("DELETE FROM login_attempts")
+	database.DB.Exec("DELETE FROM refresh_tokens")
+	database.DB.Exec("DELETE FROM sessions")
+	database.DB.Exec("DELETE FROM users")
+}
+
+// setupRouter serves the OIDC routes for the fake provider, plus signup to
+// create password accounts.
+func setupRouter(t *testing.T, fake *fakeProvider) *gin.Engine {
+	userRepo := user.NewRepository()
+	keys, err := auth.KeySetFromConfig()
+	require.NoError(t, err)
+	tokens := auth.NewTokenServiceFromConfig(auth.NewSessionRepository(), keys)
+	actionTokens, err := auth.ActionTokensFromConfig()
+	require.NoError(t, err)
+	userHandler := user.NewHandler(userRepo, tokens,
+		user.NewEmails(mailer.NewMemoryMailer(), actionTokens, "http://app.test"),
+		user.NewMFA(userRepo, actionTokens, "Deeli"),
+		auth.LoginThrottleFromConfig())
+
+	providers := map[string]*Provider{"fake": NewProvider(fake.config("http://api.test/auth/oidc/fake/callback"), nil)}
+	handler := NewHandler(providers, NewStateCodec([]byte("state-secret")), userRepo, userHandler)
+
+	r := gin.New()
+	r.POST("/signup", userHandler.Signup)
+	r.GET("/auth/oidc/:provider/login", handler.Login)
+	r.GET("/auth/oidc/:provider/callback", handler.Callback)
+	return r
+}
+
+// oidcLogin runs the whole flow against the fake provider and returns the
+// callback's response.
+func oidcLogin(t *testing.T, router *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oidc/fake/login", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	callback := authorize(t, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/oidc/fake/callback?"+callback.Encode(), nil)
+	req.AddCookie(cookies[0])
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func identityCount(t *testing.T) int64 {
+	var count int64
+	require.NoError(t, database.DB.Model(&user.Identity{}).Count(&count).Error)
+	return count
+}
+
+func TestOIDCLoginProvisionsAndLinks(t *testing.T) {
+	teardown()
+	defer teardown()
+	fake := newFakeProvider(t)
+	router := setupRouter(t, fake)
+
+	// First login creates a verified account without a password.
+	w := oidcLogin(t, router)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokens map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	assert.NotEmpty(t, tokens["token"])
+	assert.NotEmpty(t, tokens["refresh_token"])
+
+	account, err := user.NewRepository().GetUserByEmail("sso@example.com")
+	require.NoError(t, err)
+	assert.True(t, account.EmailVerified())
+	assert.Empty(t, account.Password)
+
+	// Logging in again, even after the email changed at the provider,
+	// finds the same account through the identity.
+	fake.Email = "renamed@example.com"
+	assert.Equal(t, http.StatusOK, oidcLogin(t, router).Code)
+	assert.Equal(t, int64(1), identityCount(t))
+	_, err = user.NewRepository().GetUserByEmail("renamed@example.com")
+	assert.Error(t, err)
+}
+
+func TestOIDCLoginLinksExistingAccountOnVerifiedEmail(t *testing.T) {
+	teardown()
+	defer teardown()
+	fake := newFakeProvider(t)
+	router := setupRouter(t, fake)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/signup", bytes.NewBufferString(`{"email": "sso@example.com", "password": "password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// An unverified email at the provider doesn't prove the account is theirs.
+	fake.EmailVerified = false
+	assert.Equal(t, http.StatusConflict, oidcLogin(t, router).Code)
+	assert.Equal(t, int64(0), identityCount(t))
+
+	fake.EmailVerified = true
+	assert.Equal(t, http.StatusOK, oidcLogin(t, router).Code)
+	assert.Equal(t, int64(1), identityCount(t))
+
+	account, err := user.NewRepository().GetUserByEmail("sso@example.com")
+	require.NoError(t, err)
+	assert.True(t, account.EmailVerified())
+	assert.NotEmpty(t, account.Password)
+}
+
+func TestOIDCCallbackRequiresMatchingState(t *testing.T) {
+	teardown()
+	defer teardown()
+	fake := newFakeProvider(t)
+	router := setupRouter(t, fake)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oidc/fake/login", nil)
+	router.ServeHTTP(w, req)
+	callback := authorize(t, w.Header().Get("Location"))
+
+	// Without the cookie set at the start of the login, e.g. a callback
+	// URL forwarded to another browser.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/oidc/fake/callback?"+callback.Encode(), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/oidc/other/login", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/oidc/fake/callback?"+url.Values{"error": {"access_denied"}}.Encode(), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, int64(0), identityCount(t))
+}
@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider is a minimal OpenID Connect provider. Its authorization
+// endpoint logs in as Subject without asking and redirects straight back
+// with a code.
+type fakeProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	keyID    string
+	clientID string
+	secret   string
+
+	mu            sync.Mutex
+	Subject       string
+	Email         string
+	EmailVerified bool
+	codes         map[string]url.Values
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeProvider{
+		key:           key,
+		keyID:         "fake-1",
+		clientID:      "deeli",
+		secret:        "client-secret",
+		Subject:       "subject-1",
+		Email:         "sso@example.com",
+		EmailVerified: true,
+		codes:         map[string]url.Values{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                f.URL,
+			AuthorizationEndpoint: f.URL + "/authorize",
+			TokenEndpoint:         f.URL + "/token",
+			JWKSURI:               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: f.keyID,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != f.clientID || query.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		code := "code-" + query.Get("state")
+		f.codes[code] = query
+		f.mu.Unlock()
+
+		redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != f.clientID || secret != f.secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		f.mu.Lock()
+		request, ok := f.codes[r.PostFormValue("code")]
+		delete(f.codes, r.PostFormValue("code"))
+		f.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") ||
+			r.PostFormValue("redirect_uri") != request.Get("redirect_uri") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "unused",
+			"token_type":   "Bearer",
+			"id_token":     f.idToken(t, f.claims(request.Get("nonce"))),
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeProvider) claims(nonce string) jwt.MapClaims {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            f.Subject,
+		"aud":            f.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          f.Email,
+		"email_verified": f.EmailVerified,
+	}
+}
+
+func (f *fakeProvider) idToken(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.keyID
+	signed, err := token.SignedString(f.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (f *fakeProvider) config(redirectURL string) Config {
+	return Config{
+		Name:         "fake",
+		Issuer:       f.URL,
+		ClientID:     f.clientID,
+		ClientSecret: f.secret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// authorize follows an authorization URL to the fake provider and returns
+// the query of its redirect back to us.
+func authorize(t *testing.T, authURL string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query()
+}
+
+func TestProviderAuthorizationCodeFlow(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := NewProvider(fake.config("http://api.test/auth/oidc/fake/callback"), nil)
+	ctx := context.Background()
+
+	state, err := NewLoginState("fake", time.Minute)
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, state.State, state.Nonce, state.Challenge())
+	require.NoError(t, err)
+
+	callback := authorize(t, authURL)
+	assert.Equal(t, state.State, callback.Get("state"))
+
+	// The code is bound to the PKCE verifier.
+	_, err = provider.Exchange(ctx, callback.Get("code"), "wrong-verifier")
+	assert.Error(t, err)
+
+	callback = authorize(t, authURL)
+	idToken, err := provider.Exchange(ctx, callback.Get("code"), state.Verifier)
+	require.NoError(t, err)
+
+	claims, err := provider.VerifyIDToken(ctx, idToken, state.Nonce)
+	require.NoError(t, err)
+	assert.Equal(t, "subject-1", claims.Subject)
+	assert.Equal(t, "sso@example.com", claims.Email)
+	assert.True(t, bool(claims.EmailVerified))
+
+	_, err = provider.VerifyIDToken(ctx, idToken, "other-nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestVerifyIDTokenRejectsBadTokens(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := NewProvider(fake.config("http://api.test/callback"), nil)
+	ctx := context.Background()
+
+	cases := map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"other party":    func(c jwt.MapClaims) { c["aud"] = []string{"deeli", "other"}; c["azp"] = "other" },
+	}
+	for name, tamper := range cases {
+		claims := fake.claims("n")
+		tamper(claims)
+		_, err := provider.VerifyIDToken(ctx, fake.idToken(t, claims), "n")
+		assert.ErrorIs(t, err, ErrInvalidIDToken, name)
+	}
+
+	// Signed by a key the provider doesn't publish.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, fake.claims("n"))
+	token.Header["kid"] = fake.keyID
+	forged, err := token.SignedString(other)
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(ctx, forged, "n")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+	// Symmetric algorithms are refused outright.
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, fake.claims("n"))
+	signed, err := hs.SignedString([]byte("client-secret"))
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(ctx, signed, "n")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	fake := newFakeProvider(t)
+	cfg := fake.config("http://api.test/callback")
+	cfg.Issuer = fake.URL + "/"
+	_, err := NewProvider(cfg, nil).Metadata(context.Background())
+	assert.Error(t, err)
+}
+
+func TestStateCodec(t *testing.T) {
+	codec := NewStateCodec([]byte("secret"))
+	state, err := NewLoginState("fake", time.Minute)
+	require.NoError(t, err)
+	cookie, err := codec.Encode(state)
+	require.NoError(t, err)
+
+	decoded, err := codec.Decode(cookie, "fake", state.State)
+	require.NoError(t, err)
+	assert.Equal(t, state.Verifier, decoded.Verifier)
+	assert.Equal(t, state.Nonce, decoded.Nonce)
+
+	_, err = codec.Decode(cookie, "fake", "other-state")
+	assert.ErrorIs(t, err, ErrInvalidState)
+	_, err = codec.Decode(cookie, "other", state.State)
+	assert.ErrorIs(t, err, ErrInvalidState)
+	_, err = NewStateCodec([]byte("other")).Decode(cookie, "fake", state.State)
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	codec.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = codec.Decode(cookie, "fake", state.State)
+	assert.ErrorIs(t, err, ErrInvalidState)
+}
@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidState = errors.New("invalid or expired login state")
+
+// LoginState is what the browser carries, in a signed cookie, from the
+// redirect to the provider back to our callback: the state that must come
+// back in the query, the nonce the ID token must contain, and the PKCE
+// verifier for the code exchange.
+type LoginState struct {
+	Provider  string `json:"p"`
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// NewLoginState starts a login with the provider, valid for ttl.
+func NewLoginState(provider string, ttl time.Duration) (*LoginState, error) {
+	var values [3]string
+	for i := range values {
+		v, err := randomString()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return &LoginState{
+		Provider:  provider,
+		State:     values[0],
+		Nonce:     values[1],
+		Verifier:  values[2],
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}, nil
+}
+
+// Challenge returns the PKCE S256 code challenge for the verifier.
+func (s *LoginState) Challenge() string {
+	sum := sha256.Sum256([]byte(s.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// StateCodec signs login states into cookie values and back.
+type StateCodec struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func NewStateCodec(secret []byte) *StateCodec {
+	return &StateCodec{secret: secret, now: time.Now}
+}
+
+func (c *StateCodec) Encode(state *LoginState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + c.sign(encoded), nil
+}
+
+// Decode checks the cookie's signature and expiry, and that it was issued
+// for this provider and the state that came back from it.
+func (c *StateCodec) Decode(value, provider, state string) (*LoginState, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(c.sign(encoded))) {
+		return nil, ErrInvalidState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	var decoded LoginState
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, ErrInvalidState
+	}
+	if decoded.Provider != provider || c.now().Unix() >= decoded.ExpiresAt ||
+		!hmac.Equal([]byte(decoded.State), []byte(state)) {
+		return nil, ErrInvalidState
+	}
+	return &decoded, nil
+}
+
+func (c *StateCodec) sign(encoded string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte("oidc-state:" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,252 @@
+package recommendation
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/pkg/config"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned for a pagination cursor that was not issued by the cache.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is one page of a user's recommendations.
+type Page struct {
+	Items       []article.Article `json:"items"`
+	NextCursor  string            `json:"next_cursor,omitempty"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Stale       bool              `json:"stale"`
+	OptedOut    bool              `json:"opted_out,omitempty"`
+}
+
+// ErrUnknownStrategy is returned when asked for a strategy the cache does not serve.
+var ErrUnknownStrategy = errors.New("unknown recommendation strategy")
+
+// Cache serves recommendations from precomputed lists, one per user and
+// strategy. Lists are built on first request and then kept up to date by
+// the worker: activity marks affected lists stale, stale lists keep being
+// served until they are regenerated, and lists older than maxAge are
+// regenerated regardless.
+type Cache struct {
+	cacheRepo   CacheRepository
+	repo        Repository
+	articleRepo article.Repository
+	services    map[string]Service
+	strategies  []string
+	size        int
+	maxAge      time.Duration
+}
+
+// NewCache creates a cache that stores up to size recommendations per user
+// for each of the given services. The first service is the default strategy.
+func NewCache(cacheRepo CacheRepository, repo Repository, articleRepo article.Repository, size int, maxAge time.Duration, services ...Service) *Cache {
+	c := &Cache{
+		cacheRepo:   cacheRepo,
+		repo:        repo,
+		articleRepo: articleRepo,
+		services:    make(map[string]Service, len(services)),
+		size:        size,
+		maxAge:      maxAge,
+	}
+	for _, s := range services {
+		c.services[s.Strategy()] = s
+		c.strategies = append(c.strategies, s.Strategy())
+	}
+	return c
+}
+
+// NewCacheFromConfig creates a cache sized by REC_CACHE_SIZE and REC_CACHE_MAX_AGE.
+func NewCacheFromConfig(cacheRepo CacheRepository, repo Repository, articleRepo article.Repository, services ...Service) *Cache {
+	return NewCache(cacheRepo, repo, articleRepo,
+		config.GetInt("REC_CACHE_SIZE", 100),
+		config.GetDuration("REC_CACHE_MAX_AGE", 24*time.Hour),
+		services...)
+}
+
+// Strategies lists the strategies the cache serves, default first.
+func (c *Cache) Strategies() []string {
+	return c.strategies
+}
+
+// DefaultStrategy is the strategy used for users outside any experiment.
+func (c *Cache) DefaultStrategy() string {
+	return c.strategies[0]
+}
+
+// GetPage returns up to limit of the strategy's recommendations for the user,
+// starting at cursor. An empty cursor starts at the beginning.
+func (c *Cache) GetPage(userID uint, strategy, cursor string, limit int) (*Page, error) {
+	if _, ok := c.services[strategy]; !ok {
+		return nil, ErrUnknownStrategy
+	}
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := c.cacheRepo.GetCacheState(userID, strategy)
+	if err == gorm.ErrRecordNotFound {
+		if err := c.Refresh(userID, strategy); err != nil {
+			return nil, err
+		}
+		state, err = c.cacheRepo.GetCacheState(userID, strategy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recs, err := c.cacheRepo.GetCachedRecommendations(userID, strategy, offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Items: []article.Article{}, GeneratedAt: state.GeneratedAt, Stale: state.Stale}
+	if len(recs) > limit {
+		page.NextCursor = encodeCursor(recs[limit].Position)
+		recs = recs[:limit]
+	}
+	if len(recs) == 0 {
+		return page, nil
+	}
+
+	// A stale list can still hold articles deleted or rejected since it was
+	// generated, so those are dropped on the way out.
+	ids := make([]uint, len(recs))
+	for i, rec := range recs {
+		ids[i] = rec.ArticleID
+	}
+	articles, err := c.articleRepo.GetArticlesByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := c.repo.GetFeedbackForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	filter := newFeedbackFilter(feedback)
+	byID := make(map[uint]article.Article, len(articles))
+	for _, a := range articles {
+		byID[a.ID] = a
+	}
+	for _, id := range ids {
+		if a, ok := byID[id]; ok && !filter.excluded[id] && filter.allows(&a) {
+			page.Items = append(page.Items, a)
+		}
+	}
+	return page, nil
+}
+
+// Refresh regenerates and stores a strategy's list for a user.
+func (c *Cache) Refresh(userID uint, strategy string) error {
+	service, ok := c.services[strategy]
+	if !ok {
+		return ErrUnknownStrategy
+	}
+	generatedAt := time.Now()
+	articles, err := service.GetRecommendationsForUser(userID, c.size)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint, len(articles))
+	for i, a := range articles {
+		ids[i] = a.ID
+	}
+	return c.cacheRepo.ReplaceCachedRecommendations(userID, strategy, ids, generatedAt)
+}
+
+// Invalidate marks all of a user's lists stale so the worker regenerates them.
+func (c *Cache) Invalidate(userID uint) error {
+	return c.cacheRepo.MarkStale([]uint{userID})
+}
+
+// RefreshStale regenerates lists that are stale or older than the maximum
+// age, a batch at a time. It is run periodically by the worker.
+func (c *Cache) RefreshStale() {
+	if err := c.cacheRepo.MarkStaleOlderThan(time.Now().Add(-c.maxAge)); err != nil {
+		log.Printf("Recommendation cache error expiring old lists: %v", err)
+		return
+	}
+
+	const batchSize = 50
+	for {
+		entries, err := c.cacheRepo.GetStaleEntries(batchSize)
+		if err != nil {
+			log.Printf("Recommendation cache error fetching stale lists: %v", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+		log.Printf("Recommendation cache: refreshing %d stale lists", len(entries))
+		refreshed := 0
+		for _, entry := range entries {
+			if err := c.Refresh(entry.UserID, entry.Strategy); err != nil {
+				log.Printf("Recommendation cache failed to refresh %s list for user %d: %v", entry.Strategy, entry.UserID, err)
+				continue
+			}
+			refreshed++
+		}
+		if refreshed == 0 {
+			// Every refresh in the batch failed; try again next tick rather than spin.
+			return
+		}
+	}
+}
+
+// Invalidator marks cached lists stale when article or follow activity, or
+// a newly trained model, affects them. It is registered as an article.ActivityObserver and a
+// social.FollowObserver.
+type Invalidator struct {
+	cacheRepo CacheRepository
+}
+
+func NewInvalidator(cacheRepo CacheRepository) *Invalidator {
+	return &Invalidator{cacheRepo: cacheRepo}
+}
+
+// ArticleActivity implements article.ActivityObserver.
+func (i *Invalidator) ArticleActivity(userID, articleID uint) {
+	if err := i.cacheRepo.InvalidateForActivity(userID, articleID); err != nil {
+		log.Printf("Recommendation cache failed to invalidate after activity by user %d on article %d: %v", userID, articleID, err)
+	}
+}
+
+// FollowActivity marks the follower's lists stale after they follow or
+// unfollow someone, since followed users are trusted peers.
+func (i *Invalidator) FollowActivity(followerID, followeeID uint) {
+	if err := i.cacheRepo.MarkStale([]uint{followerID}); err != nil {
+		log.Printf("Recommendation cache failed to invalidate after user %d followed or unfollowed user %d: %v", followerID, followeeID, err)
+	}
+}
+
+// ModelTrained marks every list of the strategy stale after a new model
+// for it is published, so that the worker regenerates them from the model.
+func (i *Invalidator) ModelTrained(strategy string) {
+	if err := i.cacheRepo.MarkStrategyStale(strategy); err != nil {
+		log.Printf("Recommendation cache failed to invalidate %s lists after training: %v", strategy, err)
+	}
+}
+
+func encodeCursor(position int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(position)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	position, err := strconv.Atoi(string(raw))
+	if err != nil || position < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return position, nil
+}
@@ -0,0 +1,131 @@
+package recommendation
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CacheRepository stores the precomputed recommendation lists, one per user
+// and strategy.
+type CacheRepository interface {
+	GetCacheState(userID uint, strategy string) (*CacheState, error)
+	GetCachedRecommendations(userID uint, strategy string, offset, limit int) ([]CachedRecommendation, error)
+	ReplaceCachedRecommendations(userID uint, strategy string, articleIDs []uint, generatedAt time.Time) error
+	MarkStale(userIDs []uint) error
+	MarkStaleOlderThan(cutoff time.Time) error
+	MarkStrategyStale(strategy string) error
+	GetStaleEntries(limit int) ([]CacheState, error)
+	InvalidateForActivity(userID, articleID uint) error
+}
+
+type cacheRepository struct{}
+
+func NewCacheRepository() CacheRepository {
+	return &cacheRepository{}
+}
+
+func (r *cacheRepository) GetCacheState(userID uint, strategy string) (*CacheState, error) {
+	var state CacheState
+	err := database.DB.Where("user_id = ? AND strategy = ?", userID, strategy).First(&state).Error
+	return &state, err
+}
+
+func (r *cacheRepository) GetCachedRecommendations(userID uint, strategy string, offset, limit int) ([]CachedRecommendation, error) {
+	var recs []CachedRecommendation
+	err := database.DB.Where("user_id = ? AND strategy = ? AND position >= ?", userID, strategy, offset).
+		Order("position").
+		Limit(limit).
+		Find(&recs).Error
+	return recs, err
+}
+
+// ReplaceCachedRecommendations swaps in a freshly generated list and marks
+// it current, in one transaction so readers never see a partial list. The
+// state row is written first: its lock makes concurrent refreshes of the
+// same list, such as two first requests, wait for each other instead of
+// colliding on the list's primary key.
+func (r *cacheRepository) ReplaceCachedRecommendations(userID uint, strategy string, articleIDs []uint, generatedAt time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "strategy"}},
+			DoUpdates: clause.AssignmentColumns([]string{"generated_at", "stale"}),
+		}).Create(&CacheState{UserID: userID, Strategy: strategy, GeneratedAt: generatedAt, Stale: false}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND strategy = ?", userID, strategy).Delete(&CachedRecommendation{}).Error; err != nil {
+			return err
+		}
+		if len(articleIDs) > 0 {
+			recs := make([]CachedRecommendation, len(articleIDs))
+			for i, id := range articleIDs {
+				recs[i] = CachedRecommendation{UserID: userID, Strategy: strategy, Position: i, ArticleID: id}
+			}
+			if err := tx.Create(&recs).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *cacheRepository) MarkStale(userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return database.DB.Model(&CacheState{}).
+		Where("user_id IN ? AND stale = ?", userIDs, false).
+		Update("stale", true).Error
+}
+
+func (r *cacheRepository) MarkStaleOlderThan(cutoff time.Time) error {
+	return database.DB.Model(&CacheState{}).
+		Where("generated_at < ? AND stale = ?", cutoff, false).
+		Update("stale", true).Error
+}
+
+func (r *cacheRepository) MarkStrategyStale(strategy string) error {
+	return database.DB.Model(&CacheState{}).
+		Where("strategy = ? AND stale = ?", strategy, false).
+		Update("stale", true).Error
+}
+
+func (r *cacheRepository) GetStaleEntries(limit int) ([]CacheState, error) {
+	var states []CacheState
+	err := database.DB.
+		Where("stale = ?", true).
+		Order("generated_at").
+		Limit(limit).
+		Find(&states).Error
+	return states, err
+}
+
+// InvalidateForActivity marks stale, for every strategy, each cached list
+// that activity by userID on articleID can change: the user's own, those of
+// users who share one of the user's favourites or liked the article (their
+// peer sets include the user), those of the user's followers (the user is a
+// trusted peer to them), and those that currently contain the article.
+func (r *cacheRepository) InvalidateForActivity(userID, articleID uint) error {
+	return database.DB.Exec(`
+		UPDATE cache_states SET stale = true
+		WHERE stale = false AND (
+			user_id = @user
+			OR user_id IN (
+				SELECT user_id FROM ratings
+				WHERE deleted_at IS NULL AND score >= @min AND (
+					article_id = @article
+					OR article_id IN (
+						SELECT article_id FROM ratings
+						WHERE user_id = @user AND deleted_at IS NULL AND score >= @min
+					)
+				)
+			)
+			OR user_id IN (SELECT follower_id FROM follows WHERE followee_id = @user)
+			OR user_id IN (SELECT user_id FROM cached_recommendations WHERE article_id = @article)
+		)`,
+		map[string]interface{}{"user": userID, "article": articleID, "min": minRatingForRecommendation},
+	).Error
+}
@@ -0,0 +1,254 @@
+package recommendation
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type cacheKey struct {
+	userID   uint
+	strategy string
+}
+
+// memoryCacheRepository is a CacheRepository backed by maps. Activity only
+// invalidates the acting user's lists and those holding the article; peer
+// and follower invalidation need the database.
+type memoryCacheRepository struct {
+	mu     sync.Mutex
+	states map[cacheKey]CacheState
+	lists  map[cacheKey][]uint
+}
+
+func newMemoryCacheRepository() *memoryCacheRepository {
+	return &memoryCacheRepository{states: make(map[cacheKey]CacheState), lists: make(map[cacheKey][]uint)}
+}
+
+func (r *memoryCacheRepository) GetCacheState(userID uint, strategy string) (*CacheState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[cacheKey{userID, strategy}]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &state, nil
+}
+
+func (r *memoryCacheRepository) GetCachedRecommendations(userID uint, strategy string, offset, limit int) ([]CachedRecommendation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var recs []CachedRecommendation
+	for position, id := range r.lists[cacheKey{userID, strategy}] {
+		if position >= offset && len(recs) < limit {
+			recs = append(recs, CachedRecommendation{UserID: userID, Strategy: strategy, Position: position, ArticleID: id})
+		}
+	}
+	return recs, nil
+}
+
+func (r *memoryCacheRepository) ReplaceCachedRecommendations(userID uint, strategy string, articleIDs []uint, generatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := cacheKey{userID, strategy}
+	r.lists[key] = append([]uint(nil), articleIDs...)
+	r.states[key] = CacheState{UserID: userID, Strategy: strategy, GeneratedAt: generatedAt}
+	return nil
+}
+
+func (r *memoryCacheRepository) markStale(match func(key cacheKey, state CacheState) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, state := range r.states {
+		if match(key, state) {
+			state.Stale = true
+			r.states[key] = state
+		}
+	}
+}
+
+func (r *memoryCacheRepository) MarkStale(userIDs []uint) error {
+	r.markStale(func(key cacheKey, _ CacheState) bool {
+		for _, id := range userIDs {
+			if key.userID == id {
+				return true
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+func (r *memoryCacheRepository) MarkStaleOlderThan(cutoff time.Time) error {
+	r.markStale(func(_ cacheKey, state CacheState) bool { return state.GeneratedAt.Before(cutoff) })
+	return nil
+}
+
+func (r *memoryCacheRepository) MarkStrategyStale(strategy string) error {
+	r.markStale(func(key cacheKey, _ CacheState) bool { return key.strategy == strategy })
+	return nil
+}
+
+func (r *memoryCacheRepository) GetStaleEntries(limit int) ([]CacheState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var states []CacheState
+	for _, state := range r.states {
+		if state.Stale {
+			states = append(states, state)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].GeneratedAt.Before(states[j].GeneratedAt) })
+	if len(states) > limit {
+		states = states[:limit]
+	}
+	return states, nil
+}
+
+func (r *memoryCacheRepository) InvalidateForActivity(userID, articleID uint) error {
+	r.markStale(func(key cacheKey, _ CacheState) bool {
+		if key.userID == userID {
+			return true
+		}
+		for _, id := range r.lists[key] {
+			if id == articleID {
+				return true
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	position, err := decodeCursor(encodeCursor(42))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, position)
+
+	position, err = decodeCursor("")
+	assert.NoError(t, err)
+	assert.Zero(t, position)
+
+	for _, bad := range []string{"not base64!", encodeCursor(-1), "YWJj"} {
+		_, err = decodeCursor(bad)
+		assert.ErrorIs(t, err, ErrInvalidCursor, bad)
+	}
+}
+
+// listService is a Service that recommends a fixed list of articles and
+// counts how often it was asked.
+type listService struct {
+	ids   []uint
+	calls int
+}
+
+func (s *listService) GetRecommendationsForUser(userID uint, limit int) ([]article.Article, error) {
+	s.calls++
+	articles := []article.Article{}
+	for _, id := range s.ids {
+		if len(articles) < limit {
+			articles = append(articles, article.Article{Model: gorm.Model{ID: id}})
+		}
+	}
+	return articles, nil
+}
+
+func (s *listService) Strategy() string {
+	return StrategyPeer
+}
+
+// newTestCache creates a cache over articles 1 to n serving service's list.
+func newTestCache(t *testing.T, n uint, service Service) (*Cache, *memoryCacheRepository, article.Repository, Repository) {
+	t.Helper()
+	articleRepo := article.NewMemoryRepository()
+	for i := uint(1); i <= n; i++ {
+		require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: i}, UserID: 9, URL: fmt.Sprintf("https://example.com/%d", i)}))
+	}
+	cacheRepo := newMemoryCacheRepository()
+	repo := NewMemoryRepository()
+	return NewCache(cacheRepo, repo, articleRepo, 10, time.Hour, service), cacheRepo, articleRepo, repo
+}
+
+func TestCacheGetPage(t *testing.T) {
+	service := &listService{ids: []uint{1, 2, 3, 4, 5}}
+	cache, _, articleRepo, repo := newTestCache(t, 5, service)
+
+	// The first request builds the list; later pages come from it.
+	page, err := cache.GetPage(1, StrategyPeer, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, service.calls)
+	assert.Equal(t, []uint{1, 2}, articleIDs(page.Items))
+	assert.False(t, page.Stale)
+	require.NotEmpty(t, page.NextCursor)
+
+	page, err = cache.GetPage(1, StrategyPeer, page.NextCursor, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{3, 4}, articleIDs(page.Items))
+
+	// Articles deleted or dismissed since the list was built are dropped
+	// without regenerating it.
+	require.NoError(t, articleRepo.DeleteArticle(5, 9))
+	require.NoError(t, repo.CreateFeedback(&Feedback{UserID: 1, ArticleID: 4, Action: ActionDismiss}))
+	page, err = cache.GetPage(1, StrategyPeer, page.NextCursor, 2)
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, 1, service.calls)
+
+	_, err = cache.GetPage(1, "unknown", "", 2)
+	assert.ErrorIs(t, err, ErrUnknownStrategy)
+	_, err = cache.GetPage(1, StrategyPeer, "not a cursor!", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCacheRefreshesInvalidatedLists(t *testing.T) {
+	service := &listService{ids: []uint{1, 2}}
+	cache, cacheRepo, _, _ := newTestCache(t, 3, service)
+	for _, userID := range []uint{1, 2} {
+		_, err := cache.GetPage(userID, StrategyPeer, "", 10)
+		require.NoError(t, err)
+	}
+	require.NoError(t, cacheRepo.ReplaceCachedRecommendations(3, StrategyPeer, []uint{3}, time.Now()))
+
+	// Activity on article 2 affects the lists holding it, which are served
+	// stale until the worker regenerates them.
+	NewInvalidator(cacheRepo).ArticleActivity(5, 2)
+	page, err := cache.GetPage(1, StrategyPeer, "", 10)
+	require.NoError(t, err)
+	assert.True(t, page.Stale)
+	assert.Equal(t, []uint{1, 2}, articleIDs(page.Items))
+	state, err := cacheRepo.GetCacheState(3, StrategyPeer)
+	require.NoError(t, err)
+	assert.False(t, state.Stale)
+
+	service.ids = []uint{3, 1}
+	cache.RefreshStale()
+	assert.Equal(t, 4, service.calls)
+	for _, userID := range []uint{1, 2} {
+		page, err = cache.GetPage(userID, StrategyPeer, "", 10)
+		require.NoError(t, err)
+		assert.False(t, page.Stale)
+		assert.Equal(t, []uint{3, 1}, articleIDs(page.Items))
+	}
+
+	// Invalidate marks all of a user's lists stale.
+	require.NoError(t, cache.Invalidate(2))
+	stale, err := cacheRepo.GetStaleEntries(10)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+	assert.Equal(t, uint(2), stale[0].UserID)
+}
+
+func articleIDs(articles []article.Article) []uint {
+	ids := make([]uint, len(articles))
+	for i, a := range articles {
+		ids[i] = a.ID
+	}
+	return ids
+}
@@ -0,0 +1,104 @@
+// Package eval runs recommendation services offline against a ratings
+// dataset and scores the results with standard ranking metrics.
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+)
+
+// Rating is a single user-item rating in an evaluation dataset.
+type Rating struct {
+	UserID uint
+	ItemID uint
+	Score  float64
+	Time   time.Time
+}
+
+// LoadCSV reads ratings in MovieLens layout: user, item, rating and an
+// optional Unix timestamp per line. Fields may be separated by ",", "::" or
+// tabs, and a non-numeric header line is skipped.
+func LoadCSV(r io.Reader) ([]Rating, error) {
+	var ratings []Rating
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := splitFields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least 3 fields, got %d", lineNo, len(fields))
+		}
+
+		userID, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			if lineNo == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: invalid user ID %q", lineNo, fields[0])
+		}
+		itemID, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid item ID %q", lineNo, fields[1])
+		}
+		score, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rating %q", lineNo, fields[2])
+		}
+
+		rating := Rating{UserID: uint(userID), ItemID: uint(itemID), Score: score}
+		if len(fields) > 3 {
+			ts, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid timestamp %q", lineNo, fields[3])
+			}
+			rating.Time = time.Unix(ts, 0).UTC()
+		}
+		ratings = append(ratings, rating)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+func splitFields(line string) []string {
+	var fields []string
+	switch {
+	case strings.Contains(line, "::"):
+		fields = strings.Split(line, "::")
+	case strings.Contains(line, "\t"):
+		fields = strings.Split(line, "\t")
+	default:
+		fields = strings.Split(line, ",")
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// FromArticleRatings converts stored ratings into an evaluation dataset,
+// treating each article as an item.
+func FromArticleRatings(stored []article.Rating) []Rating {
+	ratings := make([]Rating, 0, len(stored))
+	for _, r := range stored {
+		ratings = append(ratings, Rating{
+			UserID: r.UserID,
+			ItemID: r.ArticleID,
+			Score:  float64(r.Score),
+			Time:   r.CreatedAt,
+		})
+	}
+	return ratings
+}
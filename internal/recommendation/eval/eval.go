@@ -0,0 +1,175 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"gorm.io/gorm"
+)
+
+// Factory builds the recommendation service under evaluation on top of the
+// in-memory repositories seeded with the training data.
+type Factory func(articleRepo article.Repository, repo recommendation.Repository) recommendation.Service
+
+// Config controls how recommendations are scored.
+type Config struct {
+	// K is the cut-off for the ranking metrics.
+	K int
+	// RelevanceThreshold is the minimum held-out score for an item to count
+	// as relevant.
+	RelevanceThreshold float64
+}
+
+// Report holds the metrics for one evaluation run. Ranking metrics are
+// averaged over the evaluated users.
+type Report struct {
+	K            int     `json:"k"`
+	Users        int     `json:"users"`
+	UsersServed  int     `json:"users_served"`
+	Items        int     `json:"items"`
+	TrainRatings int     `json:"train_ratings"`
+	TestRatings  int     `json:"test_ratings"`
+	PrecisionAtK float64 `json:"precision_at_k"`
+	RecallAtK    float64 `json:"recall_at_k"`
+	NDCGAtK      float64 `json:"ndcg_at_k"`
+	MAPAtK       float64 `json:"map_at_k"`
+	Coverage     float64 `json:"coverage"`
+	Novelty      float64 `json:"novelty"`
+}
+
+// Evaluate seeds in-memory repositories with the training ratings, asks the
+// service for recommendations for every user with relevant held-out items,
+// and scores them. Users who get no recommendations count as misses.
+//
+// Every item becomes an article that no user owns; a training rating stands
+// for the user having saved and rated it.
+func Evaluate(split Split, factory Factory, cfg Config) (*Report, error) {
+	if cfg.K <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", cfg.K)
+	}
+
+	articleRepo := article.NewMemoryRepository()
+	items := make(map[uint]bool)
+	for _, ratings := range [][]Rating{split.Train, split.Test} {
+		for _, r := range ratings {
+			if items[r.ItemID] {
+				continue
+			}
+			items[r.ItemID] = true
+			err := articleRepo.CreateArticle(&article.Article{
+				Model:  gorm.Model{ID: r.ItemID},
+				URL:    fmt.Sprintf("https://items.invalid/%d", r.ItemID),
+				Title:  fmt.Sprintf("Item %d", r.ItemID),
+				Status: article.StatusCompleted,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("seeding item %d: %w", r.ItemID, err)
+			}
+		}
+	}
+
+	trainUsers := make(map[uint]bool)
+	popularity := make(map[uint]int)
+	for _, r := range split.Train {
+		trainUsers[r.UserID] = true
+		popularity[r.ItemID]++
+		err := articleRepo.CreateOrUpdateRating(&article.Rating{
+			Model:     gorm.Model{CreatedAt: r.Time},
+			UserID:    r.UserID,
+			ArticleID: r.ItemID,
+			Score:     toScore(r.Score),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("seeding rating: %w", err)
+		}
+	}
+
+	relevant := make(map[uint]map[uint]bool)
+	for _, r := range split.Test {
+		if r.Score < cfg.RelevanceThreshold {
+			continue
+		}
+		if relevant[r.UserID] == nil {
+			relevant[r.UserID] = make(map[uint]bool)
+		}
+		relevant[r.UserID][r.ItemID] = true
+	}
+	userIDs := make([]uint, 0, len(relevant))
+	for id := range relevant {
+		userIDs = append(userIDs, id)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	service := factory(articleRepo, recommendation.NewMemoryRepository())
+
+	report := &Report{
+		K:            cfg.K,
+		Users:        len(userIDs),
+		Items:        len(items),
+		TrainRatings: len(split.Train),
+		TestRatings:  len(split.Test),
+	}
+	recommendedItems := make(map[uint]bool)
+	var noveltySum float64
+	var noveltyCount int
+	for _, userID := range userIDs {
+		articles, err := service.GetRecommendationsForUser(userID, cfg.K)
+		if err != nil {
+			return nil, fmt.Errorf("recommending for user %d: %w", userID, err)
+		}
+		recommended := make([]uint, 0, len(articles))
+		for _, a := range articles {
+			recommended = append(recommended, a.ID)
+		}
+		recommended = topK(recommended, cfg.K)
+		if len(recommended) > 0 {
+			report.UsersServed++
+		}
+
+		rel := relevant[userID]
+		report.PrecisionAtK += precisionAtK(recommended, rel, cfg.K)
+		report.RecallAtK += recallAtK(recommended, rel, cfg.K)
+		report.NDCGAtK += ndcgAtK(recommended, rel, cfg.K)
+		report.MAPAtK += averagePrecisionAtK(recommended, rel, cfg.K)
+
+		for _, id := range recommended {
+			recommendedItems[id] = true
+			pop := popularity[id]
+			if pop == 0 {
+				pop = 1
+			}
+			noveltySum += -math.Log2(float64(pop) / float64(len(trainUsers)))
+			noveltyCount++
+		}
+	}
+
+	if report.Users > 0 {
+		n := float64(report.Users)
+		report.PrecisionAtK /= n
+		report.RecallAtK /= n
+		report.NDCGAtK /= n
+		report.MAPAtK /= n
+	}
+	if report.Items > 0 {
+		report.Coverage = float64(len(recommendedItems)) / float64(report.Items)
+	}
+	if noveltyCount > 0 {
+		report.Novelty = noveltySum / float64(noveltyCount)
+	}
+	return report, nil
+}
+
+// toScore maps a dataset rating onto the 1-5 integer scale articles use.
+func toScore(score float64) int {
+	s := int(math.Round(score))
+	if s < 1 {
+		return 1
+	}
+	if s > 5 {
+		return 5
+	}
+	return s
+}
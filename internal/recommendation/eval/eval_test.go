@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/recommendation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCSV(t *testing.T) {
+	csv := "userId,movieId,rating,timestamp\n1,10,4.0,964982703\n1,20,3.5,964981247\n"
+	ratings, err := LoadCSV(strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Len(t, ratings, 2)
+	assert.Equal(t, Rating{UserID: 1, ItemID: 10, Score: 4, Time: time.Unix(964982703, 0).UTC()}, ratings[0])
+
+	dat := "2::30::5::978300760\n"
+	ratings, err = LoadCSV(strings.NewReader(dat))
+	require.NoError(t, err)
+	assert.Equal(t, uint(30), ratings[0].ItemID)
+
+	_, err = LoadCSV(strings.NewReader("1,10,4\nx,20,4\n"))
+	assert.Error(t, err)
+}
+
+func TestMetrics(t *testing.T) {
+	relevant := map[uint]bool{1: true, 3: true, 9: true}
+	recommended := []uint{1, 2, 3, 4}
+
+	assert.InDelta(t, 0.5, precisionAtK(recommended, relevant, 4), 1e-9)
+	assert.InDelta(t, 2.0/3.0, recallAtK(recommended, relevant, 4), 1e-9)
+	// Hits at ranks 1 and 3: (1 + 2/3) / min(3, 4).
+	assert.InDelta(t, (1+2.0/3.0)/3, averagePrecisionAtK(recommended, relevant, 4), 1e-9)
+	// DCG = 1 + 1/log2(4); IDCG = 1 + 1/log2(3) + 1/log2(4).
+	assert.InDelta(t, 1.5/(1+0.6309297535714575+0.5), ndcgAtK(recommended, relevant, 4), 1e-9)
+
+	assert.Zero(t, precisionAtK(nil, relevant, 4))
+	assert.Zero(t, ndcgAtK(recommended, map[uint]bool{}, 4))
+}
+
+func TestSplitRatings(t *testing.T) {
+	base := time.Unix(0, 0)
+	var ratings []Rating
+	for u := uint(1); u <= 3; u++ {
+		for i := uint(1); i <= 5; i++ {
+			ratings = append(ratings, Rating{UserID: u, ItemID: i, Score: 5, Time: base.Add(time.Duration(i) * time.Hour)})
+		}
+	}
+	ratings = append(ratings, Rating{UserID: 4, ItemID: 1, Score: 5, Time: base})
+
+	split, err := SplitRatings(ratings, SplitTemporal, 0.4, 1)
+	require.NoError(t, err)
+	assert.Len(t, split.Test, 6)
+	for _, r := range split.Test {
+		assert.Contains(t, []uint{4, 5}, r.ItemID, "temporal split holds out the latest ratings")
+	}
+
+	first, err := SplitRatings(ratings, SplitRandom, 0.4, 42)
+	require.NoError(t, err)
+	second, err := SplitRatings(ratings, SplitRandom, 0.4, 42)
+	require.NoError(t, err)
+	assert.Equal(t, first, second, "same seed gives the same split")
+
+	_, err = SplitRatings(ratings, SplitRandom, 1.5, 42)
+	assert.Error(t, err)
+}
+
+func TestEvaluatePeerService(t *testing.T) {
+	// Users 1-4 like items 1-4; users 5-8 like items 5-8. Each user's last
+	// rating is held out and should be found through their group.
+	base := time.Unix(0, 0)
+	var ratings []Rating
+	for u := uint(1); u <= 8; u++ {
+		group := uint(0)
+		if u > 4 {
+			group = 4
+		}
+		for i := uint(1); i <= 4; i++ {
+			item := group + (u+i)%4 + 1
+			ratings = append(ratings, Rating{UserID: u, ItemID: item, Score: 5, Time: base.Add(time.Duration(i) * time.Hour)})
+		}
+	}
+
+	split, err := SplitRatings(ratings, SplitTemporal, 0.25, 1)
+	require.NoError(t, err)
+
+	factory := func(articleRepo article.Repository, repo recommendation.Repository) recommendation.Service {
+		return recommendation.NewService(articleRepo, repo, nil, nil)
+	}
+	report, err := Evaluate(split, factory, Config{K: 4, RelevanceThreshold: 4})
+	require.NoError(t, err)
+
+	assert.Equal(t, 8, report.Users)
+	assert.Equal(t, 8, report.UsersServed)
+	assert.InDelta(t, 1.0, report.RecallAtK, 1e-9)
+	assert.InDelta(t, 1.0, report.Coverage, 1e-9)
+
+	again, err := Evaluate(split, factory, Config{K: 4, RelevanceThreshold: 4})
+	require.NoError(t, err)
+	assert.Equal(t, report, again)
+}
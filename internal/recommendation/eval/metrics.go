@@ -0,0 +1,75 @@
+package eval
+
+import "math"
+
+// precisionAtK is the fraction of the top k recommendations that are relevant.
+func precisionAtK(recommended []uint, relevant map[uint]bool, k int) float64 {
+	if k == 0 {
+		return 0
+	}
+	return float64(hits(recommended, relevant, k)) / float64(k)
+}
+
+// recallAtK is the fraction of relevant items found in the top k.
+func recallAtK(recommended []uint, relevant map[uint]bool, k int) float64 {
+	if len(relevant) == 0 {
+		return 0
+	}
+	return float64(hits(recommended, relevant, k)) / float64(len(relevant))
+}
+
+// ndcgAtK is the discounted cumulative gain of the top k with binary
+// relevance, normalised by the gain of an ideal ranking.
+func ndcgAtK(recommended []uint, relevant map[uint]bool, k int) float64 {
+	var dcg float64
+	for i, id := range topK(recommended, k) {
+		if relevant[id] {
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+	}
+	var idcg float64
+	for i := 0; i < len(relevant) && i < k; i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+	if idcg == 0 {
+		return 0
+	}
+	return dcg / idcg
+}
+
+// averagePrecisionAtK averages precision at each relevant position in the top k.
+func averagePrecisionAtK(recommended []uint, relevant map[uint]bool, k int) float64 {
+	if len(relevant) == 0 {
+		return 0
+	}
+	var sum float64
+	found := 0
+	for i, id := range topK(recommended, k) {
+		if relevant[id] {
+			found++
+			sum += float64(found) / float64(i+1)
+		}
+	}
+	denom := len(relevant)
+	if k < denom {
+		denom = k
+	}
+	return sum / float64(denom)
+}
+
+func hits(recommended []uint, relevant map[uint]bool, k int) int {
+	n := 0
+	for _, id := range topK(recommended, k) {
+		if relevant[id] {
+			n++
+		}
+	}
+	return n
+}
+
+func topK(recommended []uint, k int) []uint {
+	if len(recommended) > k {
+		return recommended[:k]
+	}
+	return recommended
+}
@@ -0,0 +1,72 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// SplitMethod selects how each user's ratings are divided into train and test.
+type SplitMethod string
+
+const (
+	// SplitTemporal holds out each user's most recent ratings.
+	SplitTemporal SplitMethod = "temporal"
+	// SplitRandom holds out a random sample of each user's ratings.
+	SplitRandom SplitMethod = "random"
+)
+
+// Split is a train/test partition of a dataset.
+type Split struct {
+	Train []Rating
+	Test  []Rating
+}
+
+// SplitRatings holds out testFraction of every user's ratings, rounded up,
+// while always leaving at least one rating in train. Users with a single
+// rating go entirely to train. The same seed always produces the same split.
+func SplitRatings(ratings []Rating, method SplitMethod, testFraction float64, seed int64) (Split, error) {
+	if testFraction <= 0 || testFraction >= 1 {
+		return Split{}, fmt.Errorf("test fraction must be between 0 and 1, got %v", testFraction)
+	}
+	if method != SplitTemporal && method != SplitRandom {
+		return Split{}, fmt.Errorf("unknown split method %q", method)
+	}
+
+	byUser := make(map[uint][]Rating)
+	for _, r := range ratings {
+		byUser[r.UserID] = append(byUser[r.UserID], r)
+	}
+	userIDs := make([]uint, 0, len(byUser))
+	for id := range byUser {
+		userIDs = append(userIDs, id)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	rng := rand.New(rand.NewSource(seed))
+	var split Split
+	for _, userID := range userIDs {
+		userRatings := byUser[userID]
+		sort.SliceStable(userRatings, func(i, j int) bool {
+			if !userRatings[i].Time.Equal(userRatings[j].Time) {
+				return userRatings[i].Time.Before(userRatings[j].Time)
+			}
+			return userRatings[i].ItemID < userRatings[j].ItemID
+		})
+		if method == SplitRandom {
+			rng.Shuffle(len(userRatings), func(i, j int) {
+				userRatings[i], userRatings[j] = userRatings[j], userRatings[i]
+			})
+		}
+
+		holdout := int(math.Ceil(testFraction * float64(len(userRatings))))
+		if holdout >= len(userRatings) {
+			holdout = len(userRatings) - 1
+		}
+		cut := len(userRatings) - holdout
+		split.Train = append(split.Train, userRatings[:cut]...)
+		split.Test = append(split.Test, userRatings[cut:]...)
+	}
+	return split, nil
+}
@@ -1,28 +1,285 @@
 package recommendation
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/cheildo/deeli-api/internal/article"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// Router decides which strategy serves a user's recommendations, for
+// instance by assigning the user to an experiment variant.
+type Router interface {
+	Route(userID uint) (Attribution, error)
+}
+
+// Settings reads the user's preferences that affect recommendations.
+type Settings interface {
+	// RecommendationSettings returns whether the user has opted out of
+	// recommendations, and their timezone.
+	RecommendationSettings(userID uint) (bool, *time.Location, error)
+}
+
 type Handler struct {
-	service Service
+	cache       *Cache
+	router      Router
+	similar     *SimilarService
+	repo        Repository
+	articleRepo article.Repository
+	settings    Settings
+	workspaces  *WorkspaceService
 }
 
-func NewHandler(service Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(cache *Cache, router Router, similar *SimilarService, repo Repository, articleRepo article.Repository, settings Settings, workspaces *WorkspaceService) *Handler {
+	return &Handler{cache: cache, router: router, similar: similar, repo: repo, articleRepo: articleRepo, settings: settings, workspaces: workspaces}
 }
 
-// GetRecommendations handles the GET /recommendations request.
+// GetRecommendations handles the GET /recommendations request. The list
+// comes from the strategy the router assigns to the user, or with
+// ?workspace_id= from the workspace's members. Users who opted out get an
+// empty page and no impressions are recorded.
+//
+// The response is a bare array of articles, as it was before pagination,
+// unless the client asks for a Page with ?version=2. Only a Page carries
+// the next_cursor and generated_at a client needs to page, so ?cursor= is
+// rejected without ?version=2. Workspace lists are generated on request in
+// a single page and reject ?cursor= too.
 func (h *Handler) GetRecommendations(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 
-	recommendations, err := h.service.GetRecommendationsForUser(userID)
+	var paged bool
+	switch c.DefaultQuery("version", "1") {
+	case "1":
+	case "2":
+		paged = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported version"})
+		return
+	}
+	cursor := c.Query("cursor")
+	if cursor != "" && !paged {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pagination requires version=2"})
+		return
+	}
+
+	optedOut, loc, err := h.settings.RecommendationSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load preferences"})
+		return
+	}
+	if optedOut {
+		respondPage(c, &Page{Items: []article.Article{}, GeneratedAt: time.Now().In(loc), OptedOut: true}, paged)
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	var page *Page
+	var attribution Attribution
+	if raw := c.Query("workspace_id"); raw != "" {
+		workspaceID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+			return
+		}
+		if cursor != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Workspace recommendations are not paginated"})
+			return
+		}
+		items, err := h.workspaces.Recommend(userID, uint(workspaceID), limit)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recommendations"})
+			return
+		}
+		page = &Page{Items: items, GeneratedAt: time.Now()}
+		attribution = Attribution{Strategy: StrategyWorkspace}
+	} else {
+		attribution, err = h.router.Route(userID)
+		if err != nil {
+			log.Printf("Failed to route recommendations for user %d, using default strategy: %v", userID, err)
+			attribution = Attribution{Strategy: h.cache.DefaultStrategy()}
+		}
+
+		page, err = h.cache.GetPage(userID, attribution.Strategy, cursor, limit)
+		if err != nil {
+			if err == ErrInvalidCursor {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recommendations"})
+			return
+		}
+	}
+
+	articleIDs := make([]uint, len(page.Items))
+	for i, a := range page.Items {
+		articleIDs[i] = a.ID
+	}
+	if err := h.repo.RecordImpressions(userID, articleIDs, attribution); err != nil {
+		log.Printf("Failed to record impressions for user %d: %v", userID, err)
+	}
+
+	page.GeneratedAt = page.GeneratedAt.In(loc)
+	respondPage(c, page, paged)
+}
+
+// respondPage writes the page, or only its items for clients of the
+// unpaginated endpoint.
+func respondPage(c *gin.Context, page *Page, paged bool) {
+	if !paged {
+		c.JSON(http.StatusOK, page.Items)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetSimilarArticles handles GET /articles/:id/similar
+func (h *Handler) GetSimilarArticles(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	similar, err := h.similar.FindSimilar(userID, uint(articleID), limit)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find similar articles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, similar)
+}
+
+// FeedbackRequest defines the JSON for giving feedback on a recommendation.
+type FeedbackRequest struct {
+	Action FeedbackAction `json:"action" binding:"required,oneof=dismiss not_interested mute_domain mute_topic"`
+	Topic  string         `json:"topic"`
+}
+
+// CreateFeedback handles POST /recommendations/:id/feedback
+func (h *Handler) CreateFeedback(c *gin.Context) {
+	var req FeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Action == ActionMuteTopic && len(tokenize(req.Topic)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A topic is required to mute a topic"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	art, err := h.feedbackArticle(userID, uint(articleID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	feedback := &Feedback{
+		UserID:    userID,
+		ArticleID: art.ID,
+		Action:    req.Action,
+	}
+	switch req.Action {
+	case ActionMuteDomain:
+		feedback.Domain = art.Domain()
+		if feedback.Domain == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Article URL has no domain to mute"})
+			return
+		}
+	case ActionMuteTopic:
+		feedback.Topic = req.Topic
+	}
+
+	if err := h.repo.CreateFeedback(feedback); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+	if err := h.cache.Invalidate(userID); err != nil {
+		log.Printf("Failed to invalidate recommendations for user %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusCreated, feedback)
+}
+
+// feedbackArticle loads an article the user may give feedback on: one they
+// can read, or one they were recommended. Any other article is reported as
+// not found, so muting a domain can't reveal what another user saved.
+func (h *Handler) feedbackArticle(userID, articleID uint) (*article.Article, error) {
+	art, err := h.articleRepo.GetAccessibleArticle(articleID, userID, article.AccessRead)
+	if err != gorm.ErrRecordNotFound {
+		return art, err
+	}
+	recommended, err := h.repo.WasRecommended(userID, articleID)
+	if err != nil {
+		return nil, err
+	}
+	if !recommended {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return h.articleRepo.GetArticleByID(articleID)
+}
+
+// RecordClick handles POST /recommendations/:id/click
+func (h *Handler) RecordClick(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	if err := h.repo.RecordClick(userID, uint(articleID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article was not recommended to you"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record click"})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// GetStats handles GET /admin/recommendations/stats, reporting CTR per
+// strategy across all users.
+func (h *Handler) GetStats(c *gin.Context) {
+	stats, err := h.repo.GetStrategyStats()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recommendations"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute recommendation stats"})
 		return
 	}
 
-	c.JSON(http.StatusOK, recommendations)
+	c.JSON(http.StatusOK, stats)
 }
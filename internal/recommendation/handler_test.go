@@ -0,0 +1,152 @@
+package recommendation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// settings is a Settings with the same answer for every user.
+type settings struct {
+	optedOut bool
+}
+
+func (s settings) RecommendationSettings(userID uint) (bool, *time.Location, error) {
+	return s.optedOut, time.UTC, nil
+}
+
+// defaultRouter routes every user to the peer strategy.
+type defaultRouter struct{}
+
+func (defaultRouter) Route(userID uint) (Attribution, error) {
+	return Attribution{Strategy: StrategyPeer}, nil
+}
+
+// newTestRouter serves h's routes to user 1.
+func newTestRouter(h *Handler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", uint(1)) })
+	r.GET("/recommendations", h.GetRecommendations)
+	r.POST("/recommendations/:id/feedback", h.CreateFeedback)
+	r.POST("/recommendations/:id/click", h.RecordClick)
+	r.GET("/recommendations/stats", h.GetStats)
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func post(r *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetRecommendationsVersions(t *testing.T) {
+	cache, _, articleRepo, repo := newTestCache(t, 3, &listService{ids: []uint{1, 2, 3}})
+	r := newTestRouter(NewHandler(cache, defaultRouter{}, nil, repo, articleRepo, settings{}, nil))
+
+	// Without a version the response is the bare array it always was.
+	w := get(r, "/recommendations?limit=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	var items []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	assert.Len(t, items, 2)
+
+	w = get(r, "/recommendations?limit=2&version=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Items      []map[string]interface{} `json:"items"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	w = get(r, "/recommendations?limit=2&version=2&cursor="+page.NextCursor)
+	require.Equal(t, http.StatusOK, w.Code)
+	page.NextCursor = ""
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 1)
+	assert.Empty(t, page.NextCursor)
+
+	assert.Equal(t, http.StatusBadRequest, get(r, "/recommendations?version=3").Code)
+	// Without a Page there is no next cursor to follow, so a cursor is refused.
+	assert.Equal(t, http.StatusBadRequest, get(r, "/recommendations?limit=2&cursor="+encodeCursor(2)).Code)
+	assert.Equal(t, http.StatusBadRequest, get(r, "/recommendations?version=2&workspace_id=7&cursor="+encodeCursor(2)).Code)
+}
+
+func TestGetRecommendationsOptedOut(t *testing.T) {
+	cache, _, articleRepo, repo := newTestCache(t, 1, &listService{ids: []uint{1}})
+	r := newTestRouter(NewHandler(cache, defaultRouter{}, nil, repo, articleRepo, settings{optedOut: true}, nil))
+
+	w := get(r, "/recommendations")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+	w = get(r, "/recommendations?version=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"opted_out":true`)
+}
+
+func TestCreateFeedback(t *testing.T) {
+	// Articles 1 and 2 belong to user 9; only 1 is recommended to user 1.
+	cache, _, articleRepo, repo := newTestCache(t, 2, &listService{ids: []uint{1}})
+	require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: 3}, UserID: 1, URL: "https://www.own.example.org/post"}))
+	r := newTestRouter(NewHandler(cache, defaultRouter{}, nil, repo, articleRepo, settings{}, nil))
+	require.Equal(t, http.StatusOK, get(r, "/recommendations").Code)
+
+	// Another user's article that wasn't recommended can't be muted, which
+	// would reveal its domain.
+	assert.Equal(t, http.StatusNotFound, post(r, "/recommendations/2/feedback", `{"action":"mute_domain"}`).Code)
+	assert.Equal(t, http.StatusNotFound, post(r, "/recommendations/99/feedback", `{"action":"dismiss"}`).Code)
+
+	w := post(r, "/recommendations/1/feedback", `{"action":"mute_domain"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var feedback Feedback
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feedback))
+	assert.Equal(t, "example.com", feedback.Domain)
+
+	w = post(r, "/recommendations/3/feedback", `{"action":"mute_domain"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feedback))
+	assert.Equal(t, "own.example.org", feedback.Domain)
+
+	assert.Equal(t, http.StatusBadRequest, post(r, "/recommendations/1/feedback", `{"action":"mute_topic","topic":"  "}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(r, "/recommendations/1/feedback", `{"action":"shout"}`).Code)
+
+	stored, err := repo.GetFeedbackForUser(1)
+	require.NoError(t, err)
+	assert.Len(t, stored, 2)
+}
+
+func TestRecordClickAndStats(t *testing.T) {
+	cache, _, articleRepo, repo := newTestCache(t, 3, &listService{ids: []uint{1, 2}})
+	r := newTestRouter(NewHandler(cache, defaultRouter{}, nil, repo, articleRepo, settings{}, nil))
+	require.Equal(t, http.StatusOK, get(r, "/recommendations").Code)
+
+	assert.Equal(t, http.StatusNotFound, post(r, "/recommendations/3/click", "").Code)
+	assert.Equal(t, http.StatusBadRequest, post(r, "/recommendations/nope/click", "").Code)
+	assert.Equal(t, http.StatusNoContent, post(r, "/recommendations/1/click", "").Code)
+
+	w := get(r, "/recommendations/stats")
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats []StrategyStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, []StrategyStats{{Strategy: StrategyPeer, Impressions: 2, Clicks: 1, CTR: 0.5}}, stats)
+}
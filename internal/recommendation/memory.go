@@ -0,0 +1,129 @@
+package recommendation
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryRepository is an in-memory Repository for tools and tests that run
+// without a database.
+type memoryRepository struct {
+	mu       sync.RWMutex
+	feedback []Feedback
+	events   []Event
+}
+
+// NewMemoryRepository creates an empty in-memory Repository.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{}
+}
+
+func (r *memoryRepository) CreateFeedback(feedback *Feedback) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	feedback.ID = uint(len(r.feedback) + 1)
+	feedback.CreatedAt = time.Now()
+	feedback.UpdatedAt = feedback.CreatedAt
+	r.feedback = append(r.feedback, *feedback)
+	return nil
+}
+
+func (r *memoryRepository) GetFeedbackForUser(userID uint) ([]Feedback, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var feedback []Feedback
+	for _, fb := range r.feedback {
+		if fb.UserID == userID {
+			feedback = append(feedback, fb)
+		}
+	}
+	return feedback, nil
+}
+
+func (r *memoryRepository) RecordImpressions(userID uint, articleIDs []uint, attribution Attribution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range articleIDs {
+		r.events = append(r.events, Event{
+			ID:         uint(len(r.events) + 1),
+			CreatedAt:  time.Now(),
+			UserID:     userID,
+			ArticleID:  id,
+			Type:       EventImpression,
+			Strategy:   attribution.Strategy,
+			Experiment: attribution.Experiment,
+			Variant:    attribution.Variant,
+		})
+	}
+	return nil
+}
+
+func (r *memoryRepository) RecordClick(userID, articleID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.events) - 1; i >= 0; i-- {
+		e := r.events[i]
+		if e.UserID == userID && e.ArticleID == articleID && e.Type == EventImpression {
+			r.events = append(r.events, Event{
+				ID:         uint(len(r.events) + 1),
+				CreatedAt:  time.Now(),
+				UserID:     userID,
+				ArticleID:  articleID,
+				Type:       EventClick,
+				Strategy:   e.Strategy,
+				Experiment: e.Experiment,
+				Variant:    e.Variant,
+			})
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *memoryRepository) WasRecommended(userID, articleID uint) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, e := range r.events {
+		if e.UserID == userID && e.ArticleID == articleID && e.Type == EventImpression {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) GetStrategyStats() ([]StrategyStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byStrategy := make(map[string]*StrategyStats)
+	for _, e := range r.events {
+		st, ok := byStrategy[e.Strategy]
+		if !ok {
+			st = &StrategyStats{Strategy: e.Strategy}
+			byStrategy[e.Strategy] = st
+		}
+		switch e.Type {
+		case EventImpression:
+			st.Impressions++
+		case EventClick:
+			st.Clicks++
+		}
+	}
+	stats := make([]StrategyStats, 0, len(byStrategy))
+	for _, st := range byStrategy {
+		if st.Impressions > 0 {
+			st.CTR = float64(st.Clicks) / float64(st.Impressions)
+		}
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Strategy < stats[j].Strategy })
+	return stats, nil
+}
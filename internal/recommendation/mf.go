@@ -0,0 +1,236 @@
+package recommendation
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/pkg/config"
+)
+
+// MFParams are the hyperparameters for matrix factorization training.
+type MFParams struct {
+	Factors        int
+	Iterations     int
+	Regularization float64
+	Seed           int64
+}
+
+// MFParamsFromConfig reads the training hyperparameters from the environment.
+func MFParamsFromConfig() MFParams {
+	return MFParams{
+		Factors:        config.GetInt("MF_FACTORS", 16),
+		Iterations:     config.GetInt("MF_ITERATIONS", 15),
+		Regularization: config.GetFloat("MF_REGULARIZATION", 0.1),
+		Seed:           int64(config.GetInt("MF_SEED", 1)),
+	}
+}
+
+// MFModel is a trained low-rank factorization of the ratings matrix. A
+// rating is predicted as the global mean plus the dot product of the user
+// and item factor vectors. Models are immutable once trained.
+type MFModel struct {
+	Version     int64
+	TrainedAt   time.Time
+	Params      MFParams
+	GlobalMean  float64
+	UserIndex   map[uint]int
+	ItemIndex   map[uint]int
+	ItemIDs     []uint
+	UserFactors [][]float64
+	ItemFactors [][]float64
+}
+
+// TrainMF fits a model to the ratings with alternating least squares. Each
+// half-step solves a ridge regression per user (or item) whose penalty grows
+// with the number of ratings, which keeps sparse rows from overfitting.
+func TrainMF(ratings []article.Rating, params MFParams) *MFModel {
+	m := &MFModel{
+		TrainedAt: time.Now().UTC(),
+		Params:    params,
+		UserIndex: make(map[uint]int),
+		ItemIndex: make(map[uint]int),
+	}
+	if len(ratings) == 0 || params.Factors <= 0 {
+		return m
+	}
+
+	// Index users and items in ID order so training is reproducible.
+	var userIDs []uint
+	for _, r := range ratings {
+		if _, ok := m.UserIndex[r.UserID]; !ok {
+			m.UserIndex[r.UserID] = 0
+			userIDs = append(userIDs, r.UserID)
+		}
+		if _, ok := m.ItemIndex[r.ArticleID]; !ok {
+			m.ItemIndex[r.ArticleID] = 0
+			m.ItemIDs = append(m.ItemIDs, r.ArticleID)
+		}
+		m.GlobalMean += float64(r.Score)
+	}
+	m.GlobalMean /= float64(len(ratings))
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	sort.Slice(m.ItemIDs, func(i, j int) bool { return m.ItemIDs[i] < m.ItemIDs[j] })
+	for i, id := range userIDs {
+		m.UserIndex[id] = i
+	}
+	for i, id := range m.ItemIDs {
+		m.ItemIndex[id] = i
+	}
+
+	type entry struct {
+		index    int
+		residual float64
+	}
+	byUser := make([][]entry, len(userIDs))
+	byItem := make([][]entry, len(m.ItemIDs))
+	for _, r := range ratings {
+		u, i := m.UserIndex[r.UserID], m.ItemIndex[r.ArticleID]
+		residual := float64(r.Score) - m.GlobalMean
+		byUser[u] = append(byUser[u], entry{index: i, residual: residual})
+		byItem[i] = append(byItem[i], entry{index: u, residual: residual})
+	}
+
+	rng := rand.New(rand.NewSource(params.Seed))
+	m.UserFactors = randomFactors(rng, len(userIDs), params.Factors)
+	m.ItemFactors = randomFactors(rng, len(m.ItemIDs), params.Factors)
+
+	solve := func(target, fixed [][]float64, rows [][]entry) {
+		k := params.Factors
+		a := make([][]float64, k)
+		for i := range a {
+			a[i] = make([]float64, k)
+		}
+		b := make([]float64, k)
+		for row, entries := range rows {
+			for i := 0; i < k; i++ {
+				b[i] = 0
+				for j := 0; j < k; j++ {
+					a[i][j] = 0
+				}
+			}
+			for _, e := range entries {
+				v := fixed[e.index]
+				for i := 0; i < k; i++ {
+					b[i] += e.residual * v[i]
+					for j := 0; j <= i; j++ {
+						a[i][j] += v[i] * v[j]
+					}
+				}
+			}
+			penalty := params.Regularization * float64(len(entries))
+			for i := 0; i < k; i++ {
+				a[i][i] += penalty
+				for j := 0; j < i; j++ {
+					a[j][i] = a[i][j]
+				}
+			}
+			choleskySolve(a, b, target[row])
+		}
+	}
+
+	for it := 0; it < params.Iterations; it++ {
+		solve(m.UserFactors, m.ItemFactors, byUser)
+		solve(m.ItemFactors, m.UserFactors, byItem)
+	}
+	return m
+}
+
+func randomFactors(rng *rand.Rand, rows, k int) [][]float64 {
+	factors := make([][]float64, rows)
+	for i := range factors {
+		factors[i] = make([]float64, k)
+		for j := range factors[i] {
+			factors[i][j] = rng.NormFloat64() * 0.1
+		}
+	}
+	return factors
+}
+
+// choleskySolve solves a x = b for a symmetric positive-definite a, writing
+// the solution into x. a is overwritten with its Cholesky factor.
+func choleskySolve(a [][]float64, b, x []float64) {
+	n := len(b)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= a[i][k] * a[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					sum = 1e-12
+				}
+				a[i][i] = math.Sqrt(sum)
+			} else {
+				a[i][j] = sum / a[j][j]
+			}
+		}
+	}
+	// Forward substitution: L y = b.
+	for i := 0; i < n; i++ {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= a[i][k] * x[k]
+		}
+		x[i] = sum / a[i][i]
+	}
+	// Back substitution: L^T x = y.
+	for i := n - 1; i >= 0; i-- {
+		sum := x[i]
+		for k := i + 1; k < n; k++ {
+			sum -= a[k][i] * x[k]
+		}
+		x[i] = sum / a[i][i]
+	}
+}
+
+// HasUser reports whether the model was trained with ratings from the user.
+func (m *MFModel) HasUser(userID uint) bool {
+	_, ok := m.UserIndex[userID]
+	return ok
+}
+
+// WithoutUser returns a copy of the model with the user's factors removed,
+// sharing everything else with m.
+func (m *MFModel) WithoutUser(userID uint) *MFModel {
+	removed, ok := m.UserIndex[userID]
+	if !ok {
+		return m
+	}
+	out := *m
+	out.UserIndex = make(map[uint]int, len(m.UserIndex)-1)
+	for id, u := range m.UserIndex {
+		switch {
+		case u < removed:
+			out.UserIndex[id] = u
+		case u > removed:
+			out.UserIndex[id] = u - 1
+		}
+	}
+	out.UserFactors = make([][]float64, 0, len(m.UserFactors)-1)
+	out.UserFactors = append(out.UserFactors, m.UserFactors[:removed]...)
+	out.UserFactors = append(out.UserFactors, m.UserFactors[removed+1:]...)
+	return &out
+}
+
+// Predict returns the predicted rating of an article by a user, or the
+// global mean if either is unknown to the model.
+func (m *MFModel) Predict(userID, articleID uint) float64 {
+	u, okUser := m.UserIndex[userID]
+	i, okItem := m.ItemIndex[articleID]
+	if !okUser || !okItem {
+		return m.GlobalMean
+	}
+	return m.GlobalMean + dot(m.UserFactors[u], m.ItemFactors[i])
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,147 @@
+package recommendation
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+)
+
+// StrategyMF identifies the matrix factorization strategy in recorded impressions.
+const StrategyMF = "mf"
+
+type mfService struct {
+	articleRepo article.Repository
+	repo        Repository
+	models      *ModelHolder
+	fallback    Service
+	reranker    *Reranker
+}
+
+// NewMFService creates a service that ranks articles with the model in
+// models, and defers to fallback for users the model has not seen or while
+// no model has been trained.
+func NewMFService(articleRepo article.Repository, repo Repository, models *ModelHolder, fallback Service, reranker *Reranker) Service {
+	return &mfService{articleRepo: articleRepo, repo: repo, models: models, fallback: fallback, reranker: reranker}
+}
+
+func (s *mfService) Strategy() string {
+	return StrategyMF
+}
+
+// GetRecommendationsForUser ranks every article in the model that the user
+// has not saved or rejected by predicted rating.
+func (s *mfService) GetRecommendationsForUser(userID uint, limit int) ([]article.Article, error) {
+	model := s.models.Load()
+	if model == nil || !model.HasUser(userID) {
+		return s.fallback.GetRecommendationsForUser(userID, limit)
+	}
+
+	userSavedArticles, err := s.articleRepo.GetArticleIDsSavedByUser(userID)
+	if err != nil {
+		log.Printf("Error getting user's saved articles for user %d: %v", userID, err)
+		return nil, err
+	}
+	userSavedMap := make(map[uint]bool)
+	for _, id := range userSavedArticles {
+		userSavedMap[id] = true
+	}
+
+	feedback, err := s.repo.GetFeedbackForUser(userID)
+	if err != nil {
+		log.Printf("Error getting feedback for user %d: %v", userID, err)
+		return nil, err
+	}
+	filter := newFeedbackFilter(feedback)
+
+	scores := make(map[uint]float64)
+	for _, id := range model.ItemIDs {
+		if !userSavedMap[id] && !filter.excluded[id] {
+			scores[id] = model.Predict(userID, id)
+		}
+	}
+
+	return rankArticles(s.articleRepo, scores, filter, s.reranker, limit)
+}
+
+// Trainer periodically fits a new model from the ratings table, saves it as
+// a new version and swaps it in for serving.
+type Trainer struct {
+	articleRepo article.Repository
+	store       *ModelStore
+	models      *ModelHolder
+	invalidator *Invalidator
+	params      MFParams
+	// mu keeps a model fitted before a user was forgotten from being
+	// published after.
+	mu sync.Mutex
+}
+
+// NewTrainer creates a trainer that publishes models to store and models,
+// and has invalidator mark the cached lists of the old model stale.
+func NewTrainer(articleRepo article.Repository, store *ModelStore, models *ModelHolder, invalidator *Invalidator, params MFParams) *Trainer {
+	return &Trainer{articleRepo: articleRepo, store: store, models: models, invalidator: invalidator, params: params}
+}
+
+// LoadLatest serves the newest saved model, if any, so a restart does not
+// have to wait for the first training run.
+func (t *Trainer) LoadLatest() {
+	model, err := t.store.Latest()
+	if err != nil {
+		log.Printf("Failed to load saved recommendation model: %v", err)
+		return
+	}
+	if model == nil {
+		log.Println("No saved recommendation model found.")
+		return
+	}
+	t.models.Store(model)
+	log.Printf("Loaded recommendation model version %d (%d users, %d articles)", model.Version, len(model.UserIndex), len(model.ItemIDs))
+}
+
+// Train fits, saves and publishes a new model version.
+func (t *Trainer) Train() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ratings, err := t.articleRepo.GetAllRatings()
+	if err != nil {
+		log.Printf("Trainer error fetching ratings: %v", err)
+		return
+	}
+	if len(ratings) == 0 {
+		log.Println("Trainer: No ratings to train on.")
+		return
+	}
+
+	start := time.Now()
+	model := TrainMF(ratings, t.params)
+	model.Version = start.UnixNano()
+	if current := t.models.Load(); current != nil && model.Version <= current.Version {
+		model.Version = current.Version + 1
+	}
+
+	if err := t.store.Save(model); err != nil {
+		log.Printf("Trainer failed to save model version %d: %v", model.Version, err)
+	}
+	t.models.Store(model)
+	t.invalidator.ModelTrained(StrategyMF)
+	log.Printf("Trained recommendation model version %d on %d ratings in %s", model.Version, len(ratings), time.Since(start))
+}
+
+// ForgetUser removes a deleted user's factors from the served model and
+// every saved version. The articles' factors still reflect the user's
+// ratings until the next training run, which no longer sees them.
+func (t *Trainer) ForgetUser(userID uint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.store.ForgetUser(userID); err != nil {
+		return err
+	}
+	if current := t.models.Load(); current != nil && current.HasUser(userID) {
+		t.models.Store(current.WithoutUser(userID))
+	}
+	return nil
+}
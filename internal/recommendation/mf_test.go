@@ -0,0 +1,192 @@
+package recommendation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// plantedRatings draws ratings from a rank-2 model: users and items each
+// belong to one of two groups, and a user scores items of their own group
+// high and the other group low. Only about half the matrix is observed.
+func plantedRatings(seed int64) (train, test []article.Rating) {
+	rng := rand.New(rand.NewSource(seed))
+	for u := uint(1); u <= 60; u++ {
+		for i := uint(1); i <= 40; i++ {
+			score := 2
+			if (u%2 == 0) == (i%2 == 0) {
+				score = 5
+			}
+			r := article.Rating{UserID: u, ArticleID: i, Score: score}
+			switch p := rng.Float64(); {
+			case p < 0.5:
+				train = append(train, r)
+			case p < 0.6:
+				test = append(test, r)
+			}
+		}
+	}
+	return train, test
+}
+
+func rmse(m *MFModel, ratings []article.Rating) float64 {
+	var sum float64
+	for _, r := range ratings {
+		diff := m.Predict(r.UserID, r.ArticleID) - float64(r.Score)
+		sum += diff * diff
+	}
+	return math.Sqrt(sum / float64(len(ratings)))
+}
+
+func TestTrainMFRecoversPlantedStructure(t *testing.T) {
+	train, test := plantedRatings(7)
+	params := MFParams{Factors: 4, Iterations: 20, Regularization: 0.05, Seed: 1}
+	model := TrainMF(train, params)
+
+	baseline := &MFModel{GlobalMean: model.GlobalMean}
+	assert.Less(t, rmse(model, test), 0.5, "held-out error should be small")
+	assert.Greater(t, rmse(baseline, test), 1.0, "predicting the mean should do much worse")
+
+	// Every unseen item from the user's own group should outrank every
+	// unseen item from the other group.
+	for _, userID := range []uint{1, 2} {
+		var ownMin, otherMax = math.Inf(1), math.Inf(-1)
+		for i := uint(1); i <= 40; i++ {
+			p := model.Predict(userID, i)
+			if (userID%2 == 0) == (i%2 == 0) {
+				ownMin = math.Min(ownMin, p)
+			} else {
+				otherMax = math.Max(otherMax, p)
+			}
+		}
+		assert.Greater(t, ownMin, otherMax, "user %d", userID)
+	}
+
+	assert.Equal(t, model.UserFactors, TrainMF(train, params).UserFactors, "training is deterministic for a seed")
+}
+
+func TestModelStoreVersions(t *testing.T) {
+	train, _ := plantedRatings(3)
+	store := NewModelStore(t.TempDir(), 2)
+
+	latest, err := store.Latest()
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	trained := make(map[int64]*MFModel)
+	for v := int64(1); v <= 3; v++ {
+		m := TrainMF(train, MFParams{Factors: 2, Iterations: 2, Regularization: 0.1, Seed: v})
+		m.Version = v
+		require.NoError(t, store.Save(m))
+		trained[v] = m
+	}
+
+	latest, err = store.Latest()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), latest.Version)
+	assert.InDelta(t, trained[3].Predict(1, 1), latest.Predict(1, 1), 1e-9, "the saved model predicts as trained")
+	assert.NotEqual(t, trained[2].Predict(1, 1), latest.Predict(1, 1), "a different seed gives a different model")
+
+	_, err = store.Load(1)
+	assert.Error(t, err, "oldest version is pruned")
+	versions, err := store.versions()
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, versions)
+}
+
+func TestMFServiceFallsBackForUnknownUsers(t *testing.T) {
+	articleRepo := article.NewMemoryRepository()
+	repo := NewMemoryRepository()
+	for i := uint(1); i <= 3; i++ {
+		require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: i}, URL: fmt.Sprintf("https://example.com/%d", i)}))
+	}
+	// Users 1 and 2 share a favourite; user 2 also likes article 3 and
+	// dislikes article 2.
+	for _, r := range []article.Rating{
+		{UserID: 1, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 2, Score: 1},
+		{UserID: 2, ArticleID: 3, Score: 5},
+	} {
+		rating := r
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&rating))
+	}
+
+	models := &ModelHolder{}
+	service := NewMFService(articleRepo, repo, models, NewService(articleRepo, repo, nil, nil), nil)
+
+	// No model yet: the peer strategy answers.
+	recs, err := service.GetRecommendationsForUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, uint(3), recs[0].ID)
+
+	ratings, err := articleRepo.GetAllRatings()
+	require.NoError(t, err)
+	models.Store(TrainMF(ratings, MFParams{Factors: 2, Iterations: 5, Regularization: 0.1, Seed: 1}))
+
+	recs, err = service.GetRecommendationsForUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 2, "model ranks every unsaved article it knows")
+	assert.Equal(t, uint(3), recs[0].ID)
+	assert.Equal(t, uint(2), recs[1].ID)
+}
+
+func TestTrainerInvalidatesCachedLists(t *testing.T) {
+	train, _ := plantedRatings(4)
+	articleRepo := article.NewMemoryRepository()
+	created := make(map[uint]bool)
+	for i := range train {
+		rating := train[i]
+		if !created[rating.ArticleID] {
+			created[rating.ArticleID] = true
+			require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: rating.ArticleID}, URL: fmt.Sprintf("https://example.com/%d", rating.ArticleID)}))
+		}
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&rating))
+	}
+	cacheRepo := newMemoryCacheRepository()
+	generatedAt := time.Now()
+	require.NoError(t, cacheRepo.ReplaceCachedRecommendations(1, StrategyMF, []uint{1}, generatedAt))
+	require.NoError(t, cacheRepo.ReplaceCachedRecommendations(1, StrategyPeer, []uint{1}, generatedAt))
+
+	models := &ModelHolder{}
+	trainer := NewTrainer(articleRepo, NewModelStore(t.TempDir(), 1), models, NewInvalidator(cacheRepo), MFParams{Factors: 2, Iterations: 2, Regularization: 0.1, Seed: 1})
+	trainer.Train()
+	require.NotNil(t, models.Load())
+
+	stale, err := cacheRepo.GetStaleEntries(10)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+	assert.Equal(t, StrategyMF, stale[0].Strategy)
+}
+
+func TestTrainerForgetsUser(t *testing.T) {
+	train, _ := plantedRatings(5)
+	store := NewModelStore(t.TempDir(), 2)
+	for v := int64(1); v <= 2; v++ {
+		m := TrainMF(train, MFParams{Factors: 2, Iterations: 2, Regularization: 0.1, Seed: v})
+		m.Version = v
+		require.NoError(t, store.Save(m))
+	}
+	models := &ModelHolder{}
+	trainer := NewTrainer(article.NewMemoryRepository(), store, models, NewInvalidator(newMemoryCacheRepository()), MFParams{})
+	trainer.LoadLatest()
+	before := models.Load().Predict(2, 1)
+
+	require.NoError(t, trainer.ForgetUser(1))
+	assert.False(t, models.Load().HasUser(1))
+	assert.InDelta(t, before, models.Load().Predict(2, 1), 1e-9, "other users keep their factors")
+	for v := int64(1); v <= 2; v++ {
+		saved, err := store.Load(v)
+		require.NoError(t, err)
+		assert.False(t, saved.HasUser(1), "version %d", v)
+		assert.True(t, saved.HasUser(2), "version %d", v)
+	}
+}
@@ -0,0 +1,156 @@
+package recommendation
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const modelFilePrefix = "mf-"
+
+// ModelStore persists versioned matrix factorization models as gob files
+// named mf-<version>.gob in a directory, keeping the newest few.
+type ModelStore struct {
+	dir  string
+	keep int
+}
+
+// NewModelStore creates a store in dir that keeps the newest keep models.
+func NewModelStore(dir string, keep int) *ModelStore {
+	if keep < 1 {
+		keep = 1
+	}
+	return &ModelStore{dir: dir, keep: keep}
+}
+
+// Save writes the model under its version, replacing the file atomically,
+// and removes versions beyond the retention limit.
+func (s *ModelStore) Save(m *MFModel) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "tmp-*.gob")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(m); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(m.Version)); err != nil {
+		return err
+	}
+
+	versions, err := s.versions()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(versions)-s.keep; i++ {
+		if err := os.Remove(s.path(versions[i])); err != nil {
+			log.Printf("Failed to prune model version %d: %v", versions[i], err)
+		}
+	}
+	return nil
+}
+
+// Latest loads the newest saved model. It returns nil and no error if the
+// store is empty.
+func (s *ModelStore) Latest() (*MFModel, error) {
+	versions, err := s.versions()
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+	return s.Load(versions[len(versions)-1])
+}
+
+// Load reads a specific model version.
+func (s *ModelStore) Load(version int64) (*MFModel, error) {
+	f, err := os.Open(s.path(version))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m MFModel
+	if err := gob.NewDecoder(f).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding model version %d: %w", version, err)
+	}
+	return &m, nil
+}
+
+// ForgetUser rewrites every saved version the user appears in without
+// their factors.
+func (s *ModelStore) ForgetUser(userID uint) error {
+	versions, err := s.versions()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		m, err := s.Load(v)
+		if err != nil {
+			return err
+		}
+		if !m.HasUser(userID) {
+			continue
+		}
+		if err := s.Save(m.WithoutUser(userID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versions lists the saved model versions in ascending order.
+func (s *ModelStore) versions() ([]int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var versions []int64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, modelFilePrefix) || !strings.HasSuffix(name, ".gob") {
+			continue
+		}
+		v, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, modelFilePrefix), ".gob"), 10, 64)
+		if err == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
+func (s *ModelStore) path(version int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%d.gob", modelFilePrefix, version))
+}
+
+// ModelHolder holds the model currently used for serving. Swapping in a new
+// model is atomic, so requests in flight keep the model they started with.
+type ModelHolder struct {
+	model atomic.Pointer[MFModel]
+}
+
+// Load returns the current model, or nil if none has been trained yet.
+func (h *ModelHolder) Load() *MFModel {
+	return h.model.Load()
+}
+
+// Store makes m the model used for new requests.
+func (h *ModelHolder) Store(m *MFModel) {
+	h.model.Store(m)
+}
@@ -0,0 +1,83 @@
+package recommendation
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FeedbackAction is a user's negative reaction to a recommended article.
+type FeedbackAction string
+
+const (
+	ActionDismiss       FeedbackAction = "dismiss"
+	ActionNotInterested FeedbackAction = "not_interested"
+	ActionMuteDomain    FeedbackAction = "mute_domain"
+	ActionMuteTopic     FeedbackAction = "mute_topic"
+)
+
+// Feedback records a user's reaction to a recommended article.
+// Domain is set for mute_domain and Topic for mute_topic.
+type Feedback struct {
+	gorm.Model
+	UserID    uint           `gorm:"index;not null"`
+	ArticleID uint           `gorm:"index;not null"`
+	Action    FeedbackAction `gorm:"not null"`
+	Domain    string
+	Topic     string
+}
+
+// EventType distinguishes impressions from clicks.
+type EventType string
+
+const (
+	EventImpression EventType = "impression"
+	EventClick      EventType = "click"
+)
+
+// Event is a single impression or click on a recommended article, tagged
+// with the strategy that produced it and, when the user was enrolled in an
+// experiment, the experiment and variant.
+type Event struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index"`
+	UserID     uint      `gorm:"index:idx_event_user_article;not null"`
+	ArticleID  uint      `gorm:"index:idx_event_user_article;not null"`
+	Type       EventType `gorm:"index;not null"`
+	Strategy   string    `gorm:"index;not null"`
+	Experiment string    `gorm:"index:idx_event_experiment_variant"`
+	Variant    string    `gorm:"index:idx_event_experiment_variant"`
+}
+
+// Attribution identifies what produced a set of recommendations.
+type Attribution struct {
+	Strategy   string
+	Experiment string
+	Variant    string
+}
+
+// StrategyStats aggregates impressions and clicks for one strategy.
+type StrategyStats struct {
+	Strategy    string  `json:"strategy"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+}
+
+// CachedRecommendation is one precomputed recommendation, at its position
+// in the list a strategy produced for a user.
+type CachedRecommendation struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Strategy  string `gorm:"primaryKey"`
+	Position  int    `gorm:"primaryKey;autoIncrement:false"`
+	ArticleID uint   `gorm:"index;not null"`
+}
+
+// CacheState records when a strategy's list for a user was generated and
+// whether activity since then has made it stale.
+type CacheState struct {
+	UserID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	Strategy    string `gorm:"primaryKey"`
+	GeneratedAt time.Time
+	Stale       bool `gorm:"index;not null;default:false"`
+}
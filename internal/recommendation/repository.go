@@ -0,0 +1,101 @@
+package recommendation
+
+import (
+	"github.com/cheildo/deeli-api/pkg/database"
+)
+
+// Repository defines the interface for recommendation feedback and event storage.
+type Repository interface {
+	CreateFeedback(feedback *Feedback) error
+	GetFeedbackForUser(userID uint) ([]Feedback, error)
+	RecordImpressions(userID uint, articleIDs []uint, attribution Attribution) error
+	RecordClick(userID, articleID uint) error
+	// WasRecommended reports whether the article was ever shown to the user
+	// as a recommendation.
+	WasRecommended(userID, articleID uint) (bool, error)
+	GetStrategyStats() ([]StrategyStats, error)
+}
+
+type repository struct{}
+
+func NewRepository() Repository {
+	return &repository{}
+}
+
+func (r *repository) CreateFeedback(feedback *Feedback) error {
+	return database.DB.Create(feedback).Error
+}
+
+func (r *repository) GetFeedbackForUser(userID uint) ([]Feedback, error) {
+	var feedback []Feedback
+	err := database.DB.Where("user_id = ?", userID).Find(&feedback).Error
+	return feedback, err
+}
+
+func (r *repository) RecordImpressions(userID uint, articleIDs []uint, attribution Attribution) error {
+	if len(articleIDs) == 0 {
+		return nil
+	}
+	events := make([]Event, 0, len(articleIDs))
+	for _, id := range articleIDs {
+		events = append(events, Event{
+			UserID:     userID,
+			ArticleID:  id,
+			Type:       EventImpression,
+			Strategy:   attribution.Strategy,
+			Experiment: attribution.Experiment,
+			Variant:    attribution.Variant,
+		})
+	}
+	return database.DB.Create(&events).Error
+}
+
+// RecordClick attributes the click to the strategy and experiment variant of
+// the most recent impression of that article for the user. It returns gorm.ErrRecordNotFound
+// if the article was never recommended to them.
+func (r *repository) RecordClick(userID, articleID uint) error {
+	var impression Event
+	err := database.DB.
+		Where("user_id = ? AND article_id = ? AND type = ?", userID, articleID, EventImpression).
+		Order("created_at desc").
+		First(&impression).Error
+	if err != nil {
+		return err
+	}
+	return database.DB.Create(&Event{
+		UserID:     userID,
+		ArticleID:  articleID,
+		Type:       EventClick,
+		Strategy:   impression.Strategy,
+		Experiment: impression.Experiment,
+		Variant:    impression.Variant,
+	}).Error
+}
+
+func (r *repository) WasRecommended(userID, articleID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&Event{}).
+		Where("user_id = ? AND article_id = ? AND type = ?", userID, articleID, EventImpression).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *repository) GetStrategyStats() ([]StrategyStats, error) {
+	var stats []StrategyStats
+	err := database.DB.Model(&Event{}).
+		Select("strategy, "+
+			"COUNT(*) FILTER (WHERE type = ?) AS impressions, "+
+			"COUNT(*) FILTER (WHERE type = ?) AS clicks", EventImpression, EventClick).
+		Group("strategy").
+		Order("strategy").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range stats {
+		if stats[i].Impressions > 0 {
+			stats[i].CTR = float64(stats[i].Clicks) / float64(stats[i].Impressions)
+		}
+	}
+	return stats, nil
+}
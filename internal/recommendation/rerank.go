@@ -0,0 +1,205 @@
+package recommendation
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/pkg/config"
+)
+
+// candidatePoolFactor is how many candidates per requested slot are handed to
+// the re-ranker, so that diversity stages have alternatives to choose from.
+const candidatePoolFactor = 5
+
+// Candidate is an article with the relevance score a strategy gave it.
+type Candidate struct {
+	Article article.Article
+	Score   float64
+}
+
+// SortCandidates orders candidates by score, highest first, breaking ties by
+// article ID so the order is the same on every call.
+func SortCandidates(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Article.ID < candidates[j].Article.ID
+	})
+}
+
+// Stage is one step of re-ranking. It receives candidates in ranked order
+// and returns them reordered, rescored or trimmed.
+type Stage interface {
+	Apply(candidates []Candidate, limit int) []Candidate
+}
+
+// Reranker runs candidates through its stages in order and keeps the top limit.
+type Reranker struct {
+	Stages []Stage
+}
+
+// RerankerFromConfig builds the default pipeline: freshness boost, then MMR
+// diversification, then the per-domain cap. A stage is left out when its
+// setting disables it.
+func RerankerFromConfig() *Reranker {
+	r := &Reranker{}
+	if weight := config.GetFloat("RERANK_FRESHNESS_WEIGHT", 0.2); weight > 0 {
+		r.Stages = append(r.Stages, &FreshnessBoost{
+			Weight:   weight,
+			HalfLife: config.GetDuration("RERANK_FRESHNESS_HALF_LIFE", 7*24*time.Hour),
+		})
+	}
+	if lambda := config.GetFloat("RERANK_MMR_LAMBDA", 0.7); lambda < 1 {
+		r.Stages = append(r.Stages, &MMR{Lambda: lambda})
+	}
+	if max := config.GetInt("RERANK_DOMAIN_CAP", 2); max > 0 {
+		r.Stages = append(r.Stages, &DomainCap{Max: max})
+	}
+	return r
+}
+
+// Rerank sorts the candidates, applies every stage and returns at most limit.
+// A nil Reranker only sorts and truncates.
+func (r *Reranker) Rerank(candidates []Candidate, limit int) []Candidate {
+	SortCandidates(candidates)
+	if r != nil {
+		for _, stage := range r.Stages {
+			candidates = stage.Apply(candidates, limit)
+		}
+	}
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// FreshnessBoost multiplies each score by 1 + Weight * 2^(-age/HalfLife),
+// where age is the time since the article was saved, then re-sorts.
+type FreshnessBoost struct {
+	Weight   float64
+	HalfLife time.Duration
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+func (f *FreshnessBoost) Apply(candidates []Candidate, limit int) []Candidate {
+	if f.HalfLife <= 0 {
+		return candidates
+	}
+	now := time.Now()
+	if f.Now != nil {
+		now = f.Now()
+	}
+	boosted := make([]Candidate, len(candidates))
+	for i, c := range candidates {
+		age := now.Sub(c.Article.CreatedAt)
+		if age < 0 {
+			age = 0
+		}
+		decay := math.Exp2(-float64(age) / float64(f.HalfLife))
+		boosted[i] = Candidate{Article: c.Article, Score: c.Score * (1 + f.Weight*decay)}
+	}
+	SortCandidates(boosted)
+	return boosted
+}
+
+// MMR reorders candidates by Maximal Marginal Relevance: each pick maximises
+// Lambda * relevance - (1 - Lambda) * (highest similarity to an earlier pick).
+// Relevance is the score scaled to [0, 1]. Scores are left unchanged.
+type MMR struct {
+	Lambda float64
+	// Similarity compares two articles in [0, 1]; it defaults to ContentSimilarity.
+	Similarity func(a, b *article.Article) float64
+}
+
+func (m *MMR) Apply(candidates []Candidate, limit int) []Candidate {
+	if len(candidates) < 2 {
+		return candidates
+	}
+	similarity := m.Similarity
+	if similarity == nil {
+		tokens := make(map[uint]map[string]bool, len(candidates))
+		for i := range candidates {
+			tokens[candidates[i].Article.ID] = articleTokens(&candidates[i].Article)
+		}
+		similarity = func(a, b *article.Article) float64 {
+			return jaccard(tokens[a.ID], tokens[b.ID])
+		}
+	}
+
+	maxScore := candidates[0].Score
+	for _, c := range candidates {
+		maxScore = math.Max(maxScore, c.Score)
+	}
+
+	remaining := append([]Candidate(nil), candidates...)
+	maxSim := make([]float64, len(remaining))
+	selected := make([]Candidate, 0, len(candidates))
+	for len(remaining) > 0 {
+		best, bestValue := 0, math.Inf(-1)
+		for i, c := range remaining {
+			relevance := 0.0
+			if maxScore > 0 {
+				relevance = c.Score / maxScore
+			}
+			value := m.Lambda*relevance - (1-m.Lambda)*maxSim[i]
+			// remaining stays in ranked order, so the first maximum wins ties.
+			if value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+		pick := remaining[best]
+		selected = append(selected, pick)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		maxSim = append(maxSim[:best], maxSim[best+1:]...)
+		for i := range remaining {
+			maxSim[i] = math.Max(maxSim[i], similarity(&pick.Article, &remaining[i].Article))
+		}
+	}
+	return selected
+}
+
+// DomainCap drops candidates once Max articles from the same domain have
+// been kept, preserving the order of the rest.
+type DomainCap struct {
+	Max int
+}
+
+func (d *DomainCap) Apply(candidates []Candidate, limit int) []Candidate {
+	if d.Max <= 0 {
+		return candidates
+	}
+	perDomain := make(map[string]int)
+	kept := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		domain := c.Article.Domain()
+		if perDomain[domain] >= d.Max {
+			continue
+		}
+		perDomain[domain]++
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// ContentSimilarity is the Jaccard overlap of the words in two articles'
+// titles and descriptions.
+func ContentSimilarity(a, b *article.Article) float64 {
+	return jaccard(articleTokens(a), articleTokens(b))
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,85 @@
+package recommendation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func candidate(id uint, url, title string, score float64) Candidate {
+	return Candidate{
+		Article: article.Article{Model: gorm.Model{ID: id}, URL: url, Title: title},
+		Score:   score,
+	}
+}
+
+func ids(candidates []Candidate) []uint {
+	out := make([]uint, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.Article.ID
+	}
+	return out
+}
+
+func TestSortCandidatesBreaksTiesByID(t *testing.T) {
+	candidates := []Candidate{
+		candidate(3, "https://a.com/3", "", 1),
+		candidate(1, "https://a.com/1", "", 1),
+		candidate(2, "https://a.com/2", "", 2),
+	}
+	SortCandidates(candidates)
+	assert.Equal(t, []uint{2, 1, 3}, ids(candidates))
+}
+
+func TestFreshnessBoost(t *testing.T) {
+	now := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	old := candidate(1, "https://a.com/1", "", 1.1)
+	old.Article.CreatedAt = now.Add(-30 * 24 * time.Hour)
+	fresh := candidate(2, "https://a.com/2", "", 1.0)
+	fresh.Article.CreatedAt = now
+
+	stage := &FreshnessBoost{Weight: 0.5, HalfLife: 24 * time.Hour, Now: func() time.Time { return now }}
+	out := stage.Apply([]Candidate{old, fresh}, 10)
+
+	assert.Equal(t, []uint{2, 1}, ids(out))
+	assert.InDelta(t, 1.5, out[0].Score, 1e-9, "saved just now: full boost")
+	assert.InDelta(t, 1.1, out[1].Score, 1e-6, "a month old: boost has decayed away")
+}
+
+func TestMMRPromotesDifferentTopics(t *testing.T) {
+	candidates := []Candidate{
+		candidate(1, "https://a.com/1", "Go generics deep dive", 1.0),
+		candidate(2, "https://b.com/2", "Go generics deep dive part two", 0.95),
+		candidate(3, "https://c.com/3", "Sourdough bread baking", 0.9),
+	}
+
+	assert.Equal(t, []uint{1, 3, 2}, ids((&MMR{Lambda: 0.5}).Apply(candidates, 10)))
+	assert.Equal(t, []uint{1, 2, 3}, ids((&MMR{Lambda: 1}).Apply(candidates, 10)), "lambda 1 is pure relevance")
+}
+
+func TestDomainCap(t *testing.T) {
+	candidates := []Candidate{
+		candidate(1, "https://www.example.com/1", "", 4),
+		candidate(2, "https://example.com/2", "", 3),
+		candidate(3, "https://other.org/3", "", 2),
+		candidate(4, "https://EXAMPLE.com/4", "", 1),
+	}
+	assert.Equal(t, []uint{1, 3}, ids((&DomainCap{Max: 1}).Apply(candidates, 10)))
+	assert.Equal(t, []uint{1, 2, 3}, ids((&DomainCap{Max: 2}).Apply(candidates, 10)))
+}
+
+func TestRerankerRunsStagesAndTruncates(t *testing.T) {
+	candidates := []Candidate{
+		candidate(1, "https://a.com/1", "", 1),
+		candidate(2, "https://a.com/2", "", 3),
+		candidate(3, "https://b.com/3", "", 2),
+	}
+	r := &Reranker{Stages: []Stage{&DomainCap{Max: 1}}}
+	assert.Equal(t, []uint{2}, ids(r.Rerank(candidates, 1)))
+
+	var none *Reranker
+	assert.Equal(t, []uint{2, 3}, ids(none.Rerank(candidates, 2)))
+}
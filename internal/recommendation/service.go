@@ -9,25 +9,98 @@ import (
 
 const (
 	minRatingForRecommendation = 4
-	recommendationLimit        = 10
+
+	// followedPeerWeight is how much more a followed user's favorite counts
+	// than one from a peer found through ratings.
+	followedPeerWeight = 2
+
+	// StrategyPeer identifies the peer-based collaborative filtering strategy
+	// in recorded impressions.
+	StrategyPeer = "peer"
 )
 
 // Service provides the recommendation logic.
 type Service interface {
-	GetRecommendationsForUser(userID uint) ([]article.Article, error)
+	// GetRecommendationsForUser returns up to limit articles, best first.
+	GetRecommendationsForUser(userID uint, limit int) ([]article.Article, error)
+	// Strategy names the algorithm for impression and click tracking.
+	Strategy() string
+}
+
+// FollowGraph tells who a user follows. Followed users are trusted peers:
+// their favorites are recommended whether or not they share the user's
+// taste so far.
+type FollowGraph interface {
+	FollowedUserIDs(userID uint) ([]uint, error)
 }
 
 type service struct {
 	articleRepo article.Repository
+	repo        Repository
+	reranker    *Reranker
+	follows     FollowGraph
+}
+
+// NewService creates a new recommendation service. The reranker may be nil,
+// in which case results are ordered by score alone, and so may follows, in
+// which case only peers found through ratings are used.
+func NewService(articleRepo article.Repository, repo Repository, reranker *Reranker, follows FollowGraph) Service {
+	return &service{articleRepo: articleRepo, repo: repo, reranker: reranker, follows: follows}
+}
+
+func (s *service) Strategy() string {
+	return StrategyPeer
+}
+
+// feedbackFilter holds the negative signals a user has given.
+type feedbackFilter struct {
+	excluded      map[uint]bool
+	notInterested map[uint]bool
+	mutedDomains  map[string]bool
+	mutedTopics   []string
+}
+
+func newFeedbackFilter(feedback []Feedback) *feedbackFilter {
+	f := &feedbackFilter{
+		excluded:      make(map[uint]bool),
+		notInterested: make(map[uint]bool),
+		mutedDomains:  make(map[string]bool),
+	}
+	for _, fb := range feedback {
+		switch fb.Action {
+		case ActionDismiss:
+			f.excluded[fb.ArticleID] = true
+		case ActionNotInterested:
+			f.excluded[fb.ArticleID] = true
+			f.notInterested[fb.ArticleID] = true
+		case ActionMuteDomain:
+			if fb.Domain != "" {
+				f.mutedDomains[fb.Domain] = true
+			}
+		case ActionMuteTopic:
+			if fb.Topic != "" {
+				f.mutedTopics = append(f.mutedTopics, fb.Topic)
+			}
+		}
+	}
+	return f
 }
 
-// NewService creates a new recommendation service.
-func NewService(articleRepo article.Repository) Service {
-	return &service{articleRepo: articleRepo}
+// allows reports whether an article passes the user's domain and topic mutes.
+func (f *feedbackFilter) allows(a *article.Article) bool {
+	if f.mutedDomains[a.Domain()] {
+		return false
+	}
+	for _, topic := range f.mutedTopics {
+		if matchesTopic(a, topic) {
+			return false
+		}
+	}
+	return true
 }
 
 // GetRecommendationsForUser implements the collaborative filtering logic.
-func (s *service) GetRecommendationsForUser(userID uint) ([]article.Article, error) {
+func (s *service) GetRecommendationsForUser(userID uint, limit int) ([]article.Article, error) {
 	// 1. Get all articles the current user has rated highly.
 	userFavorites, err := s.articleRepo.GetHighlyRatedArticleIDsForUser(userID, minRatingForRecommendation)
 	if err != nil {
@@ -35,20 +108,33 @@ func (s *service) GetRecommendationsForUser(userID uint) ([]article.Article, err
 		return nil, err
 	}
 
-	// Handle cold start: If the user has no favorite articles, we can't find peers.
-	// A good fallback would be to return globally popular articles, but for now, we'll return empty.
-	if len(userFavorites) == 0 {
-		log.Printf("User %d has no highly-rated articles. Cannot generate personalized recommendations.", userID)
-		return []article.Article{}, nil
-	}
-
-	// 2. Find "peer" users who also liked the same articles.
+	// 2. Find "peer" users who also liked the same articles, and add the
+	// users this user follows.
 	peers, err := s.articleRepo.FindPeerUsers(userID, userFavorites, minRatingForRecommendation)
 	if err != nil {
 		log.Printf("Error finding peers for user %d: %v", userID, err)
 		return nil, err
 	}
+	peerWeight := make(map[uint]float64, len(peers))
+	for _, id := range peers {
+		peerWeight[id] = 1
+	}
+	if s.follows != nil {
+		followed, err := s.follows.FollowedUserIDs(userID)
+		if err != nil {
+			log.Printf("Error getting followed users for user %d: %v", userID, err)
+			return nil, err
+		}
+		for _, id := range followed {
+			if _, ok := peerWeight[id]; !ok {
+				peers = append(peers, id)
+			}
+			peerWeight[id] = followedPeerWeight
+		}
+	}
 
+	// Handle cold start: without favorites or follows there are no peers.
+	// A good fallback would be to return globally popular articles, but for now, we'll return empty.
 	if len(peers) == 0 {
 		log.Printf("No peers found for user %d. Cannot generate recommendations.", userID)
 		return []article.Article{}, nil
@@ -74,40 +160,77 @@ func (s *service) GetRecommendationsForUser(userID uint) ([]article.Article, err
 		userSavedMap[id] = true
 	}
 
-	// 5. Count the frequency of each article recommended by peers.
-	recommendationScores := make(map[uint]int)
+	// 5. Load the user's feedback: dismissed and not-interested articles are
+	// excluded, and peers who liked a not-interested article count for less.
+	feedback, err := s.repo.GetFeedbackForUser(userID)
+	if err != nil {
+		log.Printf("Error getting feedback for user %d: %v", userID, err)
+		return nil, err
+	}
+	filter := newFeedbackFilter(feedback)
+
+	peerPenalty := make(map[uint]int)
 	for _, rating := range peerRatings {
-		// If the article is not one the user has already saved...
-		if !userSavedMap[rating.ArticleID] {
-			recommendationScores[rating.ArticleID]++
+		if filter.notInterested[rating.ArticleID] {
+			peerPenalty[rating.UserID]++
 		}
 	}
 
-	// 6. Sort the recommendations by score (frequency).
-	type recommendation struct {
-		ArticleID uint
-		Score     int
+	// 6. Score each article by the weighted number of peers recommending it.
+	recommendationScores := make(map[uint]float64)
+	for _, rating := range peerRatings {
+		// If the article is not one the user has already saved or rejected...
+		if !userSavedMap[rating.ArticleID] && !filter.excluded[rating.ArticleID] {
+			recommendationScores[rating.ArticleID] += peerWeight[rating.UserID] / float64(1+peerPenalty[rating.UserID])
+		}
 	}
 
-	var sortedRecs []recommendation
-	for id, score := range recommendationScores {
-		sortedRecs = append(sortedRecs, recommendation{ArticleID: id, Score: score})
-	}
+	// 7. Filter, diversify and trim the ranked candidates.
+	return rankArticles(s.articleRepo, recommendationScores, filter, s.reranker, limit)
+}
 
-	sort.Slice(sortedRecs, func(i, j int) bool {
-		return sortedRecs[i].Score > sortedRecs[j].Score // Sort descending
+// rankArticles turns article scores into the final list. It walks articles
+// from the highest score down, fetching them in batches and dropping those
+// the feedback filter rejects, until it has a pool of candidates to hand to
+// the re-ranker.
+func rankArticles(articleRepo article.Repository, scores map[uint]float64, filter *feedbackFilter, reranker *Reranker, limit int) ([]article.Article, error) {
+	ranked := make([]uint, 0, len(scores))
+	for id := range scores {
+		ranked = append(ranked, id)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
 	})
 
-	// 7. Get the top N article IDs.
-	var finalArticleIDs []uint
-	for i := 0; i < len(sortedRecs) && i < recommendationLimit; i++ {
-		finalArticleIDs = append(finalArticleIDs, sortedRecs[i].ArticleID)
+	poolSize := limit * candidatePoolFactor
+	pool := make([]Candidate, 0, poolSize)
+	for start := 0; start < len(ranked) && len(pool) < poolSize; start += poolSize {
+		end := start + poolSize
+		if end > len(ranked) {
+			end = len(ranked)
+		}
+		articles, err := articleRepo.GetArticlesByIDs(ranked[start:end])
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[uint]article.Article, len(articles))
+		for _, a := range articles {
+			byID[a.ID] = a
+		}
+		for _, id := range ranked[start:end] {
+			a, ok := byID[id]
+			if ok && filter.allows(&a) && len(pool) < poolSize {
+				pool = append(pool, Candidate{Article: a, Score: scores[id]})
+			}
+		}
 	}
 
-	if len(finalArticleIDs) == 0 {
-		return []article.Article{}, nil
+	finalArticles := []article.Article{}
+	for _, c := range reranker.Rerank(pool, limit) {
+		finalArticles = append(finalArticles, c.Article)
 	}
-
-	// 8. Fetch the full article details for the top IDs.
-	return s.articleRepo.GetArticlesByIDs(finalArticleIDs)
+	return finalArticles, nil
 }
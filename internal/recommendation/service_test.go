@@ -0,0 +1,142 @@
+package recommendation
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// follows is a FollowGraph backed by a map.
+type follows map[uint][]uint
+
+func (f follows) FollowedUserIDs(userID uint) ([]uint, error) {
+	return f[userID], nil
+}
+
+func TestFollowedUsersAreTrustedPeers(t *testing.T) {
+	articleRepo := article.NewMemoryRepository()
+	repo := NewMemoryRepository()
+	for i := uint(1); i <= 3; i++ {
+		require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: i}, UserID: 9, URL: fmt.Sprintf("https://example.com/%d", i)}))
+	}
+	// User 2 shares user 1's favourite and likes article 2. User 3 shares
+	// nothing with user 1 but likes article 3.
+	for _, r := range []article.Rating{
+		{UserID: 1, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 2, Score: 4},
+		{UserID: 3, ArticleID: 3, Score: 5},
+	} {
+		rating := r
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&rating))
+	}
+
+	recs, err := NewService(articleRepo, repo, nil, nil).GetRecommendationsForUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, uint(2), recs[0].ID)
+
+	// Following user 3 brings in their favourite, weighted above those of
+	// peers found through ratings.
+	recs, err = NewService(articleRepo, repo, nil, follows{1: {3}}).GetRecommendationsForUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	assert.Equal(t, uint(3), recs[0].ID)
+	assert.Equal(t, uint(2), recs[1].ID)
+
+	// Follows are enough for a user without favourites.
+	recs, err = NewService(articleRepo, repo, nil, follows{4: {2}}).GetRecommendationsForUser(4, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+}
+
+func TestPersonalRecommendationsLeaveOutWorkspaceArticles(t *testing.T) {
+	articleRepo := article.NewMemoryRepository()
+	repo := NewMemoryRepository()
+	workspaceID := uint(7)
+	require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: 1}, UserID: 9, URL: "https://example.com/1"}))
+	require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: 2}, UserID: 9, URL: "https://example.com/2"}))
+	require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: 3}, UserID: 2, WorkspaceID: &workspaceID, URL: "https://example.com/3"}))
+	// User 2 shares user 1's favourite, and likes a personal article and
+	// one in a workspace user 1 is not a member of.
+	for _, r := range []article.Rating{
+		{UserID: 1, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 2, Score: 4},
+		{UserID: 2, ArticleID: 3, Score: 5},
+	} {
+		rating := r
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&rating))
+	}
+
+	peer := NewService(articleRepo, repo, nil, nil)
+	recs, err := peer.GetRecommendationsForUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, uint(2), recs[0].ID)
+
+	ratings, err := articleRepo.GetAllRatings()
+	require.NoError(t, err)
+	model := TrainMF(ratings, MFParams{Factors: 2, Iterations: 5, Regularization: 0.1, Seed: 1})
+	assert.NotContains(t, model.ItemIDs, uint(3))
+	models := &ModelHolder{}
+	models.Store(model)
+	recs, err = NewMFService(articleRepo, repo, models, peer, nil).GetRecommendationsForUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, uint(2), recs[0].ID)
+}
+
+// members is an article.Memberships backed by a map of workspace members.
+type members map[uint][]uint
+
+func (m members) MemberRole(workspaceID, userID uint) (string, error) {
+	for _, id := range m[workspaceID] {
+		if id == userID {
+			return "viewer", nil
+		}
+	}
+	return "", gorm.ErrRecordNotFound
+}
+
+func TestWorkspaceRecommendationsFavorMembersWithSharedTaste(t *testing.T) {
+	articleRepo := article.NewMemoryRepository()
+	repo := NewMemoryRepository()
+	workspaceID := uint(7)
+	for i := uint(1); i <= 4; i++ {
+		require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: i}, UserID: 9, WorkspaceID: &workspaceID, URL: fmt.Sprintf("https://example.com/%d", i)}))
+	}
+	// Article 5 is outside the workspace and must never be recommended.
+	require.NoError(t, articleRepo.CreateArticle(&article.Article{Model: gorm.Model{ID: 5}, UserID: 9, URL: "https://example.com/5"}))
+
+	// User 2 shares user 1's favourite and likes article 2; users 3 and 4
+	// like article 3 without sharing anything with user 1.
+	for _, r := range []article.Rating{
+		{UserID: 1, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 1, Score: 4},
+		{UserID: 2, ArticleID: 2, Score: 5},
+		{UserID: 2, ArticleID: 5, Score: 5},
+		{UserID: 3, ArticleID: 3, Score: 4},
+		{UserID: 4, ArticleID: 3, Score: 5},
+		{UserID: 4, ArticleID: 4, Score: 2},
+	} {
+		rating := r
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&rating))
+	}
+
+	service := NewWorkspaceService(articleRepo, repo, members{workspaceID: {1, 2, 3, 4}}, nil)
+	recs, err := service.Recommend(1, workspaceID, 10)
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	// Article 3 has two likes, article 2 one that counts double; ties go to
+	// the lower ID.
+	assert.Equal(t, uint(2), recs[0].ID)
+	assert.Equal(t, uint(3), recs[1].ID)
+
+	_, err = service.Recommend(5, workspaceID, 10)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
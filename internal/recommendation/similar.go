@@ -0,0 +1,114 @@
+package recommendation
+
+import (
+	"sort"
+
+	"github.com/cheildo/deeli-api/internal/article"
+)
+
+const (
+	coRatingWeight = 0.6
+	contentWeight  = 0.4
+)
+
+// SimilarArticle is an article related to another one. CoRatingScore is the
+// share of the source article's fans who also liked it, ContentScore the
+// word overlap of their titles and descriptions, and Score a weighted blend.
+type SimilarArticle struct {
+	Article       article.Article `json:"article"`
+	Score         float64         `json:"score"`
+	CoRatingScore float64         `json:"co_rating_score"`
+	ContentScore  float64         `json:"content_score"`
+}
+
+// SimilarService finds articles related to a given one.
+type SimilarService struct {
+	articleRepo article.Repository
+}
+
+func NewSimilarService(articleRepo article.Repository) *SimilarService {
+	return &SimilarService{articleRepo: articleRepo}
+}
+
+// FindSimilar returns up to limit articles similar to articleID that userID
+// can see, best first. It returns gorm.ErrRecordNotFound if the user cannot
+// see the source article.
+func (s *SimilarService) FindSimilar(userID, articleID uint, limit int) ([]SimilarArticle, error) {
+	source, err := s.articleRepo.GetAccessibleArticle(articleID, userID, article.AccessRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users who liked this also liked: among other users who rated the
+	// source highly, the fraction who also rated each candidate highly.
+	// Only articles the user can see count, which in practice means other
+	// members' ratings of articles in the user's workspaces.
+	coRating := make(map[uint]float64)
+	fans, err := s.articleRepo.FindPeerUsers(userID, []uint{articleID}, minRatingForRecommendation)
+	if err != nil {
+		return nil, err
+	}
+	fanRatings, err := s.articleRepo.GetHighlyRatedVisibleArticles(userID, fans, minRatingForRecommendation)
+	if err != nil {
+		return nil, err
+	}
+	for _, rating := range fanRatings {
+		if rating.ArticleID != articleID {
+			coRating[rating.ArticleID] += 1 / float64(len(fans))
+		}
+	}
+
+	// Everything co-rated plus the user's own library are candidates for
+	// content similarity.
+	savedIDs, err := s.articleRepo.GetArticleIDsSavedByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	candidateSet := make(map[uint]bool, len(coRating)+len(savedIDs))
+	for id := range coRating {
+		candidateSet[id] = true
+	}
+	for _, id := range savedIDs {
+		candidateSet[id] = true
+	}
+	delete(candidateSet, articleID)
+	candidateIDs := make([]uint, 0, len(candidateSet))
+	for id := range candidateSet {
+		candidateIDs = append(candidateIDs, id)
+	}
+
+	visibleIDs, err := s.articleRepo.FilterVisibleArticleIDs(userID, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.articleRepo.GetArticlesByIDs(visibleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceTokens := articleTokens(source)
+	similar := []SimilarArticle{}
+	for _, a := range candidates {
+		content := jaccard(sourceTokens, articleTokens(&a))
+		score := coRatingWeight*coRating[a.ID] + contentWeight*content
+		if score > 0 {
+			similar = append(similar, SimilarArticle{
+				Article:       a,
+				Score:         score,
+				CoRatingScore: coRating[a.ID],
+				ContentScore:  content,
+			})
+		}
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Score != similar[j].Score {
+			return similar[i].Score > similar[j].Score
+		}
+		return similar[i].Article.ID < similar[j].Article.ID
+	})
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
@@ -0,0 +1,81 @@
+package recommendation
+
+import (
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestFindSimilar(t *testing.T) {
+	articleRepo := article.NewMemoryRepository()
+	for _, a := range []article.Article{
+		{Model: gorm.Model{ID: 1}, UserID: 1, URL: "https://a.com/1", Title: "Scaling Postgres replicas"},
+		{Model: gorm.Model{ID: 2}, UserID: 1, URL: "https://a.com/2", Title: "Sourdough starter guide"},
+		{Model: gorm.Model{ID: 3}, UserID: 1, URL: "https://a.com/3", Title: "Postgres replicas in practice"},
+		{Model: gorm.Model{ID: 4}, UserID: 2, URL: "https://a.com/4", Title: "Scaling Postgres replicas"},
+		{Model: gorm.Model{ID: 5}, UserID: 1, URL: "https://a.com/5", Title: "Unrelated"},
+	} {
+		a := a
+		require.NoError(t, articleRepo.CreateArticle(&a))
+	}
+	// Two other users who liked article 1 both liked article 2, one liked 4.
+	for _, r := range []article.Rating{
+		{UserID: 2, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 2, Score: 4},
+		{UserID: 2, ArticleID: 4, Score: 5},
+		{UserID: 3, ArticleID: 1, Score: 4},
+		{UserID: 3, ArticleID: 2, Score: 5},
+	} {
+		r := r
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&r))
+	}
+
+	similar, err := NewSimilarService(articleRepo).FindSimilar(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, similar, 2, "article 4 belongs to someone else and article 5 shares nothing")
+
+	assert.Equal(t, uint(2), similar[0].Article.ID)
+	assert.InDelta(t, 1.0, similar[0].CoRatingScore, 1e-9)
+	assert.Zero(t, similar[0].ContentScore)
+
+	assert.Equal(t, uint(3), similar[1].Article.ID)
+	assert.Zero(t, similar[1].CoRatingScore)
+	assert.Greater(t, similar[1].ContentScore, 0.0)
+
+	_, err = NewSimilarService(articleRepo).FindSimilar(1, 4, 10)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestFindSimilarInWorkspace(t *testing.T) {
+	workspaceID := uint(7)
+	articleRepo := article.NewMemoryRepositoryWithMemberships(members{workspaceID: {1, 2, 3}})
+	for _, a := range []article.Article{
+		{Model: gorm.Model{ID: 1}, UserID: 2, WorkspaceID: &workspaceID, URL: "https://a.com/1", Title: "Scaling Postgres replicas"},
+		{Model: gorm.Model{ID: 2}, UserID: 3, WorkspaceID: &workspaceID, URL: "https://a.com/2", Title: "Sourdough starter guide"},
+		{Model: gorm.Model{ID: 3}, UserID: 2, URL: "https://a.com/3", Title: "Knitting patterns"},
+	} {
+		a := a
+		require.NoError(t, articleRepo.CreateArticle(&a))
+	}
+	// Both other members liked the source; one also liked article 2 in the
+	// workspace and article 3 in their own library.
+	for _, r := range []article.Rating{
+		{UserID: 2, ArticleID: 1, Score: 5},
+		{UserID: 2, ArticleID: 2, Score: 5},
+		{UserID: 2, ArticleID: 3, Score: 5},
+		{UserID: 3, ArticleID: 1, Score: 4},
+	} {
+		r := r
+		require.NoError(t, articleRepo.CreateOrUpdateRating(&r))
+	}
+
+	similar, err := NewSimilarService(articleRepo).FindSimilar(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, similar, 1, "article 3 is in someone else's library")
+	assert.Equal(t, uint(2), similar[0].Article.ID)
+	assert.InDelta(t, 0.5, similar[0].CoRatingScore, 1e-9)
+	assert.InDelta(t, coRatingWeight*0.5, similar[0].Score, 1e-9)
+}
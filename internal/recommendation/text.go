@@ -0,0 +1,55 @@
+package recommendation
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/cheildo/deeli-api/internal/article"
+)
+
+// stopwords are common English words that carry no topical signal.
+var stopwords = map[string]bool{
+	"an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "how": true, "in": true, "is": true, "it": true, "its": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "what": true, "when": true, "why": true, "with": true, "you": true, "your": true,
+}
+
+// tokenize lower-cases text and splits it into words, dropping single
+// characters and stopwords.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if len(f) > 1 && !stopwords[f] {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// articleTokens returns the set of words in an article's title and description.
+func articleTokens(a *article.Article) map[string]bool {
+	set := make(map[string]bool)
+	for _, t := range tokenize(a.Title + " " + a.Description) {
+		set[t] = true
+	}
+	return set
+}
+
+// matchesTopic reports whether every word of topic appears in the article.
+func matchesTopic(a *article.Article, topic string) bool {
+	words := tokenize(topic)
+	if len(words) == 0 {
+		return false
+	}
+	tokens := articleTokens(a)
+	for _, w := range words {
+		if !tokens[w] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package recommendation
+
+import (
+	"log"
+
+	"github.com/cheildo/deeli-api/internal/article"
+)
+
+const (
+	// StrategyWorkspace identifies recommendations computed within a
+	// workspace in recorded impressions.
+	StrategyWorkspace = "workspace"
+
+	// sharedFavoriteWeight is how much more a member who shares one of the
+	// user's favorites counts than any other member.
+	sharedFavoriteWeight = 2
+)
+
+// WorkspaceService recommends a workspace's articles to one of its members
+// from the other members' ratings. Lists are computed on request rather than
+// cached, as workspaces are small.
+type WorkspaceService struct {
+	articleRepo article.Repository
+	repo        Repository
+	memberships article.Memberships
+	reranker    *Reranker
+}
+
+// NewWorkspaceService creates a WorkspaceService. The reranker may be nil,
+// in which case results are ordered by score alone.
+func NewWorkspaceService(articleRepo article.Repository, repo Repository, memberships article.Memberships, reranker *Reranker) *WorkspaceService {
+	return &WorkspaceService{articleRepo: articleRepo, repo: repo, memberships: memberships, reranker: reranker}
+}
+
+// Recommend returns up to limit of the workspace's articles that the user
+// hasn't rated, best first. Each article scores one point per other member
+// who rated it highly, and two for members who share one of the user's
+// favorites in the workspace. It returns gorm.ErrRecordNotFound if the user
+// isn't a member.
+func (s *WorkspaceService) Recommend(userID, workspaceID uint, limit int) ([]article.Article, error) {
+	if _, err := s.memberships.MemberRole(workspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	ratings, err := s.articleRepo.GetWorkspaceRatings(workspaceID)
+	if err != nil {
+		log.Printf("Error getting ratings of workspace %d: %v", workspaceID, err)
+		return nil, err
+	}
+
+	rated := make(map[uint]bool)
+	favorites := make(map[uint]bool)
+	for _, rating := range ratings {
+		if rating.UserID == userID {
+			rated[rating.ArticleID] = true
+			if rating.Score >= minRatingForRecommendation {
+				favorites[rating.ArticleID] = true
+			}
+		}
+	}
+	peerWeight := make(map[uint]float64)
+	for _, rating := range ratings {
+		if rating.UserID == userID || rating.Score < minRatingForRecommendation {
+			continue
+		}
+		if favorites[rating.ArticleID] {
+			peerWeight[rating.UserID] = sharedFavoriteWeight
+		} else if _, ok := peerWeight[rating.UserID]; !ok {
+			peerWeight[rating.UserID] = 1
+		}
+	}
+
+	feedback, err := s.repo.GetFeedbackForUser(userID)
+	if err != nil {
+		log.Printf("Error getting feedback for user %d: %v", userID, err)
+		return nil, err
+	}
+	filter := newFeedbackFilter(feedback)
+
+	scores := make(map[uint]float64)
+	for _, rating := range ratings {
+		if rating.UserID == userID || rating.Score < minRatingForRecommendation {
+			continue
+		}
+		if !rated[rating.ArticleID] && !filter.excluded[rating.ArticleID] {
+			scores[rating.ArticleID] += peerWeight[rating.UserID]
+		}
+	}
+
+	return rankArticles(s.articleRepo, scores, filter, s.reranker, limit)
+}
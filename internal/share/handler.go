@@ -0,0 +1,271 @@
+package share
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/config"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PasswordHeader carries the password of a protected link.
+const PasswordHeader = "X-Share-Password"
+
+// Handler serves the owner's share link management and the public view.
+type Handler struct {
+	service  *Service
+	throttle *PasswordThrottle
+	baseURL  string
+}
+
+// NewHandler creates a Handler. Links are built as baseURL + "/s/" + token.
+func NewHandler(service *Service, throttle *PasswordThrottle, baseURL string) *Handler {
+	return &Handler{service: service, throttle: throttle, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// PasswordThrottle tracks wrong share link passwords per link and client
+// IP, and per link from any IP, so spreading guesses over many addresses
+// doesn't get around it.
+type PasswordThrottle struct {
+	client *auth.Throttle
+	link   *auth.Throttle
+}
+
+// NewPasswordThrottle keeps its counts in store apart from failed logins.
+func NewPasswordThrottle(store auth.AttemptStore, client, link auth.ThrottlePolicy) *PasswordThrottle {
+	return &PasswordThrottle{
+		client: auth.NewThrottle(store, "share", client),
+		link:   auth.NewThrottle(store, "share-link", link),
+	}
+}
+
+// PasswordThrottleFromConfig uses the per-client policy from the
+// SHARE_PASSWORD_* settings and the per-link policy from the
+// SHARE_LINK_PASSWORD_* settings.
+func PasswordThrottleFromConfig() *PasswordThrottle {
+	return NewPasswordThrottle(auth.AttemptStoreFromConfig(), auth.ThrottlePolicy{
+		FreeAttempts:    config.GetInt("SHARE_PASSWORD_FREE_ATTEMPTS", 5),
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    config.GetInt("SHARE_PASSWORD_LOCKOUT_AFTER", 20),
+		LockoutDuration: config.GetDuration("SHARE_PASSWORD_LOCKOUT_DURATION", time.Hour),
+		Window:          time.Hour,
+	}, auth.ThrottlePolicy{
+		FreeAttempts:    config.GetInt("SHARE_LINK_PASSWORD_FREE_ATTEMPTS", 20),
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    config.GetInt("SHARE_LINK_PASSWORD_LOCKOUT_AFTER", 100),
+		LockoutDuration: config.GetDuration("SHARE_LINK_PASSWORD_LOCKOUT_DURATION", time.Hour),
+		Window:          time.Hour,
+	})
+}
+
+// Check returns how long the client must wait before trying another
+// password on the link. Zero means it may try now.
+func (t *PasswordThrottle) Check(linkID uint, ip string) (time.Duration, error) {
+	wait, err := t.client.Check(clientKey(linkID, ip))
+	if err != nil {
+		return 0, err
+	}
+	linkWait, err := t.link.Check(strconv.FormatUint(uint64(linkID), 10))
+	if err != nil {
+		return 0, err
+	}
+	if linkWait > wait {
+		wait = linkWait
+	}
+	return wait, nil
+}
+
+// Failure records a wrong password for the link from the client.
+func (t *PasswordThrottle) Failure(linkID uint, ip string) error {
+	if err := t.client.Failure(clientKey(linkID, ip)); err != nil {
+		return err
+	}
+	return t.link.Failure(strconv.FormatUint(uint64(linkID), 10))
+}
+
+func clientKey(linkID uint, ip string) string {
+	return fmt.Sprintf("%d:%s", linkID, ip)
+}
+
+// LinkResponse is a share link as its owner sees it. Token and URL are only
+// set when the link is created.
+type LinkResponse struct {
+	ID             uint       `json:"id"`
+	ArticleID      uint       `json:"article_id"`
+	Prefix         string     `json:"prefix"`
+	Token          string     `json:"token,omitempty"`
+	URL            string     `json:"url,omitempty"`
+	HasPassword    bool       `json:"has_password"`
+	IncludeContent bool       `json:"include_content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	Views          int64      `json:"views"`
+	LastViewedAt   *time.Time `json:"last_viewed_at"`
+}
+
+func newLinkResponse(l *Link) LinkResponse {
+	return LinkResponse{
+		ID:             l.ID,
+		ArticleID:      l.ArticleID,
+		Prefix:         l.Prefix,
+		HasPassword:    l.PasswordHash != "",
+		IncludeContent: l.IncludeContent,
+		CreatedAt:      l.CreatedAt,
+		ExpiresAt:      l.ExpiresAt,
+		Views:          l.Views,
+		LastViewedAt:   l.LastViewedAt,
+	}
+}
+
+// CreateLinkRequest defines the JSON for sharing an article. Without
+// ExpiresAt the link doesn't expire.
+type CreateLinkRequest struct {
+	Password       string     `json:"password" binding:"omitempty,min=4,max=128"`
+	IncludeContent bool       `json:"include_content"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+// CreateLink handles POST /articles/:id/shares
+func (h *Handler) CreateLink(c *gin.Context) {
+	var req CreateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	plain, link, err := h.service.Create(userID, uint(articleID), Options{
+		Password:       req.Password,
+		IncludeContent: req.IncludeContent,
+		ExpiresAt:      req.ExpiresAt,
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found or you can't share it"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	response := newLinkResponse(link)
+	response.Token = plain
+	response.URL = h.baseURL + "/s/" + plain
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListLinks handles GET /shares
+func (h *Handler) ListLinks(c *gin.Context) {
+	links, err := h.service.List(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share links"})
+		return
+	}
+
+	response := make([]LinkResponse, len(links))
+	for i := range links {
+		response[i] = newLinkResponse(&links[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeLink handles DELETE /shares/:id
+func (h *Handler) RevokeLink(c *gin.Context) {
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link ID"})
+		return
+	}
+	if err := h.service.Revoke(c.MustGet("userID").(uint), uint(linkID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// View handles GET /s/:token, open to anyone with the token. Protected links
+// need the password in the X-Share-Password header; wrong ones are throttled,
+// and when too many are being checked at once the viewer is asked to retry.
+func (h *Handler) View(c *gin.Context) {
+	link, err := h.service.Find(c.Param("token"))
+	if err != nil {
+		if err == ErrLinkNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open share link"})
+		return
+	}
+
+	if link.PasswordHash != "" {
+		wait, err := h.throttle.Check(link.ID, c.ClientIP())
+		if err != nil {
+			log.Printf("Share link throttle check failed: %v", err)
+		} else if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return
+		}
+	}
+
+	art, err := h.service.Read(link, c.GetHeader(PasswordHeader))
+	switch err {
+	case nil:
+	case ErrLinkNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	case ErrPasswordRequired:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This link requires a password"})
+		return
+	case ErrWrongPassword:
+		if err := h.throttle.Failure(link.ID, c.ClientIP()); err != nil {
+			log.Printf("Failed to record share link password failure: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	case ErrTooManyChecks:
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many requests, try again shortly"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open share link"})
+		return
+	}
+
+	response := gin.H{
+		"url":         art.URL,
+		"title":       art.Title,
+		"description": art.Description,
+		"image_url":   art.ImageURL,
+		"shared_at":   link.CreatedAt,
+		"expires_at":  link.ExpiresAt,
+	}
+	if link.IncludeContent {
+		response["content"] = art.Content
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,40 @@
+package share
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenPrefix starts every share token.
+const TokenPrefix = "dls_"
+
+// Link lets anyone with its token read one of the user's articles without
+// an account. Only a hash of the token is stored; Prefix keeps enough of it
+// for the owner to recognise it.
+type Link struct {
+	gorm.Model
+	UserID    uint   `gorm:"index;not null"`
+	ArticleID uint   `gorm:"index;not null"`
+	Prefix    string `gorm:"not null"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	// PasswordHash is set when viewers must also give a password.
+	PasswordHash string
+	// IncludeContent shares the article's extracted text, not just its
+	// metadata.
+	IncludeContent bool `gorm:"not null;default:false"`
+	ExpiresAt      *time.Time
+	RevokedAt      *time.Time
+	Views          int64 `gorm:"not null;default:0"`
+	LastViewedAt   *time.Time
+}
+
+// TableName keeps the table from being called just "links".
+func (Link) TableName() string {
+	return "share_links"
+}
+
+// Active reports whether the link can still be opened.
+func (l *Link) Active(now time.Time) bool {
+	return l.RevokedAt == nil && (l.ExpiresAt == nil || now.Before(*l.ExpiresAt))
+}
@@ -0,0 +1,68 @@
+package share
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Repository defines the interface for share link storage.
+type Repository interface {
+	CreateLink(link *Link) error
+	// GetLinkByHash returns the link if its owner's account is in use, and
+	// gorm.ErrRecordNotFound otherwise.
+	GetLinkByHash(hash string) (*Link, error)
+	// ListLinks returns the user's links that haven't been revoked, newest
+	// first.
+	ListLinks(userID uint) ([]Link, error)
+	RevokeLink(userID, linkID uint) error
+	// RecordView counts a view of the link.
+	RecordView(linkID uint, at time.Time) error
+}
+
+type repository struct{}
+
+func NewRepository() Repository {
+	return &repository{}
+}
+
+func (r *repository) CreateLink(link *Link) error {
+	return database.DB.Create(link).Error
+}
+
+func (r *repository) GetLinkByHash(hash string) (*Link, error) {
+	var link Link
+	err := database.DB.
+		Joins("JOIN users ON users.id = share_links.user_id AND users.deleted_at IS NULL").
+		Where("share_links.token_hash = ?", hash).
+		Where("users.disabled_at IS NULL AND users.delete_after IS NULL").
+		First(&link).Error
+	return &link, err
+}
+
+func (r *repository) ListLinks(userID uint) ([]Link, error) {
+	var links []Link
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at desc").Find(&links).Error
+	return links, err
+}
+
+func (r *repository) RevokeLink(userID, linkID uint) error {
+	result := database.DB.Model(&Link{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", linkID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *repository) RecordView(linkID uint, at time.Time) error {
+	return database.DB.Model(&Link{}).Where("id = ?", linkID).Updates(map[string]interface{}{
+		"views":          gorm.Expr("views + 1"),
+		"last_viewed_at": at,
+	}).Error
+}
@@ -0,0 +1,163 @@
+package share
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrLinkNotFound covers unknown, revoked and expired links alike, so
+	// viewers can't tell them apart.
+	ErrLinkNotFound     = errors.New("share link not found")
+	ErrPasswordRequired = errors.New("share link requires a password")
+	ErrWrongPassword    = errors.New("wrong share link password")
+	// ErrTooManyChecks means the password couldn't be checked because as
+	// many checks as allowed are already running.
+	ErrTooManyChecks = errors.New("too many share link password checks")
+)
+
+// Options are the settings of a new link.
+type Options struct {
+	// Password, if set, must be given to open the link.
+	Password       string
+	IncludeContent bool
+	// ExpiresAt is nil for a link that doesn't expire.
+	ExpiresAt *time.Time
+}
+
+// Service creates share links and opens them.
+type Service struct {
+	repo     Repository
+	articles article.Repository
+	now      func() time.Time
+	// checks holds a slot for each password check running, since each
+	// one takes a password hash's worth of memory for anyone who asks.
+	checks chan struct{}
+}
+
+// NewService creates a Service that checks at most maxChecks link
+// passwords at once.
+func NewService(repo Repository, articles article.Repository, maxChecks int) *Service {
+	if maxChecks < 1 {
+		maxChecks = 1
+	}
+	return &Service{repo: repo, articles: articles, now: time.Now, checks: make(chan struct{}, maxChecks)}
+}
+
+// Create shares an article the user can change: one of their own or, as an
+// editor, a workspace's. The plain token is only ever returned here. It
+// returns gorm.ErrRecordNotFound if the user lacks that access.
+func (s *Service) Create(userID, articleID uint, opts Options) (string, *Link, error) {
+	if _, err := s.articles.GetAccessibleArticle(articleID, userID, article.AccessWrite); err != nil {
+		return "", nil, err
+	}
+	secret, err := auth.RandomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	plain := TokenPrefix + secret
+	link := &Link{
+		UserID:         userID,
+		ArticleID:      articleID,
+		Prefix:         plain[:len(TokenPrefix)+6],
+		TokenHash:      auth.HashToken(plain),
+		IncludeContent: opts.IncludeContent,
+		ExpiresAt:      opts.ExpiresAt,
+	}
+	if opts.Password != "" {
+		if link.PasswordHash, err = auth.HashPassword(opts.Password); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := s.repo.CreateLink(link); err != nil {
+		return "", nil, err
+	}
+	return plain, link, nil
+}
+
+func (s *Service) List(userID uint) ([]Link, error) {
+	return s.repo.ListLinks(userID)
+}
+
+func (s *Service) Revoke(userID, linkID uint) error {
+	return s.repo.RevokeLink(userID, linkID)
+}
+
+// Open checks a presented token and password and returns the link and its
+// article, counting the view.
+func (s *Service) Open(token, password string) (*Link, *article.Article, error) {
+	link, err := s.Find(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	art, err := s.Read(link, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return link, art, nil
+}
+
+// Find returns the active link a presented token belongs to.
+func (s *Service) Find(token string) (*Link, error) {
+	link, err := s.repo.GetLinkByHash(auth.HashToken(token))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrLinkNotFound
+		}
+		return nil, err
+	}
+	if !link.Active(s.now()) {
+		return nil, ErrLinkNotFound
+	}
+	return link, nil
+}
+
+// Read checks the password of a link from Find and returns its article,
+// counting the view.
+func (s *Service) Read(link *Link, password string) (*article.Article, error) {
+	if link.PasswordHash != "" {
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		ok, err := s.checkPassword(password, link.PasswordHash)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrWrongPassword
+		}
+	}
+
+	// The link only works while its creator can still read the article, so
+	// that leaving a workspace ends the links made there.
+	art, err := s.articles.GetAccessibleArticle(link.ArticleID, link.UserID, article.AccessRead)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrLinkNotFound
+		}
+		return nil, err
+	}
+	now := s.now()
+	if err := s.repo.RecordView(link.ID, now); err != nil {
+		return nil, err
+	}
+	link.Views++
+	link.LastViewedAt = &now
+	return art, nil
+}
+
+// checkPassword checks password against hash, or returns ErrTooManyChecks
+// rather than wait for a slot.
+func (s *Service) checkPassword(password, hash string) (bool, error) {
+	select {
+	case s.checks <- struct{}{}:
+	default:
+		return false, ErrTooManyChecks
+	}
+	defer func() { <-s.checks }()
+	return auth.CheckPasswordHash(password, hash), nil
+}
@@ -0,0 +1,246 @@
+package share
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryRepository is a Repository backed by a slice.
+type memoryRepository struct {
+	mu    sync.Mutex
+	links []*Link
+}
+
+func (r *memoryRepository) CreateLink(link *Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	link.ID = uint(len(r.links) + 1)
+	link.CreatedAt = time.Now()
+	stored := *link
+	r.links = append(r.links, &stored)
+	return nil
+}
+
+func (r *memoryRepository) GetLinkByHash(hash string) (*Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.links {
+		if l.TokenHash == hash {
+			found := *l
+			return &found, nil
+		}
+	}
+	return &Link{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryRepository) ListLinks(userID uint) ([]Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var links []Link
+	for _, l := range r.links {
+		if l.UserID == userID && l.RevokedAt == nil {
+			links = append(links, *l)
+		}
+	}
+	return links, nil
+}
+
+func (r *memoryRepository) RevokeLink(userID, linkID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.links {
+		if l.ID == linkID && l.UserID == userID && l.RevokedAt == nil {
+			now := time.Now()
+			l.RevokedAt = &now
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *memoryRepository) RecordView(linkID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.links {
+		if l.ID == linkID {
+			l.Views++
+			l.LastViewedAt = &at
+		}
+	}
+	return nil
+}
+
+// readers wraps an article.Repository so that only the listed users can
+// read articles, as if the others had left the workspace.
+type readers struct {
+	article.Repository
+	allowed map[uint]bool
+}
+
+func (r readers) GetAccessibleArticle(articleID, userID uint, access article.Access) (*article.Article, error) {
+	if !r.allowed[userID] {
+		return &article.Article{}, gorm.ErrRecordNotFound
+	}
+	return r.Repository.GetArticleByID(articleID)
+}
+
+func newTestService(t *testing.T) (*Service, *memoryRepository) {
+	articles := article.NewMemoryRepository()
+	require.NoError(t, articles.CreateArticle(&article.Article{
+		Model:   gorm.Model{ID: 1},
+		UserID:  1,
+		URL:     "https://example.com/postgres",
+		Title:   "Scaling Postgres",
+		Content: "First we added replicas.",
+	}))
+	repo := &memoryRepository{}
+	return NewService(repo, articles, 1), repo
+}
+
+func TestOpenLink(t *testing.T) {
+	service, repo := newTestService(t)
+
+	_, _, err := service.Create(2, 1, Options{})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "only the owner can share an article")
+
+	token, link, err := service.Create(1, 1, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, token[:len(link.Prefix)], link.Prefix)
+	assert.NotContains(t, link.TokenHash, token)
+
+	opened, art, err := service.Open(token, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Scaling Postgres", art.Title)
+	assert.Equal(t, int64(1), opened.Views)
+	_, _, err = service.Open(token, "")
+	require.NoError(t, err)
+	links, err := service.List(1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), links[0].Views)
+
+	_, _, err = service.Open(token+"x", "")
+	assert.ErrorIs(t, err, ErrLinkNotFound)
+
+	require.NoError(t, service.Revoke(1, link.ID))
+	_, _, err = service.Open(token, "")
+	assert.ErrorIs(t, err, ErrLinkNotFound)
+	assert.ErrorIs(t, service.Revoke(1, link.ID), gorm.ErrRecordNotFound)
+
+	expiry := time.Now().Add(time.Hour)
+	token, _, err = service.Create(1, 1, Options{ExpiresAt: &expiry})
+	require.NoError(t, err)
+	_, _, err = service.Open(token, "")
+	require.NoError(t, err)
+	service.now = func() time.Time { return expiry }
+	_, _, err = service.Open(token, "")
+	assert.ErrorIs(t, err, ErrLinkNotFound)
+	assert.Len(t, repo.links, 2)
+}
+
+func TestOpenLinkNeedsCreatorAccess(t *testing.T) {
+	articles := article.NewMemoryRepository()
+	workspaceID := uint(3)
+	require.NoError(t, articles.CreateArticle(&article.Article{Model: gorm.Model{ID: 1}, UserID: 1, WorkspaceID: &workspaceID, URL: "https://example.com/team"}))
+	access := readers{Repository: articles, allowed: map[uint]bool{2: true}}
+	service := NewService(&memoryRepository{}, access, 1)
+
+	token, _, err := service.Create(2, 1, Options{})
+	require.NoError(t, err, "an editor shares a workspace article")
+	_, _, err = service.Open(token, "")
+	require.NoError(t, err)
+
+	delete(access.allowed, 2)
+	_, _, err = service.Open(token, "")
+	assert.ErrorIs(t, err, ErrLinkNotFound, "the editor left the workspace")
+}
+
+func TestViewProtectedLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service, _ := newTestService(t)
+	policy := auth.ThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	linkPolicy := auth.ThrottlePolicy{FreeAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	store := auth.NewMemoryAttemptStore()
+	handler := NewHandler(service, NewPasswordThrottle(store, policy, linkPolicy), "https://deeli.test/")
+	router := gin.New()
+	router.GET("/s/:token", handler.View)
+
+	viewFrom := func(ip, token, password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/s/"+token, nil)
+		req.RemoteAddr = ip + ":1234"
+		if password != "" {
+			req.Header.Set(PasswordHeader, password)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	view := func(token, password string) *httptest.ResponseRecorder {
+		return viewFrom("192.0.2.1", token, password)
+	}
+
+	token, _, err := service.Create(1, 1, Options{Password: "open sesame", IncludeContent: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnauthorized, view(token, "").Code)
+	w := view(token, "open sesame")
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "Scaling Postgres", body["title"])
+	assert.Equal(t, "First we added replicas.", body["content"])
+
+	// Wrong passwords are throttled per link and IP.
+	assert.Equal(t, http.StatusUnauthorized, view(token, "guess 1").Code)
+	assert.Equal(t, http.StatusUnauthorized, view(token, "guess 2").Code)
+	assert.Equal(t, http.StatusUnauthorized, view(token, "guess 3").Code)
+	w = view(token, "open sesame")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// The failures don't lock the IP out of logging in.
+	wait, err := auth.NewLoginThrottle(store, policy, policy).Check("", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Guesses spread over other IPs still count against the link.
+	assert.Equal(t, http.StatusUnauthorized, viewFrom("192.0.2.2", token, "guess 4").Code)
+	assert.Equal(t, http.StatusUnauthorized, viewFrom("192.0.2.3", token, "guess 5").Code)
+	assert.Equal(t, http.StatusUnauthorized, viewFrom("192.0.2.4", token, "guess 6").Code)
+	assert.Equal(t, http.StatusTooManyRequests, viewFrom("192.0.2.5", token, "open sesame").Code)
+
+	// Links without a password aren't throttled, and without IncludeContent
+	// only the metadata is shared.
+	token, _, err = service.Create(1, 1, Options{})
+	require.NoError(t, err)
+	w = view(token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	body = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotContains(t, body, "content")
+}
+
+func TestPasswordChecksAreCapped(t *testing.T) {
+	service, _ := newTestService(t)
+	token, _, err := service.Create(1, 1, Options{Password: "open sesame"})
+	require.NoError(t, err)
+
+	// Every slot is taken: the check isn't run at all.
+	service.checks <- struct{}{}
+	_, _, err = service.Open(token, "open sesame")
+	assert.ErrorIs(t, err, ErrTooManyChecks)
+
+	<-service.checks
+	_, _, err = service.Open(token, "open sesame")
+	require.NoError(t, err)
+}
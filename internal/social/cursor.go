@@ -0,0 +1,57 @@
+package social
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a feed cursor that was not issued by the
+// feed.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of the last item of a feed page. Items are ordered
+// by time, then article ID, then type, all descending, so the position is
+// stable while new items arrive at the top.
+type Cursor struct {
+	At        time.Time
+	ArticleID uint
+	Type      string
+}
+
+func cursorOf(item *FeedItem) Cursor {
+	return Cursor{At: item.At, ArticleID: item.Article.ID, Type: item.Type}
+}
+
+// Encode returns the cursor as an opaque URL-safe string.
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.At.UnixMicro(), 10) + ":" + strconv.FormatUint(uint64(c.ArticleID), 10) + ":" + c.Type
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor from Encode. An empty string is the start of
+// the feed and decodes to nil.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || (parts[2] != ItemSave && parts[2] != ItemRating) {
+		return nil, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	articleID, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{At: time.UnixMicro(micros), ArticleID: uint(articleID), Type: parts[2]}, nil
+}
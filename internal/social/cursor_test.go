@@ -0,0 +1,31 @@
+package social
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	cursor := Cursor{At: at, ArticleID: 42, Type: ItemRating}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, decoded.At.Equal(at))
+	assert.Equal(t, uint(42), decoded.ArticleID)
+	assert.Equal(t, ItemRating, decoded.Type)
+
+	start, err := DecodeCursor("")
+	assert.NoError(t, err)
+	assert.Nil(t, start)
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, s := range []string{"!!!", "MTIz", "MTIzOjQ1Om90aGVy", "YWJjOjQ1OnNhdmU"} {
+		_, err := DecodeCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+}
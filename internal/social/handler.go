@@ -0,0 +1,142 @@
+package social
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves public profiles, follows and the feed.
+type Handler struct {
+	repo  Repository
+	users user.Repository
+}
+
+func NewHandler(repo Repository, users user.Repository) *Handler {
+	return &Handler{repo: repo, users: users}
+}
+
+// GetProfile handles GET /users/:id. Only public profiles can be seen by
+// others.
+func (h *Handler) GetProfile(c *gin.Context) {
+	target, ok := h.visibleUser(c)
+	if !ok {
+		return
+	}
+	followers, following, err := h.repo.CountFollows(target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count follows"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           target.ID,
+		"display_name": target.DisplayName,
+		"avatar_url":   target.AvatarURL,
+		"bio":          target.Bio,
+		"followers":    followers,
+		"following":    following,
+	})
+}
+
+// Follow handles POST /users/:id/follow
+func (h *Handler) Follow(c *gin.Context) {
+	target, ok := h.visibleUser(c)
+	if !ok {
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	if target.ID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't follow yourself"})
+		return
+	}
+
+	if err := h.repo.Follow(userID, target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Following user"})
+}
+
+// Unfollow handles DELETE /users/:id/follow. It works whether or not the
+// profile is still public.
+func (h *Handler) Unfollow(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if err := h.repo.Unfollow(c.MustGet("userID").(uint), uint(targetID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow user"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListFollowing handles GET /me/following
+func (h *Handler) ListFollowing(c *gin.Context) {
+	following, err := h.repo.ListFollowing(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve followed users"})
+		return
+	}
+	c.JSON(http.StatusOK, following)
+}
+
+// GetFeed handles GET /feed: the recent public saves and high ratings of
+// the users the caller follows, newest first, paginated with the cursor of
+// the previous page.
+func (h *Handler) GetFeed(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	after, err := DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	// One extra item tells whether there is a next page.
+	items, err := h.repo.Feed(userID, after, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve feed"})
+		return
+	}
+	page := FeedPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = cursorOf(&page.Items[limit-1]).Encode()
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// visibleUser loads the user named by the :id parameter, answering 400 or
+// 404 unless it is the caller or has a public profile.
+func (h *Handler) visibleUser(c *gin.Context) (*user.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	target, err := h.users.GetUserByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	public := target.Preferences.PublicProfile && !target.Disabled() && !target.PendingDeletion()
+	if !public && target.ID != c.MustGet("userID").(uint) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return target, true
+}
@@ -0,0 +1,45 @@
+package social
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+)
+
+// Follow is an edge of the follow graph: the follower sees the followee's
+// public saves and high ratings in their feed. Unfollowing deletes the row.
+type Follow struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	FollowerID uint `gorm:"uniqueIndex:idx_follow;not null"`
+	FolloweeID uint `gorm:"uniqueIndex:idx_follow;index;not null"`
+}
+
+// Kinds of feed items.
+const (
+	ItemSave   = "save"
+	ItemRating = "rating"
+)
+
+// Author is the public view of a user.
+type Author struct {
+	ID          uint   `json:"id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// FeedItem is a followed user saving a public article, or rating one
+// highly.
+type FeedItem struct {
+	Type    string          `json:"type"`
+	At      time.Time       `json:"at"`
+	User    Author          `json:"user"`
+	Article article.Article `json:"article"`
+	Score   int             `json:"score,omitempty"`
+}
+
+// FeedPage is one page of a user's feed.
+type FeedPage struct {
+	Items      []FeedItem `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
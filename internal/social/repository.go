@@ -0,0 +1,183 @@
+package social
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm/clause"
+)
+
+// minFeedRating is the lowest score that puts a rating in followers' feeds.
+const minFeedRating = 4
+
+// Repository stores the follow graph and reads feeds from it.
+type Repository interface {
+	// Follow makes followerID follow followeeID. Following twice is not
+	// an error.
+	Follow(followerID, followeeID uint) error
+	Unfollow(followerID, followeeID uint) error
+	// FollowedUserIDs returns the IDs of the users userID follows.
+	FollowedUserIDs(userID uint) ([]uint, error)
+	// ListFollowing returns the users userID follows, most recent first.
+	ListFollowing(userID uint) ([]Author, error)
+	// CountFollows returns how many users follow userID and how many
+	// userID follows.
+	CountFollows(userID uint) (followers, following int64, err error)
+	// Feed returns up to limit items for userID, starting after the
+	// cursor, or at the newest item if it is nil.
+	Feed(userID uint, after *Cursor, limit int) ([]FeedItem, error)
+}
+
+// FollowObserver is notified after a user follows or unfollows another.
+type FollowObserver interface {
+	FollowActivity(followerID, followeeID uint)
+}
+
+type repository struct {
+	observers []FollowObserver
+}
+
+// NewRepository creates a Repository that notifies the given observers of
+// follows and unfollows.
+func NewRepository(observers ...FollowObserver) Repository {
+	return &repository{observers: observers}
+}
+
+func (r *repository) notify(followerID, followeeID uint) {
+	for _, o := range r.observers {
+		o.FollowActivity(followerID, followeeID)
+	}
+}
+
+func (r *repository) Follow(followerID, followeeID uint) error {
+	follow := Follow{FollowerID: followerID, FolloweeID: followeeID}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		r.notify(followerID, followeeID)
+	}
+	return nil
+}
+
+func (r *repository) Unfollow(followerID, followeeID uint) error {
+	result := database.DB.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&Follow{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		r.notify(followerID, followeeID)
+	}
+	return nil
+}
+
+func (r *repository) FollowedUserIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Model(&Follow{}).Where("follower_id = ?", userID).Pluck("followee_id", &ids).Error
+	return ids, err
+}
+
+func (r *repository) ListFollowing(userID uint) ([]Author, error) {
+	var authors []Author
+	err := database.DB.Model(&user.User{}).
+		Select("users.id, users.display_name, users.avatar_url").
+		Joins("JOIN follows ON follows.followee_id = users.id").
+		Where("follows.follower_id = ?", userID).
+		Order("follows.created_at DESC, follows.id DESC").
+		Scan(&authors).Error
+	return authors, err
+}
+
+func (r *repository) CountFollows(userID uint) (int64, int64, error) {
+	var followers, following int64
+	if err := database.DB.Model(&Follow{}).Where("followee_id = ?", userID).Count(&followers).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := database.DB.Model(&Follow{}).Where("follower_id = ?", userID).Count(&following).Error; err != nil {
+		return 0, 0, err
+	}
+	return followers, following, nil
+}
+
+// feedQuery selects the feed entries of a user, newest first, computed when
+// the feed is read. Followed users who have since made their profile
+// private, or whose account is disabled or being deleted, are left out.
+const feedQuery = `
+	WITH followed AS (
+		SELECT follows.followee_id AS id FROM follows
+		JOIN users ON users.id = follows.followee_id
+		WHERE follows.follower_id = @user
+			AND users.deleted_at IS NULL AND users.disabled_at IS NULL AND users.delete_after IS NULL
+			AND COALESCE((users.preferences->>'public_profile')::boolean, false)
+	), entries AS (
+		SELECT 'save' AS type, articles.user_id, articles.id AS article_id, 0 AS score, articles.created_at AS at
+		FROM articles
+		WHERE articles.user_id IN (SELECT id FROM followed) AND articles.public AND articles.deleted_at IS NULL
+		UNION ALL
+		SELECT 'rating', ratings.user_id, ratings.article_id, ratings.score, ratings.updated_at
+		FROM ratings
+		JOIN articles ON articles.id = ratings.article_id AND articles.public AND articles.deleted_at IS NULL
+		WHERE ratings.user_id IN (SELECT id FROM followed) AND ratings.score >= @min AND ratings.deleted_at IS NULL
+	)
+	SELECT * FROM entries`
+
+func (r *repository) Feed(userID uint, after *Cursor, limit int) ([]FeedItem, error) {
+	args := map[string]interface{}{"user": userID, "min": minFeedRating, "limit": limit}
+	query := feedQuery
+	if after != nil {
+		query += " WHERE (at, article_id, type) < (@at, @article, @type)"
+		args["at"], args["article"], args["type"] = after.At, after.ArticleID, after.Type
+	}
+	query += " ORDER BY at DESC, article_id DESC, type DESC LIMIT @limit"
+
+	var entries []struct {
+		Type      string
+		UserID    uint
+		ArticleID uint
+		Score     int
+		At        time.Time
+	}
+	if err := database.DB.Raw(query, args).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return []FeedItem{}, nil
+	}
+
+	var articleIDs, userIDs []uint
+	for _, e := range entries {
+		articleIDs = append(articleIDs, e.ArticleID)
+		userIDs = append(userIDs, e.UserID)
+	}
+	var articles []article.Article
+	if err := database.DB.Where("id IN ?", articleIDs).Find(&articles).Error; err != nil {
+		return nil, err
+	}
+	var authors []Author
+	if err := database.DB.Model(&user.User{}).Select("id, display_name, avatar_url").Where("id IN ?", userIDs).Scan(&authors).Error; err != nil {
+		return nil, err
+	}
+	articlesByID := make(map[uint]article.Article, len(articles))
+	for _, a := range articles {
+		articlesByID[a.ID] = a
+	}
+	authorsByID := make(map[uint]Author, len(authors))
+	for _, a := range authors {
+		authorsByID[a.ID] = a
+	}
+
+	items := make([]FeedItem, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, FeedItem{
+			Type:    e.Type,
+			At:      e.At,
+			User:    authorsByID[e.UserID],
+			Article: articlesByID[e.ArticleID],
+			Score:   e.Score,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,148 @@
+package user
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/config"
+	"github.com/cheildo/deeli-api/pkg/mailer"
+)
+
+const (
+	verificationTTL = 48 * time.Hour
+	resetTTL        = time.Hour
+)
+
+// emailTemplate is a subject and body rendered with the link to send.
+type emailTemplate struct {
+	subject string
+	body    *template.Template
+}
+
+var verificationEmail = emailTemplate{
+	subject: "Confirm your email address",
+	body: template.Must(template.New("verify").Parse(`Hi,
+
+Please confirm that {{.Email}} is your email address by opening this link:
+
+{{.Link}}
+
+The link expires in {{.Expiry}}. If you didn't create a Deeli account, you can ignore this email.
+`)),
+}
+
+var resetEmail = emailTemplate{
+	subject: "Reset your password",
+	body: template.Must(template.New("reset").Parse(`Hi,
+
+Someone asked to reset the password for the Deeli account {{.Email}}. To choose a new password, open this link:
+
+{{.Link}}
+
+The link expires in {{.Expiry}} and works once. If you didn't ask for this, you can ignore this email; your password hasn't changed.
+`)),
+}
+
+// Emails sends the account emails that carry action links.
+type Emails struct {
+	mailer  mailer.Mailer
+	tokens  *auth.ActionTokens
+	baseURL string
+	// pending counts the emails being sent in the background.
+	pending sync.WaitGroup
+}
+
+func NewEmails(m mailer.Mailer, tokens *auth.ActionTokens, baseURL string) *Emails {
+	return &Emails{mailer: m, tokens: tokens, baseURL: baseURL}
+}
+
+// NewEmailsFromConfig builds links on APP_BASE_URL, the web app's address.
+func NewEmailsFromConfig(m mailer.Mailer, tokens *auth.ActionTokens) *Emails {
+	return NewEmails(m, tokens, config.GetString("APP_BASE_URL", "http://localhost:3000"))
+}
+
+// SendVerification emails the user a link to confirm their address.
+func (e *Emails) SendVerification(user *User) error {
+	return e.send(user, verificationEmail, auth.PurposeVerifyEmail, user.verificationState(), "/verify-email", verificationTTL)
+}
+
+// SendPasswordReset emails the user a link to choose a new password.
+func (e *Emails) SendPasswordReset(user *User) error {
+	return e.send(user, resetEmail, auth.PurposeResetPassword, user.resetState(), "/reset-password", resetTTL)
+}
+
+// inBackground sends an email without holding up the response, so that
+// endpoints which mail only existing accounts take as long for unknown
+// emails. Failures are logged.
+func (e *Emails) inBackground(send func() error) {
+	e.pending.Add(1)
+	go func() {
+		defer e.pending.Done()
+		if err := send(); err != nil {
+			log.Printf("Failed to send account email: %v", err)
+		}
+	}()
+}
+
+// Wait waits for the emails being sent in the background.
+func (e *Emails) Wait() {
+	e.pending.Wait()
+}
+
+func (e *Emails) send(user *User, tmpl emailTemplate, purpose, state, path string, ttl time.Duration) error {
+	token, err := e.tokens.Issue(purpose, user.ID, state, ttl)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	err = tmpl.body.Execute(&body, map[string]string{
+		"Email":  user.Email,
+		"Link":   e.baseURL + path + "?token=" + token,
+		"Expiry": humanizeTTL(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.mailer.Send(mailer.Message{To: user.Email, Subject: tmpl.subject, Body: body.String()}); err != nil {
+		log.Printf("Failed to send %q email to user %d: %v", tmpl.subject, user.ID, err)
+		return err
+	}
+	return nil
+}
+
+// verify checks an emailed token against the user's current state.
+func (e *Emails) verify(repo Repository, token, purpose string) (*User, error) {
+	var user *User
+	_, err := e.tokens.Verify(token, purpose, func(userID uint) (string, error) {
+		u, err := repo.GetUserByID(userID)
+		if err != nil {
+			return "", err
+		}
+		user = u
+		if purpose == auth.PurposeResetPassword {
+			return u.resetState(), nil
+		}
+		return u.verificationState(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// humanizeTTL renders whole hours or days, e.g. "1 hour" or "2 days".
+func humanizeTTL(d time.Duration) string {
+	n, unit := int(d/time.Hour), "hour"
+	if n >= 48 && n%24 == 0 {
+		n, unit = n/24, "day"
+	}
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -1,19 +1,47 @@
 package user
 
 import (
+	"encoding/json"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/config"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	repo Repository
+	repo                 Repository
+	tokens               *auth.TokenService
+	emails               *Emails
+	mfa                  *MFA
+	throttle             *auth.LoginThrottle
+	requireVerifiedEmail bool
+	deletionGracePeriod  time.Duration
+	reauthWindow         time.Duration
 }
 
-func NewHandler(repo Repository) *Handler {
-	return &Handler{repo: repo}
+// NewHandler creates the user handler. With REQUIRE_EMAIL_VERIFICATION set,
+// users can't log in until they have verified their email address. Deleted
+// accounts can be restored for ACCOUNT_DELETION_GRACE_PERIOD (14 days by
+// default). Users without a password confirm deleting their account by
+// having logged in within ACCOUNT_REAUTH_WINDOW (10 minutes by default).
+func NewHandler(repo Repository, tokens *auth.TokenService, emails *Emails, mfa *MFA, throttle *auth.LoginThrottle) *Handler {
+	return &Handler{
+		repo:                 repo,
+		tokens:               tokens,
+		emails:               emails,
+		mfa:                  mfa,
+		throttle:             throttle,
+		requireVerifiedEmail: config.GetBool("REQUIRE_EMAIL_VERIFICATION", false),
+		deletionGracePeriod:  config.GetDuration("ACCOUNT_DELETION_GRACE_PERIOD", 14*24*time.Hour),
+		reauthWindow:         config.GetDuration("ACCOUNT_REAUTH_WINDOW", 10*time.Minute),
+	}
 }
 
 // SignupRequest defines the structure for user registration
@@ -40,6 +68,8 @@ func (h *Handler) Signup(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 		return
 	}
+	// The account exists either way; a failed email can be resent.
+	_ = h.emails.SendVerification(user)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
@@ -50,17 +80,23 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// Login checks the email and password. Failed attempts slow down further
+// ones for the account and the client IP, and are recorded for auditing.
 func (h *Handler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !h.allowAttempt(c, req.Email, nil) {
+		return
+	}
 
 	user, err := h.repo.GetUserByEmail(req.Email)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			auth.CheckDummyPassword(req.Password)
+			h.loginFailed(c, req.Email, nil, FailureUnknownEmail)
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -68,17 +104,154 @@ func (h *Handler) Login(c *gin.Context) {
 	}
 
 	if !auth.CheckPasswordHash(req.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		h.loginFailed(c, req.Email, &user.ID, FailureWrongPassword)
+		return
+	}
+	h.upgradePasswordHash(user, req.Password)
+	h.CompleteLogin(c, user)
+}
+
+// CompleteLogin finishes a login once the user has proven who they are,
+// with a password or an external identity: it asks for the second factor
+// if 2FA is on and otherwise starts a session.
+func (h *Handler) CompleteLogin(c *gin.Context, user *User) {
+	h.completeLogin(c, user, false)
+}
+
+// completeLogin is CompleteLogin, also cancelling a scheduled deletion
+// when restoring. The deletion is only cancelled once the second factor,
+// if any, has been given too.
+func (h *Handler) completeLogin(c *gin.Context, user *User, restoring bool) {
+	if user.Disabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		return
+	}
+	if user.PendingDeletion() && !restoring {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":        "Account scheduled for deletion",
+			"delete_after": user.DeleteAfter.UTC().Format(time.RFC3339),
+		})
+		return
+	}
+	if h.requireVerifiedEmail && !user.EmailVerified() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+	if user.MFAEnabled() {
+		challenge := h.mfa.Challenge
+		if restoring {
+			challenge = h.mfa.RestoreChallenge
+		}
+		token, err := challenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": "totp", "mfa_token": token})
 		return
 	}
 
-	token, err := auth.GenerateJWT(user.ID)
+	if restoring && !h.cancelDeletion(c, user) {
+		return
+	}
+	h.loginSucceeded(c, user)
+}
+
+// cancelDeletion cancels the user's scheduled deletion, if any, answering
+// 500 if that fails.
+func (h *Handler) cancelDeletion(c *gin.Context, user *User) bool {
+	if !user.PendingDeletion() {
+		return true
+	}
+	if err := h.repo.ScheduleDeletion(user.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return false
+	}
+	user.DeleteAfter = nil
+	return true
+}
+
+// upgradePasswordHash rehashes a correct password whose stored hash is bcrypt
+// or uses outdated argon2id parameters. Failure only delays the upgrade.
+func (h *Handler) upgradePasswordHash(user *User, password string) {
+	if !auth.NeedsRehash(user.Password) {
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		return
+	}
+	if err := h.repo.UpdatePassword(user.ID, hash); err != nil {
+		log.Printf("Failed to store rehashed password for user %d: %v", user.ID, err)
+		return
+	}
+	user.Password = hash
+}
+
+// allowAttempt checks the throttle, answering 429 with Retry-After if the
+// client must wait.
+func (h *Handler) allowAttempt(c *gin.Context, email string, userID *uint) bool {
+	wait, err := h.throttle.Check(email, c.ClientIP())
+	if err != nil {
+		log.Printf("Login throttle check failed: %v", err)
+		return true
+	}
+	if wait <= 0 {
+		return true
+	}
+	h.audit(c, email, userID, FailureThrottled)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+	return false
+}
+
+// loginFailed counts a failed attempt and answers 401. Unknown emails and
+// wrong passwords get the same answer.
+func (h *Handler) loginFailed(c *gin.Context, email string, userID *uint, reason string) {
+	if err := h.throttle.Failure(email, c.ClientIP()); err != nil {
+		log.Printf("Failed to record failed login: %v", err)
+	}
+	h.audit(c, email, userID, reason)
+	if reason == FailureInvalidCode {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidMFACode.Error()})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+func (h *Handler) audit(c *gin.Context, email string, userID *uint, reason string) {
+	failure := &LoginFailure{
+		Email:     email,
+		UserID:    userID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+	}
+	if err := h.repo.RecordLoginFailure(failure); err != nil {
+		log.Printf("Failed to audit failed login: %v", err)
+	}
+}
+
+// loginSucceeded clears the account's failures and starts a session.
+func (h *Handler) loginSucceeded(c *gin.Context, user *User) {
+	// Checked again for logins that went through a second factor after
+	// the account was disabled.
+	if user.Disabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		return
+	}
+	if err := h.throttle.Success(user.Email); err != nil {
+		log.Printf("Failed to reset login throttle for user %d: %v", user.ID, err)
+	}
+
+	pair, err := h.tokens.IssueTokens(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, auth.TokenResponse(pair))
 }
 
 func (h *Handler) GetMe(c *gin.Context) {
@@ -94,6 +267,495 @@ func (h *Handler) GetMe(c *gin.Context) {
 		return
 	}
 
-	// Return user info but not the password hash
-	c.JSON(http.StatusOK, gin.H{"id": user.ID, "email": user.Email})
+	c.JSON(http.StatusOK, meResponse(user))
+}
+
+// meResponse is the user's view of their own account, without the password
+// hash or 2FA secret.
+func meResponse(user *User) gin.H {
+	return gin.H{
+		"id":             user.ID,
+		"email":          user.Email,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified(),
+		"mfa_enabled":    user.MFAEnabled(),
+		"display_name":   user.DisplayName,
+		"avatar_url":     user.AvatarURL,
+		"bio":            user.Bio,
+		"timezone":       user.Timezone,
+		"locale":         user.Locale,
+		"preferences":    user.Preferences,
+	}
+}
+
+// UpdateMeRequest defines the JSON for PATCH /me. Only the fields present
+// are changed.
+type UpdateMeRequest struct {
+	ProfilePatch
+	Preferences *PreferencesPatch `json:"preferences"`
+}
+
+// UpdateMe handles PATCH /me. Unknown fields are refused so that a client
+// notices when it sends something this server doesn't understand.
+func (h *Handler) UpdateMe(c *gin.Context) {
+	var req UpdateMeRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := req.ProfilePatch.Apply(user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Preferences != nil {
+		if err := req.Preferences.Apply(&user.Preferences); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := h.repo.UpdateProfile(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, meResponse(user))
+}
+
+// GetPreferences handles GET /me/preferences
+func (h *Handler) GetPreferences(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user.Preferences)
+}
+
+// EmailRequest defines the JSON for requests that only carry an email.
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPassword handles POST /password/forgot. It answers the same way,
+// and as quickly, whether or not the email belongs to an account.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user, err := h.repo.GetUserByEmail(req.Email); err == nil {
+		h.emails.inBackground(func() error { return h.emails.SendPasswordReset(user) })
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+// ResetPasswordRequest defines the JSON for choosing a new password.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// ResetPassword handles POST /password/reset. It logs the user out of every
+// session.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.emails.verify(h.repo, req.Token, auth.PurposeResetPassword)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := h.repo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if _, err := h.tokens.RevokeAllSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions for user %d after password reset: %v", user.ID, err)
+	}
+	// Receiving the reset link proves the address works.
+	if !user.EmailVerified() {
+		if err := h.repo.MarkEmailVerified(user.ID, time.Now()); err != nil {
+			log.Printf("Failed to mark email verified for user %d: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// VerifyEmailRequest defines the JSON for confirming an email address.
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail handles POST /email/verify
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.emails.verify(h.repo, req.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err := h.repo.MarkEmailVerified(user.ID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification handles POST /email/verify/resend. Like
+// ForgotPassword it doesn't reveal whether the account exists.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user, err := h.repo.GetUserByEmail(req.Email); err == nil && !user.EmailVerified() {
+		h.emails.inBackground(func() error { return h.emails.SendVerification(user) })
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account needs verifying, a link has been sent"})
+}
+
+// LoginMFARequest defines the JSON for the second step of login: the
+// mfa_token from Login and either a TOTP code or a recovery code.
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginMFA handles POST /login/mfa, for logins and account restores. Wrong
+// codes count as failed logins.
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, restoring, err := h.mfa.ParseChallenge(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.allowAttempt(c, user.Email, &user.ID) {
+		return
+	}
+
+	if err := h.mfa.VerifySecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+		if err == ErrInvalidMFACode {
+			h.loginFailed(c, user.Email, &user.ID, FailureInvalidCode)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if restoring && !h.cancelDeletion(c, user) {
+		return
+	}
+	h.loginSucceeded(c, user)
+}
+
+// currentUser loads the authenticated user, writing an error response if
+// that fails.
+func (h *Handler) currentUser(c *gin.Context) (*User, bool) {
+	user, err := h.repo.GetUserByID(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// EnrollTOTP handles POST /me/mfa/totp, starting enrollment. The secret
+// and otpauth URI go into the user's authenticator app.
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(user)
+	if err != nil {
+		if err == ErrMFAAlreadyEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri})
+}
+
+// MFACodeRequest defines the JSON for actions confirmed with a TOTP code.
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ConfirmTOTP handles POST /me/mfa/totp/confirm, enabling two-factor login
+// and returning the recovery codes. They are only shown once.
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.Confirm(user, req.Code)
+	h.respondRecoveryCodes(c, codes, err)
+}
+
+// RegenerateRecoveryCodes handles POST /me/mfa/recovery-codes
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(user, req.Code)
+	h.respondRecoveryCodes(c, codes, err)
+}
+
+func (h *Handler) respondRecoveryCodes(c *gin.Context, codes []string, err error) {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	case ErrInvalidMFACode:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case ErrMFAAlreadyEnabled, ErrMFANotEnrolled:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// DisableTOTPRequest defines the JSON for turning two-factor
+// authentication off. Accounts without a password leave it empty and
+// confirm by having logged in recently instead.
+type DisableTOTPRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTOTP handles DELETE /me/mfa/totp. Turning the second factor off
+// takes the second factor too, so a stolen session or password isn't
+// enough; attempts count against the login throttle.
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	var req DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !h.allowAttempt(c, user.Email, &user.ID) {
+		return
+	}
+	if user.Password == "" {
+		if !h.recentlyLoggedIn(c) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Log in again to confirm turning off two-factor authentication", "reauth_required": true})
+			return
+		}
+	} else if !auth.CheckPasswordHash(req.Password, user.Password) {
+		h.loginFailed(c, user.Email, &user.ID, FailureWrongPassword)
+		return
+	}
+	if user.MFAEnabled() {
+		if err := h.mfa.VerifySecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+			if err == ErrInvalidMFACode {
+				h.loginFailed(c, user.Email, &user.ID, FailureInvalidCode)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	if err := h.mfa.Disable(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ChangePasswordRequest defines the JSON for changing the password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ChangePassword handles POST /me/password. Every other session is logged
+// out; the current one stays signed in.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !auth.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := h.repo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	sessionID := c.MustGet("sessionID").(uint)
+	if _, err := h.tokens.RevokeOtherSessions(user.ID, sessionID); err != nil {
+		log.Printf("Failed to revoke sessions for user %d after password change: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// DeleteAccountRequest defines the JSON for deleting the account. Users
+// with 2FA confirm with a code as well as the password. Users who only log
+// in through an identity provider have no password and leave it out.
+type DeleteAccountRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DeleteAccount handles DELETE /me. The account is locked and every session
+// ended at once; the data is erased once the grace period is over, unless
+// the user restores the account first.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.Password == "" {
+		if !h.recentlyLoggedIn(c) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Log in again to confirm deleting your account", "reauth_required": true})
+			return
+		}
+	} else if !auth.CheckPasswordHash(req.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if user.MFAEnabled() {
+		if err := h.mfa.VerifySecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidMFACode.Error()})
+			return
+		}
+	}
+
+	deleteAfter := time.Now().Add(h.deletionGracePeriod)
+	if err := h.repo.ScheduleDeletion(user.ID, &deleteAfter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule deletion"})
+		return
+	}
+	if _, err := h.tokens.RevokeAllSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions for user %d after deletion request: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Account scheduled for deletion; log in through POST /account/restore to undo",
+		"delete_after": deleteAfter.UTC().Format(time.RFC3339),
+	})
+}
+
+// recentlyLoggedIn reports whether the current session was started within
+// the reauthentication window, standing in for a password the user
+// doesn't have.
+func (h *Handler) recentlyLoggedIn(c *gin.Context) bool {
+	startedAt, err := h.tokens.SessionStartedAt(c.MustGet("sessionID").(uint))
+	if err != nil {
+		log.Printf("Failed to load session for reauthentication: %v", err)
+		return false
+	}
+	return time.Since(startedAt) < h.reauthWindow
+}
+
+// RestoreAccount handles POST /account/restore. It cancels a scheduled
+// deletion and logs the user in; it checks credentials like Login, and with
+// 2FA on the deletion is cancelled by POST /login/mfa.
+func (h *Handler) RestoreAccount(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.allowAttempt(c, req.Email, nil) {
+		return
+	}
+
+	user, err := h.repo.GetUserByEmail(req.Email)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			auth.CheckDummyPassword(req.Password)
+			h.loginFailed(c, req.Email, nil, FailureUnknownEmail)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !auth.CheckPasswordHash(req.Password, user.Password) {
+		h.loginFailed(c, req.Email, &user.ID, FailureWrongPassword)
+		return
+	}
+
+	h.completeLogin(c, user, true)
 }
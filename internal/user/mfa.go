@@ -0,0 +1,189 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+)
+
+const (
+	recoveryCodeCount = 10
+	// challengeTTL is how long a user has to enter their code after their
+	// password.
+	challengeTTL = 5 * time.Minute
+)
+
+var (
+	ErrInvalidMFACode    = errors.New("invalid code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor enrollment not started")
+	ErrInvalidMFAToken   = errors.New("invalid or expired MFA token")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFA handles TOTP enrollment, recovery codes and the second step of login.
+type MFA struct {
+	repo       Repository
+	challenges *auth.ActionTokens
+	issuer     string
+	// Now is the clock codes are checked against; tests replace it.
+	Now func() time.Time
+}
+
+// NewMFA creates the MFA service. issuer names the account in
+// authenticator apps.
+func NewMFA(repo Repository, challenges *auth.ActionTokens, issuer string) *MFA {
+	return &MFA{repo: repo, challenges: challenges, issuer: issuer, Now: time.Now}
+}
+
+// Enroll starts enrollment with a new secret, returning it and the
+// otpauth URI for the user's authenticator app.
+func (m *MFA) Enroll(user *User) (string, string, error) {
+	if user.MFAEnabled() {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := m.repo.SetTOTPSecret(user.ID, secret); err != nil {
+		return "", "", err
+	}
+	return secret, auth.TOTPURI(m.issuer, user.Email, secret), nil
+}
+
+// Confirm enables two-factor login once the user proves their app works
+// with a first code, and returns their recovery codes.
+func (m *MFA) Confirm(user *User, code string) ([]string, error) {
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	now := m.Now()
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, now, user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if err := m.repo.EnableTOTP(user.ID, now, step); err != nil {
+		return nil, err
+	}
+	return m.replaceRecoveryCodes(user.ID)
+}
+
+// Disable turns two-factor login off and discards the recovery codes.
+func (m *MFA) Disable(user *User) error {
+	return m.repo.DisableTOTP(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, after
+// checking a current TOTP code.
+func (m *MFA) RegenerateRecoveryCodes(user *User, code string) ([]string, error) {
+	if !user.MFAEnabled() {
+		return nil, ErrMFANotEnrolled
+	}
+	if err := m.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+	return m.replaceRecoveryCodes(user.ID)
+}
+
+// Challenge returns a short-lived token standing for a correct password,
+// to be exchanged with a second factor at POST /login/mfa.
+func (m *MFA) Challenge(user *User) (string, error) {
+	return m.challenges.Issue(auth.PurposeMFALogin, user.ID, user.challengeState(), challengeTTL)
+}
+
+// RestoreChallenge is a Challenge issued by POST /account/restore:
+// completing it also cancels the account's scheduled deletion.
+func (m *MFA) RestoreChallenge(user *User) (string, error) {
+	return m.challenges.Issue(auth.PurposeMFARestore, user.ID, user.challengeState(), challengeTTL)
+}
+
+// ParseChallenge checks a token from Challenge or RestoreChallenge and
+// returns the user logging in, and whether they are restoring their
+// account.
+func (m *MFA) ParseChallenge(token string) (*User, bool, error) {
+	for _, purpose := range []string{auth.PurposeMFALogin, auth.PurposeMFARestore} {
+		var user *User
+		_, err := m.challenges.Verify(token, purpose, func(userID uint) (string, error) {
+			u, err := m.repo.GetUserByID(userID)
+			if err != nil {
+				return "", err
+			}
+			user = u
+			return u.challengeState(), nil
+		})
+		if err == nil && user.MFAEnabled() {
+			return user, purpose == auth.PurposeMFARestore, nil
+		}
+	}
+	return nil, false, ErrInvalidMFAToken
+}
+
+// VerifySecondFactor checks either a TOTP code or a recovery code. Both
+// are spent once accepted.
+func (m *MFA) VerifySecondFactor(user *User, code, recoveryCode string) error {
+	if recoveryCode == "" {
+		return m.verifyCode(user, code)
+	}
+	used, err := m.repo.UseRecoveryCode(user.ID, hashRecoveryCode(recoveryCode), m.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// verifyCode checks a TOTP code and records its step so it can't be used
+// again, even by a concurrent request.
+func (m *MFA) verifyCode(user *User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, m.Now(), user.TOTPLastStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	advanced, err := m.repo.AdvanceTOTPStep(user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (m *MFA) replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err := m.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, dashes and spaces
+// so the user can type it loosely.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
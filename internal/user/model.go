@@ -1,9 +1,127 @@
 package user
 
-import "gorm.io/gorm"
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Email    string `gorm:"uniqueIndex;not null"`
+	// Email is stored normalized; the index keeps addresses differing
+	// only in case from being registered twice.
+	Email    string `gorm:"uniqueIndex;index:idx_users_lower_email,unique,expression:lower(email);not null"`
 	Password string `gorm:"not null"`
+	Role     string `gorm:"not null;default:'user'"`
+	// Profile fields, shown to the user and, with a public profile, to
+	// others.
+	DisplayName string
+	AvatarURL   string
+	Bio         string
+	Timezone    string      `gorm:"not null;default:'UTC'"`
+	Locale      string      `gorm:"not null;default:'en'"`
+	Preferences Preferences `gorm:"type:jsonb;not null;default:'{}'"`
+	// DisabledAt is set when an admin disables the account; disabled users
+	// can't log in or use existing tokens.
+	DisabledAt *time.Time
+	// DeleteAfter is set when the user asks for their account to be
+	// deleted. Until then the account is locked but can be restored; after
+	// it, the worker erases it.
+	DeleteAfter     *time.Time
+	EmailVerifiedAt *time.Time
+	// TOTPSecret is set once enrollment starts; two-factor login is only
+	// required after TOTPEnabledAt is set by confirming a first code.
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep is the time step of the last accepted code, so codes
+	// can't be replayed.
+	TOTPLastStep int64 `gorm:"not null;default:0"`
+}
+
+// RecoveryCode is a hashed one-time code that stands in for a TOTP code
+// when the user has lost their authenticator.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null"`
+	CodeHash string `gorm:"not null"`
+	UsedAt   *time.Time
+}
+
+// Identity links an account at an external OpenID Connect provider to a
+// user. Subject is the provider's stable ID for the account; the email can
+// change there.
+type Identity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null"`
+	Provider string `gorm:"uniqueIndex:idx_identity_subject;not null"`
+	Subject  string `gorm:"uniqueIndex:idx_identity_subject;not null"`
+	Email    string
+}
+
+// NormalizeEmail trims and lowercases an email address, so addresses
+// differing only in case or surrounding space belong to the same account.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// EmailVerified reports whether the user has confirmed their email address.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// LoginFailure is an audit record of a failed login attempt. UserID is set
+// when the email belongs to an account.
+type LoginFailure struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Email     string `gorm:"index;not null"`
+	UserID    *uint  `gorm:"index"`
+	IP        string `gorm:"index"`
+	UserAgent string
+	Reason    string `gorm:"not null"`
+}
+
+// Reasons a login failed.
+const (
+	FailureUnknownEmail  = "unknown_email"
+	FailureWrongPassword = "wrong_password"
+	FailureThrottled     = "throttled"
+	FailureInvalidCode   = "invalid_mfa_code"
+)
+
+// Disabled reports whether an admin has disabled the account.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// PendingDeletion reports whether the user has asked for their account to
+// be deleted.
+func (u *User) PendingDeletion() bool {
+	return u.DeleteAfter != nil
+}
+
+// MFAEnabled reports whether logging in requires a second factor.
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// verificationState is what an email verification token is bound to.
+func (u *User) verificationState() string {
+	if u.EmailVerified() {
+		return u.Email + ":verified"
+	}
+	return u.Email + ":unverified"
+}
+
+// resetState is what a password reset token is bound to. Changing the
+// password changes the hash, so a reset link works once.
+func (u *User) resetState() string {
+	return u.Password
+}
+
+// challengeState is what an MFA login challenge is bound to, so that it
+// stops working if the password or second factor changes.
+func (u *User) challengeState() string {
+	return u.Password + ":" + u.TOTPSecret
 }
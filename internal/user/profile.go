@@ -0,0 +1,184 @@
+package user
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	// Timezones are validated against the embedded database so that hosts
+	// without tzdata behave the same.
+	_ "time/tzdata"
+
+	"golang.org/x/text/language"
+)
+
+// PreferencesVersion is the current version of the preferences document.
+// Fields are only ever added, each with a default, so a document stored
+// by an older version reads as the current version with the new fields at
+// their defaults. Clients send the version they were written against and
+// are refused if it is newer than the server's.
+const PreferencesVersion = 1
+
+// Sort orders for the article list.
+const (
+	SortNewest = "newest"
+	SortOldest = "oldest"
+	SortTitle  = "title"
+	SortRating = "rating"
+)
+
+// Digest frequencies.
+const (
+	DigestNever  = "never"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var ErrUnsupportedPreferencesVersion = errors.New("unsupported preferences version")
+
+// Preferences are the user's settings, stored as one JSON document.
+type Preferences struct {
+	Version               int    `json:"version"`
+	DefaultSort           string `json:"default_sort"`
+	ReadingFontSize       int    `json:"reading_font_size"`
+	DigestFrequency       string `json:"digest_frequency"`
+	RecommendationsOptOut bool   `json:"recommendations_opt_out"`
+	PublicProfile         bool   `json:"public_profile"`
+}
+
+// DefaultPreferences are the preferences of a user who hasn't changed any.
+func DefaultPreferences() Preferences {
+	return Preferences{
+		Version:         PreferencesVersion,
+		DefaultSort:     SortNewest,
+		ReadingFontSize: 16,
+		DigestFrequency: DigestWeekly,
+	}
+}
+
+// Scan implements sql.Scanner, filling fields missing from the stored
+// document with their defaults.
+func (p *Preferences) Scan(value interface{}) error {
+	*p = DefaultPreferences()
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Preferences", value)
+	}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return err
+	}
+	p.Version = PreferencesVersion
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (p Preferences) Value() (driver.Value, error) {
+	p.Version = PreferencesVersion
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// PreferencesPatch changes some preferences; nil fields are left alone.
+type PreferencesPatch struct {
+	Version               *int    `json:"version"`
+	DefaultSort           *string `json:"default_sort" binding:"omitempty,oneof=newest oldest title rating"`
+	ReadingFontSize       *int    `json:"reading_font_size" binding:"omitempty,min=10,max=32"`
+	DigestFrequency       *string `json:"digest_frequency" binding:"omitempty,oneof=never daily weekly"`
+	RecommendationsOptOut *bool   `json:"recommendations_opt_out"`
+	PublicProfile         *bool   `json:"public_profile"`
+}
+
+// Apply applies the patch to p.
+func (patch *PreferencesPatch) Apply(p *Preferences) error {
+	if patch.Version != nil && *patch.Version > PreferencesVersion {
+		return ErrUnsupportedPreferencesVersion
+	}
+	if patch.DefaultSort != nil {
+		p.DefaultSort = *patch.DefaultSort
+	}
+	if patch.ReadingFontSize != nil {
+		p.ReadingFontSize = *patch.ReadingFontSize
+	}
+	if patch.DigestFrequency != nil {
+		p.DigestFrequency = *patch.DigestFrequency
+	}
+	if patch.RecommendationsOptOut != nil {
+		p.RecommendationsOptOut = *patch.RecommendationsOptOut
+	}
+	if patch.PublicProfile != nil {
+		p.PublicProfile = *patch.PublicProfile
+	}
+	return nil
+}
+
+// ProfilePatch changes some profile fields; nil fields are left alone and
+// empty strings clear a field.
+type ProfilePatch struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=50"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,max=2048"`
+	Bio         *string `json:"bio" binding:"omitempty,max=500"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+}
+
+// Apply validates the fields gin's binding can't check and applies them
+// to the user.
+func (patch *ProfilePatch) Apply(u *User) error {
+	if patch.AvatarURL != nil && *patch.AvatarURL != "" {
+		parsed, err := url.Parse(*patch.AvatarURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return errors.New("avatar_url must be an http or https URL")
+		}
+	}
+	if patch.Timezone != nil {
+		if _, err := time.LoadLocation(*patch.Timezone); err != nil || *patch.Timezone == "" || *patch.Timezone == "Local" {
+			return fmt.Errorf("unknown timezone %q", *patch.Timezone)
+		}
+	}
+	locale := ""
+	if patch.Locale != nil {
+		tag, err := language.Parse(*patch.Locale)
+		if err != nil {
+			return fmt.Errorf("invalid locale %q", *patch.Locale)
+		}
+		locale = tag.String()
+	}
+
+	if patch.DisplayName != nil {
+		u.DisplayName = *patch.DisplayName
+	}
+	if patch.AvatarURL != nil {
+		u.AvatarURL = *patch.AvatarURL
+	}
+	if patch.Bio != nil {
+		u.Bio = *patch.Bio
+	}
+	if patch.Timezone != nil {
+		u.Timezone = *patch.Timezone
+	}
+	if patch.Locale != nil {
+		u.Locale = locale
+	}
+	return nil
+}
+
+// Location returns the user's timezone, UTC if they haven't set one.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
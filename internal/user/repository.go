@@ -1,11 +1,57 @@
 package user
 
-import "github.com/cheildo/deeli-api/pkg/database"
+import (
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+)
 
 type Repository interface {
 	CreateUser(user *User) error
+	// GetUserByEmail finds the user with the email, ignoring case and
+	// surrounding space.
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id uint) (*User, error)
+	UpdatePassword(id uint, hash string) error
+	MarkEmailVerified(id uint, at time.Time) error
+	SetTOTPSecret(id uint, secret string) error
+	EnableTOTP(id uint, at time.Time, step int64) error
+	DisableTOTP(id uint) error
+	// AdvanceTOTPStep records step as the last accepted one, returning
+	// false if a code for this or a later step was already accepted.
+	AdvanceTOTPStep(id uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, hashes []string) error
+	// UseRecoveryCode marks an unused code as used, returning false if the
+	// user has no such unused code.
+	UseRecoveryCode(userID uint, hash string, at time.Time) (bool, error)
+	RecordLoginFailure(failure *LoginFailure) error
+	GetIdentity(provider, subject string) (*Identity, error)
+	CreateIdentity(identity *Identity) error
+	// CreateUserWithIdentity creates a user and links the identity to it
+	// in one transaction.
+	CreateUserWithIdentity(user *User, identity *Identity) error
+	// LookupAccount implements auth.AccountLookup.
+	LookupAccount(userID uint) (*auth.Account, error)
+	// ListUsers returns a page of users whose email contains query, newest
+	// first, and the number of matching users.
+	ListUsers(query string, page, limit int) ([]User, int64, error)
+	SetRole(id uint, role string) error
+	// ListUserIDsByRole returns the IDs of the users with the role.
+	ListUserIDsByRole(role string) ([]uint, error)
+	// SetDisabled disables the user at the given time, or enables them
+	// again if at is nil.
+	SetDisabled(id uint, at *time.Time) error
+	// ScheduleDeletion sets when the account is erased, or cancels the
+	// deletion if at is nil.
+	ScheduleDeletion(id uint, at *time.Time) error
+	// UpdateProfile saves the user's profile fields and preferences.
+	UpdateProfile(user *User) error
+	// RecommendationSettings returns whether the user has opted out of
+	// recommendations, and their timezone.
+	RecommendationSettings(userID uint) (bool, *time.Location, error)
 }
 
 type repository struct{}
@@ -15,12 +61,15 @@ func NewRepository() Repository {
 }
 
 func (r *repository) CreateUser(user *User) error {
+	user.Email = NormalizeEmail(user.Email)
 	return database.DB.Create(user).Error
 }
 
 func (r *repository) GetUserByEmail(email string) (*User, error) {
 	var user User
-	err := database.DB.Where("email = ?", email).First(&user).Error
+	// Matched on lower(email) so accounts created before emails were
+	// normalized are still found.
+	err := database.DB.Where("lower(email) = ?", NormalizeEmail(email)).First(&user).Error
 	return &user, err
 }
 
@@ -29,3 +78,148 @@ func (r *repository) GetUserByID(id uint) (*User, error) {
 	err := database.DB.First(&user, id).Error
 	return &user, err
 }
+
+func (r *repository) UpdatePassword(id uint, hash string) error {
+	return database.DB.Model(&User{}).Where("id = ?", id).Update("password", hash).Error
+}
+
+func (r *repository) MarkEmailVerified(id uint, at time.Time) error {
+	return database.DB.Model(&User{}).Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", at).Error
+}
+
+func (r *repository) SetTOTPSecret(id uint, secret string) error {
+	return database.DB.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":     secret,
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error
+}
+
+func (r *repository) EnableTOTP(id uint, at time.Time, step int64) error {
+	return database.DB.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_enabled_at": at,
+		"totp_last_step":  step,
+	}).Error
+}
+
+func (r *repository) DisableTOTP(id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+	})
+}
+
+func (r *repository) AdvanceTOTPStep(id uint, step int64) (bool, error) {
+	result := database.DB.Model(&User{}).Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *repository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]RecoveryCode, len(hashes))
+		for i, h := range hashes {
+			codes[i] = RecoveryCode{UserID: userID, CodeHash: h}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *repository) UseRecoveryCode(userID uint, hash string, at time.Time) (bool, error) {
+	result := database.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *repository) RecordLoginFailure(failure *LoginFailure) error {
+	return database.DB.Create(failure).Error
+}
+
+func (r *repository) GetIdentity(provider, subject string) (*Identity, error) {
+	var identity Identity
+	err := database.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	return &identity, err
+}
+
+func (r *repository) CreateIdentity(identity *Identity) error {
+	return database.DB.Create(identity).Error
+}
+
+func (r *repository) CreateUserWithIdentity(user *User, identity *Identity) error {
+	user.Email = NormalizeEmail(user.Email)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+func (r *repository) LookupAccount(userID uint) (*auth.Account, error) {
+	var user User
+	err := database.DB.Select("id", "role", "disabled_at", "delete_after").First(&user, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Account{Role: user.Role, Disabled: user.Disabled(), PendingDeletion: user.PendingDeletion()}, nil
+}
+
+func (r *repository) ListUsers(query string, page, limit int) ([]User, int64, error) {
+	db := database.DB.Model(&User{})
+	if query != "" {
+		// Escape LIKE wildcards so the query matches literally.
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+		db = db.Where("email ILIKE ?", "%"+escaped+"%")
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []User
+	err := db.Order("id desc").Offset((page - 1) * limit).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+func (r *repository) SetRole(id uint, role string) error {
+	return database.DB.Model(&User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+func (r *repository) ListUserIDsByRole(role string) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Model(&User{}).Where("role = ?", role).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *repository) SetDisabled(id uint, at *time.Time) error {
+	return database.DB.Model(&User{}).Where("id = ?", id).Update("disabled_at", at).Error
+}
+
+func (r *repository) ScheduleDeletion(id uint, at *time.Time) error {
+	return database.DB.Model(&User{}).Where("id = ?", id).Update("delete_after", at).Error
+}
+
+func (r *repository) UpdateProfile(user *User) error {
+	return database.DB.Model(user).
+		Select("display_name", "avatar_url", "bio", "timezone", "locale", "preferences").
+		Updates(user).Error
+}
+
+func (r *repository) RecommendationSettings(userID uint) (bool, *time.Location, error) {
+	var user User
+	if err := database.DB.Select("id", "timezone", "preferences").First(&user, userID).Error; err != nil {
+		return false, time.UTC, err
+	}
+	return user.Preferences.RecommendationsOptOut, user.Location(), nil
+}
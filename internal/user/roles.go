@@ -0,0 +1,49 @@
+package user
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/config"
+)
+
+// SeedAdminsFromConfig gives the admin role to the users listed in
+// ADMIN_USER_IDS, a comma separated list of user IDs, so a new deployment
+// has an admin who can promote others through the API.
+//
+// Users are never demoted here, since admins promoted through the API are
+// not in the list either: removing an ID from ADMIN_USER_IDS leaves the
+// user an admin until they are given the user role through the API. Admins
+// missing from the list are logged so that a forgotten one stands out.
+func SeedAdminsFromConfig(repo Repository) {
+	seeded := make(map[uint]bool)
+	for _, field := range strings.Split(config.Get("ADMIN_USER_IDS"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			log.Printf("Ignoring invalid admin user ID %q", field)
+			continue
+		}
+		if err := repo.SetRole(uint(id), auth.RoleAdmin); err != nil {
+			log.Printf("Failed to make user %d an admin: %v", id, err)
+			continue
+		}
+		seeded[uint(id)] = true
+	}
+
+	admins, err := repo.ListUserIDsByRole(auth.RoleAdmin)
+	if err != nil {
+		log.Printf("Failed to list admins: %v", err)
+		return
+	}
+	for _, id := range admins {
+		if !seeded[id] {
+			log.Printf("User %d is an admin but not in ADMIN_USER_IDS; demote them with PUT /admin/users/%d/role if they shouldn't be", id, id)
+		}
+	}
+}
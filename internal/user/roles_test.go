@@ -0,0 +1,47 @@
+package user
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// roleRepository is a Repository that keeps users' roles in a map.
+type roleRepository struct {
+	Repository
+	roles map[uint]string
+}
+
+func (r *roleRepository) SetRole(id uint, role string) error {
+	r.roles[id] = role
+	return nil
+}
+
+func (r *roleRepository) ListUserIDsByRole(role string) ([]uint, error) {
+	var ids []uint
+	for id, current := range r.roles {
+		if current == role {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func TestSeedAdminsFromConfig(t *testing.T) {
+	t.Setenv("ADMIN_USER_IDS", " 1, nope,2 ")
+	repo := &roleRepository{roles: map[uint]string{1: auth.RoleUser, 3: auth.RoleAdmin}}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	SeedAdminsFromConfig(repo)
+
+	assert.Equal(t, map[uint]string{1: auth.RoleAdmin, 2: auth.RoleAdmin, 3: auth.RoleAdmin}, repo.roles, "nobody is demoted")
+	assert.Contains(t, logs.String(), `Ignoring invalid admin user ID "nope"`)
+	assert.Contains(t, logs.String(), "User 3 is an admin but not in ADMIN_USER_IDS")
+	assert.NotContains(t, logs.String(), "User 1 is an admin")
+}
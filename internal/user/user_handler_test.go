@@ -6,16 +6,25 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cheildo/deeli-api/internal/auth"
 	"github.com/cheildo/deeli-api/pkg/database"
+	"github.com/cheildo/deeli-api/pkg/mailer"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var router *gin.Engine
+var outbox *mailer.MemoryMailer
+var emails *Emails
+var tokens *auth.TokenService
+var mfa *MFA
 
 // setup performs the setup for the tests in this file.
 func setup() {
@@ -27,23 +36,68 @@ func setup() {
 
 	database.Connect()
 	// We use our User model here directly for migration.
-	database.DB.AutoMigrate(&User{})
+	database.DB.AutoMigrate(&User{}, &RecoveryCode{}, &LoginFailure{}, &auth.LoginAttempt{}, &auth.Session{}, &auth.RefreshToken{}, &auth.PersonalAccessToken{})
 
 	userRepo := NewRepository()
-	userHandler := NewHandler(userRepo)
+	keys, err := auth.KeySetFromConfig()
+	if err != nil {
+		panic("Error loading JWT keys for user test: " + err.Error())
+	}
+	tokens = auth.NewTokenServiceFromConfig(auth.NewSessionRepository(), keys)
+	personalTokens := auth.NewPersonalTokenService(auth.NewPersonalTokenRepository())
+	actionTokens, err := auth.ActionTokensFromConfig()
+	if err != nil {
+		panic("Error setting up action tokens for user test: " + err.Error())
+	}
+	outbox = mailer.NewMemoryMailer()
+	mfa = NewMFA(userRepo, actionTokens, "Deeli")
+	emails = NewEmails(outbox, actionTokens, "http://app.test")
+	userHandler := NewHandler(userRepo, tokens, emails, mfa, auth.LoginThrottleFromConfig())
+	authHandler := auth.NewHandler(tokens, personalTokens)
 
 	router = gin.Default()
 	router.POST("/signup", userHandler.Signup)
 	router.POST("/login", userHandler.Login)
+	router.POST("/login/mfa", userHandler.LoginMFA)
+	router.POST("/token/refresh", authHandler.Refresh)
+	router.POST("/password/forgot", userHandler.ForgotPassword)
+	router.POST("/password/reset", userHandler.ResetPassword)
+	router.POST("/account/restore", userHandler.RestoreAccount)
+	router.POST("/email/verify", userHandler.VerifyEmail)
+	router.POST("/email/verify/resend", userHandler.ResendVerification)
 	authRoutes := router.Group("/")
-	authRoutes.Use(auth.Middleware())
+	authRoutes.Use(auth.Middleware(tokens, personalTokens, userRepo))
 	{
 		authRoutes.GET("/me", userHandler.GetMe)
+		authRoutes.GET("/me/preferences", userHandler.GetPreferences)
+
+		// Account routes, not available to personal access tokens
+		sessionRoutes := authRoutes.Group("/", auth.RequireSession())
+		sessionRoutes.POST("/logout", authHandler.Logout)
+		sessionRoutes.GET("/sessions", authHandler.ListSessions)
+		sessionRoutes.DELETE("/sessions", authHandler.RevokeOtherSessions)
+		sessionRoutes.DELETE("/sessions/:id", authHandler.RevokeSession)
+		sessionRoutes.POST("/tokens", authHandler.CreatePersonalToken)
+		sessionRoutes.GET("/tokens", authHandler.ListPersonalTokens)
+		sessionRoutes.DELETE("/tokens/:id", authHandler.RevokePersonalToken)
+		sessionRoutes.PATCH("/me", userHandler.UpdateMe)
+		sessionRoutes.POST("/me/password", userHandler.ChangePassword)
+		sessionRoutes.DELETE("/me", userHandler.DeleteAccount)
+		sessionRoutes.POST("/me/mfa/totp", userHandler.EnrollTOTP)
+		sessionRoutes.POST("/me/mfa/totp/confirm", userHandler.ConfirmTOTP)
+		sessionRoutes.DELETE("/me/mfa/totp", userHandler.DisableTOTP)
+		sessionRoutes.POST("/me/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
 	}
 }
 
 // teardown cleans up after tests.
 func teardown() {
+	database.DB.Exec("DELETE FROM login_attempts")
+	database.DB.Exec("DELETE FROM login_failures")
+	database.DB.Exec("DELETE FROM recovery_codes")
+	database.DB.Exec("DELETE FROM personal_access_tokens")
+	database.DB.Exec("DELETE FROM refresh_tokens")
+	database.DB.Exec("DELETE FROM sessions")
 	database.DB.Exec("DELETE FROM users")
 }
 
@@ -113,3 +167,594 @@ func TestSignupAndLoginFlow(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "flow@example.com", meResponse["email"])
 }
+
+// login signs the user up and logs in, returning the token response.
+func login(t *testing.T, email string) map[string]string {
+	payload := `{"email": "` + email + `", "password": "password123"}`
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/signup", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/login", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func refresh(refreshToken string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBufferString(`{"refresh_token": "`+refreshToken+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func getMe(token string) int {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	tokens := login(t, "refresh@example.com")
+	assert.NotEmpty(t, tokens["refresh_token"])
+
+	// A refresh returns a new pair; the new access token works.
+	w := refresh(tokens["refresh_token"])
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rotated map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.NotEqual(t, tokens["refresh_token"], rotated["refresh_token"])
+	assert.Equal(t, http.StatusOK, getMe(rotated["token"]))
+
+	// Replaying the old refresh token revokes the whole session.
+	assert.Equal(t, http.StatusUnauthorized, refresh(tokens["refresh_token"]).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(rotated["refresh_token"]).Code)
+	assert.Equal(t, http.StatusUnauthorized, getMe(rotated["token"]))
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	tokens := login(t, "logout@example.com")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, getMe(tokens["token"]))
+	assert.Equal(t, http.StatusUnauthorized, refresh(tokens["refresh_token"]).Code)
+}
+
+func TestSessionManagement(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	first := login(t, "sessions@example.com")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(`{"email": "sessions@example.com", "password": "password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "second-device")
+	router.ServeHTTP(w, req)
+	var second map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+
+	// Both sessions are listed and the current one is flagged.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+second["token"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []auth.SessionResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Len(t, sessions, 2)
+	for _, s := range sessions {
+		assert.Equal(t, s.UserAgent == "second-device", s.Current)
+	}
+
+	// Logging out everywhere else keeps only the current session.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+second["token"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, getMe(first["token"]))
+	assert.Equal(t, http.StatusOK, getMe(second["token"]))
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	session := login(t, "pat@example.com")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/tokens", bytes.NewBufferString(`{"name": "backup script", "scopes": ["articles:read"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+session["token"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created auth.PersonalTokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, len(created.Token) > len(auth.PersonalTokenPrefix))
+	assert.Equal(t, created.Token[:len(created.Prefix)], created.Prefix)
+
+	// The token authenticates, but not for account management.
+	assert.Equal(t, http.StatusOK, getMe(created.Token))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Unknown scopes are rejected.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/tokens", bytes.NewBufferString(`{"name": "bad", "scopes": ["everything"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+session["token"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Revoked tokens stop working.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/tokens/"+strconv.FormatUint(uint64(created.ID), 10), nil)
+	req.Header.Set("Authorization", "Bearer "+session["token"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, getMe(created.Token))
+}
+
+// emailedToken extracts the token from the last link mailed to the address.
+func emailedToken(t *testing.T, email string) string {
+	emails.Wait()
+	msg, ok := outbox.Last(email)
+	assert.True(t, ok)
+	_, rest, found := strings.Cut(msg.Body, "?token=")
+	assert.True(t, found)
+	token, _, _ := strings.Cut(rest, "\n")
+	return token
+}
+
+func postJSON(path, payload string) int {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestEmailIsCaseInsensitive(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	assert.Equal(t, http.StatusCreated, postJSON("/signup", `{"email": "Mixed.Case@Example.com", "password": "password123"}`))
+	account, err := NewRepository().GetUserByEmail("mixed.case@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "mixed.case@example.com", account.Email)
+
+	// The same address in another case is the same account.
+	assert.Equal(t, http.StatusConflict, postJSON("/signup", `{"email": "MIXED.CASE@example.com", "password": "password123"}`))
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "Mixed.Case@EXAMPLE.com", "password": "password123"}`))
+	assert.Equal(t, http.StatusAccepted, postJSON("/password/forgot", `{"email": "MIXED.case@example.com"}`))
+	emailedToken(t, "mixed.case@example.com")
+
+	// Accounts stored before emails were normalized are still found, and
+	// can't be registered again in another case.
+	hash, err := auth.HashPassword("password123")
+	assert.NoError(t, err)
+	assert.NoError(t, database.DB.Create(&User{Email: "Legacy@Example.com", Password: hash}).Error)
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "legacy@example.com", "password": "password123"}`))
+	assert.Equal(t, http.StatusConflict, postJSON("/signup", `{"email": "legacy@example.com", "password": "password123"}`))
+}
+
+func TestEmailVerification(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	session := login(t, "verify@example.com")
+	token := emailedToken(t, "verify@example.com")
+
+	assert.Equal(t, http.StatusBadRequest, postJSON("/email/verify", `{"token": "not-a-token"}`))
+	assert.Equal(t, http.StatusOK, postJSON("/email/verify", `{"token": "`+token+`"}`))
+	// The link only works once.
+	assert.Equal(t, http.StatusBadRequest, postJSON("/email/verify", `{"token": "`+token+`"}`))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+session["token"])
+	router.ServeHTTP(w, req)
+	var me map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &me))
+	assert.Equal(t, true, me["email_verified"])
+}
+
+func TestResendVerification(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	login(t, "resend@example.com")
+	first := emailedToken(t, "resend@example.com")
+
+	// Unknown emails get the same answer and no mail.
+	sent := len(outbox.Sent())
+	assert.Equal(t, http.StatusAccepted, postJSON("/email/verify/resend", `{"email": "nobody@example.com"}`))
+	emails.Wait()
+	assert.Len(t, outbox.Sent(), sent)
+
+	assert.Equal(t, http.StatusAccepted, postJSON("/email/verify/resend", `{"email": "resend@example.com"}`))
+	token := emailedToken(t, "resend@example.com")
+	assert.Len(t, outbox.Sent(), sent+1)
+	assert.Equal(t, http.StatusOK, postJSON("/email/verify", `{"token": "`+token+`"}`))
+	assert.Equal(t, http.StatusBadRequest, postJSON("/email/verify", `{"token": "`+first+`"}`), "verifying spends every link")
+
+	// Verified accounts get no more links.
+	assert.Equal(t, http.StatusAccepted, postJSON("/email/verify/resend", `{"email": "resend@example.com"}`))
+	emails.Wait()
+	assert.Len(t, outbox.Sent(), sent+1)
+}
+
+func TestPasswordReset(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	session := login(t, "reset@example.com")
+
+	// Unknown emails get the same answer and no mail.
+	sent := len(outbox.Sent())
+	assert.Equal(t, http.StatusAccepted, postJSON("/password/forgot", `{"email": "nobody@example.com"}`))
+	emails.Wait()
+	assert.Len(t, outbox.Sent(), sent)
+
+	assert.Equal(t, http.StatusAccepted, postJSON("/password/forgot", `{"email": "reset@example.com"}`))
+	token := emailedToken(t, "reset@example.com")
+
+	assert.Equal(t, http.StatusOK, postJSON("/password/reset", `{"token": "`+token+`", "password": "new-password"}`))
+	assert.Equal(t, http.StatusBadRequest, postJSON("/password/reset", `{"token": "`+token+`", "password": "another-one"}`))
+
+	// Existing sessions are logged out and the new password works.
+	assert.Equal(t, http.StatusUnauthorized, getMe(session["token"]))
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login", `{"email": "reset@example.com", "password": "password123"}`))
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "reset@example.com", "password": "new-password"}`))
+}
+
+func TestChangePassword(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	current := login(t, "change@example.com")
+	other := login(t, "change@example.com")
+
+	w := authedJSON("POST", "/me/password", current["token"], `{"current_password": "wrong", "new_password": "new-password"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = authedJSON("POST", "/me/password", current["token"], `{"current_password": "password123", "new_password": "new-password"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Only the session that changed the password stays signed in.
+	assert.Equal(t, http.StatusOK, getMe(current["token"]))
+	assert.Equal(t, http.StatusUnauthorized, getMe(other["token"]))
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login", `{"email": "change@example.com", "password": "password123"}`))
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "change@example.com", "password": "new-password"}`))
+}
+
+func TestLoginUpgradesBcryptHash(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	assert.NoError(t, err)
+	repo := NewRepository()
+	assert.NoError(t, repo.CreateUser(&User{Email: "legacy@example.com", Password: string(legacy)}))
+
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "legacy@example.com", "password": "password123"}`))
+
+	user, err := repo.GetUserByEmail("legacy@example.com")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "legacy@example.com", "password": "password123"}`))
+}
+
+func TestDisabledUserIsRejected(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	session := login(t, "disabled@example.com")
+	repo := NewRepository()
+	account, err := repo.GetUserByEmail("disabled@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", account.Role)
+
+	now := time.Now()
+	assert.NoError(t, repo.SetDisabled(account.ID, &now))
+	assert.Equal(t, http.StatusForbidden, getMe(session["token"]))
+	assert.Equal(t, http.StatusForbidden, postJSON("/login", `{"email": "disabled@example.com", "password": "password123"}`))
+
+	assert.NoError(t, repo.SetDisabled(account.ID, nil))
+	assert.Equal(t, http.StatusOK, getMe(session["token"]))
+}
+
+func TestDeleteAndRestoreAccount(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	session := login(t, "leaving@example.com")
+	other := login(t, "leaving@example.com")
+
+	w := authedJSON("DELETE", "/me", session["token"], `{"password": "wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = authedJSON("DELETE", "/me", session["token"], `{"password": "password123"}`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	// The account is locked: sessions are gone and logins are refused.
+	assert.Equal(t, http.StatusUnauthorized, getMe(session["token"]))
+	assert.Equal(t, http.StatusUnauthorized, getMe(other["token"]))
+	assert.Equal(t, http.StatusForbidden, postJSON("/login", `{"email": "leaving@example.com", "password": "password123"}`))
+	account, err := NewRepository().GetUserByEmail("leaving@example.com")
+	assert.NoError(t, err)
+	assert.True(t, account.PendingDeletion())
+
+	// Restoring needs the password and logs the user back in.
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/account/restore", `{"email": "leaving@example.com", "password": "wrong"}`))
+	assert.Equal(t, http.StatusOK, postJSON("/account/restore", `{"email": "leaving@example.com", "password": "password123"}`))
+	assert.Equal(t, http.StatusOK, postJSON("/login", `{"email": "leaving@example.com", "password": "password123"}`))
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	// An account created through an identity provider has no password.
+	account := &User{Email: "external@example.com"}
+	assert.NoError(t, NewRepository().CreateUser(account))
+	stale, err := tokens.IssueTokens(account.ID, "test", "127.0.0.1")
+	assert.NoError(t, err)
+	fresh, err := tokens.IssueTokens(account.ID, "test", "127.0.0.1")
+	assert.NoError(t, err)
+	database.DB.Model(&auth.Session{}).
+		Where("id = (SELECT MIN(id) FROM sessions WHERE user_id = ?)", account.ID).
+		Update("created_at", time.Now().Add(-time.Hour))
+
+	// An old session has to log in again; a password can't stand in.
+	w := authedJSON("DELETE", "/me", stale.AccessToken, `{"password": ""}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "reauth_required")
+	assert.Equal(t, http.StatusUnauthorized, authedJSON("DELETE", "/me", stale.AccessToken, `{"password": "anything"}`).Code)
+
+	assert.Equal(t, http.StatusAccepted, authedJSON("DELETE", "/me", fresh.AccessToken, `{}`).Code)
+	deleted, err := NewRepository().GetUserByEmail("external@example.com")
+	assert.NoError(t, err)
+	assert.True(t, deleted.PendingDeletion())
+}
+
+func TestRestoreAccountWithTwoFactor(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	mfa.Now = func() time.Time { return now }
+	defer func() { mfa.Now = time.Now }()
+
+	session := login(t, "restore-mfa@example.com")
+	w := authedJSON("POST", "/me/mfa/totp", session["token"], "")
+	var enrollment map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	code, _ := auth.TOTPCode(enrollment["secret"], now)
+	assert.Equal(t, http.StatusOK, authedJSON("POST", "/me/mfa/totp/confirm", session["token"], `{"code": "`+code+`"}`).Code)
+
+	now = now.Add(30 * time.Second)
+	code, _ = auth.TOTPCode(enrollment["secret"], now)
+	w = authedJSON("DELETE", "/me", session["token"], `{"password": "password123", "code": "`+code+`"}`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	pending := func() bool {
+		account, err := NewRepository().GetUserByEmail("restore-mfa@example.com")
+		assert.NoError(t, err)
+		return account.PendingDeletion()
+	}
+
+	// The password alone only gets a challenge; the deletion stands.
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/account/restore", bytes.NewBufferString(`{"email": "restore-mfa@example.com", "password": "password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var challenge map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.Empty(t, challenge["token"])
+	assert.NotEmpty(t, challenge["mfa_token"])
+	assert.True(t, pending())
+
+	// A wrong code leaves it scheduled too.
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login/mfa", `{"mfa_token": "`+challenge["mfa_token"]+`", "code": "000000"}`))
+	assert.True(t, pending())
+
+	now = now.Add(30 * time.Second)
+	code, _ = auth.TOTPCode(enrollment["secret"], now)
+	assert.Equal(t, http.StatusOK, postJSON("/login/mfa", `{"mfa_token": "`+challenge["mfa_token"]+`", "code": "`+code+`"}`))
+	assert.False(t, pending())
+}
+
+func TestUpdateProfileAndPreferences(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	session := login(t, "profile@example.com")
+
+	// New users start with the default preferences.
+	w := authedJSON("GET", "/me/preferences", session["token"], "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var prefs Preferences
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &prefs))
+	assert.Equal(t, DefaultPreferences(), prefs)
+
+	for _, payload := range []string{
+		`{"timezone": "Mars/Olympus"}`,
+		`{"locale": "not a locale"}`,
+		`{"avatar_url": "javascript:alert(1)"}`,
+		`{"preferences": {"reading_font_size": 100}}`,
+		`{"preferences": {"default_sort": "random"}}`,
+		`{"preferences": {"version": 99}}`,
+		`{"nickname": "unknown field"}`,
+	} {
+		w = authedJSON("PATCH", "/me", session["token"], payload)
+		assert.Equal(t, http.StatusBadRequest, w.Code, payload)
+	}
+
+	w = authedJSON("PATCH", "/me", session["token"], `{
+		"display_name": "Ada",
+		"timezone": "Europe/Paris",
+		"locale": "fr-fr",
+		"preferences": {"version": 1, "default_sort": "rating", "recommendations_opt_out": true}
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user, err := NewRepository().GetUserByEmail("profile@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", user.DisplayName)
+	assert.Equal(t, "fr-FR", user.Locale)
+	assert.Equal(t, "Europe/Paris", user.Location().String())
+	assert.Equal(t, SortRating, user.Preferences.DefaultSort)
+	// Fields left out of the patch keep their values.
+	assert.Equal(t, DigestWeekly, user.Preferences.DigestFrequency)
+
+	optOut, loc, err := NewRepository().RecommendationSettings(user.ID)
+	assert.NoError(t, err)
+	assert.True(t, optOut)
+	assert.Equal(t, "Europe/Paris", loc.String())
+}
+
+func authedJSON(method, path, token, payload string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTOTPTwoFactorLogin(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	mfa.Now = func() time.Time { return now }
+	defer func() { mfa.Now = time.Now }()
+
+	session := login(t, "mfa@example.com")
+
+	// Enroll and confirm with a first code.
+	w := authedJSON("POST", "/me/mfa/totp", session["token"], "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var enrollment map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	assert.True(t, strings.HasPrefix(enrollment["otpauth_uri"], "otpauth://totp/Deeli:"))
+
+	code, err := auth.TOTPCode(enrollment["secret"], now)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, authedJSON("POST", "/me/mfa/totp/confirm", session["token"], `{"code": "000000"}`).Code)
+	w = authedJSON("POST", "/me/mfa/totp/confirm", session["token"], `{"code": "`+code+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var recovery map[string][]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	assert.Len(t, recovery["recovery_codes"], 10)
+
+	// Login now stops at a challenge.
+	loginPayload := `{"email": "mfa@example.com", "password": "password123"}`
+	challenge := func() string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(loginPayload))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Empty(t, response["token"])
+		return response["mfa_token"]
+	}
+
+	// The code used to confirm can't be replayed.
+	mfaToken := challenge()
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login/mfa", `{"mfa_token": "`+mfaToken+`", "code": "`+code+`"}`))
+
+	now = now.Add(30 * time.Second)
+	code, _ = auth.TOTPCode(enrollment["secret"], now)
+	assert.Equal(t, http.StatusOK, postJSON("/login/mfa", `{"mfa_token": "`+mfaToken+`", "code": "`+code+`"}`))
+
+	// Recovery codes work once, typed loosely.
+	recoveryCode := strings.ToUpper(recovery["recovery_codes"][0])
+	assert.Equal(t, http.StatusOK, postJSON("/login/mfa", `{"mfa_token": "`+challenge()+`", "recovery_code": "`+recoveryCode+`"}`))
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login/mfa", `{"mfa_token": "`+challenge()+`", "recovery_code": "`+recoveryCode+`"}`))
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login/mfa", `{"mfa_token": "forged", "code": "123456"}`))
+}
+
+func TestDisableTOTPNeedsSecondFactor(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	mfa.Now = func() time.Time { return now }
+	defer func() { mfa.Now = time.Now }()
+
+	session := login(t, "mfa-off@example.com")
+	w := authedJSON("POST", "/me/mfa/totp", session["token"], "")
+	var enrollment map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	code, _ := auth.TOTPCode(enrollment["secret"], now)
+	assert.Equal(t, http.StatusOK, authedJSON("POST", "/me/mfa/totp/confirm", session["token"], `{"code": "`+code+`"}`).Code)
+
+	// The password alone isn't enough, and failures are audited.
+	assert.Equal(t, http.StatusUnauthorized, authedJSON("DELETE", "/me/mfa/totp", session["token"], `{"password": "password123"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, authedJSON("DELETE", "/me/mfa/totp", session["token"], `{"password": "password123", "code": "000000"}`).Code)
+	var reasons []string
+	database.DB.Model(&LoginFailure{}).Where("email = ?", "mfa-off@example.com").Pluck("reason", &reasons)
+	assert.Equal(t, []string{FailureInvalidCode, FailureInvalidCode}, reasons)
+
+	now = now.Add(30 * time.Second)
+	code, _ = auth.TOTPCode(enrollment["secret"], now)
+	assert.Equal(t, http.StatusNoContent, authedJSON("DELETE", "/me/mfa/totp", session["token"], `{"password": "password123", "code": "`+code+`"}`).Code)
+	account, err := NewRepository().GetUserByEmail("mfa-off@example.com")
+	assert.NoError(t, err)
+	assert.False(t, account.MFAEnabled())
+}
+
+func TestLoginThrottling(t *testing.T) {
+	teardown()
+	defer teardown()
+
+	login(t, "throttle@example.com")
+	wrong := `{"email": "throttle@example.com", "password": "wrong-password"}`
+
+	// The first failures are free, then the account is made to wait.
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, postJSON("/login", wrong))
+	}
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login", wrong))
+	assert.Equal(t, http.StatusTooManyRequests, postJSON("/login", `{"email": "throttle@example.com", "password": "password123"}`))
+
+	// Unknown emails fail the same way, and every failure is audited.
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/login", `{"email": "ghost@example.com", "password": "whatever"}`))
+	var reasons []string
+	database.DB.Model(&LoginFailure{}).Order("id").Pluck("reason", &reasons)
+	assert.Equal(t, []string{
+		FailureWrongPassword, FailureWrongPassword, FailureWrongPassword, FailureWrongPassword,
+		FailureThrottled, FailureUnknownEmail,
+	}, reasons)
+}
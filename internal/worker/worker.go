@@ -2,6 +2,7 @@ package worker
 
 import (
 	"log"
+	"sync"
 	"time"
 
 	"github.com/cheildo/deeli-api/internal/article"
@@ -10,29 +11,115 @@ import (
 
 const maxRetries = 3
 
+// defaultInterval replaces a job interval that isn't positive, which the
+// ticker can't run on.
+const defaultInterval = time.Minute
+
+// Job is a task the worker runs periodically alongside scrape retries.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func()
+}
+
+// JobStatus reports a job's schedule and its most recent run.
+type JobStatus struct {
+	Name          string     `json:"name"`
+	Interval      string     `json:"interval"`
+	Running       bool       `json:"running"`
+	Runs          int        `json:"runs"`
+	LastStartedAt *time.Time `json:"last_started_at"`
+	LastDuration  string     `json:"last_duration,omitempty"`
+}
+
 // Worker holds dependencies for the background job processor.
 type Worker struct {
 	articleRepo article.Repository
+	jobs        []Job
+
+	mu       sync.Mutex
+	statuses map[string]*JobStatus
 }
 
 func NewWorker(repo article.Repository) *Worker {
-	return &Worker{articleRepo: repo}
+	w := &Worker{articleRepo: repo, statuses: make(map[string]*JobStatus)}
+	w.AddJob(Job{
+		Name:     "retry-failed-scrapes",
+		Interval: time.Minute,
+		Run:      w.processFailedArticles,
+	})
+	return w
+}
+
+// AddJob registers a periodic job. It must be called before Start. A job
+// whose interval isn't positive runs every defaultInterval instead.
+func (w *Worker) AddJob(job Job) {
+	if job.Interval <= 0 {
+		log.Printf("Worker: invalid interval %s for job %q, using %s", job.Interval, job.Name, defaultInterval)
+		job.Interval = defaultInterval
+	}
+	w.jobs = append(w.jobs, job)
+	w.statuses[job.Name] = &JobStatus{Name: job.Name, Interval: job.Interval.String()}
 }
 
 // Start runs the background worker loop. It should be called in a goroutine.
 func (w *Worker) Start() {
 	log.Println("Starting background worker...")
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+	for _, job := range w.jobs[1:] {
+		go w.runJob(job)
+	}
+	w.runJob(w.jobs[0])
+}
 
-	w.processFailedArticles()
+// Status reports every job in the order they were added.
+func (w *Worker) Status() []JobStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
+	statuses := make([]JobStatus, len(w.jobs))
+	for i, job := range w.jobs {
+		statuses[i] = *w.statuses[job.Name]
+	}
+	return statuses
+}
+
+// RetryQueue returns the number of failed scrapes waiting for a retry.
+func (w *Worker) RetryQueue() (int, error) {
+	articles, err := w.articleRepo.GetFailedArticlesToRetry(maxRetries)
+	return len(articles), err
+}
+
+// runJob runs a job once immediately and then on every interval.
+func (w *Worker) runJob(job Job) {
+	log.Printf("Worker: scheduling job %q every %s", job.Name, job.Interval)
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	w.run(job)
 	for range ticker.C {
-		log.Println("Worker tick: checking for failed metadata scrapes...")
-		w.processFailedArticles()
+		log.Printf("Worker tick: running job %q", job.Name)
+		w.run(job)
 	}
 }
 
+// run runs a job and records it in the job's status.
+func (w *Worker) run(job Job) {
+	start := time.Now()
+	w.mu.Lock()
+	status := w.statuses[job.Name]
+	status.Running = true
+	status.LastStartedAt = &start
+	w.mu.Unlock()
+
+	job.Run()
+
+	w.mu.Lock()
+	status.Running = false
+	status.Runs++
+	status.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	w.mu.Unlock()
+}
+
 // processFailedArticles is the core logic that is run periodically.
 func (w *Worker) processFailedArticles() {
 	articlesToRetry, err := w.articleRepo.GetFailedArticlesToRetry(maxRetries)
@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/article"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddJobReplacesNonPositiveIntervals(t *testing.T) {
+	w := NewWorker(article.NewMemoryRepository())
+	w.AddJob(Job{Name: "zero", Interval: 0, Run: func() {}})
+	w.AddJob(Job{Name: "negative", Interval: -time.Second, Run: func() {}})
+	w.AddJob(Job{Name: "hourly", Interval: time.Hour, Run: func() {}})
+
+	statuses := w.Status()
+	assert.Equal(t, defaultInterval.String(), statuses[1].Interval)
+	assert.Equal(t, defaultInterval.String(), statuses[2].Interval)
+	assert.Equal(t, time.Hour.String(), statuses[3].Interval)
+	for _, job := range w.jobs {
+		assert.Positive(t, job.Interval, job.Name)
+	}
+}
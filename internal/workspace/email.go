@@ -0,0 +1,87 @@
+package workspace
+
+import (
+	"bytes"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/auth"
+	"github.com/cheildo/deeli-api/pkg/mailer"
+	"gorm.io/gorm"
+)
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+var invitationEmail = template.Must(template.New("invitation").Parse(`Hi,
+
+{{.Inviter}} invited you to join the Deeli workspace "{{.Workspace}}" as {{.Role}}. To accept, log in as {{.Email}} and open this link:
+
+{{.Link}}
+
+The invitation expires in 7 days. If you weren't expecting it, you can ignore this email.
+`))
+
+// Invitations creates invitations and emails their links.
+type Invitations struct {
+	repo    Repository
+	mailer  mailer.Mailer
+	baseURL string
+	now     func() time.Time
+}
+
+// NewInvitations creates Invitations whose links point at baseURL, the web
+// app's address.
+func NewInvitations(repo Repository, m mailer.Mailer, baseURL string) *Invitations {
+	return &Invitations{repo: repo, mailer: m, baseURL: baseURL, now: time.Now}
+}
+
+// Send invites email to the workspace with role and emails the link.
+func (i *Invitations) Send(ws *Workspace, inviter, email, role string, invitedBy uint) (*Invitation, error) {
+	token, err := auth.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+	inv := &Invitation{
+		WorkspaceID: ws.ID,
+		Email:       email,
+		Role:        role,
+		InvitedBy:   invitedBy,
+		TokenHash:   auth.HashToken(token),
+		ExpiresAt:   i.now().Add(invitationTTL),
+	}
+	if err := i.repo.CreateInvitation(inv); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	err = invitationEmail.Execute(&body, map[string]string{
+		"Inviter":   inviter,
+		"Workspace": ws.Name,
+		"Role":      role,
+		"Email":     email,
+		"Link":      i.baseURL + "/invitations/accept?token=" + token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.mailer.Send(mailer.Message{To: email, Subject: "You're invited to " + ws.Name + " on Deeli", Body: body.String()}); err != nil {
+		log.Printf("Failed to send invitation %d to workspace %d: %v", inv.ID, ws.ID, err)
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Lookup returns the pending invitation for an emailed token, or
+// gorm.ErrRecordNotFound if there is none or it expired or was used.
+func (i *Invitations) Lookup(token string) (*Invitation, error) {
+	inv, err := i.repo.GetInvitationByHash(auth.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if !inv.Pending(i.now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return inv, nil
+}
@@ -0,0 +1,380 @@
+package workspace
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/internal/user"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the /workspaces endpoints.
+type Handler struct {
+	repo        Repository
+	users       user.Repository
+	invitations *Invitations
+}
+
+func NewHandler(repo Repository, users user.Repository, invitations *Invitations) *Handler {
+	return &Handler{repo: repo, users: users, invitations: invitations}
+}
+
+// WorkspaceRequest defines the JSON for creating or renaming a workspace.
+type WorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+func bindName(c *gin.Context) (string, bool) {
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || strings.ContainsAny(name, "\r\n") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace name"})
+		return "", false
+	}
+	return name, true
+}
+
+// CreateWorkspace handles POST /workspaces. The creator becomes its owner.
+func (h *Handler) CreateWorkspace(c *gin.Context) {
+	name, ok := bindName(c)
+	if !ok {
+		return
+	}
+	ws := &Workspace{Name: name}
+	if err := h.repo.CreateWorkspace(ws, c.MustGet("userID").(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workspace"})
+		return
+	}
+	c.JSON(http.StatusCreated, Membership{ID: ws.ID, Name: ws.Name, Role: RoleOwner})
+}
+
+// ListWorkspaces handles GET /workspaces
+func (h *Handler) ListWorkspaces(c *gin.Context) {
+	memberships, err := h.repo.ListWorkspaces(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve workspaces"})
+		return
+	}
+	c.JSON(http.StatusOK, memberships)
+}
+
+// GetWorkspace handles GET /workspaces/:id, listing the members.
+func (h *Handler) GetWorkspace(c *gin.Context) {
+	ws, role, ok := h.workspace(c, RoleViewer)
+	if !ok {
+		return
+	}
+	members, err := h.repo.ListMembers(ws.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve members"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": ws.ID, "name": ws.Name, "role": role, "members": members})
+}
+
+// RenameWorkspace handles PATCH /workspaces/:id
+func (h *Handler) RenameWorkspace(c *gin.Context) {
+	name, ok := bindName(c)
+	if !ok {
+		return
+	}
+	ws, role, ok := h.workspace(c, RoleOwner)
+	if !ok {
+		return
+	}
+	if err := h.repo.RenameWorkspace(ws.ID, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename workspace"})
+		return
+	}
+	c.JSON(http.StatusOK, Membership{ID: ws.ID, Name: name, Role: role})
+}
+
+// DeleteWorkspace handles DELETE /workspaces/:id, deleting its articles too.
+func (h *Handler) DeleteWorkspace(c *gin.Context) {
+	ws, _, ok := h.workspace(c, RoleOwner)
+	if !ok {
+		return
+	}
+	if err := h.repo.DeleteWorkspace(ws.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete workspace"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// InviteRequest defines the JSON for inviting someone to a workspace.
+type InviteRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+// InvitationResponse is a pending invitation as owners see it.
+type InvitationResponse struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newInvitationResponse(inv *Invitation) InvitationResponse {
+	return InvitationResponse{ID: inv.ID, Email: inv.Email, Role: inv.Role, CreatedAt: inv.CreatedAt, ExpiresAt: inv.ExpiresAt}
+}
+
+// Invite handles POST /workspaces/:id/invitations, emailing a link to join.
+func (h *Handler) Invite(c *gin.Context) {
+	var req InviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ws, _, ok := h.workspace(c, RoleOwner)
+	if !ok {
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	inviter, err := h.users.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	name := inviter.DisplayName
+	if name == "" {
+		name = inviter.Email
+	}
+
+	inv, err := h.invitations.Send(ws, name, strings.TrimSpace(req.Email), req.Role, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation"})
+		return
+	}
+	c.JSON(http.StatusCreated, newInvitationResponse(inv))
+}
+
+// ListInvitations handles GET /workspaces/:id/invitations
+func (h *Handler) ListInvitations(c *gin.Context) {
+	ws, _, ok := h.workspace(c, RoleOwner)
+	if !ok {
+		return
+	}
+	invitations, err := h.repo.ListInvitations(ws.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invitations"})
+		return
+	}
+	response := make([]InvitationResponse, len(invitations))
+	for i := range invitations {
+		response[i] = newInvitationResponse(&invitations[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeInvitation handles DELETE /workspaces/:id/invitations/:invitationID
+func (h *Handler) RevokeInvitation(c *gin.Context) {
+	ws, _, ok := h.workspace(c, RoleOwner)
+	if !ok {
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitationID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+	if err := h.repo.DeleteInvitation(ws.ID, uint(invitationID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// AcceptInvitationRequest defines the JSON for accepting an invitation.
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// AcceptInvitation handles POST /invitations/accept. The invitation must
+// have been sent to the logged-in user's email address.
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inv, err := h.invitations.Lookup(req.Token)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	u, err := h.users.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !strings.EqualFold(u.Email, inv.Email) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This invitation was sent to another email address"})
+		return
+	}
+	ws, err := h.repo.GetWorkspace(inv.WorkspaceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	if err := h.repo.AcceptInvitation(inv, userID, time.Now()); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	role, err := h.repo.MemberRole(ws.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, Membership{ID: ws.ID, Name: ws.Name, Role: role})
+}
+
+// SetMemberRoleRequest defines the JSON for changing a member's role.
+type SetMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+// SetMemberRole handles PUT /workspaces/:id/members/:userID/role
+func (h *Handler) SetMemberRole(c *gin.Context) {
+	var req SetMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ws, _, ok := h.workspace(c, RoleOwner)
+	if !ok {
+		return
+	}
+	memberID, ok := h.member(c, ws.ID)
+	if !ok {
+		return
+	}
+	if req.Role != RoleOwner && !h.keepsAnOwner(c, ws.ID, memberID) {
+		return
+	}
+	if err := h.repo.SetMemberRole(ws.ID, memberID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": memberID, "role": req.Role})
+}
+
+// RemoveMember handles DELETE /workspaces/:id/members/:userID. Owners can
+// remove anyone; other members can only leave.
+func (h *Handler) RemoveMember(c *gin.Context) {
+	ws, role, ok := h.workspace(c, RoleViewer)
+	if !ok {
+		return
+	}
+	memberID, ok := h.member(c, ws.ID)
+	if !ok {
+		return
+	}
+	if memberID != c.MustGet("userID").(uint) && role != RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can remove other members"})
+		return
+	}
+	if !h.keepsAnOwner(c, ws.ID, memberID) {
+		return
+	}
+	if err := h.repo.RemoveMember(ws.ID, memberID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// workspace loads the workspace named by the :id parameter if the user
+// holds at least the role in it. Non-members get 404, so they can't probe
+// for workspaces.
+func (h *Handler) workspace(c *gin.Context, want string) (*Workspace, string, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return nil, "", false
+	}
+	role, err := h.repo.MemberRole(uint(id), c.MustGet("userID").(uint))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return nil, "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, "", false
+	}
+	if !HasRole(role, want) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This requires the " + want + " role in the workspace"})
+		return nil, "", false
+	}
+	ws, err := h.repo.GetWorkspace(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, "", false
+	}
+	return ws, role, true
+}
+
+// member parses the :userID parameter, answering 404 unless it names a
+// member of the workspace.
+func (h *Handler) member(c *gin.Context, workspaceID uint) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("userID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	if _, err := h.repo.MemberRole(workspaceID, uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// keepsAnOwner refuses to let the workspace's last owner be demoted or
+// removed, which would leave nobody able to manage it.
+func (h *Handler) keepsAnOwner(c *gin.Context, workspaceID, memberID uint) bool {
+	role, err := h.repo.MemberRole(workspaceID, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if role != RoleOwner {
+		return true
+	}
+	owners, err := h.repo.CountOwners(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if owners <= 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A workspace needs at least one owner; delete it instead"})
+		return false
+	}
+	return true
+}
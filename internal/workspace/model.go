@@ -0,0 +1,83 @@
+package workspace
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Member roles. Owners manage the workspace and its members, editors save,
+// change and delete articles, viewers read and rate them.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// ValidRole reports whether role is a known member role.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole reports whether a member with role may act as want.
+func HasRole(role, want string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[want]
+}
+
+// RolesAtLeast returns the roles that may act as want.
+func RolesAtLeast(want string) []string {
+	var roles []string
+	for _, role := range []string{RoleOwner, RoleEditor, RoleViewer} {
+		if HasRole(role, want) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Workspace is a library of articles shared by its members.
+type Workspace struct {
+	gorm.Model
+	Name string `gorm:"not null"`
+}
+
+// Member gives a user a role in a workspace.
+type Member struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	WorkspaceID uint   `gorm:"uniqueIndex:idx_workspace_member;not null"`
+	UserID      uint   `gorm:"uniqueIndex:idx_workspace_member;index;not null"`
+	Role        string `gorm:"not null"`
+}
+
+// TableName keeps members of workspaces apart from any other kind.
+func (Member) TableName() string {
+	return "workspace_members"
+}
+
+// Invitation asks whoever owns Email to join the workspace with Role. Only a
+// hash of the emailed token is stored.
+type Invitation struct {
+	gorm.Model
+	WorkspaceID uint   `gorm:"index;not null"`
+	Email       string `gorm:"not null"`
+	Role        string `gorm:"not null"`
+	InvitedBy   uint   `gorm:"not null"`
+	TokenHash   string `gorm:"uniqueIndex;not null"`
+	ExpiresAt   time.Time
+	AcceptedAt  *time.Time
+}
+
+// TableName names the table after the workspace, like its members.
+func (Invitation) TableName() string {
+	return "workspace_invitations"
+}
+
+// Pending reports whether the invitation can still be accepted.
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && now.Before(i.ExpiresAt)
+}
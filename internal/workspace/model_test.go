@@ -0,0 +1,31 @@
+package workspace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	assert.True(t, HasRole(RoleOwner, RoleEditor))
+	assert.True(t, HasRole(RoleEditor, RoleEditor))
+	assert.False(t, HasRole(RoleViewer, RoleEditor))
+	assert.False(t, HasRole("", RoleViewer))
+	assert.False(t, HasRole("admin", RoleViewer))
+
+	assert.Equal(t, []string{RoleOwner, RoleEditor}, RolesAtLeast(RoleEditor))
+	assert.Equal(t, []string{RoleOwner, RoleEditor, RoleViewer}, RolesAtLeast(RoleViewer))
+	assert.True(t, ValidRole(RoleViewer))
+	assert.False(t, ValidRole("admin"))
+}
+
+func TestInvitationPending(t *testing.T) {
+	now := time.Now()
+	inv := Invitation{ExpiresAt: now.Add(time.Hour)}
+	assert.True(t, inv.Pending(now))
+	assert.False(t, inv.Pending(now.Add(2*time.Hour)))
+
+	inv.AcceptedAt = &now
+	assert.False(t, inv.Pending(now))
+}
@@ -0,0 +1,213 @@
+package workspace
+
+import (
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Membership is a workspace as one of its members sees it.
+type Membership struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// MemberInfo is a member with the user's public details.
+type MemberInfo struct {
+	UserID      uint      `json:"user_id"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// Repository defines the interface for workspace storage.
+type Repository interface {
+	// CreateWorkspace creates the workspace with ownerID as its owner.
+	CreateWorkspace(ws *Workspace, ownerID uint) error
+	GetWorkspace(id uint) (*Workspace, error)
+	RenameWorkspace(id uint, name string) error
+	// DeleteWorkspace deletes the workspace, its members, invitations and
+	// articles, and has the observers delete what they keep about it.
+	DeleteWorkspace(id uint) error
+	// ListWorkspaces returns the workspaces the user is a member of.
+	ListWorkspaces(userID uint) ([]Membership, error)
+
+	// MemberRole returns the user's role in the workspace, or
+	// gorm.ErrRecordNotFound if they aren't a member.
+	MemberRole(workspaceID, userID uint) (string, error)
+	ListMembers(workspaceID uint) ([]MemberInfo, error)
+	SetMemberRole(workspaceID, userID uint, role string) error
+	RemoveMember(workspaceID, userID uint) error
+	CountOwners(workspaceID uint) (int64, error)
+
+	CreateInvitation(inv *Invitation) error
+	GetInvitationByHash(hash string) (*Invitation, error)
+	// ListInvitations returns the workspace's invitations that haven't
+	// been accepted.
+	ListInvitations(workspaceID uint) ([]Invitation, error)
+	DeleteInvitation(workspaceID, invitationID uint) error
+	// AcceptInvitation marks the invitation accepted and adds the user to
+	// the workspace. A user who is already a member keeps their role.
+	AcceptInvitation(inv *Invitation, userID uint, at time.Time) error
+}
+
+// DeletionObserver deletes what another package keeps about a workspace
+// as the workspace is deleted. It runs in the deleting transaction, so a
+// failure leaves the workspace in place.
+type DeletionObserver interface {
+	WorkspaceDeleted(tx *gorm.DB, workspaceID uint) error
+}
+
+type repository struct {
+	observers []DeletionObserver
+}
+
+// NewRepository creates a Repository that has the given observers clean up
+// after deleted workspaces.
+func NewRepository(observers ...DeletionObserver) Repository {
+	return &repository{observers: observers}
+}
+
+func (r *repository) CreateWorkspace(ws *Workspace, ownerID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ws).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Member{WorkspaceID: ws.ID, UserID: ownerID, Role: RoleOwner}).Error
+	})
+}
+
+func (r *repository) GetWorkspace(id uint) (*Workspace, error) {
+	var ws Workspace
+	err := database.DB.First(&ws, id).Error
+	return &ws, err
+}
+
+func (r *repository) RenameWorkspace(id uint, name string) error {
+	return database.DB.Model(&Workspace{}).Where("id = ?", id).Update("name", name).Error
+}
+
+func (r *repository) DeleteWorkspace(id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range []string{
+			"UPDATE articles SET deleted_at = now() WHERE workspace_id = ? AND deleted_at IS NULL",
+			"DELETE FROM workspace_invitations WHERE workspace_id = ?",
+			"DELETE FROM workspace_members WHERE workspace_id = ?",
+		} {
+			if err := tx.Exec(statement, id).Error; err != nil {
+				return err
+			}
+		}
+		for _, o := range r.observers {
+			if err := o.WorkspaceDeleted(tx, id); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Workspace{}, id).Error
+	})
+}
+
+func (r *repository) ListWorkspaces(userID uint) ([]Membership, error) {
+	var memberships []Membership
+	err := database.DB.Model(&Workspace{}).
+		Select("workspaces.id, workspaces.name, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.name, workspaces.id").
+		Scan(&memberships).Error
+	return memberships, err
+}
+
+func (r *repository) MemberRole(workspaceID, userID uint) (string, error) {
+	var member Member
+	err := database.DB.Joins("JOIN workspaces ON workspaces.id = workspace_members.workspace_id AND workspaces.deleted_at IS NULL").
+		Where("workspace_members.workspace_id = ? AND workspace_members.user_id = ?", workspaceID, userID).
+		First(&member).Error
+	return member.Role, err
+}
+
+func (r *repository) ListMembers(workspaceID uint) ([]MemberInfo, error) {
+	var members []MemberInfo
+	err := database.DB.Model(&Member{}).
+		Select("workspace_members.user_id, users.email, users.display_name, workspace_members.role, workspace_members.created_at AS joined_at").
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ?", workspaceID).
+		Order("workspace_members.created_at, workspace_members.id").
+		Scan(&members).Error
+	return members, err
+}
+
+func (r *repository) SetMemberRole(workspaceID, userID uint, role string) error {
+	result := database.DB.Model(&Member{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *repository) RemoveMember(workspaceID, userID uint) error {
+	result := database.DB.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&Member{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *repository) CountOwners(workspaceID uint) (int64, error) {
+	var count int64
+	err := database.DB.Model(&Member{}).Where("workspace_id = ? AND role = ?", workspaceID, RoleOwner).Count(&count).Error
+	return count, err
+}
+
+func (r *repository) CreateInvitation(inv *Invitation) error {
+	return database.DB.Create(inv).Error
+}
+
+func (r *repository) GetInvitationByHash(hash string) (*Invitation, error) {
+	var inv Invitation
+	err := database.DB.Where("token_hash = ?", hash).First(&inv).Error
+	return &inv, err
+}
+
+func (r *repository) ListInvitations(workspaceID uint) ([]Invitation, error) {
+	var invitations []Invitation
+	err := database.DB.Where("workspace_id = ? AND accepted_at IS NULL", workspaceID).Order("created_at desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *repository) DeleteInvitation(workspaceID, invitationID uint) error {
+	result := database.DB.Where("id = ? AND workspace_id = ? AND accepted_at IS NULL", invitationID, workspaceID).Delete(&Invitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *repository) AcceptInvitation(inv *Invitation, userID uint, at time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Invitation{}).Where("id = ? AND accepted_at IS NULL", inv.ID).Update("accepted_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		member := Member{WorkspaceID: inv.WorkspaceID, UserID: userID, Role: inv.Role}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error
+	})
+}
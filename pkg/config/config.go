@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,3 +20,69 @@ func LoadConfig() {
 func Get(key string) string {
 	return os.Getenv(key)
 }
+
+// GetString returns the value of key, or def if it is unset.
+func GetString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// GetInt returns the integer value of key, or def if it is unset or invalid.
+func GetInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Invalid integer %q for %s, using default %d", raw, key, def)
+		return def
+	}
+	return v
+}
+
+// GetFloat returns the float value of key, or def if it is unset or invalid.
+func GetFloat(key string, def float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Invalid number %q for %s, using default %v", raw, key, def)
+		return def
+	}
+	return v
+}
+
+// GetDuration returns the duration value of key (e.g. "90s", "1h"),
+// or def if it is unset or invalid.
+func GetDuration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using default %s", raw, key, def)
+		return def
+	}
+	return v
+}
+
+// GetBool returns the boolean value of key ("true", "1", "false", ...),
+// or def if it is unset or invalid.
+func GetBool(key string, def bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Invalid boolean %q for %s, using default %t", raw, key, def)
+		return def
+	}
+	return v
+}
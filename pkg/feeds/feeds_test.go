@@ -0,0 +1,229 @@
+package feeds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
+
+func TestParseRSS(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+  <title>Caf` + "\xe9" + ` Notes</title>
+  <link>https://blog.example.com/</link>
+  <atom:link rel="self" type="application/rss+xml" href="https://blog.example.com/feed.xml"/>
+  <item>
+    <title>First</title>
+    <link>/posts/first</link>
+    <guid isPermaLink="false">post-1</guid>
+    <pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate>
+  </item>
+  <item>
+    <title>Permalink only</title>
+    <guid>https://blog.example.com/posts/second</guid>
+    <dc:date>2006-01-03T10:00:00Z</dc:date>
+  </item>
+  <item>
+    <title>No link</title>
+    <guid isPermaLink="false">post-3</guid>
+  </item>
+</channel>
+</rss>`
+
+	feed, err := Parse([]byte(doc), mustParseURL(t, "https://blog.example.com/feed.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "Café Notes", feed.Title)
+	assert.Equal(t, "https://blog.example.com/", feed.SiteURL)
+	require.Len(t, feed.Items, 2)
+
+	assert.Equal(t, "post-1", feed.Items[0].GUID)
+	assert.Equal(t, "https://blog.example.com/posts/first", feed.Items[0].URL)
+	assert.True(t, feed.Items[0].Published.Equal(time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)))
+
+	assert.Equal(t, "https://blog.example.com/posts/second", feed.Items[1].GUID)
+	assert.Equal(t, "https://blog.example.com/posts/second", feed.Items[1].URL)
+	assert.True(t, feed.Items[1].Published.Equal(time.Date(2006, 1, 3, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestParseAtom(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example Atom</title>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link href="https://example.com/"/>
+  <entry>
+    <id>tag:example.com,2024:1</id>
+    <title>Entry</title>
+    <link rel="alternate" type="text/html" href="https://example.com/entry"/>
+    <link rel="replies" href="https://example.com/entry#comments"/>
+    <updated>2024-05-01T08:00:00Z</updated>
+  </entry>
+</feed>`
+
+	feed, err := Parse([]byte(doc), mustParseURL(t, "https://example.com/atom.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "Example Atom", feed.Title)
+	assert.Equal(t, "https://example.com/", feed.SiteURL)
+	require.Len(t, feed.Items, 1)
+	assert.Equal(t, Item{
+		GUID:      "tag:example.com,2024:1",
+		URL:       "https://example.com/entry",
+		Title:     "Entry",
+		Published: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+	}, feed.Items[0])
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	doc := `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "JSON Example",
+  "home_page_url": "https://example.org/",
+  "items": [
+    {"id": "a", "url": "https://example.org/a", "title": "A", "date_published": "2024-02-03T04:05:06+01:00"},
+    {"id": 2, "external_url": "https://elsewhere.example/b"},
+    {"id": "c", "url": "javascript:alert(1)"}
+  ]
+}`
+
+	feed, err := Parse([]byte(doc), mustParseURL(t, "https://example.org/feed.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "JSON Example", feed.Title)
+	require.Len(t, feed.Items, 2)
+	assert.Equal(t, "a", feed.Items[0].GUID)
+	assert.Equal(t, "2", feed.Items[1].GUID)
+	assert.Equal(t, "https://elsewhere.example/b", feed.Items[1].URL)
+}
+
+func TestParseRejectsOtherDocuments(t *testing.T) {
+	for _, doc := range []string{
+		"<html><head><title>Page</title></head></html>",
+		`{"name": "not a feed"}`,
+		"",
+	} {
+		_, err := Parse([]byte(doc), nil)
+		assert.ErrorIs(t, err, ErrUnknownFormat, doc)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	page := `<html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="alternate" type="application/atom+xml; charset=utf-8" href="https://example.com/atom.xml">
+<link rel="alternate" hreflang="fr" type="text/html" href="/fr/">
+<link rel="Alternate" type="application/feed+json" href="/feed.json">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+</head></html>`
+
+	found, err := Discover([]byte(page), mustParseURL(t, "https://example.com/blog/"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://example.com/feed.xml",
+		"https://example.com/atom.xml",
+		"https://example.com/feed.json",
+	}, found)
+}
+
+const testFeed = `<rss version="2.0"><channel><title>T</title><item><link>https://example.com/1</link></item></channel></rss>`
+
+func TestFetchIsConditional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Write([]byte(testFeed))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(5*time.Second, "test")
+	res, err := fetcher.Fetch(server.URL, "", "")
+	require.NoError(t, err)
+	assert.False(t, res.NotModified)
+	assert.Equal(t, `"v1"`, res.ETag)
+	assert.Equal(t, "application/rss+xml", res.ContentType)
+	assert.Equal(t, testFeed, string(res.Body))
+
+	res, err = fetcher.Fetch(server.URL, res.ETag, res.LastModified)
+	require.NoError(t, err)
+	assert.True(t, res.NotModified)
+	assert.Equal(t, `"v1"`, res.ETag)
+	assert.Empty(t, res.Body)
+}
+
+func TestLocateFollowsAutodiscovery(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" href="/feed"></head></html>`))
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testFeed))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	feedURL, _, feed, err := NewFetcher(5*time.Second, "test").Locate(server.URL + "/blog")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/feed", feedURL)
+	assert.Equal(t, "T", feed.Title)
+	require.Len(t, feed.Items, 1)
+}
+
+func TestWriteRoundTrips(t *testing.T) {
+	published := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	out := &Output{
+		ID:      "urn:test:feed",
+		Title:   "Saved & shared",
+		Author:  "Ada",
+		SelfURL: "https://api.example.com/feeds/out/x.atom",
+		SiteURL: "https://example.com/",
+		Updated: published.Add(time.Hour),
+		Items: []OutputItem{{
+			ID:        "urn:test:1",
+			URL:       "https://example.com/a",
+			Title:     "A <b>bold</b> title",
+			Summary:   "Summary",
+			Content:   "One.\n\nTwo <three>.",
+			Published: published,
+			Updated:   published.Add(time.Hour),
+		}, {
+			ID:        "urn:test:2",
+			URL:       "https://example.com/untitled",
+			Published: published,
+			Updated:   published,
+		}},
+	}
+
+	for _, format := range []string{FormatAtom, FormatRSS, FormatJSON} {
+		body, err := Write(format, out)
+		require.NoError(t, err, format)
+		feed, err := Parse(body, nil)
+		require.NoError(t, err, format)
+		assert.Equal(t, "Saved & shared", feed.Title, format)
+		assert.Equal(t, "https://example.com/", feed.SiteURL, format)
+		for i := range feed.Items {
+			feed.Items[i].Published = feed.Items[i].Published.UTC()
+		}
+		assert.Equal(t, []Item{
+			{GUID: "urn:test:1", URL: "https://example.com/a", Title: "A <b>bold</b> title", Published: published},
+			{GUID: "urn:test:2", URL: "https://example.com/untitled", Title: "https://example.com/untitled", Published: published},
+		}, feed.Items, format)
+	}
+	assert.Equal(t, "<p>One.</p><p>Two &lt;three&gt;.</p>", paragraphs(out.Items[0].Content))
+}
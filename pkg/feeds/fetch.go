@@ -0,0 +1,150 @@
+package feeds
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxBodySize caps how much of a feed or page is read, in bytes.
+const maxBodySize = 5 << 20
+
+// feedTypes are the MIME types a page's <link rel="alternate"> uses to
+// advertise a feed.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// Response is the result of fetching a URL. On a 304 NotModified is set and
+// Body is empty.
+type Response struct {
+	URL          *url.URL
+	Body         []byte
+	ContentType  string
+	ETag         string
+	LastModified string
+	NotModified  bool
+}
+
+// Fetcher fetches feeds over HTTP.
+type Fetcher struct {
+	client    *http.Client
+	userAgent string
+}
+
+func NewFetcher(timeout time.Duration, userAgent string) *Fetcher {
+	return &Fetcher{client: &http.Client{Timeout: timeout}, userAgent: userAgent}
+}
+
+// Fetch gets rawURL. With etag or lastModified from an earlier response the
+// request is conditional, and an unchanged feed comes back NotModified.
+func (f *Fetcher) Fetch(rawURL, etag, lastModified string) (*Response, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", req.URL.Scheme)
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, text/xml;q=0.9, text/html;q=0.8, */*;q=0.5")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	response := &Response{
+		URL:          res.Request.URL,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	if res.StatusCode == http.StatusNotModified {
+		response.NotModified = true
+		response.ETag, response.LastModified = etag, lastModified
+		return response, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, res.Status)
+	}
+	response.ContentType, _, _ = mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if response.Body, err = io.ReadAll(io.LimitReader(res.Body, maxBodySize)); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Discover returns the feeds an HTML page advertises with
+// <link rel="alternate">, resolved against base, in the page's order.
+func Discover(page []byte, base *url.URL) ([]string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	seen := make(map[string]bool)
+	doc.Find("link[href]").Each(func(_ int, s *goquery.Selection) {
+		rels := strings.Fields(strings.ToLower(s.AttrOr("rel", "")))
+		alternate := false
+		for _, rel := range rels {
+			alternate = alternate || rel == "alternate"
+		}
+		mediaType, _, _ := mime.ParseMediaType(s.AttrOr("type", ""))
+		if !alternate || !feedTypes[mediaType] {
+			return
+		}
+		if link := resolve(base, s.AttrOr("href", "")); link != "" && !seen[link] {
+			seen[link] = true
+			found = append(found, link)
+		}
+	})
+	return found, nil
+}
+
+// Locate finds the feed at rawURL: the URL itself if it is a feed, or else
+// the first feed that the HTML page there advertises. It returns the feed's
+// address, the response it was read from, and the parsed feed.
+func (f *Fetcher) Locate(rawURL string) (string, *Response, *Feed, error) {
+	res, err := f.Fetch(rawURL, "", "")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if feed, err := Parse(res.Body, res.URL); err == nil {
+		return res.URL.String(), res, feed, nil
+	}
+	if res.ContentType != "text/html" && res.ContentType != "application/xhtml+xml" {
+		return "", nil, nil, ErrUnknownFormat
+	}
+
+	candidates, err := Discover(res.Body, res.URL)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	for _, candidate := range candidates {
+		res, err := f.Fetch(candidate, "", "")
+		if err != nil {
+			continue
+		}
+		if feed, err := Parse(res.Body, res.URL); err == nil {
+			return res.URL.String(), res, feed, nil
+		}
+	}
+	return "", nil, nil, ErrUnknownFormat
+}
@@ -0,0 +1,280 @@
+// Package feeds fetches and parses RSS 2.0, Atom and JSON Feed documents,
+// and finds the feeds a web page advertises.
+package feeds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// ErrUnknownFormat is returned for a document that isn't a feed.
+var ErrUnknownFormat = errors.New("not an RSS, Atom or JSON feed")
+
+// Feed is a parsed feed in any of the supported formats.
+type Feed struct {
+	Title string
+	// SiteURL is the web site the feed belongs to, if it says.
+	SiteURL string
+	Items   []Item
+}
+
+// Item is one entry of a feed. GUID identifies the item across fetches; it
+// falls back to the URL for feeds that don't give items an ID.
+type Item struct {
+	GUID      string
+	URL       string
+	Title     string
+	Published time.Time
+}
+
+// Parse parses a feed document. Relative links are resolved against base,
+// the address the feed was fetched from. Items without a link are dropped.
+func Parse(data []byte, base *url.URL) (*Feed, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	var feed *Feed
+	var err error
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		feed, err = parseJSONFeed(trimmed)
+	} else {
+		feed, err = parseXML(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	feed.Title = strings.TrimSpace(feed.Title)
+	feed.SiteURL = resolve(base, feed.SiteURL)
+	items := feed.Items[:0]
+	for _, item := range feed.Items {
+		item.URL = resolve(base, item.URL)
+		if item.URL == "" {
+			continue
+		}
+		item.GUID = strings.TrimSpace(item.GUID)
+		if item.GUID == "" {
+			item.GUID = item.URL
+		}
+		item.Title = strings.TrimSpace(item.Title)
+		items = append(items, item)
+	}
+	feed.Items = items
+	return feed, nil
+}
+
+// resolve makes ref absolute against base, returning "" unless the result
+// is an http or https URL.
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Links []rssLink `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// rssLink is a <link> of a channel or item. Many feeds add an <atom:link>
+// pointing at the feed itself, which must not be taken for the page.
+type rssLink struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+func pageLink(links []rssLink) string {
+	for _, l := range links {
+		if l.XMLName.Space == "" {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+type rssItem struct {
+	Title string    `xml:"title"`
+	Links []rssLink `xml:"link"`
+	GUID  struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomDocument struct {
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// alternate returns the link to the web page, which Atom marks with
+// rel="alternate" or no rel at all.
+func alternate(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+	return dec
+}
+
+// parseXML reads RSS 2.0 or Atom, telling them apart by the root element.
+func parseXML(data []byte) (*Feed, error) {
+	dec := newDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, ErrUnknownFormat
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "rss":
+			var doc rssDocument
+			if err := dec.DecodeElement(&doc, &start); err != nil {
+				return nil, err
+			}
+			feed := &Feed{Title: doc.Channel.Title, SiteURL: pageLink(doc.Channel.Links)}
+			for _, it := range doc.Channel.Items {
+				item := Item{GUID: it.GUID.Value, URL: pageLink(it.Links), Title: it.Title, Published: parseTime(it.PubDate)}
+				if item.Published.IsZero() {
+					item.Published = parseTime(it.Date)
+				}
+				if item.URL == "" && !strings.EqualFold(it.GUID.IsPermaLink, "false") {
+					item.URL = it.GUID.Value
+				}
+				feed.Items = append(feed.Items, item)
+			}
+			return feed, nil
+		case "feed":
+			var doc atomDocument
+			if err := dec.DecodeElement(&doc, &start); err != nil {
+				return nil, err
+			}
+			feed := &Feed{Title: doc.Title, SiteURL: alternate(doc.Links)}
+			for _, e := range doc.Entries {
+				item := Item{GUID: e.ID, URL: alternate(e.Links), Title: e.Title, Published: parseTime(e.Published)}
+				if item.Published.IsZero() {
+					item.Published = parseTime(e.Updated)
+				}
+				feed.Items = append(feed.Items, item)
+			}
+			return feed, nil
+		default:
+			return nil, ErrUnknownFormat
+		}
+	}
+}
+
+type jsonFeedDocument struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	Items       []struct {
+		ID            json.RawMessage `json:"id"`
+		URL           string          `json:"url"`
+		ExternalURL   string          `json:"external_url"`
+		Title         string          `json:"title"`
+		DatePublished string          `json:"date_published"`
+	} `json:"items"`
+}
+
+// parseJSONFeed reads JSON Feed 1.0 and 1.1. Item IDs should be strings but
+// some feeds use numbers, which are accepted too.
+func parseJSONFeed(data []byte) (*Feed, error) {
+	var doc jsonFeedDocument
+	if err := json.Unmarshal(data, &doc); err != nil || !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, ErrUnknownFormat
+	}
+	feed := &Feed{Title: doc.Title, SiteURL: doc.HomePageURL}
+	for _, it := range doc.Items {
+		var id string
+		if err := json.Unmarshal(it.ID, &id); err != nil {
+			id = string(it.ID)
+		}
+		link := it.URL
+		if link == "" {
+			link = it.ExternalURL
+		}
+		feed.Items = append(feed.Items, Item{GUID: id, URL: link, Title: it.Title, Published: parseTime(it.DatePublished)})
+	}
+	return feed, nil
+}
+
+// timeLayouts are the date formats seen in feeds: RFC 822 variants in RSS,
+// RFC 3339 in Atom, JSON Feed and Dublin Core.
+var timeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseTime returns the zero time for dates it can't read.
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
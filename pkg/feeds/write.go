@@ -0,0 +1,257 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"strings"
+	"time"
+)
+
+// Output formats.
+const (
+	FormatAtom = "atom"
+	FormatRSS  = "rss"
+	FormatJSON = "json"
+)
+
+// ContentTypes maps each output format to the Content-Type it is served
+// with.
+var ContentTypes = map[string]string{
+	FormatAtom: "application/atom+xml; charset=utf-8",
+	FormatRSS:  "application/rss+xml; charset=utf-8",
+	FormatJSON: "application/feed+json; charset=utf-8",
+}
+
+// Output is a feed to write. SelfURL is where the feed is served, SiteURL
+// the page it corresponds to, if any.
+type Output struct {
+	ID      string
+	Title   string
+	Author  string
+	SelfURL string
+	SiteURL string
+	Updated time.Time
+	Items   []OutputItem
+}
+
+// OutputItem is one entry of an Output. Content is plain text with one
+// paragraph per line; it is written as HTML paragraphs.
+type OutputItem struct {
+	ID        string
+	URL       string
+	Title     string
+	Summary   string
+	Content   string
+	Published time.Time
+	Updated   time.Time
+}
+
+// Write renders the feed in the given format, one of FormatAtom, FormatRSS
+// and FormatJSON.
+func Write(format string, out *Output) ([]byte, error) {
+	switch format {
+	case FormatAtom:
+		return writeAtom(out)
+	case FormatRSS:
+		return writeRSS(out)
+	default:
+		return writeJSONFeed(out)
+	}
+}
+
+// paragraphs turns plain text into escaped HTML, a paragraph per line.
+func paragraphs(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			b.WriteString("<p>" + html.EscapeString(line) + "</p>")
+		}
+	}
+	return b.String()
+}
+
+// title falls back to the item's URL for articles that have no title yet.
+func (item *OutputItem) title() string {
+	if item.Title != "" {
+		return item.Title
+	}
+	return item.URL
+}
+
+type atomFeedOut struct {
+	XMLName xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string         `xml:"id"`
+	Title   string         `xml:"title"`
+	Updated string         `xml:"updated"`
+	Links   []atomLinkOut  `xml:"link"`
+	Author  string         `xml:"author>name"`
+	Entries []atomEntryOut `xml:"entry"`
+}
+
+type atomLinkOut struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomTextOut struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntryOut struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Link      atomLinkOut  `xml:"link"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Summary   *atomTextOut `xml:"summary,omitempty"`
+	Content   *atomTextOut `xml:"content,omitempty"`
+}
+
+func writeAtom(out *Output) ([]byte, error) {
+	doc := atomFeedOut{
+		ID:      out.ID,
+		Title:   out.Title,
+		Updated: out.Updated.UTC().Format(time.RFC3339),
+		Links:   []atomLinkOut{{Rel: "self", Type: "application/atom+xml", Href: out.SelfURL}},
+		Author:  out.Author,
+	}
+	if out.SiteURL != "" {
+		doc.Links = append(doc.Links, atomLinkOut{Rel: "alternate", Type: "text/html", Href: out.SiteURL})
+	}
+	for i := range out.Items {
+		item := &out.Items[i]
+		entry := atomEntryOut{
+			ID:        item.ID,
+			Title:     item.title(),
+			Link:      atomLinkOut{Rel: "alternate", Href: item.URL},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+		}
+		if item.Summary != "" {
+			entry.Summary = &atomTextOut{Type: "text", Value: item.Summary}
+		}
+		if item.Content != "" {
+			entry.Content = &atomTextOut{Type: "html", Value: paragraphs(item.Content)}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return marshalXML(doc)
+}
+
+type rssOut struct {
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	AtomNS    string   `xml:"xmlns:atom,attr"`
+	ContentNS string   `xml:"xmlns:content,attr"`
+	Channel   struct {
+		Title         string       `xml:"title"`
+		Link          string       `xml:"link"`
+		Description   string       `xml:"description"`
+		LastBuildDate string       `xml:"lastBuildDate"`
+		Self          atomLinkOut  `xml:"atom:link"`
+		Items         []rssItemOut `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItemOut struct {
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+	GUID  struct {
+		IsPermaLink string `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	} `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description,omitempty"`
+	Content     string `xml:"content:encoded,omitempty"`
+}
+
+func writeRSS(out *Output) ([]byte, error) {
+	var doc rssOut
+	doc.Version = "2.0"
+	doc.AtomNS = "http://www.w3.org/2005/Atom"
+	doc.ContentNS = "http://purl.org/rss/1.0/modules/content/"
+	doc.Channel.Title = out.Title
+	doc.Channel.Link = out.SiteURL
+	if doc.Channel.Link == "" {
+		doc.Channel.Link = out.SelfURL
+	}
+	doc.Channel.Description = out.Title
+	doc.Channel.LastBuildDate = out.Updated.UTC().Format(time.RFC1123Z)
+	doc.Channel.Self = atomLinkOut{Rel: "self", Type: "application/rss+xml", Href: out.SelfURL}
+	for i := range out.Items {
+		item := &out.Items[i]
+		entry := rssItemOut{
+			Title:       item.title(),
+			Link:        item.URL,
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Description: item.Summary,
+			Content:     paragraphs(item.Content),
+		}
+		entry.GUID.IsPermaLink = "false"
+		entry.GUID.Value = item.ID
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+	return marshalXML(doc)
+}
+
+func marshalXML(doc interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+type jsonFeedOut struct {
+	Version     string            `json:"version"`
+	Title       string            `json:"title"`
+	HomePageURL string            `json:"home_page_url,omitempty"`
+	FeedURL     string            `json:"feed_url"`
+	Items       []jsonFeedItemOut `json:"items"`
+}
+
+type jsonFeedItemOut struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	Summary       string `json:"summary,omitempty"`
+	ContentHTML   string `json:"content_html,omitempty"`
+	ContentText   string `json:"content_text,omitempty"`
+	DatePublished string `json:"date_published"`
+	DateModified  string `json:"date_modified"`
+}
+
+func writeJSONFeed(out *Output) ([]byte, error) {
+	doc := jsonFeedOut{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       out.Title,
+		HomePageURL: out.SiteURL,
+		FeedURL:     out.SelfURL,
+		Items:       []jsonFeedItemOut{},
+	}
+	for i := range out.Items {
+		item := &out.Items[i]
+		doc.Items = append(doc.Items, jsonFeedItemOut{
+			ID:            item.ID,
+			URL:           item.URL,
+			Title:         item.title(),
+			Summary:       item.Summary,
+			ContentHTML:   paragraphs(item.Content),
+			ContentText:   item.Content,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+			DateModified:  item.Updated.UTC().Format(time.RFC3339),
+		})
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
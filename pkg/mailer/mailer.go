@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cheildo/deeli-api/pkg/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FromConfig builds the mailer selected by MAILER: "smtp" sends through
+// SMTP_HOST, "memory" keeps messages in memory, and the default "file"
+// writes them to MAIL_DIR for local development.
+func FromConfig() Mailer {
+	from := config.GetString("MAIL_FROM", "Deeli <no-reply@deeli.local>")
+	switch kind := config.GetString("MAILER", "file"); kind {
+	case "smtp":
+		return NewSMTPMailer(
+			config.Get("SMTP_HOST"),
+			config.GetInt("SMTP_PORT", 587),
+			config.Get("SMTP_USERNAME"),
+			config.Get("SMTP_PASSWORD"),
+			from,
+		)
+	case "memory":
+		return NewMemoryMailer()
+	default:
+		if kind != "file" {
+			log.Printf("Unknown MAILER %q, writing mail to files", kind)
+		}
+		return NewFileMailer(config.GetString("MAIL_DIR", "mail"), from)
+	}
+}
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message, at time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", at.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// validHeader rejects header values that could inject extra headers.
+func validHeader(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid header value %q", v)
+		}
+	}
+	return nil
+}
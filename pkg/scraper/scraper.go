@@ -5,15 +5,21 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
+// maxContentLength caps the extracted text, in bytes.
+const maxContentLength = 100000
+
 // ScrapedData holds the metadata extracted from a URL
 type ScrapedData struct {
 	Title       string
 	Description string
 	ImageURL    string
+	// Content is the readable text of the page, one paragraph per line.
+	Content string
 }
 
 // ScrapeMetadata fetches a URL and extracts OpenGraph or standard metadata.
@@ -56,7 +62,48 @@ func ScrapeMetadata(url string) (*ScrapedData, error) {
 	data.Title = strings.TrimSpace(data.Title)
 	data.Description = strings.TrimSpace(data.Description)
 	data.ImageURL = strings.TrimSpace(data.ImageURL)
+	data.Content = extractContent(doc)
 
 	log.Printf("Scraped from %s: Title='%s'", url, data.Title)
 	return data, nil
 }
+
+// extractContent returns the text of the page's headings and paragraphs,
+// looking inside <article> or <main> when the page has one so that
+// navigation and footers are left out.
+func extractContent(doc *goquery.Document) string {
+	root := doc.Find("article").First()
+	if root.Length() == 0 {
+		root = doc.Find("main").First()
+	}
+	if root.Length() == 0 {
+		root = doc.Find("body")
+	}
+
+	var b strings.Builder
+	root.Find("h1, h2, h3, h4, p, pre").Each(func(_ int, s *goquery.Selection) {
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if text == "" || b.Len() >= maxContentLength {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(text)
+	})
+
+	return truncate(strings.ToValidUTF8(b.String(), ""), maxContentLength)
+}
+
+// truncate cuts valid UTF-8 text to at most max bytes, backing off to the
+// start of the rune the cut would split.
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	cut := max
+	for cut > max-utf8.UTFMax && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
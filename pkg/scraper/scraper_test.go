@@ -0,0 +1,45 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeMetadataExtractsContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head>
+			<title>Fallback</title>
+			<meta property="og:title" content=" Scaling Postgres ">
+			<meta name="description" content="How we scaled">
+		</head><body>
+			<nav><p>Home | About</p></nav>
+			<article>
+				<h1>Scaling   Postgres</h1>
+				<p>First we added
+				replicas.</p>
+				<p>  </p>
+				<p>Then we partitioned.</p>
+			</article>
+			<footer><p>Copyright</p></footer>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	data, err := ScrapeMetadata(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "Scaling Postgres", data.Title)
+	assert.Equal(t, "How we scaled", data.Description)
+	assert.Equal(t, "Scaling Postgres\nFirst we added replicas.\nThen we partitioned.", data.Content)
+}
+
+func TestTruncateKeepsRunesWhole(t *testing.T) {
+	assert.Equal(t, "héllo", truncate("héllo", 10))
+	assert.Equal(t, "h", truncate("héllo", 2), "the cut would split é")
+	assert.Equal(t, "hé", truncate("héllo", 3))
+	assert.Equal(t, "a", truncate("a😀", 4), "backs off up to three bytes")
+	assert.Equal(t, "a😀", truncate("a😀b", 5))
+}